@@ -0,0 +1,11 @@
+package api
+
+import "context"
+
+// Banner is an optional interface implemented by a Commands module that
+// provides the splash screen shown when an interactive shell starts, in
+// place of the gosh logo. The banner of the configuration file, if any,
+// takes precedence.
+type Banner interface {
+	Banner(ctx context.Context) string
+}
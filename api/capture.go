@@ -0,0 +1,43 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"sync"
+)
+
+// Capture runs fn with a copy of ctx whose stdout is a buffer and
+// returns what fn wrote there, so that a command can run others and use
+// their output, as in:
+//
+//	out, err := api.Capture(ctx, func(ctx context.Context) error {
+//		_, err := api.Run(ctx, "status", "--short")
+//		return err
+//	})
+//
+// The output written before fn fails is returned along with its error.
+// Errors are written to the stderr of ctx as usual.
+func Capture(ctx context.Context, fn func(ctx context.Context) error) (string, error) {
+	var out captureBuffer
+	err := fn(WithStdout(ctx, &out))
+	return out.String(), err
+}
+
+// captureBuffer is a buffer that commands writing from several
+// goroutines, such as the stages of a pipeline, can share
+type captureBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *captureBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *captureBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"context"
+	"io"
+)
+
+// ContextKey is the type of the keys of the values the shell stores in
+// the context passed to commands. Values should be read and stored with
+// the Get and With functions of this package, which check their types.
+type ContextKey string
+
+// SessionKey is the key of the Session of a command
+const SessionKey ContextKey = "gosh.session"
+
+// Session is the state of the shell session a command runs in. The
+// context carries it as a single value rather than a value per field;
+// a Session stored in a context is not modified, the With functions
+// storing a changed copy instead.
+type Session struct {
+	// ID identifies the session, and User is the user running it
+	ID   string
+	User string
+
+	// Stdin, Stdout and Stderr are the standard streams of the
+	// command, the ones of the process when nil
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Prompt is the template of the shell prompt
+	Prompt string
+
+	// Env is the environment of the shell
+	Env *Env
+
+	// WorkDir is the working directory of the shell, which commands
+	// resolve relative paths against
+	WorkDir string
+
+	// History is the command history of the session
+	History History
+
+	// Registry is the command registry of the shell
+	Registry Registry
+
+	// Runner runs the commands of the shell for other commands
+	Runner Runner
+
+	// Events is the event bus of the shell
+	Events EventBus
+
+	// LastResult is the result of the previous command, whose code
+	// is also the value of $?
+	LastResult Result
+}
+
+// Runner runs commands by name as the shell does, for Run
+type Runner interface {
+	Run(ctx context.Context, name string, args ...string) (Result, error)
+}
+
+// History is the command history of a session
+type History interface {
+	// Lines returns the lines of the history, the oldest first
+	Lines() []string
+}
+
+// WithSession returns a copy of ctx holding a copy of session
+func WithSession(ctx context.Context, session Session) context.Context {
+	return context.WithValue(ctx, SessionKey, &session)
+}
+
+// GetSession returns a copy of the session stored in ctx, or an empty
+// session if there is none
+func GetSession(ctx context.Context) Session {
+	if ctx == nil {
+		return Session{}
+	}
+	if session, ok := ctx.Value(SessionKey).(*Session); ok {
+		return *session
+	}
+	return Session{}
+}
+
+// updateSession returns a copy of ctx holding the session of ctx
+// changed by update
+func updateSession(ctx context.Context, update func(*Session)) context.Context {
+	session := GetSession(ctx)
+	update(&session)
+	return WithSession(ctx, session)
+}
+
+// WithStdout returns a copy of ctx in which commands write their output to w
+func WithStdout(ctx context.Context, w io.Writer) context.Context {
+	return updateSession(ctx, func(s *Session) { s.Stdout = w })
+}
+
+// WithStderr returns a copy of ctx in which commands write errors to w
+func WithStderr(ctx context.Context, w io.Writer) context.Context {
+	return updateSession(ctx, func(s *Session) { s.Stderr = w })
+}
+
+// WithStdin returns a copy of ctx in which commands read their input from r
+func WithStdin(ctx context.Context, r io.Reader) context.Context {
+	return updateSession(ctx, func(s *Session) { s.Stdin = r })
+}
+
+// WithPrompt returns a copy of ctx with a new shell prompt
+func WithPrompt(ctx context.Context, prompt string) context.Context {
+	return updateSession(ctx, func(s *Session) { s.Prompt = prompt })
+}
+
+// Registry is the command registry of the shell. Plugins loaded or
+// reloaded while commands run replace its commands, so that it is safe
+// for concurrent use and Commands returns a copy.
+type Registry interface {
+	// Lookup returns the command registered under name
+	Lookup(name string) (Command, bool)
+
+	// Commands returns the registered commands by name
+	Commands() map[string]Command
+}
+
+// commandMap is a fixed Registry of the commands of a map
+type commandMap map[string]Command
+
+func (m commandMap) Lookup(name string) (Command, bool) {
+	cmd, ok := m[name]
+	return cmd, ok
+}
+
+func (m commandMap) Commands() map[string]Command {
+	commands := make(map[string]Command, len(m))
+	for name, cmd := range m {
+		commands[name] = cmd
+	}
+	return commands
+}
+
+// WithCommands returns a copy of ctx holding a registry of commands
+func WithCommands(ctx context.Context, commands map[string]Command) context.Context {
+	return WithRegistry(ctx, commandMap(commands))
+}
+
+// WithRegistry returns a copy of ctx holding the command registry
+func WithRegistry(ctx context.Context, registry Registry) context.Context {
+	return updateSession(ctx, func(s *Session) { s.Registry = registry })
+}
+
+// WithEnv returns a copy of ctx holding the shell environment
+func WithEnv(ctx context.Context, env *Env) context.Context {
+	return updateSession(ctx, func(s *Session) { s.Env = env })
+}
+
+// WithWorkDir returns a copy of ctx in which the working directory of
+// the shell is dir
+func WithWorkDir(ctx context.Context, dir string) context.Context {
+	return updateSession(ctx, func(s *Session) { s.WorkDir = dir })
+}
+
+// GetRegistry returns the command registry stored in ctx, or nil if
+// there is none
+func GetRegistry(ctx context.Context) Registry {
+	return GetSession(ctx).Registry
+}
+
+// GetCommands returns the commands of the registry stored in ctx,
+// or nil if there is none
+func GetCommands(ctx context.Context) map[string]Command {
+	registry := GetRegistry(ctx)
+	if registry == nil {
+		return nil
+	}
+	return registry.Commands()
+}
+
+// WithLastResult returns a copy of ctx holding the result of the
+// previous command
+func WithLastResult(ctx context.Context, res Result) context.Context {
+	return updateSession(ctx, func(s *Session) { s.LastResult = res })
+}
+
+// GetLastResult returns the result of the previous command, whose code
+// is also the value of $?
+func GetLastResult(ctx context.Context) Result {
+	return GetSession(ctx).LastResult
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Env holds the variables of a shell. It is carried in the Session of
+// the context, read with GetEnv, and is safe for concurrent use, so
+// commands may read and change variables through it. Variables are
+// exported to the environment of external processes, except the shell
+// variables assigned with Assign and not exported since.
+type Env struct {
+	mu    sync.RWMutex
+	vars  map[string]string
+	local map[string]bool
+}
+
+// NewEnv returns an environment initialized from a list of
+// "key=value" strings, such as the one returned by os.Environ
+func NewEnv(environ []string) *Env {
+	env := &Env{vars: make(map[string]string), local: make(map[string]bool)}
+	for _, kv := range environ {
+		if i := strings.Index(kv, "="); i > 0 {
+			env.vars[kv[:i]] = kv[i+1:]
+		}
+	}
+	return env
+}
+
+// Get returns the value of the named variable
+func (e *Env) Get(name string) (string, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	val, ok := e.vars[name]
+	return val, ok
+}
+
+// Set sets the value of the named variable and exports it
+func (e *Env) Set(name, value string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.vars[name] = value
+	delete(e.local, name)
+}
+
+// Assign sets the value of the named variable. A new variable is a
+// shell variable, which is not exported; a variable that is exported
+// stays exported.
+func (e *Env) Assign(name, value string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.vars[name]; !ok {
+		e.local[name] = true
+	}
+	e.vars[name] = value
+}
+
+// Export exports the named variable, which is set to the empty string
+// when it is not set
+func (e *Env) Export(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.vars[name]; !ok {
+		e.vars[name] = ""
+	}
+	delete(e.local, name)
+}
+
+// Exported reports whether the named variable is set and exported
+func (e *Env) Exported(name string) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	_, ok := e.vars[name]
+	return ok && !e.local[name]
+}
+
+// Unset removes the named variable
+func (e *Env) Unset(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.vars, name)
+	delete(e.local, name)
+}
+
+// Names returns the sorted names of all variables
+func (e *Env) Names() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	names := make([]string, 0, len(e.vars))
+	for name := range e.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Environ returns the exported variables as "key=value" strings,
+// suitable for the environment of an external process
+func (e *Env) Environ() []string {
+	var environ []string
+	for _, name := range e.Names() {
+		e.mu.RLock()
+		val, ok := e.vars[name]
+		local := e.local[name]
+		e.mu.RUnlock()
+		if ok && !local {
+			environ = append(environ, name+"="+val)
+		}
+	}
+	return environ
+}
+
+// GetEnv returns the shell environment stored in ctx,
+// or nil if there is none
+func GetEnv(ctx context.Context) *Env {
+	return GetSession(ctx).Env
+}
+
+// Clone returns a copy of the environment
+func (e *Env) Clone() *Env {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	clone := &Env{vars: make(map[string]string, len(e.vars)), local: make(map[string]bool, len(e.local))}
+	for name, val := range e.vars {
+		clone.vars[name] = val
+	}
+	for name := range e.local {
+		clone.local[name] = true
+	}
+	return clone
+}
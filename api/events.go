@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"time"
+)
+
+// The topics of the events published by the shell. Plugins publish
+// events on topics of their own, which should start with the name of
+// the plugin, such as "deploy.finished".
+const (
+	// EventStartup is published once a session started, with its
+	// plugins loaded, with a SessionEvent
+	EventStartup = "shell.startup"
+
+	// EventShutdown is published when a session closes, before the
+	// plugins are closed, with a SessionEvent
+	EventShutdown = "shell.shutdown"
+
+	// EventPreCommand and EventPostCommand are published before and
+	// after each command line runs, with a CommandEvent
+	EventPreCommand  = "command.pre"
+	EventPostCommand = "command.post"
+
+	// EventDirChange is published when the working directory of a
+	// session changes, with a DirEvent
+	EventDirChange = "dir.change"
+
+	// EventAll subscribes to the events of every topic
+	EventAll = "*"
+)
+
+// Event is a message published on a topic of the event bus
+type Event struct {
+	Topic string
+	Data  interface{}
+}
+
+// SessionEvent is the data of the startup and shutdown events
+type SessionEvent struct {
+	Session string
+	User    string
+}
+
+// CommandEvent is the data of the command events. Status, Err and
+// Duration are only set after the command line ran.
+type CommandEvent struct {
+	Session  string
+	Line     string
+	Status   int
+	Err      error
+	Duration time.Duration
+}
+
+// DirEvent is the data of the directory change events
+type DirEvent struct {
+	Session string
+	From    string
+	To      string
+}
+
+// EventHandler handles the events of the topics it is subscribed to
+type EventHandler func(ctx context.Context, event Event)
+
+// EventBus delivers the events published on a topic to the handlers
+// subscribed to it, so that plugins react to the shell and to each
+// other without depending on each other. The bus is shared by the
+// sessions of the shell.
+type EventBus interface {
+	// Publish calls the handlers subscribed to topic, and to all
+	// topics, in the order they subscribed, and returns once they
+	// returned
+	Publish(ctx context.Context, topic string, data interface{})
+
+	// Subscribe subscribes handler to topic, or to every topic for
+	// EventAll, until the returned function is called
+	Subscribe(topic string, handler EventHandler) (unsubscribe func())
+}
+
+// Events returns the event bus of the shell, or a bus that drops the
+// events when ctx has none
+func Events(ctx context.Context) EventBus {
+	if bus := GetSession(ctx).Events; bus != nil {
+		return bus
+	}
+	return nopBus{}
+}
+
+type nopBus struct{}
+
+func (nopBus) Publish(ctx context.Context, topic string, data interface{}) {}
+
+func (nopBus) Subscribe(topic string, handler EventHandler) func() { return func() {} }
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FlagKind is the type of the value of a flag
+type FlagKind int
+
+const (
+	StringFlag FlagKind = iota
+	BoolFlag
+	IntFlag
+)
+
+func (k FlagKind) String() string {
+	switch k {
+	case BoolFlag:
+		return "bool"
+	case IntFlag:
+		return "int"
+	default:
+		return "string"
+	}
+}
+
+// Flag describes a flag accepted by a command. It is given on the
+// command line as --name, or -s when the flag has a short name.
+type Flag struct {
+	Name    string   `json:"name"`
+	Short   string   `json:"short,omitempty"`
+	Kind    FlagKind `json:"kind"`
+	Default string   `json:"default,omitempty"`
+	Usage   string   `json:"usage"`
+}
+
+// Flagger is an optional interface implemented by commands that accept
+// flags. The shell lists them in the help of the command and in usage
+// errors, and parses them before calling Exec: the command gets the
+// arguments left after the flags and reads the flags with GetFlags.
+type Flagger interface {
+	Flags() []Flag
+}
+
+// UsageError reports that a command was called with invalid arguments.
+// The shell prints it along with the usage of the command.
+type UsageError struct {
+	Msg string
+}
+
+// NewUsageError returns a usage error with a formatted message
+func NewUsageError(format string, args ...interface{}) *UsageError {
+	return &UsageError{Msg: fmt.Sprintf(format, args...)}
+}
+
+func (e *UsageError) Error() string { return e.Msg }
+
+// ExitCode returns 2, the conventional status of a usage error
+func (e *UsageError) ExitCode() int { return 2 }
+
+// FormatUsage returns the usage line of a command followed by the
+// description of its flags, if it has any
+func FormatUsage(cmd Command) string {
+	var b strings.Builder
+	if cmd.Usage() != "" {
+		fmt.Fprintf(&b, "  Usage: %s\n", cmd.Usage())
+	}
+	flagger, ok := cmd.(Flagger)
+	if !ok || len(flagger.Flags()) == 0 {
+		return b.String()
+	}
+	b.WriteString("  Flags:\n")
+	for _, flag := range flagger.Flags() {
+		name := "    "
+		if flag.Short != "" {
+			name = "-" + flag.Short + ", "
+		}
+		name += "--" + flag.Name
+		if flag.Kind != BoolFlag {
+			name += " " + flag.Kind.String()
+		}
+		fmt.Fprintf(&b, "    %-24s %s", name, flag.Usage)
+		if flag.Default != "" {
+			fmt.Fprintf(&b, " (default %s)", flag.Default)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// FlagsKey is the context key of the flags parsed for a command
+const FlagsKey ContextKey = "gosh.flags"
+
+// ErrHelp is returned by FlagSet.Parse when the arguments ask for help
+// with -h or --help and the command does not define such a flag
+var ErrHelp = errors.New("help requested")
+
+// FlagSet parses the flags of a command. Flags are given as --name,
+// --name=value or --name value, and as -s when they have a short name;
+// short boolean flags can be combined, as in -vq. Parsing stops at the
+// first argument that is not a flag, or after "--".
+type FlagSet struct {
+	flags  []Flag
+	values map[string]string
+	args   []string
+}
+
+// NewFlagSet returns a flag set for the given flags
+func NewFlagSet(flags []Flag) *FlagSet {
+	return &FlagSet{flags: flags, values: make(map[string]string)}
+}
+
+// lookup returns the flag with the given long or short name
+func (fs *FlagSet) lookup(name string, short bool) (Flag, bool) {
+	for _, flag := range fs.flags {
+		if (!short && flag.Name == name) || (short && flag.Short != "" && flag.Short == name) {
+			return flag, true
+		}
+	}
+	return Flag{}, false
+}
+
+// Parse parses the flags at the start of args, which does not include
+// the command name. Errors are usage errors.
+func (fs *FlagSet) Parse(args []string) error {
+	fs.args = nil
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			fs.args = args[i+1:]
+			return nil
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			fs.args = args[i:]
+			return nil
+		}
+
+		if strings.HasPrefix(arg, "--") {
+			name, value, hasValue := strings.Cut(arg[2:], "=")
+			flag, ok := fs.lookup(name, false)
+			if !ok {
+				if name == "help" {
+					return ErrHelp
+				}
+				return NewUsageError("unknown flag: --%s", name)
+			}
+			if !hasValue && flag.Kind != BoolFlag {
+				if i+1 == len(args) {
+					return NewUsageError("flag needs an argument: --%s", name)
+				}
+				i++
+				value, hasValue = args[i], true
+			}
+			if !hasValue {
+				value = "true"
+			}
+			if err := fs.Set(flag.Name, value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// short flags; only the last one of a group may take a value
+		shorts := arg[1:]
+		for j := 0; j < len(shorts); j++ {
+			name := shorts[j : j+1]
+			flag, ok := fs.lookup(name, true)
+			if !ok {
+				if name == "h" {
+					return ErrHelp
+				}
+				return NewUsageError("unknown flag: -%s", name)
+			}
+			if flag.Kind == BoolFlag {
+				if err := fs.Set(flag.Name, "true"); err != nil {
+					return err
+				}
+				continue
+			}
+			value := strings.TrimPrefix(shorts[j+1:], "=")
+			if value == "" {
+				if i+1 == len(args) {
+					return NewUsageError("flag needs an argument: -%s", name)
+				}
+				i++
+				value = args[i]
+			}
+			if err := fs.Set(flag.Name, value); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// Set sets the value of the flag with the given long name
+func (fs *FlagSet) Set(name, value string) error {
+	flag, ok := fs.lookup(name, false)
+	if !ok {
+		return NewUsageError("unknown flag: --%s", name)
+	}
+	switch flag.Kind {
+	case BoolFlag:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return NewUsageError("invalid value %q for flag --%s: expected a boolean", value, name)
+		}
+	case IntFlag:
+		if _, err := strconv.Atoi(value); err != nil {
+			return NewUsageError("invalid value %q for flag --%s: expected an integer", value, name)
+		}
+	}
+	fs.values[name] = value
+	return nil
+}
+
+// value returns the value of a flag, or its default when it is not set
+func (fs *FlagSet) value(name string) string {
+	if fs == nil {
+		return ""
+	}
+	if value, ok := fs.values[name]; ok {
+		return value
+	}
+	flag, _ := fs.lookup(name, false)
+	return flag.Default
+}
+
+// String returns the value of a flag
+func (fs *FlagSet) String(name string) string { return fs.value(name) }
+
+// Bool returns the value of a boolean flag
+func (fs *FlagSet) Bool(name string) bool {
+	b, _ := strconv.ParseBool(fs.value(name))
+	return b
+}
+
+// Int returns the value of an integer flag
+func (fs *FlagSet) Int(name string) int {
+	n, _ := strconv.Atoi(fs.value(name))
+	return n
+}
+
+// IsSet reports whether a flag was given on the command line
+func (fs *FlagSet) IsSet(name string) bool {
+	if fs == nil {
+		return false
+	}
+	_, ok := fs.values[name]
+	return ok
+}
+
+// Values returns the flags given on the command line by long name
+func (fs *FlagSet) Values() map[string]string {
+	values := make(map[string]string)
+	if fs == nil {
+		return values
+	}
+	for name, value := range fs.values {
+		values[name] = value
+	}
+	return values
+}
+
+// Args returns the arguments left after the flags
+func (fs *FlagSet) Args() []string {
+	if fs == nil {
+		return nil
+	}
+	return fs.args
+}
+
+// WithFlags returns a copy of ctx holding the parsed flags of a command
+func WithFlags(ctx context.Context, fs *FlagSet) context.Context {
+	return context.WithValue(ctx, FlagsKey, fs)
+}
+
+// GetFlags returns the flags the shell parsed for the running command.
+// The methods of the returned flag set may be called even when it is nil.
+func GetFlags(ctx context.Context) *FlagSet {
+	if ctx == nil {
+		return nil
+	}
+	fs, _ := ctx.Value(FlagsKey).(*FlagSet)
+	return fs
+}
@@ -0,0 +1,187 @@
+// Package goshtest runs commands the way the shell does, without a
+// shell or a terminal, so that plugin commands can be unit tested. A
+// command runs with in-memory standard streams and environment, and its
+// output, log and exit status are returned for the test to check:
+//
+//	func TestGreet(t *testing.T) {
+//		res := goshtest.Run(greetCmd("greet"), []string{"greet", "gosh"})
+//		res.ExpectCode(t, 0)
+//		res.ExpectStdout(t, "hello gosh\n")
+//	}
+package goshtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+	"github.com/vladimirvivien/gosh/api/output"
+)
+
+// Option sets up the context a command runs in
+type Option func(*config)
+
+type config struct {
+	ctx    context.Context
+	stdin  string
+	env    []string
+	dir    string
+	format output.Format
+}
+
+// WithContext runs the command in a context derived from ctx, for
+// deadlines and values of the test
+func WithContext(ctx context.Context) Option {
+	return func(c *config) { c.ctx = ctx }
+}
+
+// WithStdin sets the standard input of the command. The answers to
+// api.Confirm, api.Select and api.Password are read from it a line at a
+// time.
+func WithStdin(input string) Option {
+	return func(c *config) { c.stdin = input }
+}
+
+// WithEnv sets the environment of the command, "key=value" strings. It
+// is empty otherwise.
+func WithEnv(vars ...string) Option {
+	return func(c *config) { c.env = append(c.env, vars...) }
+}
+
+// WithWorkDir sets the working directory of the shell
+func WithWorkDir(dir string) Option {
+	return func(c *config) { c.dir = dir }
+}
+
+// WithFormat sets the output format the data of results is rendered
+// in, text by default
+func WithFormat(format output.Format) Option {
+	return func(c *config) { c.format = format }
+}
+
+// Result is the outcome of a command run by Run
+type Result struct {
+	// Stdout and Stderr are what the command wrote to its standard
+	// output, with its rendered data, and standard error
+	Stdout string
+	Stderr string
+
+	// Log holds the records the command logged with api.Logger, in
+	// the text format of log/slog
+	Log string
+
+	// Code is the exit status of the command, as the shell computes it
+	Code int
+
+	// Result, Err and Ctx are what Exec returned
+	Result api.Result
+	Err    error
+	Ctx    context.Context
+}
+
+// Run runs cmd with args, args[0] being the name of the command, as the
+// shell runs it: the flags of a command implementing api.Flagger are
+// parsed first, and the data of its result is rendered to its output
+// when it is an output.Renderer.
+func Run(cmd api.Command, args []string, opts ...Option) *Result {
+	cfg := config{ctx: context.Background(), format: output.Text}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if len(args) == 0 {
+		args = []string{cmd.Name()}
+	}
+
+	var stdout, stderr, log bytes.Buffer
+	ctx := api.WithStdin(cfg.ctx, strings.NewReader(cfg.stdin))
+	ctx = api.WithStdout(ctx, &stdout)
+	ctx = api.WithStderr(ctx, &stderr)
+	ctx = api.WithEnv(ctx, api.NewEnv(cfg.env))
+	ctx = api.WithLogger(ctx, slog.New(slog.NewTextHandler(&log, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	ctx = output.WithFormat(ctx, cfg.format)
+	if cfg.dir != "" {
+		ctx = api.WithWorkDir(ctx, cfg.dir)
+	}
+
+	newCtx, res, err := exec(ctx, cmd, args, &stdout)
+	if renderer, ok := res.Data.(output.Renderer); ok && err == nil {
+		if rerr := output.Render(ctx, renderer); rerr != nil {
+			res.Code, err = 1, rerr
+		}
+	}
+	return &Result{
+		Stdout: stdout.String(),
+		Stderr: stderr.String(),
+		Log:    log.String(),
+		Code:   api.Status(res, err),
+		Result: res,
+		Err:    err,
+		Ctx:    newCtx,
+	}
+}
+
+// exec parses the flags of the command, if it has any, and runs it
+func exec(ctx context.Context, cmd api.Command, args []string, stdout *bytes.Buffer) (context.Context, api.Result, error) {
+	flagger, ok := cmd.(api.Flagger)
+	if !ok || len(flagger.Flags()) == 0 {
+		return cmd.Exec(ctx, args)
+	}
+	flags := api.NewFlagSet(flagger.Flags())
+	err := flags.Parse(args[1:])
+	if errors.Is(err, api.ErrHelp) {
+		stdout.WriteString(api.FormatUsage(cmd))
+		return ctx, api.Result{}, nil
+	}
+	if err != nil {
+		return ctx, api.Result{}, err
+	}
+	return cmd.Exec(api.WithFlags(ctx, flags), append([]string{args[0]}, flags.Args()...))
+}
+
+// ExpectCode fails the test when the exit status is not code
+func (r *Result) ExpectCode(t testing.TB, code int) {
+	t.Helper()
+	if r.Code != code {
+		t.Errorf("expected exit status %d, got %d (error: %v, stderr: %q)", code, r.Code, r.Err, r.Stderr)
+	}
+}
+
+// ExpectStdout fails the test when the output is not expected
+func (r *Result) ExpectStdout(t testing.TB, expected string) {
+	t.Helper()
+	if r.Stdout != expected {
+		t.Errorf("expected stdout %q, got %q", expected, r.Stdout)
+	}
+}
+
+// ExpectStderr fails the test when the standard error is not expected
+func (r *Result) ExpectStderr(t testing.TB, expected string) {
+	t.Helper()
+	if r.Stderr != expected {
+		t.Errorf("expected stderr %q, got %q", expected, r.Stderr)
+	}
+}
+
+// ExpectStdoutContains fails the test when the output does not contain
+// each of parts
+func (r *Result) ExpectStdoutContains(t testing.TB, parts ...string) {
+	t.Helper()
+	for _, part := range parts {
+		if !strings.Contains(r.Stdout, part) {
+			t.Errorf("expected stdout to contain %q, got %q", part, r.Stdout)
+		}
+	}
+}
+
+// ExpectError fails the test when the command returned no error, or one
+// whose message does not contain msg
+func (r *Result) ExpectError(t testing.TB, msg string) {
+	t.Helper()
+	if r.Err == nil || !strings.Contains(r.Err.Error(), msg) {
+		t.Errorf("expected an error containing %q, got %v", msg, r.Err)
+	}
+}
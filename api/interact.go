@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// InteractorKey is the context key of the interactor of the shell
+const InteractorKey ContextKey = "gosh.interactor"
+
+// ErrCanceled is returned by Confirm, Select and Password when the user
+// cancels the question, as with Ctrl-C or Escape
+var ErrCanceled = errors.New("canceled")
+
+// Interactor asks the user questions on the terminal of the shell. The
+// shell provides one that reads keys in raw mode when stdin is a
+// terminal.
+type Interactor interface {
+	// Confirm asks a yes or no question, no being the default
+	Confirm(ctx context.Context, msg string) (bool, error)
+	// Select lets the user pick one of options and returns its index
+	Select(ctx context.Context, options []string) (int, error)
+	// Password reads a secret without showing it
+	Password(ctx context.Context, msg string) (string, error)
+}
+
+// WithInteractor returns a copy of ctx in which Confirm, Select and
+// Password use i
+func WithInteractor(ctx context.Context, i Interactor) context.Context {
+	return context.WithValue(ctx, InteractorKey, i)
+}
+
+func getInteractor(ctx context.Context) Interactor {
+	if ctx != nil {
+		if i, ok := ctx.Value(InteractorKey).(Interactor); ok && i != nil {
+			return i
+		}
+	}
+	return LineInteractor{}
+}
+
+// Confirm asks the user the yes or no question msg on stderr and
+// reports whether the answer is yes
+func Confirm(ctx context.Context, msg string) (bool, error) {
+	return getInteractor(ctx).Confirm(ctx, msg)
+}
+
+// Select lets the user pick one of options and returns its index. On a
+// terminal the options are picked with the arrow keys.
+func Select(ctx context.Context, options []string) (int, error) {
+	if len(options) == 0 {
+		return -1, errors.New("select: no options")
+	}
+	return getInteractor(ctx).Select(ctx, options)
+}
+
+// Password asks for a secret with msg on stderr. On a terminal the typed
+// characters are masked.
+func Password(ctx context.Context, msg string) (string, error) {
+	return getInteractor(ctx).Password(ctx, msg)
+}
+
+// LineInteractor asks questions a line at a time, for when there is no
+// terminal to read keys from. It is used when ctx has no interactor.
+type LineInteractor struct{}
+
+func (LineInteractor) Confirm(ctx context.Context, msg string) (bool, error) {
+	fmt.Fprintf(GetStderr(ctx), "%s [y/N] ", msg)
+	answer, err := readAnswer(GetStdin(ctx))
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func (LineInteractor) Select(ctx context.Context, options []string) (int, error) {
+	stderr := GetStderr(ctx)
+	for i, option := range options {
+		fmt.Fprintf(stderr, "%d) %s\n", i+1, option)
+	}
+	fmt.Fprint(stderr, "? ")
+	answer, err := readAnswer(GetStdin(ctx))
+	if err != nil {
+		return -1, err
+	}
+	answer = strings.TrimSpace(answer)
+	n, err := strconv.Atoi(answer)
+	if err != nil || n < 1 || n > len(options) {
+		return -1, fmt.Errorf("select: invalid choice %q", answer)
+	}
+	return n - 1, nil
+}
+
+func (LineInteractor) Password(ctx context.Context, msg string) (string, error) {
+	fmt.Fprintf(GetStderr(ctx), "%s ", msg)
+	return readAnswer(GetStdin(ctx))
+}
+
+// readAnswer reads a line from r a byte at a time, so that the input
+// following it is left for the next reader. The line ending is dropped.
+func readAnswer(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSuffix(string(line), "\r"), nil
+}
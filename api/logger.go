@@ -0,0 +1,27 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LoggerKey is the context key of the logger of the shell
+const LoggerKey ContextKey = "gosh.logger"
+
+// WithLogger returns a copy of ctx in which Logger returns logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, LoggerKey, logger)
+}
+
+// Logger returns the logger of the shell, which writes diagnostics at
+// the level and to the destination chosen with the --log-level and
+// --log-file flags. Commands should log there rather than write
+// diagnostics to their output. It defaults to slog.Default().
+func Logger(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(LoggerKey).(*slog.Logger); ok && logger != nil {
+			return logger
+		}
+	}
+	return slog.Default()
+}
@@ -0,0 +1,470 @@
+// Package output formats command output as tables, key-value lists and
+// columns that fit the width of the terminal. The same values can also
+// be rendered as JSON or YAML, as selected by the --output flag or the
+// set builtin of the shell, so that commands stay readable and
+// scriptable.
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vladimirvivien/gosh/api"
+	"gopkg.in/yaml.v3"
+)
+
+// FormatKey is the context key of the output format
+const FormatKey api.ContextKey = "gosh.output"
+
+// Format is a rendering mode
+type Format int
+
+const (
+	// Text renders aligned text for people
+	Text Format = iota
+	// JSON renders JSON documents
+	JSON
+	// YAML renders YAML documents
+	YAML
+)
+
+func (f Format) String() string {
+	switch f {
+	case JSON:
+		return "json"
+	case YAML:
+		return "yaml"
+	default:
+		return "text"
+	}
+}
+
+// ParseFormat returns the format with the given name: text (or
+// table), json or yaml
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "text", "table":
+		return Text, nil
+	case "json":
+		return JSON, nil
+	case "yaml":
+		return YAML, nil
+	}
+	return Text, fmt.Errorf("unknown output format %q", name)
+}
+
+// WithFormat returns a copy of ctx in which output is rendered in format
+func WithFormat(ctx context.Context, format Format) context.Context {
+	return context.WithValue(ctx, FormatKey, format)
+}
+
+// GetFormat returns the output format of ctx, Text by default
+func GetFormat(ctx context.Context) Format {
+	if ctx == nil {
+		return Text
+	}
+	format, _ := ctx.Value(FormatKey).(Format)
+	return format
+}
+
+// Renderer is a value that can be written in each format. Width is the
+// number of columns available to text output.
+type Renderer interface {
+	Write(w io.Writer, format Format, width int) error
+}
+
+// Render writes r to the stdout of ctx in the output format of ctx
+func Render(ctx context.Context, r Renderer) error {
+	out := api.GetStdout(ctx)
+	return r.Write(out, GetFormat(ctx), Width(out))
+}
+
+// Width returns the number of columns of the terminal w writes to. For
+// other writers it is $COLUMNS, or 80 when that is not set.
+func Width(w io.Writer) int {
+	if f, ok := w.(*os.File); ok {
+		if cols, err := termWidth(f.Fd()); err == nil && cols > 0 {
+			return cols
+		}
+	}
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 0 {
+		return cols
+	}
+	return 80
+}
+
+// encode writes v as JSON or YAML
+func encode(w io.Writer, format Format, v interface{}) error {
+	if format == YAML {
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// Table is a list of rows with a header
+type Table struct {
+	Headers []string
+	Rows    [][]string
+}
+
+// NewTable returns an empty table with the given headers
+func NewTable(headers ...string) *Table {
+	return &Table{Headers: headers}
+}
+
+// AddRow appends a row, formatting its values like fmt.Sprint
+func (t *Table) AddRow(values ...interface{}) {
+	row := make([]string, len(values))
+	for i, v := range values {
+		row[i] = fmt.Sprint(v)
+	}
+	t.Rows = append(t.Rows, row)
+}
+
+// Write renders the table as aligned columns, truncating the widest
+// cells when it does not fit in width, or as a list of objects keyed
+// by the headers in JSON and YAML
+func (t *Table) Write(w io.Writer, format Format, width int) error {
+	if format != Text {
+		records := make([]KeyValues, 0, len(t.Rows))
+		for _, row := range t.Rows {
+			record := make(KeyValues, len(t.Headers))
+			for i, header := range t.Headers {
+				record[i] = KeyValue{Key: header, Value: ""}
+				if i < len(row) {
+					record[i].Value = row[i]
+				}
+			}
+			records = append(records, record)
+		}
+		return encode(w, format, records)
+	}
+
+	widths := make([]int, len(t.Headers))
+	for i, header := range t.Headers {
+		widths[i] = textWidth(header)
+	}
+	for _, row := range t.Rows {
+		for i := 0; i < len(row) && i < len(widths); i++ {
+			if n := textWidth(row[i]); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	fitWidths(widths, width)
+
+	rows := append([][]string{t.Headers}, t.Rows...)
+	for _, row := range rows {
+		var b strings.Builder
+		for i := range widths {
+			cell := ""
+			if i < len(row) {
+				cell = truncate(row[i], widths[i])
+			}
+			if i == len(widths)-1 {
+				b.WriteString(cell)
+				break
+			}
+			b.WriteString(cell)
+			b.WriteString(strings.Repeat(" ", widths[i]-textWidth(cell)+2))
+		}
+		if _, err := fmt.Fprintln(w, strings.TrimRight(b.String(), " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fitWidths shrinks the widest columns until the columns and the two
+// spaces between them fit in width, keeping at least 3 characters each
+func fitWidths(widths []int, width int) {
+	total := 2 * (len(widths) - 1)
+	for _, n := range widths {
+		total += n
+	}
+	for total > width {
+		widest := 0
+		for i, n := range widths {
+			if n > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= 3 {
+			return
+		}
+		widths[widest]--
+		total--
+	}
+}
+
+// KeyValue is a named value
+type KeyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// KeyValues is an ordered list of named values. A value may itself be
+// a KeyValues, which is shown indented below its key.
+type KeyValues []KeyValue
+
+// Write renders the values as "key: value" lines with aligned values,
+// or as an object in JSON and YAML
+func (kvs KeyValues) Write(w io.Writer, format Format, width int) error {
+	if format != Text {
+		return encode(w, format, kvs)
+	}
+	return kvs.writeText(w, "", width)
+}
+
+func (kvs KeyValues) writeText(w io.Writer, indent string, width int) error {
+	keyWidth := 0
+	for _, kv := range kvs {
+		if n := textWidth(kv.Key); n > keyWidth {
+			keyWidth = n
+		}
+	}
+	for _, kv := range kvs {
+		key := indent + kv.Key + ":"
+		if nested, ok := kv.Value.(KeyValues); ok {
+			if _, err := fmt.Fprintln(w, truncate(key, width)); err != nil {
+				return err
+			}
+			if err := nested.writeText(w, indent+"  ", width); err != nil {
+				return err
+			}
+			continue
+		}
+		line := key + strings.Repeat(" ", keyWidth+2-textWidth(kv.Key)) + textValue(kv.Value)
+		if _, err := fmt.Fprintln(w, truncate(strings.TrimRight(line, " "), width)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the values as an object, keeping their order
+func (kvs KeyValues) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("{")
+	for i, kv := range kvs {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		key, err := json.Marshal(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(kv.Value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteString(":")
+		b.Write(value)
+	}
+	b.WriteString("}")
+	return b.Bytes(), nil
+}
+
+// MarshalYAML encodes the values as a mapping, keeping their order
+func (kvs KeyValues) MarshalYAML() (interface{}, error) {
+	m := &yaml.Node{Kind: yaml.MappingNode}
+	for _, kv := range kvs {
+		value := &yaml.Node{}
+		if err := value.Encode(kv.Value); err != nil {
+			return nil, err
+		}
+		m.Content = append(m.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: kv.Key}, value)
+	}
+	return m, nil
+}
+
+// textValue formats a value for text output, joining lists with commas
+func textValue(v interface{}) string {
+	if list, ok := v.([]string); ok {
+		return strings.Join(list, ", ")
+	}
+	return fmt.Sprint(v)
+}
+
+// Columns is a list of short strings, such as names, shown in as many
+// columns as fit the width
+type Columns []string
+
+// Write renders the items in columns filled top to bottom, or as a list
+// in JSON and YAML
+func (c Columns) Write(w io.Writer, format Format, width int) error {
+	if format != Text {
+		return encode(w, format, []string(c))
+	}
+	if len(c) == 0 {
+		return nil
+	}
+	colWidth := 0
+	for _, item := range c {
+		if n := textWidth(item); n > colWidth {
+			colWidth = n
+		}
+	}
+	colWidth += 2
+	// the last column needs no gap after it
+	cols := (width + 2) / colWidth
+	if cols < 1 {
+		cols = 1
+	}
+	rows := (len(c) + cols - 1) / cols
+	for r := 0; r < rows; r++ {
+		var b strings.Builder
+		for i := r; i < len(c); i += rows {
+			b.WriteString(c[i])
+			b.WriteString(strings.Repeat(" ", colWidth-textWidth(c[i])))
+		}
+		if _, err := fmt.Fprintln(w, strings.TrimRight(b.String(), " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// textWidth returns the number of characters of s
+func textWidth(s string) int {
+	return len([]rune(s))
+}
+
+// truncate shortens s to width characters, ending it with "..."
+func truncate(s string, width int) string {
+	runes := []rune(s)
+	if len(runes) <= width {
+		return s
+	}
+	if width <= 3 {
+		return string(runes[:width])
+	}
+	return string(runes[:width-3]) + "..."
+}
+
+// Records is a list of structured records, such as structs, maps or
+// KeyValues, that a command returns in the Data of its api.Result. The
+// shell renders them in its output format: a table with a column per
+// field in text, or a list of objects in JSON and YAML.
+type Records []interface{}
+
+// Write renders the records as a table, or as a list of objects in JSON
+// and YAML. Values that are not records are shown in a VALUE column.
+func (r Records) Write(w io.Writer, format Format, width int) error {
+	if format != Text {
+		list := make([]interface{}, len(r))
+		for i, v := range r {
+			list[i] = v
+			if fields, ok := recordFields(v); ok {
+				list[i] = fields
+			}
+		}
+		return encode(w, format, list)
+	}
+
+	var headers []string
+	index := make(map[string]int)
+	rows := make([]KeyValues, len(r))
+	for i, v := range r {
+		fields, ok := recordFields(v)
+		if !ok {
+			fields = KeyValues{{Key: "VALUE", Value: v}}
+		}
+		for _, field := range fields {
+			if _, ok := index[field.Key]; !ok {
+				index[field.Key] = len(headers)
+				headers = append(headers, field.Key)
+			}
+		}
+		rows[i] = fields
+	}
+	if len(headers) == 0 {
+		return nil
+	}
+	table := NewTable(headers...)
+	for _, fields := range rows {
+		row := make([]string, len(headers))
+		for _, field := range fields {
+			row[index[field.Key]] = textValue(field.Value)
+		}
+		table.Rows = append(table.Rows, row)
+	}
+	return table.Write(w, Text, width)
+}
+
+// recordFields returns the fields of a record: the values of KeyValues,
+// the exported fields of a struct, named like encoding/json names them,
+// or the entries of a map sorted by key
+func recordFields(v interface{}) (KeyValues, bool) {
+	if kvs, ok := v.(KeyValues); ok {
+		return kvs, true
+	}
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+	switch val.Kind() {
+	case reflect.Struct:
+		var fields KeyValues
+		for i := 0; i < val.NumField(); i++ {
+			field := val.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := field.Name
+			if tag, ok := field.Tag.Lookup("json"); ok {
+				tag = strings.Split(tag, ",")[0]
+				if tag == "-" {
+					continue
+				}
+				if tag != "" {
+					name = tag
+				}
+			}
+			fields = append(fields, KeyValue{Key: name, Value: val.Field(i).Interface()})
+		}
+		return fields, true
+	case reflect.Map:
+		keys := val.MapKeys()
+		names := make([]string, len(keys))
+		for i, key := range keys {
+			names[i] = fmt.Sprint(key.Interface())
+		}
+		sort.Sort(byName{names, keys})
+		fields := make(KeyValues, len(keys))
+		for i, key := range keys {
+			fields[i] = KeyValue{Key: names[i], Value: val.MapIndex(key).Interface()}
+		}
+		return fields, true
+	}
+	return nil, false
+}
+
+// byName sorts map keys by their formatted names
+type byName struct {
+	names []string
+	keys  []reflect.Value
+}
+
+func (b byName) Len() int           { return len(b.names) }
+func (b byName) Less(i, j int) bool { return b.names[i] < b.names[j] }
+func (b byName) Swap(i, j int) {
+	b.names[i], b.names[j] = b.names[j], b.names[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package output
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// termWidth returns the number of columns of the terminal fd refers to
+func termWidth(fd uintptr) (int, error) {
+	var ws struct{ row, col, xpixel, ypixel uint16 }
+	if _, _, errno := syscall.Syscall6(syscall.SYS_IOCTL, fd, syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws)), 0, 0, 0); errno != 0 {
+		return 0, errno
+	}
+	return int(ws.col), nil
+}
@@ -0,0 +1,12 @@
+package output
+
+import "golang.org/x/sys/windows"
+
+// termWidth returns the number of columns of the console fd refers to
+func termWidth(fd uintptr) (int, error) {
+	var info windows.ConsoleScreenBufferInfo
+	if err := windows.GetConsoleScreenBufferInfo(windows.Handle(fd), &info); err != nil {
+		return 0, err
+	}
+	return int(info.Window.Right-info.Window.Left) + 1, nil
+}
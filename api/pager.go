@@ -0,0 +1,38 @@
+package api
+
+import (
+	"context"
+	"io"
+)
+
+// PagerKey is the context key of the pager of the shell
+const PagerKey ContextKey = "gosh.pager"
+
+// Pager returns a writer for the output of a command that pages it when
+// it does not fit the terminal. Closing the writer flushes the output
+// and waits for the user to leave the pager.
+type Pager func(ctx context.Context) io.WriteCloser
+
+// WithPager returns a copy of ctx in which Paged uses pager
+func WithPager(ctx context.Context, pager Pager) context.Context {
+	return context.WithValue(ctx, PagerKey, pager)
+}
+
+// Paged returns a writer to the stdout of ctx that lets the user page
+// through long output when stdout is a terminal. Commands producing
+// output that may be long should write it there and close the writer
+// before returning. Without a pager the writer writes to stdout as is.
+func Paged(ctx context.Context) io.WriteCloser {
+	if ctx != nil {
+		if pager, ok := ctx.Value(PagerKey).(Pager); ok && pager != nil {
+			return pager(ctx)
+		}
+	}
+	return nopCloser{GetStdout(ctx)}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
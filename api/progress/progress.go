@@ -0,0 +1,319 @@
+// Package progress shows spinners and progress bars for long-running
+// commands. They are drawn on a line of the stderr of the command when
+// it is a terminal, and are logged as plain lines otherwise, so that
+// output sent to a file or another command stays readable. The shell
+// stops the indicators left running when a command returns, so that
+// they never draw over the prompt.
+package progress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+	"github.com/vladimirvivien/gosh/api/output"
+)
+
+// tick is the interval between frames of the spinners
+const tick = 100 * time.Millisecond
+
+var frames = []string{"|", "/", "-", "\\"}
+
+// active holds the indicators drawn on terminals that have not been
+// stopped
+var active = struct {
+	sync.Mutex
+	indicators map[*indicator]struct{}
+}{indicators: make(map[*indicator]struct{})}
+
+// StopAll stops the indicators still running on w and clears their
+// lines. The shell calls it with its stderr when a command line is done.
+func StopAll(w io.Writer) {
+	active.Lock()
+	var indicators []*indicator
+	for ind := range active.indicators {
+		if ind.w == w {
+			indicators = append(indicators, ind)
+		}
+	}
+	active.Unlock()
+	for _, ind := range indicators {
+		ind.stop("")
+	}
+}
+
+// indicator is the line a spinner or bar is drawn on. On a terminal the
+// line is redrawn in place; otherwise each message is written once, on
+// its own line.
+type indicator struct {
+	mu      sync.Mutex
+	w       io.Writer
+	tty     bool
+	width   int
+	drawn   bool
+	stopped bool
+	done    chan struct{}
+	render  func() string
+}
+
+func newIndicator(ctx context.Context, render func() string) *indicator {
+	w := api.GetStderr(ctx)
+	ind := &indicator{
+		w:      w,
+		tty:    isTerminal(w),
+		width:  output.Width(w),
+		done:   make(chan struct{}),
+		render: render,
+	}
+	if ind.tty {
+		active.Lock()
+		active.indicators[ind] = struct{}{}
+		active.Unlock()
+	}
+	return ind
+}
+
+// draw redraws the line on a terminal. It is called with mu held.
+func (ind *indicator) draw() {
+	if !ind.tty || ind.stopped {
+		return
+	}
+	line := []rune(ind.render())
+	if len(line) > ind.width-1 {
+		line = line[:ind.width-1]
+	}
+	fmt.Fprintf(ind.w, "\r\x1b[K%s", string(line))
+	ind.drawn = true
+}
+
+// clear erases the line on a terminal. It is called with mu held.
+func (ind *indicator) clear() {
+	if ind.drawn {
+		io.WriteString(ind.w, "\r\x1b[K")
+		ind.drawn = false
+	}
+}
+
+// log writes a line above the indicator, which is drawn again below it
+func (ind *indicator) log(format string, args ...interface{}) {
+	ind.mu.Lock()
+	defer ind.mu.Unlock()
+	ind.clear()
+	fmt.Fprintf(ind.w, strings.TrimSuffix(format, "\n")+"\n", args...)
+	ind.draw()
+}
+
+// stop clears the line and writes msg, if any, in its place
+func (ind *indicator) stop(msg string) {
+	ind.mu.Lock()
+	defer ind.mu.Unlock()
+	if ind.stopped {
+		return
+	}
+	ind.clear()
+	ind.stopped = true
+	close(ind.done)
+	active.Lock()
+	delete(active.indicators, ind)
+	active.Unlock()
+	if msg != "" {
+		fmt.Fprintln(ind.w, msg)
+	}
+}
+
+// Spinner shows a message after a spinning character while work of
+// unknown length is going on
+type Spinner struct {
+	ind   *indicator
+	msg   string
+	frame int
+}
+
+// NewSpinner starts a spinner showing msg on the stderr of ctx. It is
+// stopped by Stop, or when ctx is cancelled. When stderr is not a
+// terminal, msg is written once.
+func NewSpinner(ctx context.Context, msg string) *Spinner {
+	s := &Spinner{msg: msg}
+	s.ind = newIndicator(ctx, func() string { return frames[s.frame%len(frames)] + " " + s.msg })
+	if !s.ind.tty {
+		fmt.Fprintln(s.ind.w, msg)
+		return s
+	}
+	s.ind.mu.Lock()
+	s.ind.draw()
+	s.ind.mu.Unlock()
+	go s.spin(ctx)
+	return s
+}
+
+func (s *Spinner) spin(ctx context.Context) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.ind.mu.Lock()
+			s.frame++
+			s.ind.draw()
+			s.ind.mu.Unlock()
+		case <-ctx.Done():
+			s.ind.stop("")
+			return
+		case <-s.ind.done:
+			return
+		}
+	}
+}
+
+// Update changes the message of the spinner. When stderr is not a
+// terminal, the new message is written on its own line.
+func (s *Spinner) Update(msg string) {
+	s.ind.mu.Lock()
+	defer s.ind.mu.Unlock()
+	if s.ind.stopped || msg == s.msg {
+		return
+	}
+	s.msg = msg
+	if !s.ind.tty {
+		fmt.Fprintln(s.ind.w, msg)
+		return
+	}
+	s.ind.draw()
+}
+
+// Printf writes a line above the spinner
+func (s *Spinner) Printf(format string, args ...interface{}) {
+	s.ind.log(format, args...)
+}
+
+// Stop stops the spinner and replaces it with msg, or clears its line
+// when msg is empty
+func (s *Spinner) Stop(msg string) {
+	s.ind.stop(msg)
+}
+
+// Bar shows the completion of work of known length, such as the bytes
+// of a download
+type Bar struct {
+	ind     *indicator
+	msg     string
+	current int64
+	total   int64
+	logged  int64
+}
+
+// NewBar starts a progress bar showing msg for total units of work on
+// the stderr of ctx. A total of 0 or less shows the count of units done
+// without a bar. The bar is stopped by Done, or when ctx is cancelled.
+// When stderr is not a terminal, the progress is logged every tenth of
+// the total.
+func NewBar(ctx context.Context, msg string, total int64) *Bar {
+	b := &Bar{msg: msg, total: total, logged: -1}
+	b.ind = newIndicator(ctx, b.line)
+	b.ind.mu.Lock()
+	b.update()
+	b.ind.mu.Unlock()
+	go func() {
+		select {
+		case <-ctx.Done():
+			b.ind.stop("")
+		case <-b.ind.done:
+		}
+	}()
+	return b
+}
+
+// line renders the bar to fit the width of the terminal
+func (b *Bar) line() string {
+	if b.total <= 0 {
+		return fmt.Sprintf("%s %d", b.msg, b.current)
+	}
+	stats := fmt.Sprintf(" %3d%% %d/%d", b.percent(), b.current, b.total)
+	cells := b.ind.width - 1 - len([]rune(b.msg)) - len(stats) - 3
+	if cells > 40 {
+		cells = 40
+	}
+	if cells < 10 {
+		return b.msg + stats
+	}
+	full := int(int64(cells) * b.current / b.total)
+	bar := strings.Repeat("=", full)
+	if full < cells {
+		bar += ">" + strings.Repeat(" ", cells-full-1)
+	}
+	return b.msg + " [" + bar + "]" + stats
+}
+
+func (b *Bar) percent() int64 {
+	return b.current * 100 / b.total
+}
+
+// update draws the bar, or logs it when it reached a new tenth of the
+// total. It is called with mu held.
+func (b *Bar) update() {
+	if b.ind.tty {
+		b.ind.draw()
+		return
+	}
+	if b.total <= 0 || b.ind.stopped {
+		return
+	}
+	if step := b.percent() / 10; step > b.logged {
+		b.logged = step
+		fmt.Fprintf(b.ind.w, "%s %d%% (%d/%d)\n", b.msg, b.percent(), b.current, b.total)
+	}
+}
+
+// Add adds n units to the work done
+func (b *Bar) Add(n int64) {
+	b.ind.mu.Lock()
+	defer b.ind.mu.Unlock()
+	b.set(b.current + n)
+}
+
+// Set sets the units of work done to n
+func (b *Bar) Set(n int64) {
+	b.ind.mu.Lock()
+	defer b.ind.mu.Unlock()
+	b.set(n)
+}
+
+func (b *Bar) set(n int64) {
+	if n < 0 {
+		n = 0
+	}
+	if b.total > 0 && n > b.total {
+		n = b.total
+	}
+	b.current = n
+	b.update()
+}
+
+// Printf writes a line above the bar
+func (b *Bar) Printf(format string, args ...interface{}) {
+	b.ind.log(format, args...)
+}
+
+// Done stops the bar and replaces it with msg, or clears its line when
+// msg is empty
+func (b *Bar) Done(msg string) {
+	b.ind.stop(msg)
+}
+
+// isTerminal reports whether w is a terminal that can redraw lines
+func isTerminal(w io.Writer) bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,15 @@
+package api
+
+import "context"
+
+// PromptSegment renders a custom part of the shell prompt. It is called
+// with the context of the shell each time the prompt is shown, so it
+// should return quickly.
+type PromptSegment func(ctx context.Context) string
+
+// PromptSegmenter is an optional interface implemented by a Commands
+// module that provides prompt segments. A segment is used in the prompt
+// template as {{segment "name"}}.
+type PromptSegmenter interface {
+	PromptSegments() map[string]PromptSegment
+}
@@ -0,0 +1,244 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// RPCServiceName is the name of the JSON-RPC service served by a
+// process plugin. Its methods are Plugin.Version, Plugin.Commands,
+// Plugin.Exec, Plugin.Cancel, Plugin.Segments and Plugin.Segment.
+const RPCServiceName = "Plugin"
+
+// CommandInfo describes a command provided by a process plugin
+type CommandInfo struct {
+	Name      string    `json:"name"`
+	Usage     string    `json:"usage"`
+	ShortDesc string    `json:"short_desc"`
+	LongDesc  string    `json:"long_desc"`
+	Flags     []Flag    `json:"flags,omitempty"`
+	Category  string    `json:"category,omitempty"`
+	Examples  []Example `json:"examples,omitempty"`
+	Roles     []string  `json:"roles,omitempty"`
+
+	// CacheTTL is the TTL of a Cacheable command, in nanoseconds in
+	// JSON
+	CacheTTL time.Duration `json:"cache_ttl,omitempty"`
+}
+
+// ExecRequest asks a process plugin to run a command. ID identifies
+// the call for Plugin.Cancel, Env holds "key=value" strings, Dir the
+// working directory of the shell and Stdin the whole input of the
+// command. Flags holds the flags parsed by the
+// shell for a command that has any, and Args the arguments left after
+// them. Trace holds the W3C trace context of the span of the command in
+// the shell, its traceparent and tracestate, when it is traced.
+type ExecRequest struct {
+	ID    uint64            `json:"id"`
+	Name  string            `json:"name"`
+	Args  []string          `json:"args"`
+	Flags map[string]string `json:"flags,omitempty"`
+	Env   []string          `json:"env"`
+	Dir   string            `json:"dir,omitempty"`
+	Stdin string            `json:"stdin"`
+	Trace map[string]string `json:"trace,omitempty"`
+}
+
+// ExecResponse holds the output and exit status of a command run by
+// a process plugin. Error is the message of the error returned by the
+// command, if any, and Data the structured data of its result, which
+// must be encodable as JSON.
+type ExecResponse struct {
+	Stdout string      `json:"stdout"`
+	Stderr string      `json:"stderr"`
+	Status int         `json:"status"`
+	Error  string      `json:"error"`
+	Data   interface{} `json:"data,omitempty"`
+}
+
+// CancelRequest asks a process plugin to cancel a running command
+type CancelRequest struct {
+	ID uint64 `json:"id"`
+}
+
+// SegmentRequest asks a process plugin to render a prompt segment with
+// the environment of the shell, "key=value" strings
+type SegmentRequest struct {
+	Name string   `json:"name"`
+	Env  []string `json:"env"`
+}
+
+// Serve runs the commands as a process plugin, speaking JSON-RPC over
+// the standard input and output of the process. It returns when the
+// shell closes the connection. Anything written to the standard error
+// of the process is shown by the shell.
+func Serve(cmds Commands) error {
+	return ServeConn(cmds, struct {
+		io.Reader
+		io.WriteCloser
+	}{os.Stdin, os.Stdout})
+}
+
+// ServeConn runs the commands as a process plugin over conn
+func ServeConn(cmds Commands, conn io.ReadWriteCloser) error {
+	ctx := WithStdout(context.Background(), os.Stderr)
+	ctx = WithStderr(ctx, os.Stderr)
+	if err := cmds.Init(ctx); err != nil {
+		return err
+	}
+	server := rpc.NewServer()
+	svc := &rpcService{
+		ctx:     ctx,
+		cmds:    cmds.Registry(),
+		running: make(map[uint64]context.CancelFunc),
+	}
+	if segmenter, ok := cmds.(PromptSegmenter); ok {
+		svc.segments = segmenter.PromptSegments()
+	}
+	if err := server.RegisterName(RPCServiceName, svc); err != nil {
+		return err
+	}
+	server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	if closer, ok := cmds.(Closer); ok {
+		return closer.Close(ctx)
+	}
+	return nil
+}
+
+// rpcService exposes the commands and prompt segments of a process
+// plugin
+type rpcService struct {
+	ctx      context.Context
+	cmds     map[string]Command
+	segments map[string]PromptSegment
+
+	mu      sync.Mutex
+	running map[uint64]context.CancelFunc
+}
+
+// Commands lists the commands of the plugin
+func (s *rpcService) Commands(_ struct{}, infos *[]CommandInfo) error {
+	for name, cmd := range s.cmds {
+		info := CommandInfo{
+			Name:      name,
+			Usage:     cmd.Usage(),
+			ShortDesc: cmd.ShortDesc(),
+			LongDesc:  cmd.LongDesc(),
+		}
+		if flagger, ok := cmd.(Flagger); ok {
+			info.Flags = flagger.Flags()
+		}
+		if describer, ok := cmd.(Describer); ok {
+			info.Category = describer.Category()
+			info.Examples = describer.Examples()
+		}
+		if restricted, ok := cmd.(Restricted); ok {
+			info.Roles = restricted.Roles()
+		}
+		if cacheable, ok := cmd.(Cacheable); ok {
+			info.CacheTTL = cacheable.CacheTTL()
+		}
+		*infos = append(*infos, info)
+	}
+	return nil
+}
+
+// Exec runs a command with buffered input and output, in the context
+// of the span of the command in the shell when it is traced
+func (s *rpcService) Exec(req ExecRequest, resp *ExecResponse) error {
+	cmd, ok := s.cmds[req.Name]
+	if !ok {
+		return errors.New("command not found: " + req.Name)
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	if len(req.Trace) > 0 {
+		ctx = propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier(req.Trace))
+	}
+	s.mu.Lock()
+	s.running[req.ID] = cancel
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, req.ID)
+		s.mu.Unlock()
+		cancel()
+	}()
+
+	var stdout, stderr bytes.Buffer
+	ctx = WithStdout(ctx, &stdout)
+	ctx = WithStderr(ctx, &stderr)
+	ctx = WithStdin(ctx, strings.NewReader(req.Stdin))
+	ctx = WithEnv(ctx, NewEnv(req.Env))
+	if req.Dir != "" {
+		ctx = WithWorkDir(ctx, req.Dir)
+	}
+	if flagger, ok := cmd.(Flagger); ok {
+		flags := NewFlagSet(flagger.Flags())
+		for name, value := range req.Flags {
+			if err := flags.Set(name, value); err != nil {
+				return err
+			}
+		}
+		if len(req.Args) > 0 {
+			flags.args = req.Args[1:]
+		}
+		ctx = WithFlags(ctx, flags)
+	}
+
+	_, res, err := cmd.Exec(ctx, req.Args)
+	resp.Stdout = stdout.String()
+	resp.Stderr = stderr.String()
+	resp.Status = Status(res, err)
+	resp.Data = res.Data
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return nil
+}
+
+// Cancel cancels the context of a running command
+func (s *rpcService) Cancel(req CancelRequest, _ *struct{}) error {
+	s.mu.Lock()
+	cancel, ok := s.running[req.ID]
+	s.mu.Unlock()
+	if ok {
+		cancel()
+	}
+	return nil
+}
+
+// Version returns the version of the plugin API the plugin was built
+// against, which the shell checks against its own
+func (s *rpcService) Version(_ struct{}, version *string) error {
+	*version = APIVersion
+	return nil
+}
+
+// Segments lists the names of the prompt segments of the plugin
+func (s *rpcService) Segments(_ struct{}, names *[]string) error {
+	for name := range s.segments {
+		*names = append(*names, name)
+	}
+	return nil
+}
+
+// Segment renders a prompt segment
+func (s *rpcService) Segment(req SegmentRequest, text *string) error {
+	segment, ok := s.segments[req.Name]
+	if !ok {
+		return errors.New("segment not found: " + req.Name)
+	}
+	*text = segment(WithEnv(s.ctx, NewEnv(req.Env)))
+	return nil
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"context"
+	"fmt"
+)
+
+// Run runs the command name with args, as the shell would run it from
+// a command line, and returns its result: the command is looked up in
+// the registry of the shell, checked against the roles of the user,
+// has its flags parsed and its data rendered to the stdout of ctx, and
+// is traced and measured. Its arguments are not expanded. A command
+// builds on others with Run rather than by starting a shell or calling
+// the commands of the registry directly. The context changes made by
+// the command are discarded.
+//
+//	res, err := api.Run(ctx, "deploy", "--env", "staging")
+//
+// Combined with Capture, Run returns the output of the command:
+//
+//	out, err := api.Capture(ctx, func(ctx context.Context) error {
+//		_, err := api.Run(ctx, "status", "--short")
+//		return err
+//	})
+func Run(ctx context.Context, name string, args ...string) (Result, error) {
+	runner := GetSession(ctx).Runner
+	if runner == nil {
+		return Result{Code: 1}, fmt.Errorf("%s: no shell to run the command", name)
+	}
+	return runner.Run(ctx, name, args...)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+)
+
+// ExitCoder is implemented by errors that carry the exit status
+// of a command, such as *exec.ExitError
+type ExitCoder interface {
+	error
+	ExitCode() int
+}
+
+// ExitError is an error that reports a specific exit status
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+// NewExitError returns an error reporting the given exit status
+func NewExitError(code int, err error) *ExitError {
+	return &ExitError{Code: code, Err: err}
+}
+
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return "exit status " + strconv.Itoa(e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error { return e.Err }
+
+// ExitCode returns the exit status
+func (e *ExitError) ExitCode() int { return e.Code }
+
+// Result is the outcome of a command. Code is its exit status and Data
+// optional structured output, such as the values behind the text written
+// to stdout, which the next command can read with GetLastResult.
+type Result struct {
+	Code int
+	Data interface{}
+}
+
+// Status returns the exit status of a command that returned res and err
+func Status(res Result, err error) int {
+	if res.Code != 0 {
+		return res.Code
+	}
+	return ExitStatus(err)
+}
+
+// ExitStatus returns the exit status represented by an error returned
+// from Command.Exec: 0 for nil, the code of an ExitCoder, or 1 otherwise
+func ExitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var coder ExitCoder
+	if errors.As(err, &coder) {
+		return coder.ExitCode()
+	}
+	return 1
+}
@@ -0,0 +1,159 @@
+// Package style formats text with ANSI colors and styles. Output is
+// only styled when it goes to a terminal and the NO_COLOR environment
+// variable is not set, so commands can use the same code whether their
+// output is shown to a user or sent to a file or another command.
+package style
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Attr is an ANSI text attribute
+type Attr int
+
+const (
+	Reset     Attr = 0
+	Bold      Attr = 1
+	Dim       Attr = 2
+	Italic    Attr = 3
+	Underline Attr = 4
+	Reverse   Attr = 7
+)
+
+const (
+	Black Attr = iota + 30
+	Red
+	Green
+	Yellow
+	Blue
+	Magenta
+	Cyan
+	White
+)
+
+var attrNames = map[string]Attr{
+	"reset":     Reset,
+	"bold":      Bold,
+	"dim":       Dim,
+	"italic":    Italic,
+	"underline": Underline,
+	"reverse":   Reverse,
+	"black":     Black,
+	"red":       Red,
+	"green":     Green,
+	"yellow":    Yellow,
+	"blue":      Blue,
+	"magenta":   Magenta,
+	"cyan":      Cyan,
+	"white":     White,
+}
+
+// Style is a combination of attributes
+type Style []Attr
+
+// New returns a style combining the attributes
+func New(attrs ...Attr) Style { return Style(attrs) }
+
+// Parse returns the style combining the named attributes, such as
+// "red" or "bold"
+func Parse(names ...string) (Style, error) {
+	s := make(Style, 0, len(names))
+	for _, name := range names {
+		attr, ok := attrNames[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown style %q", name)
+		}
+		s = append(s, attr)
+	}
+	return s, nil
+}
+
+// Code returns the escape sequence that turns on the style
+func (s Style) Code() string {
+	if len(s) == 0 {
+		return ""
+	}
+	codes := make([]string, len(s))
+	for i, attr := range s {
+		codes[i] = strconv.Itoa(int(attr))
+	}
+	return "\x1b[" + strings.Join(codes, ";") + "m"
+}
+
+// Sprint formats its operands like fmt.Sprint and always wraps the
+// result in the style
+func (s Style) Sprint(a ...interface{}) string {
+	if len(s) == 0 {
+		return fmt.Sprint(a...)
+	}
+	return s.Code() + fmt.Sprint(a...) + Reset.code()
+}
+
+// Fprint writes its operands to w like fmt.Fprint, styled if Enabled(w)
+func (s Style) Fprint(w io.Writer, a ...interface{}) (int, error) {
+	if !Enabled(w) {
+		return fmt.Fprint(w, a...)
+	}
+	return io.WriteString(w, s.Sprint(a...))
+}
+
+// Fprintf writes to w like fmt.Fprintf, styled if Enabled(w)
+func (s Style) Fprintf(w io.Writer, format string, a ...interface{}) (int, error) {
+	return s.Fprint(w, fmt.Sprintf(format, a...))
+}
+
+// Fprintln writes its operands to w like fmt.Fprintln, styled if
+// Enabled(w). The newline is written after the end of the style.
+func (s Style) Fprintln(w io.Writer, a ...interface{}) (int, error) {
+	text := fmt.Sprintln(a...)
+	n, err := s.Fprint(w, strings.TrimSuffix(text, "\n"))
+	if err != nil {
+		return n, err
+	}
+	m, err := io.WriteString(w, "\n")
+	return n + m, err
+}
+
+func (a Attr) code() string { return Style{a}.Code() }
+
+// Mode decides when output is styled
+type Mode int32
+
+const (
+	// Auto styles output written to a terminal unless NO_COLOR is set
+	Auto Mode = iota
+	// Always styles all output
+	Always
+	// Never disables styling
+	Never
+)
+
+var mode int32
+
+// SetMode sets when output is styled. The shell sets it to Never when
+// color output is disabled in its configuration.
+func SetMode(m Mode) { atomic.StoreInt32(&mode, int32(m)) }
+
+// Enabled reports whether output written to w should be styled
+func Enabled(w io.Writer) bool {
+	switch Mode(atomic.LoadInt32(&mode)) {
+	case Always:
+		return true
+	case Never:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
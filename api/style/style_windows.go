@@ -0,0 +1,19 @@
+package style
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// Windows consoles only interpret the escape sequences of styles, and
+// of the cursor motions of the line editor, once virtual terminal
+// processing is turned on for their output
+func init() {
+	for _, f := range []*os.File{os.Stdout, os.Stderr} {
+		var mode uint32
+		if windows.GetConsoleMode(windows.Handle(f.Fd()), &mode) == nil {
+			windows.SetConsoleMode(windows.Handle(f.Fd()), mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING)
+		}
+	}
+}
@@ -1,19 +1,36 @@
 package api
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Module a plugin that can be initialized
 type Module interface {
 	Init(context.Context) error
 }
 
-// Command represents an executable a command
+// Command represents an executable a command.
+//
+// A command should read its input from the reader returned by GetStdin
+// and write its output to the writers returned by GetStdout and GetStderr
+// rather than assuming a terminal, since the shell may connect them to
+// other commands in a pipeline.
+//
+// Exec returns the context for the next command, the result of the
+// command and an error if it failed. The exit status of the command is
+// the code of the result, or the status of the error when the code is 0.
+//
+// The context of Exec is cancelled when the user interrupts the command
+// or its timeout expires. A command should then stop its work and
+// return promptly, with the error of the context; the shell waits for
+// Exec to return.
 type Command interface {
 	Name() string
 	Usage() string
 	ShortDesc() string
 	LongDesc() string
-	Exec(context.Context, []string) (context.Context, error)
+	Exec(context.Context, []string) (context.Context, Result, error)
 }
 
 // Commands a plugin that contains one or more command
@@ -21,3 +38,50 @@ type Commands interface {
 	Module
 	Registry() map[string]Command
 }
+
+// Completer is an optional interface implemented by commands
+// that can complete their arguments. Args holds the words of the
+// command line (args[0] is the command name) and cursorPos is the
+// index of the word being completed. It returns the candidates
+// that may replace args[cursorPos].
+type Completer interface {
+	Complete(ctx context.Context, args []string, cursorPos int) []string
+}
+
+// Closer is an optional interface implemented by a Commands module
+// that needs to release resources when the shell exits
+type Closer interface {
+	Close(context.Context) error
+}
+
+// Example is an example command line of a command with what it does
+type Example struct {
+	Command string `json:"command"`
+	Desc    string `json:"desc,omitempty"`
+}
+
+// Describer is an optional interface implemented by commands that give
+// more metadata to the help of the shell: the category they are listed
+// under, in place of the plugin that provides them, and examples of
+// their use, listed by help <command>.
+type Describer interface {
+	Category() string
+	Examples() []Example
+}
+
+// Restricted is an optional interface implemented by commands that only
+// users with one of their roles may run. The roles of the users are set
+// in the configuration of the shell; users of SSH sessions are the SSH
+// users.
+type Restricted interface {
+	Roles() []string
+}
+
+// Cacheable is an optional interface implemented by read-only commands,
+// such as listings of cloud resources, whose output only depends on
+// their name and arguments. The shell serves the output of a successful
+// run to the runs with the same arguments for CacheTTL, unless caching
+// is turned off with the cache builtin; 0 disables caching.
+type Cacheable interface {
+	CacheTTL() time.Duration
+}
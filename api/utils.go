@@ -12,28 +12,64 @@ const (
 	DefaultPrompt = "gosh>"
 )
 
+// APIVersion is the version of the plugin API provided by the shell,
+// whose minor number grows with additions to the API and major number
+// with changes breaking the plugins. The manifest of a plugin may
+// require a minimum version.
+const APIVersion = "1.1"
+
+// VersionSymbolName is the symbol a Go plugin exports to tell the shell
+// the version of the plugin API it was built against:
+//
+//	var APIVersion = api.APIVersion
+//
+// The shell refuses plugins built against another major version, or a
+// newer minor version, than its own, and warns about plugins that do not
+// export the symbol.
+const VersionSymbolName = "APIVersion"
+
+// GetStdout returns the writer a command should send its output to.
+// It defaults to os.Stdout.
 func GetStdout(ctx context.Context) io.Writer {
-	var out io.Writer = os.Stdout
-	if ctx == nil {
+	if out := GetSession(ctx).Stdout; out != nil {
 		return out
 	}
-	if outVal := ctx.Value("gosh.stdout"); outVal != nil {
-		if stdout, ok := outVal.(io.Writer); ok {
-			out = stdout
-		}
-	}
-	return out
+	return os.Stdout
 }
 
+// GetPrompt returns the current shell prompt
 func GetPrompt(ctx context.Context) string {
-	prompt := DefaultPrompt
-	if ctx == nil {
+	if prompt := GetSession(ctx).Prompt; prompt != "" {
 		return prompt
 	}
-	if promptVal := ctx.Value("gosh.prompt"); promptVal != nil {
-		if p, ok := promptVal.(string); ok {
-			prompt = p
-		}
+	return DefaultPrompt
+}
+
+// GetStderr returns the writer a command should send errors to.
+// It defaults to os.Stderr.
+func GetStderr(ctx context.Context) io.Writer {
+	if out := GetSession(ctx).Stderr; out != nil {
+		return out
+	}
+	return os.Stderr
+}
+
+// GetStdin returns the reader a command should read its input from.
+// It defaults to os.Stdin.
+func GetStdin(ctx context.Context) io.Reader {
+	if in := GetSession(ctx).Stdin; in != nil {
+		return in
+	}
+	return os.Stdin
+}
+
+// GetWorkDir returns the working directory of the shell, which commands
+// should resolve relative paths against. It defaults to the working
+// directory of the process.
+func GetWorkDir(ctx context.Context) string {
+	if dir := GetSession(ctx).WorkDir; dir != "" {
+		return dir
 	}
-	return prompt
+	dir, _ := os.Getwd()
+	return dir
 }
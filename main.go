@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+	"github.com/vladimirvivien/gosh/api/output"
+	"github.com/vladimirvivien/gosh/pkg/shell"
+)
+
+// shutdownTimeout bounds the time plugins get to shut down
+const shutdownTimeout = 5 * time.Second
+
+func main() {
+	command := flag.String("c", "", "run a command line and exit with its status")
+	keepGoing := flag.Bool("continue-on-error", false, "keep running a script after a command fails")
+	noSplash := flag.Bool("no-splash", false, "do not show the splash screen on startup")
+	debug := flag.Bool("debug", false, "print diagnostics such as plugin load timings")
+	logLevel := flag.String("log-level", "info", "level of the diagnostics logged: debug, info, warn or error")
+	logFile := flag.String("log-file", "", "file to append the diagnostics to instead of stderr")
+	allowUnsigned := flag.Bool("allow-unsigned", false, "load Go plugins without a valid signature")
+	outputFormat := flag.String("output", "", "output format of commands: text, json or yaml")
+	pluginsDir := flag.String("plugins-dir", "", "plugins search path, a "+string(filepath.ListSeparator)+
+		" separated list of directories (overrides "+shell.PluginsDirEnv+")")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [-c <command> | run <script> | new-plugin <name> | test [--update] <script> ... | serve [--ssh <addr>] [--http <addr>] [--tcp <addr>] [--api <addr>] [--metrics <addr>]]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// a script is run from a file with "gosh run <file>", from
+	// the command line with "gosh -c <command>", or read from
+	// stdin when it is not a terminal; "gosh serve" serves shell
+	// sessions instead, "gosh test" checks the transcripts of scripts
+	// and "gosh new-plugin" writes a plugin module
+	var script io.Reader
+	var serveArgs, testArgs []string
+	scriptName := "stdin"
+	switch args := flag.Args(); {
+	case *command != "" && len(args) > 0:
+		flag.Usage()
+		os.Exit(2)
+	case *command != "":
+		script, scriptName = strings.NewReader(*command), "-c"
+	case len(args) > 0 && args[0] == "serve":
+		serveArgs = args[1:]
+	case len(args) > 0 && args[0] == "test":
+		testArgs = args[1:]
+	case len(args) > 0 && args[0] == "new-plugin":
+		os.Exit(newPlugin(args[1:]))
+	case len(args) == 2 && args[0] == "run":
+		file, err := os.Open(args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		script, scriptName = file, args[1]
+	case len(args) > 0:
+		flag.Usage()
+		os.Exit(2)
+	case !isTerminal(os.Stdin):
+		script = os.Stdin
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg, err := shell.LoadConfig(shell.DefaultConfigPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+	}
+
+	ctx = api.WithStdout(ctx, os.Stdout)
+	ctx = api.WithStderr(ctx, os.Stderr)
+	ctx = api.WithStdin(ctx, os.Stdin)
+
+	// the flag takes precedence over the environment,
+	// which takes precedence over the config file
+	if dir := os.Getenv(shell.PluginsDirEnv); dir != "" {
+		cfg.PluginsDir = dir
+	}
+	if *pluginsDir != "" {
+		cfg.PluginsDir = *pluginsDir
+	}
+	if *allowUnsigned {
+		cfg.AllowUnsigned = true
+	}
+	if *outputFormat != "" {
+		cfg.Output = *outputFormat
+	}
+	if _, err := output.ParseFormat(cfg.Output); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if script != nil || testArgs != nil || *noSplash {
+		cfg.Splash = false
+	}
+
+	level, err := shell.ParseLogLevel(*logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	opts := []shell.Option{shell.WithConfig(cfg), shell.WithDebug(*debug), shell.WithLogLevel(level)}
+	if *logFile != "" {
+		file, err := os.OpenFile(*logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		if *debug {
+			level = slog.LevelDebug
+		}
+		opts = append(opts, shell.WithLogger(slog.New(slog.NewTextHandler(file, &slog.HandlerOptions{Level: level}))))
+	}
+	shutdownTracing, err := setupTracing(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to set up tracing: %v\n", err)
+	}
+	if serveArgs != nil {
+		status := serve(ctx, opts, serveArgs)
+		flushTraces(shutdownTracing)
+		os.Exit(status)
+	}
+	if testArgs != nil {
+		status := testTranscripts(ctx, opts, testArgs)
+		flushTraces(shutdownTracing)
+		os.Exit(status)
+	}
+	sh := shell.New(opts...)
+	status := 0
+	done := make(chan struct{})
+	if script != nil {
+		if err := sh.Init(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to initialize:", err)
+			os.Exit(1)
+		}
+		go func() {
+			status = sh.RunScript(script, scriptName, !*keepGoing)
+			close(done)
+		}()
+	} else {
+		go func() {
+			if err := sh.Run(ctx); err != nil {
+				fmt.Fprintln(os.Stderr, "failed to initialize:", err)
+				status = 1
+			} else {
+				status = sh.ExitStatus()
+			}
+			close(done)
+		}()
+	}
+
+	// Ctrl-C cancels the running command; when no command
+	// is running it closes the shell. SIGTERM and SIGHUP
+	// always close the shell.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+loop:
+	for {
+		select {
+		case sig := <-sigs:
+			if sig == syscall.SIGINT && sh.Interrupt() {
+				continue
+			}
+			cancel()
+			<-done
+			break loop
+		case <-done:
+			break loop
+		}
+	}
+
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer closeCancel()
+	if err := sh.Close(closeCtx); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+	flushTraces(shutdownTracing)
+	if status != 0 {
+		closeCancel()
+		cancel()
+		os.Exit(status)
+	}
+}
+
+// flushTraces exports the spans left before gosh exits
+func flushTraces(shutdown func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := shutdown(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to export traces: %v\n", err)
+	}
+}
+
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/vladimirvivien/gosh/pkg/shell"
+)
+
+// newPlugin runs "gosh new-plugin <name>", which writes a Go plugin
+// module providing the command name, ready to build, and returns the
+// exit status of gosh
+func newPlugin(args []string) int {
+	flags := flag.NewFlagSet("new-plugin", flag.ContinueOnError)
+	module := flags.String("module", "", "module path of the plugin (default example.com/<name>)")
+	dir := flags.String("dir", "", "directory to write the plugin module to (default <name>)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: gosh new-plugin [--module <path>] [--dir <dir>] <name>")
+		flags.PrintDefaults()
+		return 2
+	}
+	name := flags.Arg(0)
+	if *module == "" {
+		*module = "example.com/" + name
+	}
+	if *dir == "" {
+		*dir = name
+	}
+	paths, err := shell.ScaffoldPlugin(*dir, name, *module)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "new-plugin: %v\n", err)
+		return 1
+	}
+	for _, path := range paths {
+		fmt.Println("created", path)
+	}
+	fmt.Printf("run make in %s to build %s_command.so, and make install to copy it to the plugins directory\n", *dir, name)
+	return 0
+}
@@ -0,0 +1,209 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const aliasFileName = ".gosh_aliases"
+
+// reAliasParam matches the positional parameters of an alias value
+var reAliasParam = regexp.MustCompile(`\$([1-9]|@)`)
+
+// aliasTable maps alias names to the command lines they expand to.
+// Aliases are persisted to a file holding one alias command per line.
+type aliasTable struct {
+	mu      sync.RWMutex
+	path    string
+	aliases map[string]string
+}
+
+func newAliasTable(path string) *aliasTable {
+	return &aliasTable{path: path, aliases: make(map[string]string)}
+}
+
+// defaultAliasPath returns the location of the alias file
+// in the user's home directory
+func defaultAliasPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, aliasFileName)
+}
+
+// load reads the aliases saved in the alias file.
+// A missing file is not an error.
+func (t *aliasTable) load() error {
+	if t.path == "" {
+		return nil
+	}
+	file, err := os.Open(t.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		tokens, err := lex(scanner.Text())
+		if err != nil || len(tokens) != 2 || tokens[0].word.String() != "alias" {
+			continue
+		}
+		def := tokens[1].word.String()
+		if i := strings.Index(def, "="); i > 0 {
+			t.set(def[:i], def[i+1:])
+		}
+	}
+	return scanner.Err()
+}
+
+// save writes all aliases to the alias file
+func (t *aliasTable) save() error {
+	if t.path == "" {
+		return nil
+	}
+	var b strings.Builder
+	for _, name := range t.names() {
+		b.WriteString(t.define(name))
+		b.WriteString("\n")
+	}
+	return os.WriteFile(t.path, []byte(b.String()), 0600)
+}
+
+// define returns the alias command that defines the named alias
+func (t *aliasTable) define(name string) string {
+	value, _ := t.get(name)
+	return fmt.Sprintf("alias %s=%s", name, shellQuote(value))
+}
+
+func (t *aliasTable) get(name string) (string, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	val, ok := t.aliases[name]
+	return val, ok
+}
+
+func (t *aliasTable) set(name, value string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.aliases[name] = value
+}
+
+func (t *aliasTable) remove(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.aliases[name]
+	delete(t.aliases, name)
+	return ok
+}
+
+// names returns the sorted alias names
+func (t *aliasTable) names() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	names := make([]string, 0, len(t.aliases))
+	for name := range t.aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// expand replaces unquoted words in command position that name an
+// alias with the tokens of the alias value. An alias is not expanded
+// again within its own expansion. When the value refers to positional
+// parameters ($1 to $9, or $@ for all of them), the arguments following
+// the alias are substituted instead of being appended.
+func (t *aliasTable) expand(tokens []token) ([]token, error) {
+	return t.expandTokens(tokens, map[string]bool{})
+}
+
+func (t *aliasTable) expandTokens(tokens []token, seen map[string]bool) ([]token, error) {
+	var expanded []token
+	cmdPos := true
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		if tok.op != "" {
+			expanded = append(expanded, tok)
+			cmdPos = isPipeOp(tok.op) || isListOp(tok.op)
+			continue
+		}
+		if !cmdPos {
+			expanded = append(expanded, tok)
+			continue
+		}
+		cmdPos = false
+
+		name, ok := unquotedWord(tok.word)
+		value, isAlias := t.get(name)
+		if !ok || !isAlias || seen[name] {
+			expanded = append(expanded, tok)
+			continue
+		}
+		if reAliasParam.MatchString(value) {
+			var params []string
+			for i+1 < len(tokens) && tokens[i+1].op == "" {
+				i++
+				params = append(params, tokens[i].word.String())
+			}
+			value = substituteParams(value, params)
+		}
+		aliasTokens, err := lex(value)
+		if err != nil {
+			return nil, err
+		}
+		seen[name] = true
+		aliasTokens, err = t.expandTokens(aliasTokens, seen)
+		delete(seen, name)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, aliasTokens...)
+	}
+	return expanded, nil
+}
+
+// unquotedWord returns the text of w if no part of it is quoted
+func unquotedWord(w word) (string, bool) {
+	for _, part := range w {
+		if part.quote != unquoted {
+			return "", false
+		}
+	}
+	return w.String(), true
+}
+
+// substituteParams replaces the positional parameters in value with
+// the quoted params
+func substituteParams(value string, params []string) string {
+	return reAliasParam.ReplaceAllStringFunc(value, func(param string) string {
+		if param == "$@" {
+			quoted := make([]string, len(params))
+			for i, p := range params {
+				quoted[i] = shellQuote(p)
+			}
+			return strings.Join(quoted, " ")
+		}
+		n, _ := strconv.Atoi(param[1:])
+		if n > len(params) {
+			return ""
+		}
+		return shellQuote(params[n-1])
+	})
+}
+
+// shellQuote quotes s so that the lexer reads it back as a single word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,60 @@
+package shell
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAliasExpand(t *testing.T) {
+	aliases := newAliasTable("")
+	aliases.set("ll", "ls -l")
+	aliases.set("ls", "ls --color")
+	aliases.set("greet", "echo hello $1!")
+	aliases.set("all", "echo [$@]")
+
+	tests := []struct {
+		line   string
+		tokens []string
+	}{
+		{"ll /tmp", []string{"ls", "--color", "-l", "/tmp"}},
+		{"echo ll | ll", []string{"echo", "ll", "|", "ls", "--color", "-l"}},
+		{"'ll'", []string{"ll"}},
+		{"greet 'big world' && ll", []string{"echo", "hello", "big world!", "&&", "ls", "--color", "-l"}},
+		{"all a b", []string{"echo", "[a", "b]"}},
+	}
+	for _, test := range tests {
+		tokens, err := lex(test.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens, err = aliases.expand(tokens)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tokenStrings(tokens); !reflect.DeepEqual(got, test.tokens) {
+			t.Errorf("%s: expected %q, got %q", test.line, test.tokens, got)
+		}
+	}
+}
+
+func TestAliasPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), aliasFileName)
+	aliases := newAliasTable(path)
+	aliases.set("gs", "git status")
+	aliases.set("q", "echo 'it''s'")
+	if err := aliases.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newAliasTable(path)
+	if err := loaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"gs", "q"} {
+		expected, _ := aliases.get(name)
+		if got, _ := loaded.get(name); got != expected {
+			t.Errorf("alias %s: expected %q, got %q", name, expected, got)
+		}
+	}
+}
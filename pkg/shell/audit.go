@@ -0,0 +1,86 @@
+package shell
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+)
+
+// auditSyslog is the audit_log setting that sends the audit log to the
+// system logger
+const auditSyslog = "syslog"
+
+// auditEntry records a command line run by the shell
+type auditEntry struct {
+	Time       time.Time `json:"time"`
+	User       string    `json:"user"`
+	Session    string    `json:"session"`
+	Command    string    `json:"command"`
+	ExitCode   int       `json:"exit_code"`
+	DurationMS int64     `json:"duration_ms"`
+	Denied     bool      `json:"denied,omitempty"`
+}
+
+// auditLog writes the entries of the audit log, one JSON document per
+// line, to a file or the system logger. It is shared by the sessions
+// of a shell.
+type auditLog struct {
+	mu sync.Mutex
+	w  io.WriteCloser
+}
+
+// openAuditLog opens the audit log set by the audit_log setting: the
+// system logger for "syslog", or else the file at dest, which entries
+// are appended to
+func openAuditLog(dest string) (*auditLog, error) {
+	if dest == auditSyslog {
+		w, err := openSyslog()
+		if err != nil {
+			return nil, err
+		}
+		return &auditLog{w: w}, nil
+	}
+	file, err := os.OpenFile(dest, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &auditLog{w: file}, nil
+}
+
+// record writes an entry to the log
+func (l *auditLog) record(entry auditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(append(data, '\n'))
+	return err
+}
+
+func (l *auditLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Close()
+}
+
+// currentUser returns the name of the user running the shell
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// newSessionID returns a random identifier for a shell session
+func newSessionID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
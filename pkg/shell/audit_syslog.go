@@ -0,0 +1,14 @@
+//go:build !windows
+
+package shell
+
+import (
+	"io"
+	"log/syslog"
+)
+
+// openSyslog connects to the system logger, which audit entries are
+// sent to with the informational priority of the auth facility
+func openSyslog() (io.WriteCloser, error) {
+	return syslog.New(syslog.LOG_INFO|syslog.LOG_AUTH, "gosh")
+}
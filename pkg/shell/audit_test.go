@@ -0,0 +1,70 @@
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestShellAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, err := openAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	shell.audit = audit
+	shell.user = "alice"
+	shell.Register("fail", rpcTestCmd{"fail", func(ctx context.Context, args []string) error {
+		return errors.New("failed")
+	}})
+	if err := shell.Init(api.WithStdout(context.TODO(), bytes.NewBufferString(""))); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := api.WithStderr(shell.ctx, bytes.NewBufferString(""))
+	shell.Eval(ctx, "set output text")
+	shell.Eval(ctx, "  ")
+	session := shell.NewSession()
+	session.Eval(ctx, "fail now")
+	if err := shell.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var entries []auditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("invalid entry %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", entries)
+	}
+	if e := entries[0]; e.Command != "set output text" || e.ExitCode != 0 || e.User != "alice" || e.Session != shell.sessionID || e.Time.IsZero() {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if e := entries[1]; e.Command != "fail now" || e.ExitCode != 1 || e.User != "alice" || e.Session != session.sessionID {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if shell.sessionID == session.sessionID {
+		t.Errorf("expected the session to have its own id")
+	}
+}
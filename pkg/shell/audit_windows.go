@@ -0,0 +1,11 @@
+package shell
+
+import (
+	"errors"
+	"io"
+)
+
+// openSyslog fails: Windows has no system logger for the audit log
+func openSyslog() (io.WriteCloser, error) {
+	return nil, errors.New("syslog is not supported on Windows")
+}
@@ -0,0 +1,65 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// deniedStatus is the exit status of a command the user may not run,
+// the status of a command found but not executable
+const deniedStatus = 126
+
+// permissionError is the error of a command the user lacks the roles
+// to run
+type permissionError struct {
+	cmd   string
+	user  string
+	roles []string
+}
+
+func (e *permissionError) Error() string {
+	return fmt.Sprintf("%s: permission denied: %s lacks the role %s", e.cmd, e.user, strings.Join(e.roles, " or "))
+}
+
+// ExitCode returns 126, the status of a command that cannot be run
+func (e *permissionError) ExitCode() int { return deniedStatus }
+
+// authorize checks that the user of the shell has one of the roles
+// required by the command, if it requires any. A denied command is
+// recorded in the audit log.
+func (gosh *Goshell) authorize(ctx context.Context, args []string, cmd api.Command) error {
+	restricted, ok := cmd.(api.Restricted)
+	if !ok || len(restricted.Roles()) == 0 {
+		return nil
+	}
+	for _, role := range restricted.Roles() {
+		if gosh.hasRole(role) {
+			return nil
+		}
+	}
+	err := &permissionError{cmd: args[0], user: gosh.user, roles: restricted.Roles()}
+	gosh.recordAudit(ctx, auditEntry{
+		Time:     time.Now(),
+		User:     gosh.user,
+		Session:  gosh.sessionID,
+		Command:  strings.Join(args, " "),
+		ExitCode: deniedStatus,
+		Denied:   true,
+	})
+	return err
+}
+
+// hasRole reports whether the roles of the configuration give role to
+// the user of the shell
+func (gosh *Goshell) hasRole(role string) bool {
+	for _, r := range gosh.roles[gosh.user] {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
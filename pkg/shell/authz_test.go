@@ -0,0 +1,85 @@
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// restrictedCmd is a command requiring roles
+type restrictedCmd struct {
+	rpcTestCmd
+	roles []string
+}
+
+func (c restrictedCmd) Roles() []string { return c.roles }
+
+func TestShellAuthorize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	audit, err := openAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	shell.audit = audit
+	shell.roles = map[string][]string{"alice": {"ops"}}
+	ran := 0
+	shell.Register("deploy", restrictedCmd{rpcTestCmd{"deploy", func(ctx context.Context, args []string) error {
+		ran++
+		return nil
+	}}, []string{"admin", "ops"}})
+	if err := shell.Init(api.WithStdout(context.TODO(), bytes.NewBufferString(""))); err != nil {
+		t.Fatal(err)
+	}
+
+	shell.user = "bob"
+	for _, line := range []string{"deploy prod", "set output text | deploy prod", "timeout 5 deploy prod", "env X=1 deploy prod"} {
+		_, err := shell.Eval(shell.ctx, line)
+		if api.ExitStatus(err) != deniedStatus || !strings.Contains(err.Error(), "deploy: permission denied: bob lacks the role admin or ops") {
+			t.Errorf("%s: expected a permission error, got %v", line, err)
+		}
+	}
+	shell.user = "alice"
+	if _, err := shell.Eval(shell.ctx, "deploy prod"); err != nil {
+		t.Errorf("expected alice to be authorized: %v", err)
+	}
+	if ran != 1 {
+		t.Errorf("expected deploy to run once, ran %d times", ran)
+	}
+	if err := shell.Close(shell.ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	denied := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Denied {
+			denied++
+			if entry.Command != "deploy prod" || entry.User != "bob" || entry.ExitCode != deniedStatus {
+				t.Errorf("unexpected denied entry %+v", entry)
+			}
+		}
+	}
+	if denied != 4 {
+		t.Errorf("expected 4 denied entries, got %d", denied)
+	}
+}
@@ -0,0 +1,54 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vladimirvivien/gosh/api"
+	"github.com/vladimirvivien/gosh/api/style"
+)
+
+// logo is the splash screen shown when no banner is configured
+const logo = `	
+                        888      
+                        888      
+                        888      
+ .d88b.  .d88b. .d8888b 88888b.  
+d88P"88bd88""88b88K     888 "88b 
+888  888888  888"Y8888b.888  888 
+Y88b 888Y88..88P     X88888  888 
+ "Y88888 "Y88P"  88888P'888  888 
+     888                         
+Y8b d88P                         
+ "Y88P"
+ 
+ `
+
+// printSplash prints the splash screen to the stdout of ctx: the banner
+// of the configuration, rendered as a template like the prompt, or else
+// the banner of the first plugin in the search path that provides one,
+// or else the gosh logo
+func (gosh *Goshell) printSplash(ctx context.Context) {
+	out := api.GetStdout(ctx)
+	fmt.Fprintln(out, gosh.splashText(ctx, style.Enabled(out)))
+}
+
+func (gosh *Goshell) splashText(ctx context.Context, color bool) string {
+	if gosh.banner != "" {
+		return gosh.renderTemplate(ctx, gosh.banner, color)
+	}
+	for _, plug := range gosh.sortedPlugins() {
+		if plug.lazy {
+			if !plug.banner {
+				continue
+			}
+			if _, err := gosh.openLazy(plug); err != nil {
+				continue
+			}
+		}
+		if banner, ok := plug.module.(api.Banner); ok {
+			return banner.Banner(ctx)
+		}
+	}
+	return logo
+}
@@ -0,0 +1,37 @@
+package shell
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// bannerCmds is a plugin module that provides a banner
+type bannerCmds string
+
+func (b bannerCmds) Init(ctx context.Context) error    { return nil }
+func (b bannerCmds) Registry() map[string]api.Command  { return nil }
+func (b bannerCmds) Banner(ctx context.Context) string { return string(b) }
+
+func TestSplashText(t *testing.T) {
+	shell := newTestShell()
+	ctx := api.WithEnv(context.TODO(), api.NewEnv([]string{"USER=gopher"}))
+	if got := shell.splashText(ctx, false); got != logo {
+		t.Errorf("expected the logo, got %q", got)
+	}
+
+	shell.plugins["banner"] = &pluginFile{path: "banner_command.so", module: bannerCmds("welcome to ops")}
+	shell.plugins["seg"] = &pluginFile{path: "seg_command.so", module: segmentCmds{}}
+	if got := shell.splashText(ctx, false); got != "welcome to ops" {
+		t.Errorf("expected the banner of the plugin, got %q", got)
+	}
+
+	shell.banner = "{{color \"bold\"}}hello {{.User}}{{reset}}"
+	if got := shell.splashText(ctx, false); got != "hello gopher" {
+		t.Errorf("expected the banner of the configuration, got %q", got)
+	}
+	if got := shell.splashText(ctx, true); got != "\x1b[1mhello gopher\x1b[0m" {
+		t.Errorf("expected a colored banner, got %q", got)
+	}
+}
@@ -0,0 +1,622 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vladimirvivien/gosh/api"
+	"github.com/vladimirvivien/gosh/api/output"
+	"github.com/vladimirvivien/gosh/api/style"
+)
+
+// errExit is returned by the exit builtin to close the shell
+var errExit = errors.New("exit")
+
+// builtins returns the commands compiled into the shell.
+// Commands loaded from plugins take precedence over them.
+func (gosh *Goshell) builtins() map[string]api.Command {
+	return map[string]api.Command{
+		"help":     helpCmd{gosh},
+		"man":      manCmd{gosh},
+		"exit":     exitCmd("exit"),
+		"cd":       cdCmd("cd"),
+		"pwd":      pwdCmd("pwd"),
+		"pushd":    pushdCmd{gosh.dirs},
+		"popd":     popdCmd{gosh.dirs},
+		"dirs":     dirsCmd{gosh.dirs},
+		"history":  historyCmd{gosh.history},
+		"alias":    aliasCmd{gosh.aliases},
+		"unalias":  unaliasCmd{gosh.aliases},
+		"env":      envCmd{gosh},
+		"clear":    clearCmd("clear"),
+		"reload":   reloadCmd{gosh},
+		"plugin":   pluginCmd{gosh},
+		"export":   exportCmd("export"),
+		"unset":    unsetCmd("unset"),
+		"vars":     varsCmd("vars"),
+		"set":      setCmd{gosh},
+		"timeout":  timeoutCmd{gosh},
+		"tee":      teeCmd("tee"),
+		"bindkey":  bindkeyCmd{gosh},
+		"palette":  paletteCmd{gosh},
+		"theme":    themeCmd("theme"),
+		"jobs":     jobsCmd{gosh.jobs},
+		"fg":       fgCmd{gosh.jobs},
+		"bg":       bgCmd{gosh.jobs},
+		"kill":     killCmd{gosh.jobs},
+		"schedule": scheduleCmd{gosh},
+		"watch":    watchCmd{gosh},
+		"parallel": parallelCmd{gosh},
+		"retry":    retryCmd{gosh},
+		"time":     timeCmd{gosh},
+		"cache":    cacheCmd{gosh},
+	}
+}
+
+// builtinsGroup and commandsGroup are the help groups of the builtins
+// and of the commands that come from no plugin
+const (
+	builtinsGroup = "builtins"
+	commandsGroup = "commands"
+)
+
+// helpCmd prints help information about the available commands, listed
+// by group, or about one of them
+type helpCmd struct {
+	gosh *Goshell
+}
+
+func (h helpCmd) Name() string     { return "help" }
+func (h helpCmd) Usage() string    { return "help [<command-name>]" }
+func (h helpCmd) LongDesc() string { return "" }
+func (h helpCmd) ShortDesc() string {
+	return `prints help information for other commands.`
+}
+func (h helpCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	out := api.Paged(ctx)
+	defer out.Close()
+	commands := api.GetCommands(ctx)
+	if commands == nil {
+		return ctx, api.Result{}, errors.New("no commands registered")
+	}
+
+	if len(args) > 1 {
+		cmd, found := commands[args[1]]
+		if !found {
+			return ctx, api.Result{}, fmt.Errorf("command %s not found", args[1])
+		}
+		printCommandHelp(out, args[1], cmd)
+		return ctx, api.Result{}, nil
+	}
+
+	groups := make(map[string][]string)
+	for name, cmd := range commands {
+		group := h.group(name, cmd)
+		groups[group] = append(groups[group], name)
+	}
+	order := make([]string, 0, len(groups))
+	for group := range groups {
+		order = append(order, group)
+	}
+	// the builtins come first, then the other groups by name
+	sort.Slice(order, func(i, j int) bool {
+		if (order[i] == builtinsGroup) != (order[j] == builtinsGroup) {
+			return order[i] == builtinsGroup
+		}
+		return order[i] < order[j]
+	})
+
+	// the headings and names are styled by the theme on terminals
+	theme, styled := currentTheme(), style.Enabled(api.GetStdout(ctx))
+	apply := func(s style.Style, text string) string {
+		if !styled {
+			return text
+		}
+		return s.Sprint(text)
+	}
+	fmt.Fprintf(out, "\n%s: %s\n", h.Name(), h.ShortDesc())
+	for _, group := range order {
+		names := groups[group]
+		sort.Strings(names)
+		fmt.Fprintf(out, "\n%s\n%s\n", apply(theme.heading, group), strings.Repeat("-", len(group)))
+		for _, name := range names {
+			fmt.Fprintf(out, "%s:\t%s\n", apply(theme.command, fmt.Sprintf("%12s", name)), commands[name].ShortDesc())
+		}
+	}
+	fmt.Fprint(out, "\nUse \"help <command-name>\" for detail about the specified command\n\n")
+	return ctx, api.Result{}, nil
+}
+
+// group returns the help group of a command: its category, when it has
+// one, or the plugin it comes from
+func (h helpCmd) group(name string, cmd api.Command) string {
+	if describer, ok := cmd.(api.Describer); ok && describer.Category() != "" {
+		return describer.Category()
+	}
+	if group, ok := h.gosh.commands.group(name); ok {
+		return group
+	}
+	return commandsGroup
+}
+
+// Complete completes the command name argument of help
+func (h helpCmd) Complete(ctx context.Context, args []string, cursorPos int) []string {
+	return completeCommandName(ctx, args, cursorPos)
+}
+
+// completeCommandName completes the command name argument of help and
+// man
+func completeCommandName(ctx context.Context, args []string, cursorPos int) []string {
+	if cursorPos != 1 {
+		return nil
+	}
+	var names []string
+	for name := range api.GetCommands(ctx) {
+		if strings.HasPrefix(name, args[cursorPos]) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// printCommandHelp prints the usage, flags, descriptions and examples
+// of a command
+func printCommandHelp(out io.Writer, name string, cmd api.Command) {
+	fmt.Fprintf(out, "\n%s\n", name)
+	fmt.Fprint(out, api.FormatUsage(cmd))
+	if cmd.ShortDesc() != "" {
+		fmt.Fprintf(out, "  %s\n\n", cmd.ShortDesc())
+	}
+	if cmd.LongDesc() != "" {
+		fmt.Fprintf(out, "%s\n\n", cmd.LongDesc())
+	}
+	describer, ok := cmd.(api.Describer)
+	if !ok || len(describer.Examples()) == 0 {
+		return
+	}
+	fmt.Fprintln(out, "  Examples:")
+	for _, example := range describer.Examples() {
+		fmt.Fprintf(out, "    %s\n", example.Command)
+		if example.Desc != "" {
+			fmt.Fprintf(out, "        %s\n", example.Desc)
+		}
+	}
+	fmt.Fprintln(out)
+}
+
+// exitCmd exits the shell with the status of its result
+type exitCmd string
+
+func (c exitCmd) Name() string  { return string(c) }
+func (c exitCmd) Usage() string { return "exit [code]" }
+func (c exitCmd) LongDesc() string {
+	return `The shell exits with the given code, or with the status of the last
+command when there is none. Before exiting, the background jobs are
+cancelled, the plugins are closed and the history is saved.`
+}
+func (c exitCmd) ShortDesc() string { return `exits the shell` }
+func (c exitCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	switch len(args) {
+	case 1:
+		return ctx, api.Result{Code: api.GetLastResult(ctx).Code}, errExit
+	case 2:
+		code, err := strconv.Atoi(args[1])
+		if err != nil || code < 0 || code > 255 {
+			return ctx, api.Result{}, api.NewUsageError("invalid code: %s", args[1])
+		}
+		return ctx, api.Result{Code: code}, errExit
+	}
+	return ctx, api.Result{}, api.NewUsageError("too many arguments")
+}
+
+// historyCmd prints the command history
+type historyCmd struct {
+	history *history
+}
+
+func (c historyCmd) Name() string      { return "history" }
+func (c historyCmd) Usage() string     { return "history" }
+func (c historyCmd) LongDesc() string  { return "" }
+func (c historyCmd) ShortDesc() string { return `prints the command history` }
+func (c historyCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	out := api.Paged(ctx)
+	defer out.Close()
+	for i := 0; i < c.history.len(); i++ {
+		fmt.Fprintf(out, "%5d  %s\n", i+1, c.history.get(i))
+	}
+	return ctx, api.Result{}, nil
+}
+
+// aliasCmd defines aliases or lists them
+type aliasCmd struct {
+	aliases *aliasTable
+}
+
+func (c aliasCmd) Name() string  { return "alias" }
+func (c aliasCmd) Usage() string { return "alias [name[=value] ...]" }
+func (c aliasCmd) LongDesc() string {
+	return `An alias replaces the command name it defines with its value. When the value
+refers to positional parameters ($1 to $9, or $@ for all of them), the
+arguments are substituted into the value, e.g. alias greet='echo hello $1!'.
+Aliases are saved and restored across sessions.`
+}
+func (c aliasCmd) ShortDesc() string {
+	return `defines aliases, or lists them when called without arguments`
+}
+func (c aliasCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	out := api.Paged(ctx)
+	defer out.Close()
+	if len(args) == 1 {
+		for _, name := range c.aliases.names() {
+			fmt.Fprintln(out, c.aliases.define(name))
+		}
+		return ctx, api.Result{}, nil
+	}
+	changed := false
+	for _, arg := range args[1:] {
+		i := strings.Index(arg, "=")
+		if i <= 0 {
+			if _, ok := c.aliases.get(arg); !ok {
+				return ctx, api.Result{}, fmt.Errorf("alias: %s not found", arg)
+			}
+			fmt.Fprintln(out, c.aliases.define(arg))
+			continue
+		}
+		c.aliases.set(arg[:i], arg[i+1:])
+		changed = true
+	}
+	if changed {
+		return ctx, api.Result{}, c.aliases.save()
+	}
+	return ctx, api.Result{}, nil
+}
+
+// unaliasCmd removes aliases
+type unaliasCmd struct {
+	aliases *aliasTable
+}
+
+func (c unaliasCmd) Name() string      { return "unalias" }
+func (c unaliasCmd) Usage() string     { return "unalias name [name ...]" }
+func (c unaliasCmd) LongDesc() string  { return "" }
+func (c unaliasCmd) ShortDesc() string { return `removes aliases` }
+func (c unaliasCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	if len(args) < 2 {
+		return ctx, api.Result{}, api.NewUsageError("missing alias name")
+	}
+	for _, name := range args[1:] {
+		if !c.aliases.remove(name) {
+			return ctx, api.Result{}, fmt.Errorf("unalias: %s not found", name)
+		}
+	}
+	return ctx, api.Result{}, c.aliases.save()
+}
+
+// envCmd prints the environment, or runs a command with
+// additional environment variables
+type envCmd struct {
+	gosh *Goshell
+}
+
+func (c envCmd) Name() string     { return "env" }
+func (c envCmd) Usage() string    { return "env [name=value ...] [command [args ...]]" }
+func (c envCmd) LongDesc() string { return "" }
+func (c envCmd) ShortDesc() string {
+	return `prints the environment or runs a command in a modified environment`
+}
+func (c envCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	env := api.GetEnv(ctx)
+	if env == nil {
+		env = c.gosh.env
+	}
+	env = env.Clone()
+
+	args = args[1:]
+	for len(args) > 0 {
+		i := strings.Index(args[0], "=")
+		if i <= 0 {
+			break
+		}
+		env.Set(args[0][:i], args[0][i+1:])
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		out := api.Paged(ctx)
+		defer out.Close()
+		for _, kv := range env.Environ() {
+			fmt.Fprintln(out, kv)
+		}
+		return ctx, api.Result{}, nil
+	}
+
+	stage, err := c.gosh.commandStage(ctx, args)
+	if err != nil {
+		return ctx, api.Result{}, err
+	}
+	_, res, err := stage.exec(api.WithEnv(ctx, env))
+	return ctx, rendered(res), err
+}
+
+// clearCmd clears the terminal screen
+type clearCmd string
+
+func (c clearCmd) Name() string      { return string(c) }
+func (c clearCmd) Usage() string     { return "clear" }
+func (c clearCmd) LongDesc() string  { return "" }
+func (c clearCmd) ShortDesc() string { return `clears the terminal screen` }
+func (c clearCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	fmt.Fprint(api.GetStdout(ctx), "\x1b[H\x1b[2J")
+	return ctx, api.Result{}, nil
+}
+
+// exportCmd sets environment variables or lists them
+type exportCmd string
+
+func (c exportCmd) Name() string     { return string(c) }
+func (c exportCmd) Usage() string    { return "export [name[=value] ...]" }
+func (c exportCmd) LongDesc() string { return "" }
+func (c exportCmd) ShortDesc() string {
+	return `exports variables to external processes, or lists them when called without arguments`
+}
+func (c exportCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	env := api.GetEnv(ctx)
+	if env == nil {
+		return ctx, api.Result{}, errors.New("no shell environment")
+	}
+	if len(args) == 1 {
+		out := api.Paged(ctx)
+		defer out.Close()
+		for _, kv := range env.Environ() {
+			fmt.Fprintln(out, kv)
+		}
+		return ctx, api.Result{}, nil
+	}
+	for _, arg := range args[1:] {
+		i := strings.Index(arg, "=")
+		switch {
+		case i < 0 && isName(arg):
+			env.Export(arg)
+		case i > 0 && isName(arg[:i]):
+			env.Set(arg[:i], arg[i+1:])
+		default:
+			return ctx, api.Result{}, fmt.Errorf("export: invalid assignment: %s", arg)
+		}
+	}
+	return ctx, api.Result{}, nil
+}
+
+// unsetCmd removes environment variables
+type unsetCmd string
+
+func (c unsetCmd) Name() string      { return string(c) }
+func (c unsetCmd) Usage() string     { return "unset name [name ...]" }
+func (c unsetCmd) LongDesc() string  { return "" }
+func (c unsetCmd) ShortDesc() string { return `removes environment variables` }
+func (c unsetCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	env := api.GetEnv(ctx)
+	if env == nil {
+		return ctx, api.Result{}, errors.New("no shell environment")
+	}
+	if len(args) < 2 {
+		return ctx, api.Result{}, api.NewUsageError("missing variable name")
+	}
+	for _, name := range args[1:] {
+		env.Unset(name)
+	}
+	return ctx, api.Result{}, nil
+}
+
+// setCmd changes shell settings or lists them
+type setCmd struct {
+	gosh *Goshell
+}
+
+func (c setCmd) Name() string  { return "set" }
+func (c setCmd) Usage() string { return "set [-x | +x | <setting> [<value>]]" }
+func (c setCmd) LongDesc() string {
+	return `The output setting selects how commands that return structured output,
+such as plugin list, render it: as aligned text, or as JSON or YAML
+documents that other tools can read. The editing-mode setting selects
+the default key bindings of the line editor. The command-timeout
+setting, a duration such as 30s, cancels the commands run in the
+foreground that take longer; 0 lets them run. The slow-command setting,
+a duration too, reports on stderr the pipelines that run for that long
+or longer, whatever their commands; 0 turns it off. The noglob setting,
+on or off, leaves the patterns of the arguments, such as *.go,
+unexpanded; set noglob alone turns it on. The complete-hidden setting,
+on or off, completes the paths of hidden files without a leading dot.
+The xtrace setting, on or off, writes each command line to stderr
+before it runs, once expanded, with where its command comes from, then
+its exit status and how long it ran; set -x turns it on and set +x off.`
+}
+func (c setCmd) ShortDesc() string {
+	return `changes shell settings, or lists them when called without arguments`
+}
+func (c setCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	settings := output.KeyValues{
+		{Key: "output", Value: output.GetFormat(ctx).String()},
+		{Key: "editing-mode", Value: c.gosh.keymap.mode},
+		{Key: "command-timeout", Value: c.gosh.commandTimeout.String()},
+		{Key: "slow-command", Value: c.gosh.slowCommand.String()},
+		{Key: "noglob", Value: formatSwitch(c.gosh.noglob)},
+		{Key: "complete-hidden", Value: formatSwitch(c.gosh.completeHidden)},
+		{Key: "xtrace", Value: formatSwitch(c.gosh.xtrace)},
+	}
+	if len(args) == 2 {
+		switch args[1] {
+		case "noglob", "xtrace":
+			args = append(args, "on")
+		case "-x":
+			args = []string{args[0], "xtrace", "on"}
+		case "+x":
+			args = []string{args[0], "xtrace", "off"}
+		}
+	}
+	switch len(args) {
+	case 1:
+		return ctx, api.Result{Data: settings}, nil
+	case 2:
+		for _, setting := range settings {
+			if setting.Key == args[1] {
+				return ctx, api.Result{Data: output.KeyValues{setting}}, nil
+			}
+		}
+		return ctx, api.Result{}, fmt.Errorf("set: unknown setting %q", args[1])
+	case 3:
+	default:
+		return ctx, api.Result{}, api.NewUsageError("expected a setting and its value")
+	}
+	switch args[1] {
+	case "output":
+		format, err := output.ParseFormat(args[2])
+		if err != nil {
+			return ctx, api.Result{}, fmt.Errorf("set: %w", err)
+		}
+		return output.WithFormat(ctx, format), api.Result{}, nil
+	case "editing-mode":
+		keys, err := newKeymap(args[2])
+		if err != nil {
+			return ctx, api.Result{}, fmt.Errorf("set: %w", err)
+		}
+		c.gosh.keymap = keys
+		return ctx, api.Result{}, nil
+	case "command-timeout":
+		timeout, err := parseTimeout(args[2])
+		if err != nil {
+			return ctx, api.Result{}, fmt.Errorf("set: %w", err)
+		}
+		c.gosh.commandTimeout = timeout
+		return ctx, api.Result{}, nil
+	case "slow-command":
+		threshold, err := parseTimeout(args[2])
+		if err != nil {
+			return ctx, api.Result{}, fmt.Errorf("set: %w", err)
+		}
+		c.gosh.slowCommand = threshold
+		return ctx, api.Result{}, nil
+	case "noglob":
+		noglob, err := parseSwitch(args[2])
+		if err != nil {
+			return ctx, api.Result{}, fmt.Errorf("set: %w", err)
+		}
+		c.gosh.noglob = noglob
+		return ctx, api.Result{}, nil
+	case "complete-hidden":
+		hidden, err := parseSwitch(args[2])
+		if err != nil {
+			return ctx, api.Result{}, fmt.Errorf("set: %w", err)
+		}
+		c.gosh.completeHidden = hidden
+		return ctx, api.Result{}, nil
+	case "xtrace":
+		xtrace, err := parseSwitch(args[2])
+		if err != nil {
+			return ctx, api.Result{}, fmt.Errorf("set: %w", err)
+		}
+		c.gosh.xtrace = xtrace
+		return ctx, api.Result{}, nil
+	}
+	return ctx, api.Result{}, fmt.Errorf("set: unknown setting %q", args[1])
+}
+
+// parseSwitch parses the value of a setting that is on or off
+func parseSwitch(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "on", "true", "1":
+		return true, nil
+	case "off", "false", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid value %q, expected on or off", s)
+}
+
+// formatSwitch formats the value of a setting that is on or off
+func formatSwitch(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
+
+// bindkeyCmd lists or changes the key bindings of the line editor
+type bindkeyCmd struct {
+	gosh *Goshell
+}
+
+func (c bindkeyCmd) Name() string  { return "bindkey" }
+func (c bindkeyCmd) Usage() string { return "bindkey [-e | -v | -l | -r <keys> | <keys> [<action>]]" }
+func (c bindkeyCmd) LongDesc() string {
+	return `Keys are written in readline notation: \C-a for Control-a, \M-b or \eb
+for Meta-b, and \e for Escape, as in bindkey '\C-t' kill-word. Without
+arguments the bindings are listed; with keys alone their binding is
+shown. -r removes a binding, -l lists the editing actions, and -e and
+-v restore the default emacs and vi bindings. In vi mode the bindings
+apply to the insert mode. Bindings last for the session; the
+keybindings table of the configuration file sets them at startup.`
+}
+func (c bindkeyCmd) ShortDesc() string { return `lists or changes the key bindings of the line editor` }
+func (c bindkeyCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	keys := c.gosh.keymap
+	switch {
+	case len(args) == 1:
+		var bindings output.KeyValues
+		for _, b := range keys.list() {
+			bindings = append(bindings, output.KeyValue{Key: b[0], Value: b[1]})
+		}
+		return ctx, api.Result{Data: bindings}, nil
+	case len(args) == 2 && args[1] == "-l":
+		names := make([]string, 0, len(editActions))
+		for name := range editActions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintln(api.GetStdout(ctx), strings.Join(names, "\n"))
+	case len(args) == 2 && args[1] == "-e":
+		c.gosh.keymap, _ = newKeymap("emacs")
+	case len(args) == 2 && args[1] == "-v":
+		c.gosh.keymap, _ = newKeymap("vi")
+	case len(args) == 3 && args[1] == "-r":
+		if err := keys.unbind(args[2]); err != nil {
+			return ctx, api.Result{}, fmt.Errorf("bindkey: %w", err)
+		}
+	case len(args) == 2:
+		seq, err := parseKeySeq(args[1])
+		if err != nil {
+			return ctx, api.Result{}, fmt.Errorf("bindkey: %w", err)
+		}
+		action, ok := keys.lookup(seq)
+		switch r := []rune(seq); {
+		case !ok && len(r) == 1 && r[0] >= ' ':
+			action = "self-insert"
+		case !ok:
+			return ctx, api.Result{}, fmt.Errorf("bindkey: %s is not bound", formatKeySeq(seq))
+		}
+		return ctx, api.Result{Data: output.KeyValues{{Key: formatKeySeq(seq), Value: action}}}, nil
+	case len(args) == 3:
+		if err := keys.bind(args[1], args[2]); err != nil {
+			return ctx, api.Result{}, fmt.Errorf("bindkey: %w", err)
+		}
+	default:
+		return ctx, api.Result{}, api.NewUsageError("expected keys and an action")
+	}
+	return ctx, api.Result{}, nil
+}
+
+// nopCmd does nothing. It runs in place of a command whose words all
+// expand to nothing, such as $(true), so that its redirections apply.
+type nopCmd struct{}
+
+func (nopCmd) Name() string      { return "" }
+func (nopCmd) Usage() string     { return "" }
+func (nopCmd) LongDesc() string  { return "" }
+func (nopCmd) ShortDesc() string { return "" }
+func (nopCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	return ctx, api.Result{}, nil
+}
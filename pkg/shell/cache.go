@@ -0,0 +1,342 @@
+package shell
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+	"github.com/vladimirvivien/gosh/api/output"
+)
+
+// defaultCacheDir returns the directory of the results cached on disk
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gosh", "results")
+}
+
+// resultCache holds the output of the successful runs of api.Cacheable
+// commands, by output format and arguments, until their TTL expires.
+// The entries are kept in memory and, when the cache has a directory,
+// in a file each, so that later sessions use them as well.
+type resultCache struct {
+	mu      sync.Mutex
+	dir     string
+	off     bool
+	entries map[string]*cacheEntry
+	hits    int
+	misses  int
+}
+
+// cacheEntry is the output of a run of a cacheable command
+type cacheEntry struct {
+	Key     string    `json:"key"`
+	Line    string    `json:"line"`
+	Output  []byte    `json:"output"`
+	Expires time.Time `json:"expires"`
+
+	// data is the structured result of the run, only kept in memory
+	data interface{}
+}
+
+func newResultCache(dir string) *resultCache {
+	return &resultCache{dir: dir, entries: make(map[string]*cacheEntry)}
+}
+
+// cacheKey returns the key of the output of a command run with args in
+// the output format of ctx
+func cacheKey(ctx context.Context, args []string) string {
+	return output.GetFormat(ctx).String() + "\x00" + strings.Join(args, "\x00")
+}
+
+// enabled reports whether the cache is on
+func (c *resultCache) enabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.off
+}
+
+// setEnabled turns the cache on or off. The entries are kept.
+func (c *resultCache) setEnabled(on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.off = !on
+}
+
+// get returns the entry of key, if it has not expired
+func (c *resultCache) get(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok && c.dir != "" {
+		entry, ok = c.load(c.path(key))
+		ok = ok && entry.Key == key
+	}
+	if ok && time.Now().After(entry.Expires) {
+		c.drop(entry)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.entries[key] = entry
+	c.hits++
+	return entry, true
+}
+
+// put stores entry, in its file as well when the cache has a directory
+func (c *resultCache) put(entry *cacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[entry.Key] = entry
+	if c.dir == "" {
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path(entry.Key), data, 0600)
+}
+
+// list returns the entries that have not expired, in memory or on
+// disk, ordered by command line
+func (c *resultCache) list() []*cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries := c.all()
+	list := make([]*cacheEntry, 0, len(entries))
+	for _, entry := range entries {
+		if time.Now().After(entry.Expires) {
+			c.drop(entry)
+			continue
+		}
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Line != list[j].Line {
+			return list[i].Line < list[j].Line
+		}
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
+
+// clear removes the entries of the command name, or all of them when
+// name is empty, and returns how many it removed
+func (c *resultCache) clear(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for _, entry := range c.all() {
+		args := strings.Split(entry.Key, "\x00")
+		if name == "" || len(args) > 1 && args[1] == name {
+			c.drop(entry)
+			removed++
+		}
+	}
+	return removed
+}
+
+// all returns the entries in memory and on disk by key
+func (c *resultCache) all() map[string]*cacheEntry {
+	entries := make(map[string]*cacheEntry, len(c.entries))
+	if c.dir != "" {
+		files, _ := filepath.Glob(filepath.Join(c.dir, "*.json"))
+		for _, file := range files {
+			if entry, ok := c.load(file); ok {
+				entries[entry.Key] = entry
+			}
+		}
+	}
+	for key, entry := range c.entries {
+		entries[key] = entry
+	}
+	return entries
+}
+
+// load reads the entry saved in file
+func (c *resultCache) load(file string) (*cacheEntry, bool) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+// drop removes entry from memory and from disk
+func (c *resultCache) drop(entry *cacheEntry) {
+	delete(c.entries, entry.Key)
+	if c.dir != "" {
+		os.Remove(c.path(entry.Key))
+	}
+}
+
+// path returns the file of the entry of key
+func (c *resultCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// cacheTTL returns how long the output of the stage stays in the cache,
+// or 0 when it is not cached
+func (stage pipeStage) cacheTTL() time.Duration {
+	cacheable, ok := stage.cmd.(api.Cacheable)
+	if !ok || stage.cache == nil || !stage.cache.enabled() {
+		return 0
+	}
+	return cacheable.CacheTTL()
+}
+
+// runCached runs the stage and renders its result, with the output of a
+// cacheable command served from the cache. The output of a run is
+// written once the command completes, and cached when it succeeded.
+func (stage pipeStage) runCached(ctx context.Context) (context.Context, api.Result, error) {
+	ttl := stage.cacheTTL()
+	if ttl <= 0 {
+		newCtx, res, err := stage.run(ctx)
+		res, err = render(ctx, res, err)
+		return newCtx, res, err
+	}
+	key := cacheKey(ctx, stage.args)
+	if entry, ok := stage.cache.get(key); ok {
+		if _, err := api.GetStdout(ctx).Write(entry.Output); err != nil {
+			return ctx, api.Result{Code: 1}, err
+		}
+		return ctx, api.Result{Data: entry.data}, nil
+	}
+
+	newCtx, res := ctx, api.Result{}
+	out, err := api.Capture(ctx, func(ctx context.Context) error {
+		var err error
+		newCtx, res, err = stage.run(ctx)
+		res, err = render(ctx, res, err)
+		return err
+	})
+	newCtx = withIOFrom(newCtx, ctx)
+	if _, werr := io.WriteString(api.GetStdout(ctx), out); werr != nil && err == nil {
+		return newCtx, api.Result{Code: 1}, werr
+	}
+	if err != nil || res.Code != 0 {
+		return newCtx, res, err
+	}
+	words := make([]string, len(stage.args))
+	for i, arg := range stage.args {
+		words[i] = quoteWord(arg)
+	}
+	entry := &cacheEntry{Key: key, Line: strings.Join(words, " "), Output: []byte(out), Expires: time.Now().Add(ttl), data: res.Data}
+	if err := stage.cache.put(entry); err != nil {
+		api.Logger(ctx).Warn("failed to cache the output of a command", "command", stage.args[0], "error", err)
+	}
+	return newCtx, res, nil
+}
+
+// cacheCmd shows and controls the cache of the results of cacheable
+// commands
+type cacheCmd struct {
+	gosh *Goshell
+}
+
+func (c cacheCmd) Name() string { return "cache" }
+func (c cacheCmd) Usage() string {
+	return "cache [status | list | on | off | clear [<command>]]"
+}
+func (c cacheCmd) LongDesc() string {
+	return `Read-only commands, such as listings of cloud resources, may declare
+that their output can be cached for some time. Their output is then
+served from the cache to the runs with the same arguments and output
+format, until it expires. status prints whether the cache is on, where
+it is kept and how often it was used; list prints the cached command
+lines with the time they expire. on and off turn the cache on and off
+for all sessions. clear invalidates the cached output of a command, or
+of all commands.`
+}
+func (c cacheCmd) ShortDesc() string { return `shows and controls the command result cache` }
+func (c cacheCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	cache := c.gosh.cache
+	switch {
+	case len(args) == 1 || args[1] == "status" && len(args) == 2:
+		return ctx, api.Result{Data: c.status()}, nil
+	case args[1] == "list" && len(args) == 2:
+		table := output.NewTable("COMMAND", "EXPIRES", "SIZE")
+		for _, entry := range cache.list() {
+			table.AddRow(entry.Line, entry.Expires.Format(time.Stamp), len(entry.Output))
+		}
+		return ctx, api.Result{Data: table}, nil
+	case (args[1] == "on" || args[1] == "off") && len(args) == 2:
+		cache.setEnabled(args[1] == "on")
+		return ctx, api.Result{}, nil
+	case args[1] == "clear" && len(args) <= 3:
+		name := ""
+		if len(args) == 3 {
+			name = args[2]
+		}
+		n := cache.clear(name)
+		fmt.Fprintf(api.GetStderr(ctx), "cleared %d cached results\n", n)
+		return ctx, api.Result{}, nil
+	}
+	return ctx, api.Result{}, api.NewUsageError("invalid subcommand %s", args[1])
+}
+
+func (c cacheCmd) status() output.KeyValues {
+	cache := c.gosh.cache
+	entries := len(cache.list())
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	dir := cache.dir
+	if dir == "" {
+		dir = "(memory)"
+	}
+	return output.KeyValues{
+		{Key: "cache", Value: formatSwitch(!cache.off)},
+		{Key: "dir", Value: dir},
+		{Key: "entries", Value: entries},
+		{Key: "hits", Value: cache.hits},
+		{Key: "misses", Value: cache.misses},
+	}
+}
+
+// Complete completes the subcommands and the commands to clear
+func (c cacheCmd) Complete(ctx context.Context, args []string, cursorPos int) []string {
+	var candidates []string
+	switch {
+	case cursorPos == 1:
+		candidates = []string{"clear", "list", "off", "on", "status"}
+	case cursorPos == 2 && args[1] == "clear":
+		for _, name := range c.gosh.commands.names() {
+			if cmd, ok := c.gosh.commands.Lookup(name); ok {
+				if _, ok := cmd.(api.Cacheable); ok {
+					candidates = append(candidates, name)
+				}
+			}
+		}
+	}
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, args[cursorPos]) {
+			matches = append(matches, candidate)
+		}
+	}
+	return matches
+}
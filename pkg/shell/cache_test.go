@@ -0,0 +1,96 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+type cachedCmd struct {
+	rpcTestCmd
+	ttl time.Duration
+}
+
+func (c cachedCmd) CacheTTL() time.Duration { return c.ttl }
+
+func TestShellCache(t *testing.T) {
+	dir := t.TempDir()
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	shell.cache = newResultCache(dir)
+	runs := 0
+	shell.Register("inventory", cachedCmd{rpcTestCmd{"inventory", func(ctx context.Context, args []string) error {
+		runs++
+		fmt.Fprintf(api.GetStdout(ctx), "%s: run %d\n", strings.Join(args[1:], " "), runs)
+		if len(args) > 1 && args[1] == "broken" {
+			return fmt.Errorf("unavailable")
+		}
+		return nil
+	}}, time.Hour})
+	shell.Register("uptime", cachedCmd{rpcTestCmd{"uptime", func(ctx context.Context, args []string) error {
+		runs++
+		fmt.Fprintf(api.GetStdout(ctx), "up %d\n", runs)
+		return nil
+	}}, time.Millisecond})
+	if err := shell.Init(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(line string) string {
+		t.Helper()
+		var out bytes.Buffer
+		ctx := api.WithStderr(api.WithStdout(shell.ctx, &out), &out)
+		shell.handle(ctx, line)
+		return out.String()
+	}
+	tests := []struct {
+		line, output string
+	}{
+		{"inventory eu", "eu: run 1\n"},
+		{"inventory eu", "eu: run 1\n"},
+		{"inventory us", "us: run 2\n"},
+		{"inventory broken", "broken: run 3\n"},
+		{"inventory broken", "broken: run 4\n"},
+		{"uptime", "up 5\n"},
+		{"cache clear inventory", "cleared 2 cached results\n"},
+		{"inventory eu", "eu: run 6\n"},
+		{"cache off", ""},
+		{"inventory eu", "eu: run 7\n"},
+		{"cache on", ""},
+		{"inventory eu", "eu: run 6\n"},
+	}
+	for _, test := range tests {
+		if out := run(test.line); out != test.output {
+			t.Errorf("%s: expected %q, got %q", test.line, test.output, out)
+		}
+	}
+	// the ttl of uptime has expired
+	time.Sleep(5 * time.Millisecond)
+	if out := run("uptime"); out != "up 8\n" {
+		t.Errorf("expected uptime to run again, got %q", out)
+	}
+
+	list := run("cache list")
+	if !strings.Contains(list, "inventory eu") || strings.Contains(list, "inventory us") {
+		t.Errorf("unexpected cache list:\n%s", list)
+	}
+
+	// another session reads the cache from disk
+	shell.cache = newResultCache(dir)
+	if out := run("inventory eu"); out != "eu: run 6\n" {
+		t.Errorf("expected the output cached on disk, got %q", out)
+	}
+	if out := run("cache clear"); !strings.HasPrefix(out, "cleared ") {
+		t.Errorf("unexpected clear output %q", out)
+	}
+	if entries := shell.cache.list(); len(entries) != 0 {
+		t.Errorf("expected an empty cache, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,65 @@
+package shell
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// completePath returns the paths starting with prefix, relative to the
+// working directory of ctx unless prefix is absolute or starts with ~/.
+// Directories end with a slash so that completion can go on inside
+// them. Hidden files are only completed when the completed name starts
+// with a dot or when hidden is set.
+func completePath(ctx context.Context, prefix string, hidden bool) []string {
+	dir, name := "", prefix
+	if i := strings.LastIndexByte(prefix, '/'); i >= 0 {
+		dir, name = prefix[:i+1], prefix[i+1:]
+	}
+	search := dir
+	switch {
+	case search == "":
+		search = "."
+	case search == "~/" || strings.HasPrefix(search, "~/"):
+		home, err := homeDir(ctx)
+		if err != nil || home == "" {
+			return nil
+		}
+		search = filepath.Join(home, search[2:])
+	}
+	if !filepath.IsAbs(search) {
+		search = filepath.Join(api.GetWorkDir(ctx), search)
+	}
+
+	entries, err := ioutil.ReadDir(search)
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), name) {
+			continue
+		}
+		if strings.HasPrefix(entry.Name(), ".") && !hidden && !strings.HasPrefix(name, ".") {
+			continue
+		}
+		path := dir + entry.Name()
+		if isDir(filepath.Join(search, entry.Name())) {
+			path += "/"
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// isDir reports whether path is a directory or a link to one
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,72 @@
+package shell
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestCompletePath(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"src/main.go", "src/.hidden", "README.md", "run.sh", ".env"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := api.WithWorkDir(context.TODO(), dir)
+	ctx = api.WithEnv(ctx, api.NewEnv([]string{"HOME=" + dir}))
+
+	tests := []struct {
+		prefix string
+		hidden bool
+		paths  []string
+	}{
+		{"", false, []string{"README.md", "run.sh", "src/"}},
+		{"", true, []string{".env", "README.md", "run.sh", "src/"}},
+		{"r", false, []string{"run.sh"}},
+		{"src/", false, []string{"src/main.go"}},
+		{"src/.", false, []string{"src/.hidden"}},
+		{"~/s", false, []string{"~/src/"}},
+		{dir + "/R", false, []string{dir + "/README.md"}},
+		{"missing/", false, nil},
+	}
+	for _, test := range tests {
+		if paths := completePath(ctx, test.prefix, test.hidden); !reflect.DeepEqual(paths, test.paths) {
+			t.Errorf("%q: expected %q, got %q", test.prefix, test.paths, paths)
+		}
+	}
+
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if paths := shell.complete(shell.ctx, []string{"cat", "src/m"}); !reflect.DeepEqual(paths, []string{"src/main.go"}) {
+		t.Errorf("expected the arguments to complete as paths, got %q", paths)
+	}
+	if paths := shell.complete(shell.ctx, []string{"./r"}); !reflect.DeepEqual(paths, []string{"./run.sh"}) {
+		t.Errorf("expected a command path to complete, got %q", paths)
+	}
+
+	complete := func(words []string) []string { return shell.complete(shell.ctx, words) }
+	in := bufio.NewReader(strings.NewReader("cat s\tm\t\r"))
+	line, err := newLineEditor(in, ioutil.Discard, ">", defaultKeymap(), newHistory("", 10), complete).readLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimRight(line, "\r\n") != "cat src/main.go " {
+		t.Errorf("unexpected completed line: %q", line)
+	}
+}
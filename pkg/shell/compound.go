@@ -0,0 +1,100 @@
+package shell
+
+import (
+	"context"
+	"errors"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// runCompound runs an if, for or while command, or defines a function.
+// The failure of a condition is consumed, as it is with ||. The result
+// of the command is the one of the last body it ran, whose previous
+// iterations have their errors printed like pipelines followed by ;. A
+// command running no body succeeds.
+func (gosh *Goshell) runCompound(ctx context.Context, node *compoundNode) (context.Context, api.Result, error) {
+	var res api.Result
+	var err error
+	switch node.keyword {
+	case "if":
+		for _, c := range node.clauses {
+			var ok bool
+			if ctx, ok, err = gosh.runCond(ctx, c.cond); err != nil {
+				return ctx, res, err
+			}
+			if ok {
+				return gosh.runBody(ctx, c.body)
+			}
+		}
+		if node.elseBody != nil {
+			return gosh.runBody(ctx, node.elseBody)
+		}
+	case "while":
+		for {
+			newCtx, ok, condErr := gosh.runCond(ctx, node.clauses[0].cond)
+			ctx = newCtx
+			if condErr != nil {
+				return ctx, res, condErr
+			}
+			if !ok {
+				break
+			}
+			if err != nil {
+				gosh.printErr(ctx, err)
+			}
+			if ctx, res, err = gosh.runBody(ctx, node.body); err == errExit {
+				break
+			}
+		}
+	case "for":
+		var items []string
+		for _, w := range node.words {
+			expanded, err := gosh.expandArg(ctx, w)
+			if err != nil {
+				return ctx, api.Result{Code: api.ExitStatus(err)}, err
+			}
+			items = append(items, expanded...)
+		}
+		env := api.GetEnv(ctx)
+		if env == nil {
+			return ctx, res, errors.New("no shell environment")
+		}
+		for _, item := range items {
+			if ctx.Err() != nil {
+				return ctx, res, ctx.Err()
+			}
+			if err != nil {
+				gosh.printErr(ctx, err)
+			}
+			env.Assign(node.name, item)
+			if ctx, res, err = gosh.runBody(ctx, node.body); err == errExit {
+				break
+			}
+		}
+	case "fn":
+		gosh.functions.define(funcCmd{gosh: gosh, name: node.name, body: node.body})
+	}
+	return ctx, res, err
+}
+
+// runCond runs the condition of a compound command and reports whether
+// it succeeded. Only exiting the shell and the interruption of the
+// command are errors.
+func (gosh *Goshell) runCond(ctx context.Context, cond []pipelineNode) (context.Context, bool, error) {
+	ctx, err := gosh.runList(ctx, cond)
+	if err == errExit {
+		return ctx, false, err
+	}
+	if ctx.Err() != nil {
+		return ctx, false, ctx.Err()
+	}
+	return ctx, api.ExitStatus(err) == 0, nil
+}
+
+// runBody runs a body of a compound command, whose result is the one of
+// its last pipeline
+func (gosh *Goshell) runBody(ctx context.Context, body []pipelineNode) (context.Context, api.Result, error) {
+	last := gosh.lastResult(ctx)
+	ctx, err := gosh.runList(ctx, body)
+	return ctx, *last, err
+}
@@ -0,0 +1,93 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestShellCompound(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	out := new(bytes.Buffer)
+	ctx := api.WithStdout(context.TODO(), out)
+	ctx = api.WithStderr(ctx, out)
+	countdown := 0
+	shell.RegisterCommand(
+		rpcTestCmd{"say", func(ctx context.Context, a []string) error {
+			fmt.Fprintln(api.GetStdout(ctx), strings.Join(a[1:], " "))
+			return nil
+		}},
+		rpcTestCmd{"ok", func(ctx context.Context, a []string) error { return nil }},
+		rpcTestCmd{"fail", func(ctx context.Context, a []string) error { return api.NewExitError(1, nil) }},
+		rpcTestCmd{"pending", func(ctx context.Context, a []string) error {
+			if countdown == 0 {
+				return api.NewExitError(1, nil)
+			}
+			countdown--
+			return nil
+		}},
+	)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line string
+		out  string
+	}{
+		{"if ok; then say yes; else say no; fi", "yes\n"},
+		{"if fail; then say a; elif fail || ok; then say b; fi; say c", "b\nc\n"},
+		{"if fail; then say a; fi && say ran", "ran\n"},
+		{"for x in 1 {2,3} 'a b'; do say item $x; done; say last $x", "item 1\nitem 2\nitem 3\nitem a b\nlast a b\n"},
+		{"while pending; do say tick; done", "tick\ntick\ntick\n"},
+		{"fn greet() { say $0 $# $1 ${2} \"$@\" }; greet a b", "greet 2 a b a b\n"},
+		{"fn twice { greet $1; greet $1 x }; twice y; say [$1]", "greet 1 y  y\ngreet 2 y x y x\n[]\n"},
+	}
+	for _, test := range tests {
+		countdown = 3
+		out.Reset()
+		if _, err := shell.Eval(shell.ctx, test.line); err != nil {
+			t.Fatalf("%s: %v", test.line, err)
+		}
+		if out.String() != test.out {
+			t.Errorf("%s: expected %q, got %q", test.line, test.out, out.String())
+		}
+	}
+
+	// the functions of a session are its own
+	if _, err := shell.Eval(shell.ctx, "fn ok { say hijacked }"); err != nil {
+		t.Fatal(err)
+	}
+	session := shell.NewSession()
+	if err := session.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if _, err := session.Eval(session.ctx, "ok; greet"); err == nil || out.String() != "" {
+		t.Errorf("expected the functions of the shell to be undefined in the session, got %q, %v", out.String(), err)
+	}
+	if _, err := shell.Eval(shell.ctx, "ok"); err != nil || out.String() != "hijacked\n" {
+		t.Errorf("expected the function of the shell, got %q, %v", out.String(), err)
+	}
+
+	out.Reset()
+	if _, err := shell.Eval(shell.ctx, "for x in a b; do fail; done"); api.ExitStatus(err) != 1 {
+		t.Error("expected the status of the last iteration, got", err)
+	}
+
+	out.Reset()
+	script := "for x in one two\ndo\n  if fail\n  then say never\n  else\n    say $x\n  fi\ndone\nsay end\n"
+	if status := shell.RunScript(strings.NewReader(script), "test.gsh", true); status != 0 {
+		t.Error("expected exit status 0, got", status)
+	}
+	if out.String() != "one\ntwo\nend\n" {
+		t.Errorf("unexpected script output: %q", out.String())
+	}
+}
@@ -0,0 +1,303 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/vladimirvivien/gosh/api"
+	"github.com/vladimirvivien/gosh/api/output"
+	"github.com/vladimirvivien/gosh/api/style"
+)
+
+// Config holds the shell settings read from the configuration file
+type Config struct {
+	PluginsDir     string
+	Prompt         string
+	HistorySize    int
+	Color          bool
+	Theme          string
+	Splash         bool
+	Banner         string
+	WatchPlugins   bool
+	TrustedKeys    []string
+	AllowUnsigned  bool
+	LazyPlugins    bool
+	Paging         bool
+	AutoSuggest    bool
+	CompleteHidden bool
+	MaxPanics      int
+	AuditLog       string
+	PluginOrder    []string
+	Output         string
+	EditingMode    string
+	KeyBindings    map[string]string
+	Roles          map[string][]string
+}
+
+// DefaultConfig returns the settings used when the configuration file
+// does not set them
+func DefaultConfig() Config {
+	return Config{
+		PluginsDir:   api.PluginsDir,
+		Prompt:       api.DefaultPrompt,
+		HistorySize:  historyMaxSize,
+		Color:        true,
+		Theme:        defaultTheme,
+		Splash:       true,
+		WatchPlugins: true,
+		LazyPlugins:  true,
+		Paging:       true,
+		AutoSuggest:  true,
+		Output:       "text",
+		EditingMode:  defaultEditingMode,
+	}
+}
+
+// DefaultConfigPath returns $XDG_CONFIG_HOME/gosh/config.toml,
+// or ~/.config/gosh/config.toml when XDG_CONFIG_HOME is not set
+func DefaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "gosh", "config.toml")
+}
+
+// LoadConfig reads the configuration file at path on top of the
+// defaults. A missing file yields the default configuration.
+//
+//	plugins_dir = "./plugins"
+//	prompt = "gosh>"
+//	history_size = 1000
+//	color = true
+//	theme = "default"
+//	splash = true
+//	banner = ""
+//	watch_plugins = true
+//	trusted_keys = ["<base64 ed25519 public key>"]
+//	allow_unsigned = false
+//	lazy_plugins = true
+//	paging = true
+//	autosuggest = true
+//	complete_hidden = false
+//	max_panics = 0
+//	audit_log = ""
+//	plugin_precedence = []
+//	output = "text"
+//	editing_mode = "emacs"
+//
+//	[keybindings]
+//	'\C-t' = "kill-word"
+//
+//	[roles]
+//	alice = ["admin"]
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return cfg, err
+	}
+	defer file.Close()
+
+	values, err := parseTOML(file)
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %v", path, err)
+	}
+	for key, val := range values {
+		var ok bool
+		switch key {
+		case "plugins_dir":
+			cfg.PluginsDir, ok = val.(string)
+		case "prompt":
+			cfg.Prompt, ok = val.(string)
+		case "history_size":
+			var size int64
+			size, ok = val.(int64)
+			ok = ok && size >= 0
+			cfg.HistorySize = int(size)
+		case "color":
+			cfg.Color, ok = val.(bool)
+		case "theme":
+			cfg.Theme, ok = val.(string)
+		case "splash":
+			cfg.Splash, ok = val.(bool)
+		case "banner":
+			cfg.Banner, ok = val.(string)
+		case "watch_plugins":
+			cfg.WatchPlugins, ok = val.(bool)
+		case "trusted_keys":
+			cfg.TrustedKeys, ok = stringList(val)
+		case "allow_unsigned":
+			cfg.AllowUnsigned, ok = val.(bool)
+		case "lazy_plugins":
+			cfg.LazyPlugins, ok = val.(bool)
+		case "paging":
+			cfg.Paging, ok = val.(bool)
+		case "autosuggest":
+			cfg.AutoSuggest, ok = val.(bool)
+		case "complete_hidden":
+			cfg.CompleteHidden, ok = val.(bool)
+		case "max_panics":
+			var max int64
+			max, ok = val.(int64)
+			cfg.MaxPanics = int(max)
+		case "audit_log":
+			cfg.AuditLog, ok = val.(string)
+		case "plugin_precedence":
+			cfg.PluginOrder, ok = stringList(val)
+		case "output":
+			cfg.Output, ok = val.(string)
+		case "editing_mode":
+			cfg.EditingMode, ok = val.(string)
+		case "keybindings":
+			cfg.KeyBindings, ok = stringTable(val)
+		case "roles":
+			cfg.Roles, ok = stringListTable(val)
+		default:
+			// unknown keys and tables are ignored so that newer
+			// files still load
+			ok = true
+		}
+		if !ok {
+			return cfg, fmt.Errorf("%s: invalid value for %s", path, key)
+		}
+	}
+	return cfg, nil
+}
+
+// stringList converts an array value to a list of strings
+func stringList(val interface{}) ([]string, bool) {
+	vals, ok := val.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	list := make([]string, 0, len(vals))
+	for _, v := range vals {
+		s, ok := v.(string)
+		if !ok {
+			return nil, false
+		}
+		list = append(list, s)
+	}
+	return list, true
+}
+
+// stringTable converts a table of string values to a map
+func stringTable(val interface{}) (map[string]string, bool) {
+	table, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	m := make(map[string]string, len(table))
+	for k, v := range table {
+		s, ok := v.(string)
+		if !ok {
+			return nil, false
+		}
+		m[k] = s
+	}
+	return m, true
+}
+
+// stringListTable converts a table of array values to a map of lists
+// of strings
+func stringListTable(val interface{}) (map[string][]string, bool) {
+	table, ok := val.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	m := make(map[string][]string, len(table))
+	for k, v := range table {
+		list, ok := stringList(v)
+		if !ok {
+			return nil, false
+		}
+		m[k] = list
+	}
+	return m, true
+}
+
+// configure applies the settings of cfg to the shell. An invalid output
+// format is reported and text output is used instead, as are an unknown
+// editing mode or theme and invalid key bindings, which are skipped.
+func (gosh *Goshell) configure(cfg Config) {
+	gosh.pluginsDir = cfg.PluginsDir
+	gosh.prompt = cfg.Prompt
+	gosh.splash = cfg.Splash
+	gosh.banner = cfg.Banner
+	gosh.watch = cfg.WatchPlugins
+	gosh.format = output.Text
+	if cfg.Output != "" {
+		format, err := output.ParseFormat(cfg.Output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ignoring output setting: %v\n", err)
+		}
+		gosh.format = format
+	}
+	gosh.history.max = cfg.HistorySize
+	if cfg.EditingMode != "" {
+		keys, err := newKeymap(cfg.EditingMode)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ignoring editing mode: %v\n", err)
+			keys = defaultKeymap()
+		}
+		gosh.keymap = keys
+	}
+	for seq, action := range cfg.KeyBindings {
+		if err := gosh.keymap.bind(seq, action); err != nil {
+			fmt.Fprintf(os.Stderr, "skipping key binding: %v\n", err)
+		}
+	}
+	if cfg.Color {
+		style.SetMode(style.Auto)
+	} else {
+		style.SetMode(style.Never)
+	}
+	if cfg.Theme != "" {
+		if err := setTheme(cfg.Theme); err != nil {
+			fmt.Fprintf(os.Stderr, "ignoring theme setting: %v\n", err)
+			setTheme(defaultTheme)
+		}
+	}
+	gosh.allowUnsigned = cfg.AllowUnsigned
+	gosh.paging = cfg.Paging
+	gosh.autosuggest = cfg.AutoSuggest
+	gosh.completeHidden = cfg.CompleteHidden
+	gosh.panics = newPanicGuard(cfg.MaxPanics)
+	gosh.roles = cfg.Roles
+	gosh.pluginOrder = cfg.PluginOrder
+	if gosh.audit != nil {
+		gosh.audit.close()
+		gosh.audit = nil
+	}
+	if cfg.AuditLog != "" {
+		audit, err := openAuditLog(cfg.AuditLog)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "not auditing commands: %v\n", err)
+		}
+		gosh.audit = audit
+	}
+	if !cfg.LazyPlugins {
+		gosh.indexPath = ""
+	}
+	gosh.trustedKeys = nil
+	for _, s := range cfg.TrustedKeys {
+		key, err := parsePublicKey(s)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping trusted key: %v\n", err)
+			continue
+		}
+		gosh.trustedKeys = append(gosh.trustedKeys, key)
+	}
+}
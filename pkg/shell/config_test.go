@@ -0,0 +1,87 @@
+package shell
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	doc := `
+# shell settings
+name = "gosh # shell"  # trailing comment
+literal = 'C:\path'
+count = 1_000
+enabled = false
+list = ["a", 'b',
+  "c,d"]
+
+[table.sub]
+key = "value"
+`
+	values, err := parseTOML(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"name":    "gosh # shell",
+		"literal": `C:\path`,
+		"count":   int64(1000),
+		"enabled": false,
+		"list":    []interface{}{"a", "b", "c,d"},
+		"table": map[string]interface{}{
+			"sub": map[string]interface{}{"key": "value"},
+		},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("unexpected values: %#v", values)
+	}
+
+	if _, err := parseTOML(strings.NewReader("key")); err == nil {
+		t.Error("expected error for missing value")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := LoadConfig(filepath.Join(t.TempDir(), "missing.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg, DefaultConfig()) {
+		t.Error("missing file should yield the default config")
+	}
+
+	path := filepath.Join(t.TempDir(), "config.toml")
+	doc := "plugins_dir = \"/opt/gosh\"\nprompt = \"$\"\nhistory_size = 10\ncolor = false\ntheme = \"solarized\"\nsplash = false\nbanner = \"ops console\"\nwatch_plugins = false\n" +
+		"trusted_keys = [\"a2V5\"]\nallow_unsigned = true\nlazy_plugins = false\npaging = false\nautosuggest = false\ncomplete_hidden = true\nmax_panics = 3\naudit_log = \"/var/log/gosh.jsonl\"\nplugin_precedence = [\"sys\"]\noutput = \"json\"\n" +
+		"editing_mode = \"emacs\"\n[keybindings]\n'\\C-t' = \"kill-word\"\n[roles]\nalice = [\"admin\", \"ops\"]\n"
+	if err := ioutil.WriteFile(path, []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Config{PluginsDir: "/opt/gosh", Prompt: "$", HistorySize: 10, Theme: "solarized", Banner: "ops console", TrustedKeys: []string{"a2V5"}, AllowUnsigned: true, CompleteHidden: true, MaxPanics: 3, AuditLog: "/var/log/gosh.jsonl", PluginOrder: []string{"sys"}, Output: "json",
+		EditingMode: "emacs", KeyBindings: map[string]string{`\C-t`: "kill-word"},
+		Roles: map[string][]string{"alice": {"admin", "ops"}}}
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("history_size = \"ten\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("expected error for invalid value")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("history_size = -1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Error("expected error for negative history size")
+	}
+}
@@ -0,0 +1,20 @@
+package shell
+
+import "context"
+
+// detachedCtx carries the values of one context with the deadline
+// and cancellation of another
+type detachedCtx struct {
+	context.Context
+	values context.Context
+}
+
+func (c detachedCtx) Value(key interface{}) interface{} {
+	return c.values.Value(key)
+}
+
+// detach returns a context with the values of values that is
+// cancelled along with parent instead of values
+func detach(parent, values context.Context) context.Context {
+	return detachedCtx{Context: parent, values: values}
+}
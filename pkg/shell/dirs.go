@@ -0,0 +1,347 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// dirStack holds the directories saved by pushd, the most recent first.
+// The working directory of the shell is not part of it: dirs lists it
+// first, followed by the stack.
+type dirStack struct {
+	mu   sync.Mutex
+	dirs []string
+}
+
+func newDirStack() *dirStack {
+	return &dirStack{}
+}
+
+func (s *dirStack) push(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirs = append([]string{dir}, s.dirs...)
+}
+
+// top returns the most recent directory of the stack
+func (s *dirStack) top() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.dirs) == 0 {
+		return "", false
+	}
+	return s.dirs[0], true
+}
+
+// replaceTop replaces the most recent directory of the stack with dir
+func (s *dirStack) replaceTop(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.dirs) > 0 {
+		s.dirs[0] = dir
+	}
+}
+
+// drop removes the most recent directory of the stack
+func (s *dirStack) drop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.dirs) > 0 {
+		s.dirs = s.dirs[1:]
+	}
+}
+
+func (s *dirStack) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirs = nil
+}
+
+// list returns the working directory of ctx followed by the stack
+func (s *dirStack) list(ctx context.Context) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{api.GetWorkDir(ctx)}, s.dirs...)
+}
+
+// workPath returns path relative to the working directory of ctx,
+// rather than to the one of the process, unless it is absolute
+func workPath(ctx context.Context, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(api.GetWorkDir(ctx), path)
+}
+
+// changeDir makes dir, resolved against the working directory of ctx,
+// the working directory of the shell. It returns the context holding it
+// and the cleaned path of the directory. The working directory of the
+// process follows, for the plugins that do not read it from the
+// context, unless the command line runs apart from the session, and so
+// do $PWD and $OLDPWD. The change is published on the event bus.
+func changeDir(ctx context.Context, dir string) (context.Context, string, error) {
+	prev := api.GetWorkDir(ctx)
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(prev, dir)
+	}
+	dir = filepath.Clean(dir)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return ctx, "", err
+	}
+	if !info.IsDir() {
+		return ctx, "", fmt.Errorf("%s: not a directory", dir)
+	}
+	if !runsApart(ctx) {
+		if err := os.Chdir(dir); err != nil {
+			return ctx, "", err
+		}
+	}
+	if env := api.GetEnv(ctx); env != nil {
+		env.Set("OLDPWD", prev)
+		env.Set("PWD", dir)
+	}
+	ctx = api.WithWorkDir(ctx, dir)
+	api.Events(ctx).Publish(ctx, api.EventDirChange, api.DirEvent{Session: api.GetSession(ctx).ID, From: prev, To: dir})
+	return ctx, dir, nil
+}
+
+// getenv returns the value of a variable of the shell environment, or
+// of the process when ctx holds none
+func getenv(ctx context.Context, name string) string {
+	if env := api.GetEnv(ctx); env != nil {
+		val, _ := env.Get(name)
+		return val
+	}
+	return os.Getenv(name)
+}
+
+// homeDir returns $HOME, or the home directory of the user
+func homeDir(ctx context.Context) (string, error) {
+	if home := getenv(ctx, "HOME"); home != "" {
+		return home, nil
+	}
+	return os.UserHomeDir()
+}
+
+// shortenHome replaces the home directory at the start of dir with ~
+func shortenHome(ctx context.Context, dir string) string {
+	home, err := homeDir(ctx)
+	if err != nil || home == "" {
+		return dir
+	}
+	if rel, err := filepath.Rel(home, dir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Join("~", rel)
+	}
+	return dir
+}
+
+// searchCDPath looks for the relative directory dir in the directories
+// of $CDPATH, and returns the first one found. Paths starting with . or
+// .. are not searched, and neither is an empty entry of $CDPATH, which
+// stands for the working directory.
+func searchCDPath(ctx context.Context, dir string) string {
+	if filepath.IsAbs(dir) || dir == "." || dir == ".." ||
+		strings.HasPrefix(dir, "./") || strings.HasPrefix(dir, "../") {
+		return ""
+	}
+	for _, base := range filepath.SplitList(getenv(ctx, "CDPATH")) {
+		if base == "" || base == "." {
+			if info, err := os.Stat(filepath.Join(api.GetWorkDir(ctx), dir)); err == nil && info.IsDir() {
+				return ""
+			}
+			continue
+		}
+		path := filepath.Join(base, dir)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// cdCmd changes the working directory of the shell
+type cdCmd string
+
+func (c cdCmd) Name() string  { return string(c) }
+func (c cdCmd) Usage() string { return "cd [dir | -]" }
+func (c cdCmd) LongDesc() string {
+	return `Without a directory, cd changes to $HOME; cd - changes back to the previous
+directory, $OLDPWD, and prints it. A relative directory that is not in the
+working directory is looked for in the directories of $CDPATH,
+separated by colons, and printed when found there.`
+}
+func (c cdCmd) ShortDesc() string { return `changes the working directory, $HOME by default` }
+func (c cdCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	if len(args) > 2 {
+		return ctx, api.Result{}, api.NewUsageError("too many arguments")
+	}
+	var dir string
+	var err error
+	show := false
+	switch {
+	case len(args) == 1:
+		dir, err = homeDir(ctx)
+	case args[1] == "-":
+		dir, show = getenv(ctx, "OLDPWD"), true
+		if dir == "" {
+			err = errors.New("OLDPWD not set")
+		}
+	default:
+		dir = args[1]
+		if found := searchCDPath(ctx, dir); found != "" {
+			dir, show = found, true
+		}
+	}
+	if err == nil {
+		ctx, dir, err = changeDir(ctx, dir)
+	}
+	if err != nil {
+		return ctx, api.Result{}, fmt.Errorf("cd: %w", err)
+	}
+	if show {
+		fmt.Fprintln(api.GetStdout(ctx), dir)
+	}
+	return ctx, api.Result{}, nil
+}
+
+// pwdCmd prints the working directory
+type pwdCmd string
+
+func (c pwdCmd) Name() string      { return string(c) }
+func (c pwdCmd) Usage() string     { return "pwd [-P]" }
+func (c pwdCmd) LongDesc() string  { return `-P prints the directory with its symbolic links resolved.` }
+func (c pwdCmd) ShortDesc() string { return `prints the working directory` }
+func (c pwdCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	dir := api.GetWorkDir(ctx)
+	if dir == "" {
+		return ctx, api.Result{}, errors.New("pwd: working directory unknown")
+	}
+	if len(args) > 1 && args[1] == "-P" {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return ctx, api.Result{}, fmt.Errorf("pwd: %w", err)
+		}
+		dir = resolved
+	}
+	fmt.Fprintln(api.GetStdout(ctx), dir)
+	return ctx, api.Result{}, nil
+}
+
+// pushdCmd saves the working directory on the directory stack and
+// changes to another one
+type pushdCmd struct {
+	stack *dirStack
+}
+
+func (c pushdCmd) Name() string  { return "pushd" }
+func (c pushdCmd) Usage() string { return "pushd [dir]" }
+func (c pushdCmd) LongDesc() string {
+	return `Without a directory, pushd exchanges the working directory with the one
+on top of the stack. The stack is printed as dirs does.`
+}
+func (c pushdCmd) ShortDesc() string {
+	return `changes the working directory, saving the previous one on the directory stack`
+}
+func (c pushdCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	prev := api.GetWorkDir(ctx)
+	var err error
+	switch len(args) {
+	case 1:
+		top, ok := c.stack.top()
+		if !ok {
+			return ctx, api.Result{}, errors.New("pushd: no other directory")
+		}
+		if ctx, _, err = changeDir(ctx, top); err != nil {
+			return ctx, api.Result{}, fmt.Errorf("pushd: %w", err)
+		}
+		c.stack.replaceTop(prev)
+	case 2:
+		if ctx, _, err = changeDir(ctx, args[1]); err != nil {
+			return ctx, api.Result{}, fmt.Errorf("pushd: %w", err)
+		}
+		c.stack.push(prev)
+	default:
+		return ctx, api.Result{}, api.NewUsageError("too many arguments")
+	}
+	printDirs(ctx, c.stack, false)
+	return ctx, api.Result{}, nil
+}
+
+// popdCmd changes to the directory on top of the directory stack and
+// removes it
+type popdCmd struct {
+	stack *dirStack
+}
+
+func (c popdCmd) Name() string     { return "popd" }
+func (c popdCmd) Usage() string    { return "popd" }
+func (c popdCmd) LongDesc() string { return "" }
+func (c popdCmd) ShortDesc() string {
+	return `changes to the directory on top of the directory stack and removes it`
+}
+func (c popdCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	top, ok := c.stack.top()
+	if !ok {
+		return ctx, api.Result{}, errors.New("popd: directory stack empty")
+	}
+	ctx, _, err := changeDir(ctx, top)
+	if err != nil {
+		return ctx, api.Result{}, fmt.Errorf("popd: %w", err)
+	}
+	c.stack.drop()
+	printDirs(ctx, c.stack, false)
+	return ctx, api.Result{}, nil
+}
+
+// dirsCmd prints the directory stack
+type dirsCmd struct {
+	stack *dirStack
+}
+
+func (c dirsCmd) Name() string  { return "dirs" }
+func (c dirsCmd) Usage() string { return "dirs [-c | -v]" }
+func (c dirsCmd) LongDesc() string {
+	return `The working directory is printed first, followed by the directories saved
+by pushd, the most recent first. -v prints them one per line with their
+position in the stack, and -c clears the stack.`
+}
+func (c dirsCmd) ShortDesc() string { return `prints the directory stack` }
+func (c dirsCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	switch {
+	case len(args) == 1:
+		printDirs(ctx, c.stack, false)
+	case len(args) == 2 && args[1] == "-v":
+		printDirs(ctx, c.stack, true)
+	case len(args) == 2 && args[1] == "-c":
+		c.stack.clear()
+	default:
+		return ctx, api.Result{}, api.NewUsageError("expected -c or -v")
+	}
+	return ctx, api.Result{}, nil
+}
+
+// printDirs prints the working directory and the directory stack, with
+// the home directory shortened to ~, on one line or, when numbered, one
+// per line after their position
+func printDirs(ctx context.Context, stack *dirStack, numbered bool) {
+	out := api.GetStdout(ctx)
+	dirs := stack.list(ctx)
+	for i, dir := range dirs {
+		dirs[i] = shortenHome(ctx, dir)
+	}
+	if !numbered {
+		fmt.Fprintln(out, strings.Join(dirs, " "))
+		return
+	}
+	for i, dir := range dirs {
+		fmt.Fprintf(out, "%2d  %s\n", i, dir)
+	}
+}
@@ -0,0 +1,106 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestShellDirs(t *testing.T) {
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"home/src", "projects/gosh", "tmp"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	home, tmp := filepath.Join(root, "home"), filepath.Join(root, "tmp")
+
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	shell.env.Set("HOME", home)
+	shell.env.Set("CDPATH", ":"+filepath.Join(root, "projects"))
+	if err := os.Chdir(tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := shell.Init(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line   string
+		dir    string
+		output string
+	}{
+		{line: "pwd", dir: tmp, output: tmp + "\n"},
+		{line: "cd", dir: home},
+		{line: "cd src", dir: filepath.Join(home, "src")},
+		{line: "cd -", dir: home, output: home + "\n"},
+		{line: "cd gosh", dir: filepath.Join(root, "projects", "gosh"), output: filepath.Join(root, "projects", "gosh") + "\n"},
+		{line: "cd ~/src && pwd", dir: filepath.Join(home, "src"), output: filepath.Join(home, "src") + "\n"},
+		{line: "cd ../..", dir: root},
+		{line: "pushd tmp", dir: tmp, output: tmp + " " + root + "\n"},
+		{line: "pushd ~", dir: home, output: "~ " + tmp + " " + root + "\n"},
+		{line: "pushd", dir: tmp, output: tmp + " ~ " + root + "\n"},
+		{line: "dirs -v", dir: tmp, output: " 0  " + tmp + "\n 1  ~\n 2  " + root + "\n"},
+		{line: "popd", dir: home, output: "~ " + root + "\n"},
+		{line: "dirs -c", dir: home},
+		{line: "dirs", dir: home, output: "~\n"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		if _, err := shell.Eval(api.WithStdout(context.TODO(), &out), test.line); err != nil {
+			t.Fatalf("%s: %v", test.line, err)
+		}
+		if got := api.GetWorkDir(shell.ctx); got != test.dir {
+			t.Errorf("%s: expected the working directory %s, got %s", test.line, test.dir, got)
+		}
+		if got, _ := os.Getwd(); got != test.dir {
+			t.Errorf("%s: expected the process in %s, got %s", test.line, test.dir, got)
+		}
+		if out.String() != test.output {
+			t.Errorf("%s: expected output %q, got %q", test.line, test.output, out.String())
+		}
+	}
+	if pwd, _ := shell.env.Get("PWD"); pwd != home {
+		t.Errorf("expected PWD %s, got %s", home, pwd)
+	}
+	if old, _ := shell.env.Get("OLDPWD"); old != tmp {
+		t.Errorf("expected OLDPWD %s, got %s", tmp, old)
+	}
+	if got := shell.renderPrompt(api.WithPrompt(shell.ctx, "{{.Cwd}}>"), false); got != "~>" {
+		t.Errorf("unexpected prompt %q", got)
+	}
+
+	for _, line := range []string{"cd missing", "popd", "cd a b"} {
+		if _, err := shell.Eval(api.WithStderr(context.TODO(), &bytes.Buffer{}), line); err == nil {
+			t.Errorf("%s: expected an error", line)
+		}
+	}
+
+	// external commands run in the working directory of the session,
+	// whatever the working directory of the process
+	if _, err := exec.LookPath("sh"); err != nil {
+		return
+	}
+	os.Chdir(root)
+	var out bytes.Buffer
+	if _, err := shell.Eval(api.WithStdout(context.TODO(), &out), "sh -c pwd"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(out.String()); got != home {
+		t.Errorf("expected the external command in %s, got %s", home, got)
+	}
+}
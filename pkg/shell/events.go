@@ -0,0 +1,86 @@
+package shell
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// eventBus is the api.EventBus shared by a shell and its sessions. The
+// handlers run in the goroutine publishing the event; a handler that
+// panics is logged and the others still run.
+type eventBus struct {
+	mu       sync.Mutex
+	lastID   int
+	handlers map[string][]subscription
+}
+
+// subscription is a handler subscribed to a topic, identified by the
+// order it subscribed in
+type subscription struct {
+	id      int
+	handler api.EventHandler
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{handlers: make(map[string][]subscription)}
+}
+
+// Publish calls the handlers of topic and of all topics, in the order
+// they subscribed
+func (b *eventBus) Publish(ctx context.Context, topic string, data interface{}) {
+	b.mu.Lock()
+	subs := append([]subscription(nil), b.handlers[topic]...)
+	if topic != api.EventAll {
+		subs = append(subs, b.handlers[api.EventAll]...)
+	}
+	b.mu.Unlock()
+	sort.Slice(subs, func(i, j int) bool { return subs[i].id < subs[j].id })
+
+	event := api.Event{Topic: topic, Data: data}
+	for _, sub := range subs {
+		deliver(ctx, sub.handler, event)
+	}
+}
+
+// deliver calls handler with event, recovering from a panic
+func deliver(ctx context.Context, handler api.EventHandler, event api.Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			api.Logger(ctx).Error("event handler panicked", "topic", event.Topic, "panic", r)
+		}
+	}()
+	handler(ctx, event)
+}
+
+// Subscribe adds handler to the handlers of topic
+func (b *eventBus) Subscribe(topic string, handler api.EventHandler) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	id := b.lastID
+	b.handlers[topic] = append(b.handlers[topic], subscription{id: id, handler: handler})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { b.unsubscribe(topic, id) })
+	}
+}
+
+// unsubscribe removes the subscription id of topic
+func (b *eventBus) unsubscribe(topic string, id int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subs := b.handlers[topic]
+	for i, sub := range subs {
+		if sub.id == id {
+			b.handlers[topic] = append(subs[:i:i], subs[i+1:]...)
+			break
+		}
+	}
+	if len(b.handlers[topic]) == 0 {
+		delete(b.handlers, topic)
+	}
+}
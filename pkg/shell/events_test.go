@@ -0,0 +1,90 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := newEventBus()
+	var got []string
+	record := func(name string) api.EventHandler {
+		return func(ctx context.Context, event api.Event) {
+			got = append(got, fmt.Sprintf("%s:%s=%v", name, event.Topic, event.Data))
+		}
+	}
+	bus.Subscribe("deploy.done", record("a"))
+	unsubscribe := bus.Subscribe(api.EventAll, record("all"))
+	bus.Subscribe("deploy.done", func(ctx context.Context, event api.Event) { panic("boom") })
+	bus.Subscribe("deploy.done", record("b"))
+
+	var log bytes.Buffer
+	ctx := api.WithLogger(context.Background(), NewLogger(&log, slog.LevelInfo))
+	bus.Publish(ctx, "deploy.done", "prod")
+	unsubscribe()
+	unsubscribe()
+	bus.Publish(ctx, "other", 1)
+
+	expected := "a:deploy.done=prod all:deploy.done=prod b:deploy.done=prod"
+	if strings.Join(got, " ") != expected {
+		t.Errorf("expected %q, got %q", expected, strings.Join(got, " "))
+	}
+	if !strings.Contains(log.String(), "event handler panicked topic=deploy.done panic=boom") {
+		t.Errorf("expected the panic to be logged, got %q", log.String())
+	}
+	if api.Events(context.Background()).Subscribe("x", record("none")) == nil {
+		t.Error("expected a bus without a shell to accept subscriptions")
+	}
+}
+
+func TestShellEvents(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	var events []string
+	shell.events.Subscribe(api.EventAll, func(ctx context.Context, event api.Event) {
+		switch data := event.Data.(type) {
+		case api.SessionEvent:
+			events = append(events, event.Topic)
+		case api.CommandEvent:
+			events = append(events, fmt.Sprintf("%s %q %d", event.Topic, data.Line, data.Status))
+		case api.DirEvent:
+			events = append(events, fmt.Sprintf("%s %s", event.Topic, data.To))
+		}
+	})
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	dir := t.TempDir()
+	ctx := api.WithWorkDir(api.WithStdout(context.Background(), &bytes.Buffer{}), wd)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if api.Events(shell.ctx) != shell.events {
+		t.Error("expected the bus of the shell in the context")
+	}
+	shell.Eval(shell.ctx, "cd "+dir)
+	shell.Eval(shell.ctx, "  ")
+	shell.Eval(shell.ctx, "missing")
+	shell.Close(context.Background())
+
+	expected := []string{
+		api.EventStartup,
+		`command.pre "cd ` + dir + `" 0`,
+		"dir.change " + dir,
+		`command.post "cd ` + dir + `" 0`,
+		`command.pre "missing" 0`,
+		`command.post "missing" 1`,
+		api.EventShutdown,
+	}
+	if strings.Join(events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected events:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(events, "\n"))
+	}
+}
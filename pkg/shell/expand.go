@@ -0,0 +1,271 @@
+package shell
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// expandVars replaces $NAME and ${NAME} references, as well as the
+// special parameters $?, $#, $@ and $0 to $9, in the unquoted and
+// double quoted parts of w with values returned by lookup. Literal
+// parts and command substitutions are left untouched.
+func expandVars(w word, lookup func(string) string) word {
+	expanded := make(word, 0, len(w))
+	for _, part := range w {
+		if part.quote == literal || part.subst || !strings.Contains(part.text, "$") {
+			expanded = append(expanded, part)
+			continue
+		}
+		expanded = append(expanded, wordPart{text: expandVarsString(part.text, lookup), quote: part.quote})
+	}
+	return expanded
+}
+
+func expandVarsString(s string, lookup func(string) string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		if s[i+1] == '{' {
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				b.WriteString(s[i:])
+				break
+			}
+			b.WriteString(lookup(s[i+2 : i+end]))
+			i += end
+			continue
+		}
+		if c := s[i+1]; c == '?' || c == '#' || c == '@' || (c >= '0' && c <= '9') {
+			b.WriteString(lookup(string(c)))
+			i++
+			continue
+		}
+		end := i + 1
+		for end < len(s) && isNameChar(s[end], end == i+1) {
+			end++
+		}
+		if end == i+1 {
+			b.WriteByte('$')
+			continue
+		}
+		b.WriteString(lookup(s[i+1 : end]))
+		i = end - 1
+	}
+	return b.String()
+}
+
+// isName reports if s is a variable name
+func isName(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isNameChar(s[i], i == 0) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// isNameChar reports if c may appear in a variable name
+func isNameChar(c byte, first bool) bool {
+	switch {
+	case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return true
+	case c >= '0' && c <= '9':
+		return !first
+	}
+	return false
+}
+
+// expandTilde replaces an unquoted ~ at the start of w, followed by a
+// login name up to the first slash, with the home directory lookup
+// returns for the name: the home directory of the user for ~, $PWD for
+// ~+ and $OLDPWD for ~-. Names lookup does not know are left as they
+// are, and so is a prefix that is partly quoted.
+func expandTilde(w word, lookup func(name string) (string, bool)) word {
+	if len(w) == 0 || w[0].quote != unquoted || w[0].subst || !strings.HasPrefix(w[0].text, "~") {
+		return w
+	}
+	end := strings.IndexByte(w[0].text, '/')
+	if end < 0 {
+		if len(w) > 1 {
+			return w
+		}
+		end = len(w[0].text)
+	}
+	dir, ok := lookup(w[0].text[1:end])
+	if !ok {
+		return w
+	}
+	expanded := word{{text: dir, quote: literal}}
+	if rest := w[0].text[end:]; rest != "" {
+		expanded = append(expanded, wordPart{text: rest, quote: unquoted})
+	}
+	return append(expanded, w[1:]...)
+}
+
+// qchar is a character of a word with its quoting, or a command
+// substitution of the word, which counts as one quoted character
+type qchar struct {
+	c     byte
+	quote quoteKind
+	subst *wordPart
+}
+
+// splitWord returns the characters of w
+func splitWord(w word) []qchar {
+	var chars []qchar
+	for i, part := range w {
+		if part.subst {
+			chars = append(chars, qchar{quote: literal, subst: &w[i]})
+			continue
+		}
+		for i := 0; i < len(part.text); i++ {
+			chars = append(chars, qchar{c: part.text[i], quote: part.quote})
+		}
+	}
+	return chars
+}
+
+// joinWord returns the word of chars, with the runs of characters sharing
+// the same quoting as parts
+func joinWord(chars []qchar) word {
+	var w word
+	for _, ch := range chars {
+		if ch.subst != nil {
+			w = append(w, *ch.subst)
+			continue
+		}
+		if n := len(w); n > 0 && w[n-1].quote == ch.quote && !w[n-1].subst {
+			w[n-1].text += string(ch.c)
+			continue
+		}
+		w = append(w, wordPart{text: string(ch.c), quote: ch.quote})
+	}
+	if w == nil {
+		w = word{{quote: literal}}
+	}
+	return w
+}
+
+// expandBraces returns the words of the brace expressions of w, in
+// order: a{b,c}d expands to abd and acd, and {1..3} and {a..c} to the
+// sequences they bound, with an optional step as in {0..10..5}. Braces
+// nest, and only unquoted braces and commas count; ${NAME} and braces
+// that are not expressions are left as they are.
+func expandBraces(w word) []word {
+	chars := splitWord(w)
+	for open := 0; open < len(chars); open++ {
+		if !isUnquoted(chars, open, '{') || (open > 0 && isUnquoted(chars, open-1, '$')) {
+			continue
+		}
+		depth, commas, close := 0, []int{}, -1
+		for i := open + 1; i < len(chars) && close < 0; i++ {
+			switch {
+			case isUnquoted(chars, i, '{'):
+				depth++
+			case isUnquoted(chars, i, '}') && depth > 0:
+				depth--
+			case isUnquoted(chars, i, '}'):
+				close = i
+			case isUnquoted(chars, i, ',') && depth == 0:
+				commas = append(commas, i)
+			}
+		}
+		if close < 0 {
+			continue
+		}
+
+		var alts [][]qchar
+		if len(commas) > 0 {
+			start := open + 1
+			for _, comma := range append(commas, close) {
+				alts = append(alts, chars[start:comma])
+				start = comma + 1
+			}
+		} else if seq, ok := braceSequence(chars[open+1 : close]); ok {
+			for _, s := range seq {
+				alts = append(alts, splitWord(word{{text: s, quote: unquoted}}))
+			}
+		} else {
+			continue
+		}
+
+		var words []word
+		for _, alt := range alts {
+			expanded := append(append(append([]qchar{}, chars[:open]...), alt...), chars[close+1:]...)
+			words = append(words, expandBraces(joinWord(expanded))...)
+		}
+		return words
+	}
+	return []word{w}
+}
+
+func isUnquoted(chars []qchar, i int, c byte) bool {
+	return chars[i].c == c && chars[i].quote == unquoted
+}
+
+// braceSequence returns the sequence of a brace expression such as 1..5,
+// 01..10, a..e or 10..0..2. Numbers keep the width of a bound written
+// with leading zeros.
+func braceSequence(chars []qchar) ([]string, bool) {
+	var b strings.Builder
+	for _, ch := range chars {
+		if ch.quote != unquoted {
+			return nil, false
+		}
+		b.WriteByte(ch.c)
+	}
+	bounds := strings.Split(b.String(), "..")
+	if len(bounds) != 2 && len(bounds) != 3 {
+		return nil, false
+	}
+	step := 1
+	if len(bounds) == 3 {
+		n, err := strconv.Atoi(bounds[2])
+		if err != nil || n == 0 {
+			return nil, false
+		}
+		if n < 0 {
+			n = -n
+		}
+		step = n
+	}
+
+	first, errFirst := strconv.Atoi(bounds[0])
+	last, errLast := strconv.Atoi(bounds[1])
+	letters := false
+	switch {
+	case errFirst == nil && errLast == nil:
+	case len(bounds[0]) == 1 && len(bounds[1]) == 1 && isLetter(bounds[0][0]) && isLetter(bounds[1][0]):
+		first, last, letters = int(bounds[0][0]), int(bounds[1][0]), true
+	default:
+		return nil, false
+	}
+	width := 0
+	for _, bound := range bounds[:2] {
+		if digits := strings.TrimPrefix(bound, "-"); len(digits) > 1 && digits[0] == '0' {
+			width = len(bound)
+		}
+	}
+	if first > last {
+		step = -step
+	}
+
+	var seq []string
+	for n := first; (step > 0 && n <= last) || (step < 0 && n >= last); n += step {
+		switch {
+		case letters:
+			seq = append(seq, string(rune(n)))
+		default:
+			seq = append(seq, fmt.Sprintf("%0*d", width, n))
+		}
+	}
+	return seq, true
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
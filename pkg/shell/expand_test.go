@@ -0,0 +1,173 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestExpandVars(t *testing.T) {
+	vars := map[string]string{"NAME": "gosh", "DIR": "/tmp/x", "1": "one"}
+	lookup := func(name string) string { return vars[name] }
+
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{`$NAME`, "gosh"},
+		{`${NAME}shell`, "goshshell"},
+		{`"hello $NAME"`, "hello gosh"},
+		{`'$NAME'`, "$NAME"},
+		{`\$NAME`, "$NAME"},
+		{`$DIR/$MISSING/file`, "/tmp/x//file"},
+		{`cost:$5$`, "cost:$"},
+		{`$12%$`, "one2%$"},
+	}
+	for _, test := range tests {
+		tokens, err := lex(test.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := expandVars(tokens[0].word, lookup).String(); got != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.line, test.expected, got)
+		}
+	}
+}
+
+func TestExpandTilde(t *testing.T) {
+	homes := map[string]string{"": "/home/me", "bob": "/home/bob", "+": "/work"}
+	lookup := func(name string) (string, bool) {
+		dir, ok := homes[name]
+		return dir, ok
+	}
+
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{`~`, "/home/me"},
+		{`~/src`, "/home/me/src"},
+		{`~bob/docs`, "/home/bob/docs"},
+		{`~+/file`, "/work/file"},
+		{`~nobody/x`, "~nobody/x"},
+		{`'~'/src`, "~/src"},
+		{`~"bob"`, "~bob"},
+		{`a~`, "a~"},
+	}
+	for _, test := range tests {
+		tokens, err := lex(test.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := expandTilde(tokens[0].word, lookup).String(); got != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.line, test.expected, got)
+		}
+	}
+}
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []string
+	}{
+		{`file.{go,md}`, []string{"file.go", "file.md"}},
+		{`{a,b}{1,2}`, []string{"a1", "a2", "b1", "b2"}},
+		{`x{a,{b,c}d}`, []string{"xa", "xbd", "xcd"}},
+		{`v{1..3}`, []string{"v1", "v2", "v3"}},
+		{`{3..1}`, []string{"3", "2", "1"}},
+		{`{08..10}`, []string{"08", "09", "10"}},
+		{`{0..10..5}`, []string{"0", "5", "10"}},
+		{`{a..c}`, []string{"a", "b", "c"}},
+		{`a{,b}`, []string{"a", "ab"}},
+		{`{a{b,c}`, []string{"{ab", "{ac"}},
+		{`'{a,b}'`, []string{"{a,b}"}},
+		{`"{"a,b}`, []string{"{a,b}"}},
+		{`${HOME}`, []string{"${HOME}"}},
+		{`{}`, []string{"{}"}},
+		{`{a}`, []string{"{a}"}},
+		{`{1..x}`, []string{"{1..x}"}},
+	}
+	for _, test := range tests {
+		tokens, err := lex(test.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, w := range expandBraces(tokens[0].word) {
+			got = append(got, w.String())
+		}
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: expected %q, got %q", test.line, test.expected, got)
+		}
+	}
+}
+
+func TestShellCommandSubstitution(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	var args []string
+	shell.RegisterCommand(
+		rpcTestCmd{"args", func(ctx context.Context, a []string) error {
+			args = a[1:]
+			return nil
+		}},
+		rpcTestCmd{"say", func(ctx context.Context, a []string) error {
+			fmt.Fprintln(api.GetStdout(ctx), strings.Join(a[1:], " "))
+			return nil
+		}},
+		rpcTestCmd{"fail", func(ctx context.Context, a []string) error {
+			return api.NewExitError(3, errors.New("failed"))
+		}},
+	)
+	if err := shell.Init(api.WithStderr(context.TODO(), ioutil.Discard)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line     string
+		expected []string
+	}{
+		{`args $(say a  b)`, []string{"a", "b"}},
+		{`args "$(say 'a  b')" $(say 'a  b')`, []string{"a  b", "a", "b"}},
+		{`args x$(say a b)y`, []string{"xa", "by"}},
+		{`args $(say $(say nested) ok)`, []string{"nested", "ok"}},
+		{`args "$(say 'a ; b')" $(say; say)`, []string{"a ; b"}},
+		{`args v{1,2}$(say -)`, []string{"v1-", "v2-"}},
+		{`args "$(export X=1)$X"`, []string{""}},
+	}
+	for _, test := range tests {
+		args = nil
+		if _, err := shell.Eval(shell.ctx, test.line); err != nil {
+			t.Fatalf("%s: %v", test.line, err)
+		}
+		if !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("%s: expected %q, got %q", test.line, test.expected, args)
+		}
+	}
+
+	// the working directory changed by a substitution does not outlive it
+	wd, _ := os.Getwd()
+	if _, err := shell.Eval(shell.ctx, "args $(cd "+t.TempDir()+"; say moved)"); err != nil {
+		t.Fatal(err)
+	}
+	if dir, _ := os.Getwd(); dir != wd || api.GetWorkDir(shell.ctx) != wd {
+		t.Errorf("expected the working directory %s, got %s for the process and %s for the shell", wd, dir, api.GetWorkDir(shell.ctx))
+	}
+
+	args = []string{"untouched"}
+	if _, err := shell.Eval(shell.ctx, "args $(fail)"); api.ExitStatus(err) != 3 {
+		t.Errorf("expected the status of the substitution, got %v", err)
+	}
+	if args[0] != "untouched" {
+		t.Error("the command ran after its substitution failed")
+	}
+}
@@ -0,0 +1,59 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// externalCmd is a command backed by an executable found on $PATH.
+// It is used when a command name is not in the plugin registry.
+type externalCmd struct {
+	name string
+	path string
+}
+
+// lookupExternal searches $PATH for an executable with the given name
+func lookupExternal(name string) (*externalCmd, bool) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, false
+	}
+	return &externalCmd{name: name, path: path}, true
+}
+
+func (c *externalCmd) Name() string      { return c.name }
+func (c *externalCmd) Usage() string     { return c.name }
+func (c *externalCmd) ShortDesc() string { return fmt.Sprintf("runs %s", c.path) }
+func (c *externalCmd) LongDesc() string  { return "" }
+
+// Exec runs the executable in the working directory of the shell, with
+// stdin, stdout and stderr taken from ctx. The trace context of the
+// command is passed on in the TRACEPARENT and TRACESTATE variables.
+// The input of a remote session is not passed on: it never ends, and
+// the executable would keep reading the keys meant for the shell.
+func (c *externalCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	proc := exec.CommandContext(ctx, c.path, args[1:]...)
+	if stdin := api.GetStdin(ctx); !isSessionInput(stdin) {
+		proc.Stdin = stdin
+	}
+	proc.Stdout = api.GetStdout(ctx)
+	proc.Stderr = api.GetStderr(ctx)
+	proc.Dir = api.GetWorkDir(ctx)
+	if env := api.GetEnv(ctx); env != nil {
+		proc.Env = env.Environ()
+	}
+	if trace := traceContext(ctx); trace != nil {
+		if proc.Env == nil {
+			proc.Env = os.Environ()
+		}
+		for key, value := range trace {
+			proc.Env = append(proc.Env, strings.ToUpper(key)+"="+value)
+		}
+	}
+	return ctx, api.Result{}, proc.Run()
+}
@@ -0,0 +1,162 @@
+package shell
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// argsKey is the context key of the positional parameters of the
+// running function: its name, then its arguments
+type argsKey struct{}
+
+// positionalArgs returns the positional parameters of ctx, which has none
+// outside of functions
+func positionalArgs(ctx context.Context) []string {
+	args, _ := ctx.Value(argsKey{}).([]string)
+	return args
+}
+
+// lookupParam returns the value of the special parameter name: $0 to $9
+// and ${10} onwards are the positional parameters, $# is their number
+// and $@ all of them. It reports false for other names.
+func lookupParam(ctx context.Context, name string) (string, bool) {
+	args := positionalArgs(ctx)
+	switch name {
+	case "#":
+		if len(args) == 0 {
+			return "0", true
+		}
+		return strconv.Itoa(len(args) - 1), true
+	case "@":
+		if len(args) == 0 {
+			return "", true
+		}
+		return strings.Join(args[1:], " "), true
+	}
+	n, err := strconv.Atoi(name)
+	if err != nil || n < 0 {
+		return "", false
+	}
+	if n < len(args) {
+		return args[n], true
+	}
+	return "", true
+}
+
+// funcCmd is a function defined with fn, which runs its body in the
+// shell with its arguments as the positional parameters. Like a
+// builtin, the body may change the context of the shell, such as its
+// working directory and variables.
+type funcCmd struct {
+	gosh *Goshell
+	name string
+	body []pipelineNode
+}
+
+func (c funcCmd) Name() string      { return c.name }
+func (c funcCmd) Usage() string     { return c.name + " [arg ...]" }
+func (c funcCmd) ShortDesc() string { return "shell function" }
+func (c funcCmd) LongDesc() string {
+	return "Defined as:\n\n```\n" + (&compoundNode{keyword: "fn", name: c.name, body: c.body}).String() + "\n```"
+}
+func (c funcCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	// the body keeps the result of its last command apart, as it may
+	// run in a pipeline, concurrently with the commands of the caller
+	last := c.gosh.lastResult(ctx)
+	callCtx := withLast(context.WithValue(ctx, argsKey{}, args), *last)
+	newCtx, err := c.gosh.runList(callCtx, c.body)
+	res := *c.gosh.lastResult(callCtx)
+	if newCtx == callCtx {
+		return ctx, res, err
+	}
+	// the positional parameters and last result of the caller are
+	// restored
+	newCtx = context.WithValue(newCtx, argsKey{}, positionalArgs(ctx))
+	return context.WithValue(newCtx, lastKey{}, last), res, err
+}
+
+// funcTable holds the functions defined in a session. They are looked
+// up before the commands of the registry shared with the other
+// sessions, and only by the session that defined them.
+type funcTable struct {
+	mu    sync.Mutex
+	funcs map[string]funcCmd
+}
+
+func newFuncTable() *funcTable {
+	return &funcTable{funcs: make(map[string]funcCmd)}
+}
+
+// define defines the function cmd, in place of the function of the
+// same name, if any
+func (t *funcTable) define(cmd funcCmd) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.funcs[cmd.name] = cmd
+}
+
+// lookup returns the function named name
+func (t *funcTable) lookup(name string) (funcCmd, bool) {
+	if t == nil {
+		return funcCmd{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cmd, ok := t.funcs[name]
+	return cmd, ok
+}
+
+// all returns the functions by name
+func (t *funcTable) all() map[string]funcCmd {
+	funcs := make(map[string]funcCmd)
+	if t == nil {
+		return funcs
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name, cmd := range t.funcs {
+		funcs[name] = cmd
+	}
+	return funcs
+}
+
+// sessionRegistry is the api.Registry of a session: the shared command
+// registry, with the functions of the session in place of the commands
+// of the same names
+type sessionRegistry struct {
+	gosh *Goshell
+}
+
+// Lookup returns the function or the command named name
+func (r sessionRegistry) Lookup(name string) (api.Command, bool) {
+	if cmd, ok := r.gosh.functions.lookup(name); ok {
+		return cmd, true
+	}
+	return r.gosh.commands.Lookup(name)
+}
+
+// Commands returns the commands and functions of the session by name
+func (r sessionRegistry) Commands() map[string]api.Command {
+	commands := r.gosh.commands.Commands()
+	for name, cmd := range r.gosh.functions.all() {
+		commands[name] = cmd
+	}
+	return commands
+}
+
+// names returns the names of the commands and functions in order
+func (r sessionRegistry) names() []string {
+	names := r.gosh.commands.names()
+	for name := range r.gosh.functions.all() {
+		if _, ok := r.gosh.commands.Lookup(name); !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,132 @@
+package shell
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// globChars are the characters that make an unquoted word a pattern
+const globChars = "*?["
+
+// globPattern returns the pattern of w, with the metacharacters of its
+// quoted parts escaped, and whether its unquoted parts have any
+func globPattern(w word) (string, bool) {
+	var b strings.Builder
+	meta := false
+	for _, part := range w {
+		if part.quote == unquoted {
+			meta = meta || strings.ContainsAny(part.text, globChars)
+			// [!...] negates a class in the shell, [^...] in path.Match
+			b.WriteString(strings.Replace(part.text, "[!", "[^", -1))
+			continue
+		}
+		for _, c := range part.text {
+			if strings.ContainsRune(globChars+`\`, c) {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(c)
+		}
+	}
+	return b.String(), meta
+}
+
+// glob returns the paths matching w, relative to dir unless the pattern
+// is absolute, sorted. Unquoted *, ? and [...] match the characters of
+// a path element as in path.Match, [!...] negating a class, except a
+// leading dot, which must be matched explicitly. A word that is not a
+// pattern, or that matches nothing, expands to its text.
+func glob(w word, dir string) []string {
+	pattern, meta := globPattern(w)
+	if !meta {
+		return []string{w.String()}
+	}
+	elems := strings.Split(pattern, "/")
+	matches := []string{""}
+	for i, elem := range elems {
+		var next []string
+		switch {
+		case i == 0 && elem == "":
+			// an absolute pattern
+			next = matches
+		case !strings.ContainsAny(elem, globChars):
+			for _, m := range matches {
+				next = append(next, joinGlob(m, i, unescapeGlob(elem)))
+			}
+		default:
+			for _, m := range matches {
+				entries, err := os.ReadDir(globDir(m, i, dir))
+				if err != nil {
+					continue
+				}
+				for _, entry := range entries {
+					name := entry.Name()
+					if strings.HasPrefix(name, ".") && !strings.HasPrefix(elem, ".") {
+						continue
+					}
+					if ok, _ := path.Match(elem, name); ok {
+						next = append(next, joinGlob(m, i, name))
+					}
+				}
+			}
+		}
+		matches = next
+	}
+
+	var found []string
+	for _, m := range matches {
+		p := m
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		// a trailing slash only matches directories
+		if strings.HasSuffix(m, "/") {
+			p += string(filepath.Separator)
+		}
+		if _, err := os.Stat(p); err == nil {
+			found = append(found, m)
+		}
+	}
+	if len(found) == 0 {
+		return []string{w.String()}
+	}
+	sort.Strings(found)
+	return found
+}
+
+// joinGlob appends the element i of a pattern to a partial match
+func joinGlob(match string, i int, elem string) string {
+	if i == 0 {
+		return elem
+	}
+	return match + "/" + elem
+}
+
+// globDir returns the directory to list for the element i of a pattern
+// after a partial match
+func globDir(match string, i int, dir string) string {
+	switch {
+	case i == 0:
+		return dir
+	case match == "":
+		return "/"
+	case filepath.IsAbs(match):
+		return match
+	}
+	return filepath.Join(dir, match)
+}
+
+// unescapeGlob removes the escapes of the quoted metacharacters of a
+// pattern element
+func unescapeGlob(elem string) string {
+	var b strings.Builder
+	for i := 0; i < len(elem); i++ {
+		if elem[i] == '\\' && i+1 < len(elem) {
+			i++
+		}
+		b.WriteByte(elem[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,95 @@
+package shell
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "b.go", "c.txt", ".hidden.go", "sub/d.go", "sub/e.md", "[x].go"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		line     string
+		expected []string
+	}{
+		{`*.go`, []string{"[x].go", "a.go", "b.go"}},
+		{`?.go`, []string{"a.go", "b.go"}},
+		{`[ab].*`, []string{"a.go", "b.go"}},
+		{`[!a].go`, []string{"b.go"}},
+		{`.*.go`, []string{".hidden.go"}},
+		{`*/*.go`, []string{"sub/d.go"}},
+		{`sub/*`, []string{"sub/d.go", "sub/e.md"}},
+		{`*/`, []string{"sub/"}},
+		{`*.rs`, []string{"*.rs"}},
+		{`'*.go'`, []string{"*.go"}},
+		{`"*".go`, []string{"*.go"}},
+		{`\*.go`, []string{"*.go"}},
+		{`'[x]'*`, []string{"[x].go"}},
+		{`c.txt`, []string{"c.txt"}},
+		{filepath.ToSlash(dir) + "/s*/d.*", []string{filepath.ToSlash(dir) + "/sub/d.go"}},
+	}
+	for _, test := range tests {
+		tokens, err := lex(test.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := glob(tokens[0].word, dir); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: expected %q, got %q", test.line, test.expected, got)
+		}
+	}
+}
+
+func TestShellGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "b.go"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	var args []string
+	shell.Register("args", rpcTestCmd{"args", func(ctx context.Context, a []string) error {
+		args = a[1:]
+		return nil
+	}})
+	if err := shell.Init(api.WithWorkDir(context.TODO(), dir)); err != nil {
+		t.Fatal(err)
+	}
+
+	shell.env.Set("PATTERN", "*.go")
+	tests := []struct {
+		line     string
+		expected []string
+	}{
+		{"args *.go x", []string{"a.go", "b.go", "x"}},
+		{"args $PATTERN \"$PATTERN\"", []string{"a.go", "b.go", "*.go"}},
+		{"args {b,c}.go ~+", []string{"b.go", "c.go", dir}},
+		{"set noglob; args *.go", []string{"*.go"}},
+		{"set noglob off; args *.go", []string{"a.go", "b.go"}},
+	}
+	for _, test := range tests {
+		if _, err := shell.Eval(shell.ctx, test.line); err != nil {
+			t.Fatalf("%s: %v", test.line, err)
+		}
+		if !reflect.DeepEqual(args, test.expected) {
+			t.Errorf("%s: expected %q, got %q", test.line, test.expected, args)
+		}
+	}
+}
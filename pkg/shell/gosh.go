@@ -0,0 +1,1117 @@
+// Package shell implements the gosh shell: its line editor, parser,
+// builtins and plugin loaders. Programs embed it to offer gosh as their
+// own console, with commands registered directly or loaded as plugins:
+//
+//	sh := shell.New(shell.WithConfig(shell.DefaultConfig()))
+//	sh.RegisterCommand(statusCmd{})
+//	err := sh.Run(ctx)
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/user"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/vladimirvivien/gosh/api"
+	"github.com/vladimirvivien/gosh/api/output"
+	"github.com/vladimirvivien/gosh/api/progress"
+	"github.com/vladimirvivien/gosh/api/style"
+)
+
+// PluginsDirEnv names the environment variable that overrides the
+// plugins search path
+const PluginsDirEnv = "GOSH_PLUGINS_DIR"
+
+var (
+	// reCmd splits a partial line into words for completion
+	reCmd = regexp.MustCompile(`\S+`)
+)
+
+// pluginHost is the plugin state shared by the sessions of a shell: the
+// loaded plugins and the command registry built from them
+type pluginHost struct {
+	pluginsDir string
+	commands   *registry
+	panics     *panicGuard
+	metrics    *metrics
+	events     *eventBus
+	cache      *resultCache
+	segments   map[string]api.PromptSegment
+	plugins    map[string]*pluginFile
+	indexPath  string
+	index      *pluginIndex
+	watcher    *fsnotify.Watcher
+	reloadReq  chan struct{}
+
+	// Go plugins must be signed by one of the trusted keys
+	// unless unsigned plugins are allowed
+	trustedKeys   []ed25519.PublicKey
+	allowUnsigned bool
+
+	// noPlugins skips plugin discovery, leaving the builtins and
+	// the registered commands
+	noPlugins bool
+
+	// loadMu serializes the loads and reloads of the sessions; loaded
+	// is set once the first of them to initialize loaded the plugins
+	loadMu sync.Mutex
+	loaded bool
+
+	// audit, when set, records the command lines run by the shell and
+	// its sessions
+	audit *auditLog
+
+	// roles maps the users to their roles, which restricted commands
+	// require
+	roles map[string][]string
+
+	// conflicts maps the commands provided by several plugins to the
+	// plugin files providing them, the one used first
+	conflicts map[string][]string
+
+	// pluginOrder lists the plugins whose commands take precedence
+	// over the ones of other plugins, in order
+	pluginOrder []string
+}
+
+// Goshell is a shell session with its own context, environment, aliases,
+// history, jobs and functions. The plugins and the command registry are shared
+// with the sessions created by NewSession.
+type Goshell struct {
+	*pluginHost
+
+	ctx       context.Context
+	env       *api.Env
+	aliases   *aliasTable
+	history   *history
+	keymap    *keymap
+	jobs      *jobTable
+	schedules *scheduleTable
+	functions *funcTable
+	dirs      *dirStack
+	rcFiles   []string
+	termState *termState
+	closed    chan struct{}
+
+	// startDir is the working directory of the process when the shell
+	// was initialized, the initial one of the sessions created after
+	startDir string
+
+	// session is set on the shells returned by NewSession, which
+	// leave the shared plugins open when they close
+	session bool
+
+	// debug enables diagnostics such as plugin load timings
+	debug bool
+
+	// logger, when set, replaces the logger writing the diagnostics
+	// of logLevel and above to stderr
+	logger   *slog.Logger
+	logLevel slog.Level
+
+	// remoteTerm is set when stdin is a terminal of a remote client,
+	// such as an SSH PTY, that sends keys without line editing
+	remoteTerm bool
+
+	// paging lets api.Paged page long output on terminals
+	paging bool
+
+	// autosuggest shows suggestions from the history as the
+	// line is typed
+	autosuggest bool
+
+	// commandTimeout, when set, is the deadline of each pipeline
+	// run in the foreground
+	commandTimeout time.Duration
+
+	// slowCommand, when set, is the run time from which pipelines
+	// are reported on stderr
+	slowCommand time.Duration
+
+	// noglob leaves the patterns of the arguments unexpanded
+	noglob bool
+
+	// xtrace writes the command lines run to stderr once expanded,
+	// with where their commands come from, their status and timing
+	xtrace bool
+
+	// completeHidden completes the paths of hidden files without a
+	// leading dot being typed
+	completeHidden bool
+
+	// user and sessionID identify the session in the audit log
+	user      string
+	sessionID string
+
+	// settings of the configuration applied by Init and Run
+	prompt string
+	format output.Format
+	splash bool
+	banner string
+	watch  bool
+
+	// last is the result of the last foreground pipeline, whose code
+	// is the value of $?
+	last api.Result
+
+	// nextLine is the text the next input line starts with, as
+	// selected in the palette
+	nextLine string
+
+	mu        sync.Mutex
+	cancelCmd context.CancelFunc
+}
+
+// Option configures a shell created by New
+type Option func(*Goshell)
+
+// WithConfig applies the settings of cfg to the shell
+func WithConfig(cfg Config) Option {
+	return func(gosh *Goshell) { gosh.configure(cfg) }
+}
+
+// WithDebug enables diagnostics such as plugin load timings
+func WithDebug(debug bool) Option {
+	return func(gosh *Goshell) { gosh.debug = debug }
+}
+
+// WithoutPlugins skips plugin discovery, so that the shell only has the
+// builtins and the commands registered with Register
+func WithoutPlugins() Option {
+	return func(gosh *Goshell) {
+		gosh.noPlugins = true
+		gosh.indexPath = ""
+	}
+}
+
+// New returns a new shell configured by opts
+func New(opts ...Option) *Goshell {
+	gosh := &Goshell{
+		pluginHost: &pluginHost{
+			pluginsDir: api.PluginsDir,
+			commands:   newRegistry(),
+			panics:     newPanicGuard(0),
+			metrics:    newMetrics(),
+			events:     newEventBus(),
+			cache:      newResultCache(defaultCacheDir()),
+			plugins:    make(map[string]*pluginFile),
+			indexPath:  defaultIndexPath(),
+			reloadReq:  make(chan struct{}, 1),
+		},
+		env:       api.NewEnv(os.Environ()),
+		aliases:   newAliasTable(defaultAliasPath()),
+		history:   newHistory(defaultHistoryPath(), historyMaxSize),
+		keymap:    defaultKeymap(),
+		jobs:      newJobTable(),
+		schedules: newScheduleTable(),
+		functions: newFuncTable(),
+		dirs:      newDirStack(),
+		rcFiles:   defaultRCFiles(),
+		closed:    make(chan struct{}),
+		user:      currentUser(),
+		sessionID: newSessionID(),
+	}
+	for _, opt := range opts {
+		opt(gosh)
+	}
+	return gosh
+}
+
+// NewSession returns a new session of the shell for another user, such
+// as a remote client. The session starts with the settings and key
+// bindings of the shell, and a fresh environment, aliases, history and
+// jobs read from the same files, but shares its plugins and command
+// registry: they are loaded once, by the first of the shell and its
+// sessions to initialize, and are closed with the shell. Sessions do
+// not watch the plugins.
+func (gosh *Goshell) NewSession() *Goshell {
+	return &Goshell{
+		pluginHost:     gosh.pluginHost,
+		env:            api.NewEnv(os.Environ()),
+		aliases:        newAliasTable(gosh.aliases.path),
+		history:        newHistory(gosh.history.path, gosh.history.max),
+		keymap:         gosh.keymap.clone(),
+		jobs:           newJobTable(),
+		schedules:      newScheduleTable(),
+		functions:      newFuncTable(),
+		dirs:           newDirStack(),
+		rcFiles:        gosh.rcFiles,
+		closed:         make(chan struct{}),
+		startDir:       gosh.startDir,
+		session:        true,
+		debug:          gosh.debug,
+		logger:         gosh.logger,
+		logLevel:       gosh.logLevel,
+		paging:         gosh.paging,
+		autosuggest:    gosh.autosuggest,
+		prompt:         gosh.prompt,
+		commandTimeout: gosh.commandTimeout,
+		slowCommand:    gosh.slowCommand,
+		noglob:         gosh.noglob,
+		xtrace:         gosh.xtrace,
+		completeHidden: gosh.completeHidden,
+		user:           gosh.user,
+		sessionID:      newSessionID(),
+		format:         gosh.format,
+		splash:         gosh.splash,
+		banner:         gosh.banner,
+	}
+}
+
+// Init initializes the shell with the given context, which holds the
+// standard streams of the shell and closes it when it is cancelled. The
+// prompt and output format of the configuration are used unless ctx
+// sets them, and so is the working directory of the process, or of the
+// shell that created the session. The session of the shell, with its
+// environment, history, command registry, runner of api.Run and event
+// bus, is stored in the context of the commands. The startup event is
+// published once the plugins are loaded.
+func (gosh *Goshell) Init(ctx context.Context) error {
+	session := api.GetSession(ctx)
+	if session.Prompt == "" {
+		session.Prompt = gosh.prompt
+	}
+	if gosh.startDir == "" {
+		gosh.startDir, _ = os.Getwd()
+	}
+	if session.WorkDir == "" {
+		session.WorkDir = gosh.startDir
+	}
+	session.Env = gosh.env
+	session.History = gosh.history
+	session.Registry = sessionRegistry{gosh}
+	session.Runner = runner{gosh}
+	session.Events = gosh.events
+	session.ID, session.User = gosh.sessionID, gosh.user
+	gosh.env.Set("PWD", api.GetWorkDir(ctx))
+	gosh.ctx = api.WithSession(ctx, session)
+	if ctx.Value(output.FormatKey) == nil {
+		gosh.ctx = output.WithFormat(gosh.ctx, gosh.format)
+	}
+	if ctx.Value(api.LoggerKey) == nil {
+		gosh.ctx = api.WithLogger(gosh.ctx, gosh.newLogger(api.GetStderr(ctx)))
+	}
+	if err := gosh.history.load(); err != nil {
+		gosh.log().Error("failed to load history", "err", err)
+	}
+	if err := gosh.aliases.load(); err != nil {
+		gosh.log().Error("failed to load aliases", "err", err)
+	}
+	gosh.ctx = api.WithPager(gosh.ctx, gosh.pager)
+	gosh.ctx = api.WithInteractor(gosh.ctx, interactor{gosh})
+
+	gosh.loadMu.Lock()
+	var err error
+	if !gosh.loaded {
+		gosh.loaded = true
+		err = gosh.loadCommands()
+	}
+	gosh.loadMu.Unlock()
+	gosh.events.Publish(gosh.ctx, api.EventStartup, api.SessionEvent{Session: gosh.sessionID, User: gosh.user})
+	return err
+}
+
+// Run runs an interactive session that reads commands from the stdin
+// of ctx until the exit builtin, the end of input or the cancellation
+// of ctx. The shell is initialized with ctx first unless Init was
+// called, and its startup files run before the first prompt.
+func (gosh *Goshell) Run(ctx context.Context) error {
+	if gosh.ctx == nil {
+		if err := gosh.Init(ctx); err != nil {
+			return err
+		}
+	}
+	if gosh.splash {
+		gosh.printSplash(gosh.ctx)
+	}
+	gosh.LoadRC()
+	if gosh.watch {
+		if err := gosh.watchPlugins(); err != nil {
+			fmt.Fprintf(api.GetStderr(gosh.ctx), "failed to watch plugins: %v\n", err)
+		}
+	}
+
+	// prompt for help
+	out := api.GetStdout(gosh.ctx)
+	fmt.Fprintf(out, "\nLoaded %d command(s)...", gosh.commands.len())
+	fmt.Fprintln(out, "\nType help for available commands")
+	fmt.Fprint(out, "\n")
+
+	go gosh.Open(bufio.NewReader(api.GetStdin(gosh.ctx)))
+	<-gosh.Closed()
+	return nil
+}
+
+// Eval runs a command line with the standard streams of ctx and returns
+// the result of its last pipeline. Cancelling ctx interrupts the running
+// command. Context changes made by the commands, such as a new prompt,
+// are kept like they are at the prompt. The shell is initialized with
+// ctx first unless Init was called.
+func (gosh *Goshell) Eval(ctx context.Context, line string) (api.Result, error) {
+	if gosh.ctx == nil {
+		if err := gosh.Init(ctx); err != nil {
+			return api.Result{Code: 1}, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return api.Result{Code: 1}, err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			gosh.Interrupt()
+		case <-done:
+		}
+	}()
+
+	newCtx, err := gosh.exec(withIOFrom(gosh.ctx, ctx), line)
+	gosh.ctx = withIOFrom(newCtx, gosh.ctx)
+	return gosh.last, err
+}
+
+// RegisterCommand adds commands to the registry under their names
+func (gosh *Goshell) RegisterCommand(cmds ...api.Command) {
+	for _, cmd := range cmds {
+		gosh.Register(cmd.Name(), cmd)
+	}
+}
+
+// Register adds cmd to the registry under name. Registered commands
+// take precedence over builtins and plugin commands and are kept when
+// plugins are reloaded. Commands should be registered before Run.
+func (gosh *Goshell) Register(name string, cmd api.Command) {
+	gosh.commands.register(name, cmd)
+}
+
+// Open opens the shell for the given reader. The statements are read by
+// a single goroutine, one per prompt, so that commands can read the
+// input while they run. Open returns when gosh.ctx is cancelled; the
+// goroutine ends once its pending read returns, as it does when the
+// reader is closed.
+func (gosh *Goshell) Open(r *bufio.Reader) {
+	defer close(gosh.closed)
+	defer gosh.restoreTerm()
+
+	loopCtx := gosh.ctx
+	reader := gosh.startInputReader(gosh.ctx, r)
+	interrupted := false
+	for {
+		gosh.jobs.notify(api.GetStderr(loopCtx))
+		reader.request(loopCtx)
+
+		// wait for input or cancel, reloading plugins when
+		// the watcher detects changes
+		var input userInput
+	wait:
+		for {
+			select {
+			case <-gosh.ctx.Done():
+				return
+			case <-gosh.reloadReq:
+				gosh.reloadPlugins(loopCtx)
+			case input = <-reader.inputs:
+				break wait
+			}
+		}
+
+		switch input.err {
+		case io.EOF:
+			return
+		case errInterrupt:
+			if interrupted {
+				return
+			}
+			interrupted = true
+			fmt.Fprintln(api.GetStdout(loopCtx), "(press Ctrl-C again or Ctrl-D to exit)")
+			continue
+		}
+		interrupted = false
+
+		// history references are expanded before the line is
+		// recorded, and the expanded line is echoed
+		expanded, changed, err := gosh.history.expand(input.line)
+		if err != nil {
+			gosh.printErr(loopCtx, err)
+			continue
+		}
+		if changed {
+			fmt.Fprintln(api.GetStdout(loopCtx), strings.TrimSpace(expanded))
+			input.line = expanded
+		}
+		if err := gosh.history.add(input.line); err != nil {
+			fmt.Fprintf(api.GetStderr(loopCtx), "%v\n", err)
+		}
+		loopCtx, err = gosh.exec(loopCtx, input.line)
+		if err == errExit {
+			return
+		}
+		if err != nil {
+			gosh.printErr(loopCtx, err)
+		}
+	}
+}
+
+// printErr prints err to stderr, in red when color output is
+// enabled and stderr is a terminal
+func (gosh *Goshell) printErr(ctx context.Context, err error) {
+	currentTheme().err.Fprintln(api.GetStderr(ctx), err)
+}
+
+// exec handles a command line with a context that is cancelled by
+// Interrupt. The returned context keeps the values set by the commands
+// but is only cancelled along with the shell.
+func (gosh *Goshell) exec(ctx context.Context, line string) (context.Context, error) {
+	cmdCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	gosh.mu.Lock()
+	gosh.cancelCmd = cancel
+	gosh.mu.Unlock()
+	defer func() {
+		gosh.mu.Lock()
+		gosh.cancelCmd = nil
+		gosh.mu.Unlock()
+	}()
+
+	event := api.CommandEvent{Session: gosh.sessionID, Line: strings.TrimSpace(line)}
+	if event.Line != "" {
+		gosh.events.Publish(ctx, api.EventPreCommand, event)
+	}
+	start := time.Now()
+	newCtx, err := gosh.handle(cmdCtx, line)
+	progress.StopAll(api.GetStderr(ctx))
+	if cmdCtx.Err() != nil && err != nil {
+		err = errors.New("interrupted")
+	}
+	gosh.auditLine(ctx, line, start)
+	if event.Line != "" {
+		event.Status, event.Err, event.Duration = gosh.last.Code, err, time.Since(start)
+		if err == errExit {
+			event.Err = nil
+		}
+		gosh.events.Publish(newCtx, api.EventPostCommand, event)
+	}
+	return detach(gosh.ctx, newCtx), err
+}
+
+// auditLine records a command line that started at start in the audit
+// log, if there is one
+func (gosh *Goshell) auditLine(ctx context.Context, line string, start time.Time) {
+	line = strings.TrimSpace(line)
+	if gosh.audit == nil || line == "" {
+		return
+	}
+	gosh.recordAudit(ctx, auditEntry{
+		Time:       start,
+		User:       gosh.user,
+		Session:    gosh.sessionID,
+		Command:    line,
+		ExitCode:   gosh.last.Code,
+		DurationMS: time.Since(start).Milliseconds(),
+	})
+}
+
+// recordAudit writes an entry to the audit log, if there is one
+func (gosh *Goshell) recordAudit(ctx context.Context, entry auditEntry) {
+	if gosh.audit == nil {
+		return
+	}
+	if err := gosh.audit.record(entry); err != nil {
+		fmt.Fprintf(api.GetStderr(ctx), "failed to write the audit log: %v\n", err)
+	}
+}
+
+// Interrupt cancels the command currently running in the foreground.
+// It returns false if no command was running.
+func (gosh *Goshell) Interrupt() bool {
+	gosh.mu.Lock()
+	defer gosh.mu.Unlock()
+	if gosh.cancelCmd == nil {
+		return false
+	}
+	gosh.cancelCmd()
+	return true
+}
+
+// readStatement reads a complete statement. While the input ends with a
+// backslash or an operator, or has an unterminated quote or brace or an
+// unclosed if, for or while, more lines are read with the continuation
+// prompt. Reaching the end of input in the middle of a statement
+// returns what was read, so that the syntax error is reported.
+func (gosh *Goshell) readStatement(ctx context.Context, r *bufio.Reader) (string, error) {
+	out := api.GetStdout(ctx)
+	input, err := gosh.readLine(ctx, r, gosh.renderPrompt(ctx, style.Enabled(out)))
+	for err == nil && incomplete(input) {
+		var line string
+		line, err = gosh.readLine(ctx, r, continuationPrompt)
+		if err == io.EOF {
+			return continueLine(input, line), nil
+		}
+		input = continueLine(input, line)
+	}
+	return input, err
+}
+
+// continuationPrompt is shown while reading the rest of a statement
+const continuationPrompt = "..."
+
+// readLine prints the prompt and reads a line of input. When stdin is a
+// terminal, the line is read in raw mode to support history recall, as
+// it is from a remote terminal, which is already in raw mode.
+func (gosh *Goshell) readLine(ctx context.Context, r *bufio.Reader, prompt string) (string, error) {
+	out := api.GetStdout(ctx)
+	edit := func() (string, error) {
+		complete := func(words []string) []string {
+			return gosh.complete(ctx, words)
+		}
+		e := newLineEditor(r, out, prompt, gosh.keymap, gosh.history, complete)
+		e.suggest = gosh.autosuggest
+		e.palette, e.rows = gosh.paletteItems, gosh.termRows(ctx)
+		if gosh.nextLine != "" {
+			e.buf, e.pos = []rune(gosh.nextLine), len([]rune(gosh.nextLine))
+			gosh.nextLine = ""
+		}
+		return e.readLine()
+	}
+	if gosh.remoteTerm {
+		return edit()
+	}
+	stdin, ok := api.GetStdin(ctx).(*os.File)
+	if !ok || !isTerminal(stdin.Fd()) {
+		fmt.Fprintf(out, "%s ", prompt)
+		return r.ReadString('\n')
+	}
+
+	state, err := makeRaw(stdin.Fd())
+	if err != nil {
+		return "", err
+	}
+	gosh.termState = state
+	defer gosh.restoreTerm()
+	return edit()
+}
+
+// complete returns completion candidates for the last of the given words.
+// The first word is completed against the registered command names,
+// unless it is a path; other words are delegated to the command if it
+// implements api.Completer, and completed as paths when it does not or
+// has no candidates.
+func (gosh *Goshell) complete(ctx context.Context, words []string) []string {
+	if len(words) == 1 && !strings.ContainsRune(words[0], '/') {
+		var names []string
+		for _, name := range (sessionRegistry{gosh}).names() {
+			if strings.HasPrefix(name, words[0]) {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	cmd, _ := sessionRegistry{gosh}.Lookup(words[0])
+	if completer, ok := cmd.(api.Completer); ok && len(words) > 1 {
+		if candidates := completer.Complete(ctx, words, len(words)-1); len(candidates) > 0 {
+			return candidates
+		}
+	}
+	return completePath(ctx, words[len(words)-1], gosh.completeHidden)
+}
+
+// restoreTerm puts the terminal back in the state it was in
+// before raw mode was enabled
+func (gosh *Goshell) restoreTerm() {
+	if gosh.termState == nil {
+		return
+	}
+	if stdin, ok := api.GetStdin(gosh.ctx).(*os.File); ok {
+		restoreTerm(stdin.Fd(), gosh.termState)
+	}
+	gosh.termState = nil
+}
+
+// Close shuts the shell down: it publishes the shutdown event, cancels
+// the background jobs, stops the plugins watcher, runs the shutdown
+// hooks of the loaded plugins, closes the audit log and flushes the
+// history file. Closing a session only publishes its shutdown, cancels
+// its jobs and flushes its history. Jobs and plugins get until ctx is
+// done to stop.
+func (gosh *Goshell) Close(ctx context.Context) error {
+	if gosh.ctx != nil {
+		gosh.events.Publish(detach(ctx, gosh.ctx), api.EventShutdown, api.SessionEvent{Session: gosh.sessionID, User: gosh.user})
+	}
+	gosh.jobs.cancelAll(ctx)
+	gosh.schedules.cancelAll(ctx)
+	if gosh.session {
+		return gosh.history.close()
+	}
+	if gosh.watcher != nil {
+		gosh.watcher.Close()
+	}
+	for _, plug := range gosh.plugins {
+		gosh.closePlugin(ctx, plug)
+	}
+	if gosh.audit != nil {
+		if err := gosh.audit.close(); err != nil {
+			fmt.Fprintf(api.GetStderr(gosh.ctx), "failed to close the audit log: %v\n", err)
+		}
+	}
+	return gosh.history.close()
+}
+
+// ExitStatus returns the status the shell exits with: the code given to
+// the exit builtin, or the status of the last command
+func (gosh *Goshell) ExitStatus() int {
+	return gosh.last.Code
+}
+
+// Closed returns a channel that closes when the shell has closed
+func (gosh *Goshell) Closed() <-chan struct{} {
+	return gosh.closed
+}
+
+func (gosh *Goshell) handle(ctx context.Context, cmdLine string) (context.Context, error) {
+	line := strings.TrimSpace(cmdLine)
+	if line == "" {
+		return ctx, nil
+	}
+
+	list, err := gosh.parseLine(line)
+	if err != nil {
+		gosh.last = api.Result{Code: 2}
+		return ctx, api.NewExitError(2, err)
+	}
+	return gosh.runList(ctx, list)
+}
+
+// parseLine splits a command line into tokens, expands its aliases and
+// parses the result
+func (gosh *Goshell) parseLine(line string) ([]pipelineNode, error) {
+	tokens, err := lex(line)
+	if err != nil || len(tokens) == 0 {
+		return nil, err
+	}
+	tokens, err = gosh.aliases.expand(tokens)
+	if err != nil {
+		return nil, err
+	}
+	return parseList(tokens)
+}
+
+// lastKey is the context key of the result of the last command of the
+// command lines that keep it apart from the session
+type lastKey struct{}
+
+// apartKey marks the contexts of the command lines run apart from the
+// session, whose changes of working directory do not outlive them
+type apartKey struct{}
+
+// withLast returns a copy of ctx whose command lines keep the result of
+// their last command apart from the one of the session, starting with
+// res
+func withLast(ctx context.Context, res api.Result) context.Context {
+	return context.WithValue(ctx, lastKey{}, &res)
+}
+
+// apart returns a copy of ctx whose command lines run apart from the
+// session, starting with the result res. The builtins running command
+// lines of their own, background jobs and command substitutions run
+// theirs apart, possibly concurrently with the session.
+func apart(ctx context.Context, res api.Result) context.Context {
+	return context.WithValue(withLast(ctx, res), apartKey{}, true)
+}
+
+// runsApart reports whether the command lines of ctx run apart from the
+// session
+func runsApart(ctx context.Context) bool {
+	return ctx.Value(apartKey{}) != nil
+}
+
+// lastResult returns where the result of the last command of the
+// command lines of ctx is kept: the status of the session unless they
+// run apart from it
+func (gosh *Goshell) lastResult(ctx context.Context) *api.Result {
+	if last, ok := ctx.Value(lastKey{}).(*api.Result); ok {
+		return last
+	}
+	return &gosh.last
+}
+
+// runList runs the pipelines of a list in order. A pipeline joined
+// with && only runs if the previous one succeeded, and one joined with
+// || only runs if it failed, which also consumes the error. Errors of
+// pipelines followed by ; are printed; the last error is returned.
+// Background pipelines are started as jobs and count as successful.
+// Each pipeline sees the result of the previous one in its context.
+func (gosh *Goshell) runList(ctx context.Context, list []pipelineNode) (context.Context, error) {
+	last := gosh.lastResult(ctx)
+	var lastErr error
+	for i, node := range list {
+		if i > 0 {
+			failed := api.ExitStatus(lastErr) != 0
+			if (node.op == "&&" && failed) || (node.op == "||" && !failed) {
+				continue
+			}
+			if node.op == ";" && lastErr != nil {
+				gosh.printErr(ctx, lastErr)
+			}
+		}
+		nodeCtx := api.WithLastResult(ctx, *last)
+		if node.background {
+			gosh.startJob(nodeCtx, node)
+			*last, lastErr = api.Result{}, nil
+			continue
+		}
+		newCtx, res, err := runWithTimeout(nodeCtx, gosh.commandTimeout, func(ctx context.Context) (context.Context, api.Result, error) {
+			return gosh.runNode(ctx, node)
+		})
+		if newCtx != nodeCtx {
+			ctx = newCtx
+		}
+		lastErr = err
+		*last = res
+		if lastErr == errExit {
+			break
+		}
+	}
+	return ctx, lastErr
+}
+
+// runApart runs a parsed command line apart from the session, for
+// the builtins running command lines of their own. Unlike runList, it
+// leaves the status of the last command alone and runs background
+// pipelines like the others.
+func (gosh *Goshell) runApart(ctx context.Context, list []pipelineNode) (api.Result, error) {
+	ctx = apart(ctx, api.GetLastResult(ctx))
+	var res api.Result
+	var lastErr error
+	for i, node := range list {
+		if i > 0 {
+			failed := api.Status(res, lastErr) != 0
+			if (node.op == "&&" && failed) || (node.op == "||" && !failed) {
+				continue
+			}
+			if node.op == ";" && lastErr != nil {
+				gosh.printErr(ctx, lastErr)
+			}
+		}
+		_, res, lastErr = gosh.runNode(ctx, node)
+	}
+	return res, lastErr
+}
+
+// commandLine returns the command line run by a builtin given its
+// arguments: a single argument is the command line, as in
+// schedule 5m 'check || notify', and several are a command to quote
+func commandLine(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// runNode runs a pipeline or the compound command taking its place
+func (gosh *Goshell) runNode(ctx context.Context, node pipelineNode) (context.Context, api.Result, error) {
+	if node.compound != nil {
+		return gosh.runCompound(ctx, node.compound)
+	}
+	return gosh.runPipelineNode(ctx, node.cmds)
+}
+
+// runPipelineNode expands and runs the commands of a pipeline
+func (gosh *Goshell) runPipelineNode(ctx context.Context, nodes []commandNode) (context.Context, api.Result, error) {
+	var stages []pipeStage
+	for _, node := range nodes {
+		stage, err := gosh.buildStage(ctx, node)
+		if err != nil {
+			return ctx, api.Result{Code: api.ExitStatus(err)}, err
+		}
+		stages = append(stages, stage)
+	}
+
+	gosh.traceStages(ctx, stages)
+	start := time.Now()
+	newCtx, res, err := ctx, api.Result{}, error(nil)
+	if len(stages) == 1 {
+		newCtx, res, err = stages[0].exec(ctx)
+	} else {
+		res, err = runPipeline(ctx, stages)
+	}
+	elapsed := time.Since(start)
+	gosh.traceResult(ctx, stages, res, err, elapsed)
+	gosh.reportSlow(ctx, stages, elapsed)
+	return newCtx, res, err
+}
+
+// buildStage expands the words of a parsed command and
+// turns it into a runnable pipeline stage. The assignments leading
+// the command are exported to it, or, without a command, set shell
+// variables.
+func (gosh *Goshell) buildStage(ctx context.Context, node commandNode) (pipeStage, error) {
+	words := node.args
+	var assigns []assignment
+	for len(words) > 0 {
+		name, value, ok := splitAssignment(words[0])
+		if !ok {
+			break
+		}
+		a, err := gosh.expandAssignment(ctx, name, value)
+		if err != nil {
+			return pipeStage{}, err
+		}
+		assigns = append(assigns, a)
+		words = words[1:]
+	}
+	args := make([]string, 0, len(words))
+	for _, arg := range words {
+		expanded, err := gosh.expandArg(ctx, arg)
+		if err != nil {
+			return pipeStage{}, err
+		}
+		args = append(args, expanded...)
+	}
+
+	var stage pipeStage
+	switch {
+	case len(args) > 0:
+		var err error
+		if stage, err = gosh.commandStage(ctx, args); err != nil {
+			return pipeStage{}, err
+		}
+		stage.assigns = assigns
+	case len(assigns) > 0:
+		stage = pipeStage{cmd: assignCmd(assigns), args: []string{""}, panics: gosh.panics}
+	default:
+		stage = pipeStage{cmd: nopCmd{}, args: []string{""}, panics: gosh.panics}
+	}
+	for _, r := range node.redirs {
+		var target string
+		var err error
+		switch r.op {
+		case "<<":
+			target, err = gosh.expandText(ctx, r.body)
+		case "<<<":
+			target, err = gosh.expandText(ctx, r.target)
+			target += "\n"
+		default:
+			target, err = gosh.expand(ctx, r.target)
+		}
+		if err != nil {
+			return pipeStage{}, err
+		}
+		stage.redirs = append(stage.redirs, redirect{op: r.op, target: target})
+	}
+	stage.pipeStderr = node.pipeStderr
+	return stage, nil
+}
+
+// commandStage returns the stage running the command args[0] with its
+// arguments, unless the command is disabled or the user may not run it
+func (gosh *Goshell) commandStage(ctx context.Context, args []string) (pipeStage, error) {
+	cmd, err := gosh.lookup(args[0])
+	if err != nil {
+		return pipeStage{}, err
+	}
+	if err := gosh.authorize(ctx, args, cmd); err != nil {
+		return pipeStage{}, err
+	}
+	if err := gosh.panics.check(args[0]); err != nil {
+		return pipeStage{}, err
+	}
+	stage := pipeStage{cmd: cmd, args: args, panics: gosh.panics, metrics: gosh.metrics, cache: gosh.cache}
+	stage.origin = gosh.origin(stage)
+	return stage, nil
+}
+
+// expand applies the expansion stages to the target of a redirection
+// and returns its final text, which must be a single word
+func (gosh *Goshell) expand(ctx context.Context, w word) (string, error) {
+	words, err := gosh.expandWord(ctx, w)
+	if err != nil {
+		return "", err
+	}
+	if len(words) != 1 {
+		return "", fmt.Errorf("%s: ambiguous redirect", w)
+	}
+	return words[0].String(), nil
+}
+
+// expandText expands w like a word in double quotes, but for a leading
+// tilde: it is neither split into words nor matched against files
+func (gosh *Goshell) expandText(ctx context.Context, w word) (string, error) {
+	quoted := make(word, len(w))
+	for i, part := range w {
+		if part.subst {
+			part.quote = doubleQuoted
+		}
+		quoted[i] = part
+	}
+	words, err := gosh.expandWord(ctx, quoted)
+	if err != nil {
+		return "", err
+	}
+	var text string
+	for i, w := range words {
+		if i > 0 {
+			text += " "
+		}
+		text += w.String()
+	}
+	return text, nil
+}
+
+// expandArg expands the braces of w, then expands each of the words
+// and replaces it with the files matching it when it is a pattern,
+// unless globbing is turned off
+func (gosh *Goshell) expandArg(ctx context.Context, w word) ([]string, error) {
+	var args []string
+	for _, w := range expandBraces(w) {
+		words, err := gosh.expandWord(ctx, w)
+		if err != nil {
+			return nil, err
+		}
+		for _, w := range words {
+			if gosh.noglob {
+				args = append(args, w.String())
+				continue
+			}
+			args = append(args, glob(w, api.GetWorkDir(ctx))...)
+		}
+	}
+	return args, nil
+}
+
+// expandWord replaces the leading tilde, the variables, the positional
+// parameters and the command substitutions of w. The output of the
+// unquoted substitutions is split into words at whitespace, so w may
+// expand to several words, or none.
+func (gosh *Goshell) expandWord(ctx context.Context, w word) ([]word, error) {
+	env := api.GetEnv(ctx)
+	if env == nil {
+		env = gosh.env
+	}
+	lookup := func(name string) string {
+		if name == "?" {
+			return strconv.Itoa(api.GetLastResult(ctx).Code)
+		}
+		if val, ok := lookupParam(ctx, name); ok {
+			return val
+		}
+		val, _ := env.Get(name)
+		return val
+	}
+	home := func(name string) (string, bool) {
+		switch name {
+		case "":
+			dir, err := homeDir(ctx)
+			return dir, err == nil && dir != ""
+		case "+":
+			return api.GetWorkDir(ctx), true
+		case "-":
+			return env.Get("OLDPWD")
+		}
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", false
+		}
+		return u.HomeDir, true
+	}
+	return gosh.expandSubst(ctx, expandVars(expandTilde(w, home), lookup))
+}
+
+// expandSubst replaces the command substitutions of w with the output of
+// their commands, splitting the output of the unquoted ones into words
+func (gosh *Goshell) expandSubst(ctx context.Context, w word) ([]word, error) {
+	const whitespace = " \t\n\r"
+	var words []word
+	var cur word
+	end := func() {
+		if len(cur) > 0 {
+			words = append(words, cur)
+		}
+		cur = nil
+	}
+	for _, part := range w {
+		if !part.subst {
+			cur = append(cur, part)
+			continue
+		}
+		out, err := gosh.substitute(ctx, part.text)
+		if err != nil {
+			return nil, err
+		}
+		if part.quote == doubleQuoted {
+			cur = append(cur, wordPart{text: out, quote: doubleQuoted})
+			continue
+		}
+		if strings.TrimLeft(out, whitespace) != out {
+			end()
+		}
+		for i, field := range strings.Fields(out) {
+			if i > 0 {
+				end()
+			}
+			cur = append(cur, wordPart{text: field, quote: unquoted})
+		}
+		if strings.TrimRight(out, whitespace) != out {
+			end()
+		}
+	}
+	end()
+	return words, nil
+}
+
+// substitute runs the command line of a command substitution like a
+// subshell and returns its output without its trailing newlines. The
+// working directory, variables and result changed by its commands do not
+// outlive it. The error of the command line is returned when it fails.
+func (gosh *Goshell) substitute(ctx context.Context, line string) (string, error) {
+	list, err := gosh.parseLine(line)
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	env := api.GetEnv(ctx)
+	if env == nil {
+		env = gosh.env
+	}
+	subCtx := api.WithEnv(api.WithStdout(ctx, &out), env.Clone())
+	subCtx = apart(subCtx, *gosh.lastResult(ctx))
+	_, err = gosh.runList(subCtx, list)
+	if err == errExit {
+		err = nil
+	}
+	return strings.TrimRight(out.String(), "\r\n"), err
+}
+
+// lookup resolves a command name against the functions of the session
+// and the registry, then as a command of a plugin named plugin:command,
+// falling back to executables on $PATH
+func (gosh *Goshell) lookup(cmdName string) (api.Command, error) {
+	if cmd, ok := (sessionRegistry{gosh}).Lookup(cmdName); ok {
+		return cmd, nil
+	}
+	if cmd, ok := gosh.lookupNamespaced(cmdName); ok {
+		return cmd, nil
+	}
+	if ext, found := lookupExternal(cmdName); found {
+		return ext, nil
+	}
+	return nil, gosh.notFoundError(cmdName)
+}
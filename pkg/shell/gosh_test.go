@@ -0,0 +1,990 @@
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+	"github.com/vladimirvivien/gosh/api/output"
+	"github.com/vladimirvivien/gosh/api/style"
+)
+
+var (
+	testPluginsDir = "../../plugins"
+)
+
+// newTestShell returns a shell that loads the unsigned test plugins
+func newTestShell() *Goshell {
+	shell := New()
+	shell.pluginsDir = testPluginsDir
+	shell.allowUnsigned = true
+	shell.indexPath = ""
+	return shell
+}
+
+func TestShellNew(t *testing.T) {
+	shell := New()
+	if shell.pluginsDir != api.PluginsDir {
+		t.Error("pluginsDir not set")
+	}
+
+	cfg := DefaultConfig()
+	cfg.PluginsDir = testPluginsDir
+	shell = New(WithConfig(cfg), WithDebug(true))
+	if shell.pluginsDir != testPluginsDir || !shell.debug {
+		t.Error("options not applied")
+	}
+}
+
+func TestShellInit(t *testing.T) {
+	shell := newTestShell()
+	shell.pluginsDir = testPluginsDir
+	ctx := api.WithStdout(context.TODO(), os.Stdout)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if shell.commands.len() <= 0 {
+		t.Error("failed to load plugins from", testPluginsDir)
+	}
+	if _, ok := shell.commands.Lookup("hello"); !ok {
+		t.Error("missing 'hello' command from test module")
+	}
+	if _, ok := shell.commands.Lookup("goodbye"); !ok {
+		t.Error("missing 'goodbye' command from test module")
+	}
+
+}
+
+func TestShellHandle(t *testing.T) {
+	shell := newTestShell()
+	shell.pluginsDir = testPluginsDir
+
+	ctx := api.WithStdout(context.TODO(), os.Stdout)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	helloOut := bytes.NewBufferString("")
+	shell.ctx = api.WithStdout(context.TODO(), helloOut)
+	if _, err := shell.handle(shell.ctx, "testhello"); err == nil {
+		t.Error("this test should have failed with command not found")
+	}
+	if _, err := shell.handle(shell.ctx, "hello"); err != nil {
+		t.Error(err)
+	}
+	printedOut := strings.TrimSpace(helloOut.String())
+	if printedOut != "hello there" {
+		t.Error("did not get expected output from testcmd")
+	}
+
+	byeOut := bytes.NewBufferString("")
+	shell.ctx = api.WithStdout(context.TODO(), byeOut)
+	if _, err := shell.handle(shell.ctx, "goodbye"); err != nil {
+		t.Error(err)
+	}
+	printedOut = strings.TrimSpace(byeOut.String())
+	if printedOut != "bye bye" {
+		t.Error("did not get expected output from testcmd")
+	}
+
+}
+
+func TestShellComplete(t *testing.T) {
+	shell := newTestShell()
+	shell.pluginsDir = testPluginsDir
+	ctx := api.WithStdout(context.TODO(), os.Stdout)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	names := shell.complete(shell.ctx, []string{"he"})
+	if len(names) != 2 || names[0] != "hello" || names[1] != "help" {
+		t.Error("unexpected command name completions:", names)
+	}
+	names = shell.complete(shell.ctx, []string{"help", "good"})
+	if len(names) != 1 || names[0] != "goodbye" {
+		t.Error("unexpected argument completions:", names)
+	}
+}
+
+func TestShellHandleExternal(t *testing.T) {
+	shell := newTestShell()
+	out := bytes.NewBufferString("")
+	ctx := api.WithStdout(context.TODO(), out)
+	if _, err := shell.handle(ctx, "echo external"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(out.String()) != "external" {
+		t.Error("did not get expected output from external command:", out.String())
+	}
+}
+
+func TestShellHandlePipeline(t *testing.T) {
+	shell := newTestShell()
+	shell.pluginsDir = testPluginsDir
+	ctx := api.WithStdout(context.TODO(), os.Stdout)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	out := bytes.NewBufferString("")
+	ctx = api.WithStdout(shell.ctx, out)
+	if _, err := shell.handle(ctx, "hello | tr a-z A-Z | cat"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(out.String()) != "HELLO THERE" {
+		t.Error("unexpected pipeline output:", out.String())
+	}
+}
+
+func TestShellHandleRedirect(t *testing.T) {
+	shell := newTestShell()
+	shell.pluginsDir = testPluginsDir
+	ctx := api.WithStdout(context.TODO(), os.Stdout)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "out.txt")
+	if _, err := shell.handle(shell.ctx, "hello > "+file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shell.handle(shell.ctx, "goodbye >>"+file); err != nil {
+		t.Fatal(err)
+	}
+	out := bytes.NewBufferString("")
+	ctx = api.WithStdout(shell.ctx, out)
+	newCtx, err := shell.handle(ctx, "cat < "+file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hello there\nbye bye\n" {
+		t.Error("unexpected redirected output:", out.String())
+	}
+	if api.GetStdout(newCtx) != out {
+		t.Error("redirection leaked into the returned context")
+	}
+
+	out.Reset()
+	shell.env.Set("GOSH_TEST", "there")
+	if _, err := shell.handle(ctx, "cat <<EOF\nhello $GOSH_TEST\n  $(echo bye)  \nEOF\ncat <<< \"$GOSH_TEST\"'!'"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hello there\n  bye  \nthere!\n" {
+		t.Errorf("unexpected here-document output: %q", out.String())
+	}
+
+	// relative targets are in the working directory of the shell
+	dir := t.TempDir()
+	if _, err := shell.handle(api.WithWorkDir(shell.ctx, dir), "hello > out.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "out.txt")); err != nil || string(data) != "hello there\n" {
+		t.Errorf("expected the output in the working directory, got %q, %v", data, err)
+	}
+}
+
+func TestShellHandleEnv(t *testing.T) {
+	shell := newTestShell()
+	ctx := api.WithStdout(context.TODO(), os.Stdout)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := shell.handle(shell.ctx, "export GOSH_TEST=hello"); err != nil {
+		t.Fatal(err)
+	}
+	out := bytes.NewBufferString("")
+	ctx = api.WithStdout(shell.ctx, out)
+	if _, err := shell.handle(ctx, `sh -c "echo $GOSH_TEST \$GOSH_TEST"`); err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(out.String()) != "hello hello" {
+		t.Error("unexpected expansion output:", out.String())
+	}
+}
+
+func TestShellHandleChain(t *testing.T) {
+	shell := newTestShell()
+	out := bytes.NewBufferString("")
+	ctx := api.WithStdout(context.TODO(), out)
+	ctx = api.WithStderr(ctx, out)
+	if _, err := shell.handle(ctx, "true && echo a || echo b; false && echo c || echo d; false || false"); err == nil {
+		t.Error("expected the error of the last command")
+	}
+	if out.String() != "a\nd\n" {
+		t.Errorf("unexpected chain output: %q", out.String())
+	}
+}
+
+func TestShellHandleBackground(t *testing.T) {
+	shell := newTestShell()
+	ctx := api.WithStdout(context.TODO(), ioutil.Discard)
+	ctx = api.WithStderr(ctx, ioutil.Discard)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := shell.handle(shell.ctx, "sh -c 'exit 3' & echo foreground"); err != nil {
+		t.Fatal(err)
+	}
+	if len(shell.jobs.list()) != 1 {
+		t.Fatal("expected a background job")
+	}
+	_, err := shell.handle(shell.ctx, "fg %1")
+	if api.ExitStatus(err) != 3 {
+		t.Error("expected exit status of the job from fg, got", err)
+	}
+	if len(shell.jobs.list()) != 0 {
+		t.Error("finished job not removed")
+	}
+}
+
+func TestShellInterrupt(t *testing.T) {
+	shell := newTestShell()
+	ctx := api.WithStdout(context.TODO(), ioutil.Discard)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if shell.Interrupt() {
+		t.Error("nothing should be running")
+	}
+
+	done := make(chan error)
+	go func() {
+		newCtx, err := shell.exec(shell.ctx, "sleep 5")
+		if newCtx.Err() != nil {
+			t.Error("returned context should not be cancelled")
+		}
+		done <- err
+	}()
+	for !shell.Interrupt() {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected interrupted error")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("command was not cancelled")
+	}
+}
+
+func TestShellBuiltins(t *testing.T) {
+	shell := newTestShell()
+	shell.pluginsDir = t.TempDir()
+	shell.aliases = newAliasTable(filepath.Join(t.TempDir(), aliasFileName))
+	out := bytes.NewBufferString("")
+	ctx := api.WithStdout(context.TODO(), out)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"help", "exit", "cd", "pwd", "history", "alias", "env", "clear"} {
+		if _, ok := shell.commands.Lookup(name); !ok {
+			t.Errorf("missing builtin %s", name)
+		}
+	}
+
+	if _, err := shell.handle(shell.ctx, "alias greet='echo hello'"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shell.handle(shell.ctx, "greet world"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shell.handle(shell.ctx, "env GOSH_TEST=env sh -c 'echo $GOSH_TEST'"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shell.handle(shell.ctx, "env GOSH_TEST=env set editing-mode"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hello world\nenv\nediting-mode:  emacs\n" {
+		t.Errorf("unexpected builtin output: %q", out.String())
+	}
+	if _, err := shell.handle(shell.ctx, `bindkey '\C-t' kill-word`); err != nil {
+		t.Fatal(err)
+	}
+	if action, _ := shell.keymap.lookup("\x14"); action != "kill-word" {
+		t.Errorf("bindkey did not bind the key: %q", action)
+	}
+	if _, err := shell.handle(shell.ctx, "set editing-mode vi"); err != nil || shell.keymap.mode != "vi" {
+		t.Errorf("set did not select vi mode: %v", err)
+	}
+	if _, err := shell.handle(shell.ctx, "exit"); err != errExit {
+		t.Error("exit should close the shell, got", err)
+	}
+}
+
+func TestShellRunScript(t *testing.T) {
+	shell := newTestShell()
+	shell.pluginsDir = t.TempDir()
+	out := bytes.NewBufferString("")
+	ctx := api.WithStdout(context.TODO(), out)
+	ctx = api.WithStderr(ctx, out)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	script := "# greet\nexport NAME=gosh\n\necho hello $NAME\nsh -c 'exit 4'\necho unreachable\n"
+	if status := shell.RunScript(strings.NewReader(script), "test.gsh", true); status != 4 {
+		t.Error("expected exit status 4, got", status)
+	}
+	if out.String() != "hello gosh\ntest.gsh:5: exit status 4\n" {
+		t.Errorf("unexpected script output: %q", out.String())
+	}
+
+	out.Reset()
+	if status := shell.RunScript(strings.NewReader("false\necho reached"), "test.gsh", false); status != 0 {
+		t.Error("expected exit status 0, got", status)
+	}
+	if !strings.HasSuffix(out.String(), "reached\n") {
+		t.Errorf("script did not continue after error: %q", out.String())
+	}
+}
+
+func TestShellExitCode(t *testing.T) {
+	shell := newTestShell()
+	shell.pluginsDir = t.TempDir()
+	out := bytes.NewBufferString("")
+	ctx := api.WithStdout(context.TODO(), out)
+	ctx = api.WithStderr(ctx, out)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		script string
+		status int
+	}{
+		{"echo a\nexit 7\necho b", 7},
+		{"sh -c 'exit 3'\nexit", 3},
+		{"if true; then exit 4; fi\necho b", 4},
+		{"exit 0", 0},
+		{"exit x", 2},
+		{"exit 1 2", 2},
+	}
+	for _, test := range tests {
+		if status := shell.RunScript(strings.NewReader(test.script), "test.gsh", false); status != test.status {
+			t.Errorf("%q: expected exit status %d, got %d", test.script, test.status, status)
+		}
+		if shell.ExitStatus() != test.status {
+			t.Errorf("%q: expected shell exit status %d, got %d", test.script, test.status, shell.ExitStatus())
+		}
+	}
+	if strings.Contains(out.String(), "b\n") {
+		t.Errorf("script went on after exit: %q", out.String())
+	}
+}
+
+func TestShellCloseCancelsJobs(t *testing.T) {
+	shell := newTestShell()
+	shell.pluginsDir = t.TempDir()
+	if err := shell.Init(api.WithStderr(context.TODO(), ioutil.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	shell.commands.set("block", rpcTestCmd{"block", func(ctx context.Context, args []string) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	if _, err := shell.handle(shell.ctx, "block &"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	shell.Close(ctx)
+	for _, j := range shell.jobs.list() {
+		if !j.finished() {
+			t.Errorf("job %d was not cancelled", j.id)
+		}
+	}
+}
+
+func TestShellLastStatus(t *testing.T) {
+	shell := newTestShell()
+	shell.pluginsDir = t.TempDir()
+	out := bytes.NewBufferString("")
+	ctx := api.WithStdout(context.TODO(), out)
+	ctx = api.WithStderr(ctx, ioutil.Discard)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	shell.commands.set("flags", flagsCmd("flags"))
+	shell.commands.set("last", rpcTestCmd{"last", func(ctx context.Context, args []string) error {
+		fmt.Fprintf(api.GetStdout(ctx), "%v\n", api.GetLastResult(ctx).Data)
+		return nil
+	}})
+
+	script := strings.Join([]string{
+		"echo $?",
+		"sh -c 'exit 3'; echo status $?",
+		`echo "still ${?}"`,
+		"flags --bogus",
+		"echo $?",
+		"echo a | | cat",
+		"echo $?",
+		"sh -c 'exit 5' | true; echo $?",
+		"flags a b && last",
+		"echo '$?'",
+	}, "\n")
+	shell.RunScript(strings.NewReader(script), "test.gsh", false)
+	expected := "0\nstatus 3\nstill 0\n2\n2\n0\nverbose=false count=1 args=[a b]\n[a b]\n$?\n"
+	if out.String() != expected {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+}
+
+func TestShellContinuation(t *testing.T) {
+	shell := newTestShell()
+	shell.pluginsDir = t.TempDir()
+	out := bytes.NewBufferString("")
+	errOut := bytes.NewBufferString("")
+	ctx := api.WithStdout(context.TODO(), out)
+	ctx = api.WithStderr(ctx, errOut)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	script := strings.Join([]string{
+		"echo one \\",
+		"  two",
+		`echo "three`,
+		`four"`,
+		"echo five |",
+		"  cat",
+		"false &&",
+		"  echo skipped",
+		`echo "six`,
+	}, "\n")
+	shell.RunScript(strings.NewReader(script), "test.gsh", false)
+	if expected := "one two\nthree\nfour\nfive\n"; out.String() != expected {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+	if !strings.Contains(errOut.String(), "test.gsh:9: syntax error") {
+		t.Errorf("unterminated statements should be reported at their first line: %q", errOut.String())
+	}
+
+	out.Reset()
+	in := bufio.NewReader(strings.NewReader("echo 'a\nb' \\\nc\n"))
+	line, err := shell.readStatement(api.WithStdin(shell.ctx, strings.NewReader("")), in)
+	if err != nil || line != "echo 'a\nb' c\n" || !strings.HasSuffix(out.String(), continuationPrompt+" ") {
+		t.Errorf("unexpected statement %q (%v), output %q", line, err, out.String())
+	}
+}
+
+func TestShellEval(t *testing.T) {
+	shell := newTestShell()
+	shell.pluginsDir = t.TempDir()
+	shell.RegisterCommand(rpcTestCmd{"status", func(ctx context.Context, args []string) error {
+		fmt.Fprintln(api.GetStdout(ctx), "ok")
+		return nil
+	}}, rpcTestCmd{"cd", func(ctx context.Context, args []string) error {
+		return errors.New("replaced")
+	}})
+	if err := shell.Init(api.WithStdout(context.TODO(), ioutil.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shell.reloadPlugins(shell.ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	out := bytes.NewBufferString("")
+	ctx := api.WithStdout(context.TODO(), out)
+	if res, err := shell.Eval(ctx, "status && set output json"); err != nil || res.Code != 0 {
+		t.Fatalf("unexpected result %v: %v", res, err)
+	}
+	if out.String() != "ok\n" || output.GetFormat(shell.ctx) != output.JSON {
+		t.Errorf("unexpected output %q or format %v", out.String(), output.GetFormat(shell.ctx))
+	}
+	if api.GetStdout(shell.ctx) == out {
+		t.Error("the streams of Eval should not be kept")
+	}
+	if res, err := shell.Eval(ctx, "cd /"); err == nil || res.Code != 1 {
+		t.Errorf("registered commands should take precedence over builtins: %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := shell.Eval(cancelled, "status"); err == nil {
+		t.Error("expected an error for a cancelled context")
+	}
+}
+
+func TestShellWithoutPlugins(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PluginsDir = testPluginsDir
+	cfg.AllowUnsigned = true
+	shell := New(WithoutPlugins(), WithConfig(cfg))
+	shell.Register("greet", rpcTestCmd{"hello", func(ctx context.Context, args []string) error {
+		fmt.Fprintln(api.GetStdout(ctx), "greetings")
+		return nil
+	}})
+	out := bytes.NewBufferString("")
+	if err := shell.Init(api.WithStdout(context.TODO(), out)); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 || len(shell.plugins) != 0 {
+		t.Errorf("no plugins should be loaded: %q", out.String())
+	}
+	if _, ok := shell.commands.Lookup("hello"); ok {
+		t.Error("plugin commands should not be registered")
+	}
+	if _, err := shell.Eval(api.WithStdout(context.TODO(), out), "greet"); err != nil || out.String() != "greetings\n" {
+		t.Errorf("unexpected output %q: %v", out.String(), err)
+	}
+}
+
+func TestShellNewSession(t *testing.T) {
+	shell := newTestShell()
+	shell.pluginsDir = t.TempDir()
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	if err := shell.Init(api.WithStdout(context.TODO(), ioutil.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	session := shell.NewSession()
+	if err := session.Init(api.WithStdout(context.TODO(), ioutil.Discard)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the registry is shared
+	out := bytes.NewBufferString("")
+	shell.Register("greet", rpcTestCmd{"greet", func(ctx context.Context, args []string) error {
+		fmt.Fprintln(api.GetStdout(ctx), "greetings")
+		return nil
+	}})
+	if _, err := session.Eval(api.WithStdout(context.TODO(), out), "greet"); err != nil || out.String() != "greetings\n" {
+		t.Errorf("unexpected output %q: %v", out.String(), err)
+	}
+
+	// the context, environment and history are not
+	if _, err := session.Eval(context.TODO(), "export GOSH_SESSION=1; set output json"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := shell.env.Get("GOSH_SESSION"); ok {
+		t.Error("the environment of the session leaked into the shell")
+	}
+	if output.GetFormat(session.ctx) != output.JSON || output.GetFormat(shell.ctx) != output.Text {
+		t.Error("the output format of the session leaked into the shell")
+	}
+	session.history.add("greet")
+	if len(shell.history.entries) != 0 {
+		t.Error("the history of the session leaked into the shell")
+	}
+
+	// new sessions start in the directory the shell started in
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if _, err := shell.Eval(shell.ctx, "cd "+t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	other := shell.NewSession()
+	if err := other.Init(api.WithStdout(context.TODO(), ioutil.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	if dir := api.GetWorkDir(other.ctx); dir != wd {
+		t.Errorf("expected the session to start in %s, got %s", wd, dir)
+	}
+}
+
+func TestShellLoadRC(t *testing.T) {
+	dir := t.TempDir()
+	rc := filepath.Join(dir, userRCFile)
+	if err := ioutil.WriteFile(rc, []byte("export GOSH_RC=loaded\nalias hi='echo hi'\nprompt 'rc>'\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	shell := newTestShell()
+	shell.rcFiles = []string{filepath.Join(dir, "missing"), rc}
+	shell.aliases = newAliasTable("")
+	ctx := api.WithStdout(context.TODO(), ioutil.Discard)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	shell.LoadRC()
+
+	if val, _ := shell.env.Get("GOSH_RC"); val != "loaded" {
+		t.Error("rc file did not set environment variable")
+	}
+	if _, ok := shell.aliases.get("hi"); !ok {
+		t.Error("rc file did not define alias")
+	}
+	if api.GetPrompt(shell.ctx) != "rc>" {
+		t.Error("rc file did not set prompt:", api.GetPrompt(shell.ctx))
+	}
+}
+
+func TestShellInitSearchPath(t *testing.T) {
+	shell := newTestShell()
+	missing := filepath.Join(t.TempDir(), "missing")
+	shell.pluginsDir = strings.Join([]string{missing, t.TempDir(), testPluginsDir}, string(filepath.ListSeparator))
+	ctx := api.WithStdout(context.TODO(), ioutil.Discard)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := shell.commands.Lookup("hello"); !ok {
+		t.Error("missing 'hello' command from the search path")
+	}
+}
+
+func TestShellReloadPlugins(t *testing.T) {
+	shell := newTestShell()
+	shell.pluginsDir = testPluginsDir
+	out := bytes.NewBufferString("")
+	ctx := api.WithStdout(context.TODO(), out)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// a plugin whose file was removed loses its commands,
+	// and the builtins it shadowed come back
+	removed := filepath.Join(testPluginsDir, "removed_command.so")
+	shell.plugins[removed] = &pluginFile{
+		path:     removed,
+		dir:      testPluginsDir,
+		version:  1,
+		registry: map[string]api.Command{"removed": pwdCmd("removed"), "pwd": pwdCmd("shadow")},
+	}
+	shell.buildRegistry()
+	if pwd, _ := shell.commands.Lookup("pwd"); pwd.Name() != "shadow" {
+		t.Fatal("plugin command should shadow the builtin")
+	}
+
+	if _, err := shell.handle(shell.ctx, "reload"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := shell.commands.Lookup("removed"); ok {
+		t.Error("commands of a removed plugin should be dropped")
+	}
+	if pwd, _ := shell.commands.Lookup("pwd"); pwd.Name() != "pwd" {
+		t.Error("builtin should be restored")
+	}
+	if _, ok := shell.commands.Lookup("hello"); !ok {
+		t.Error("unchanged plugins should be kept")
+	}
+	if !strings.Contains(out.String(), "no plugin changes") {
+		t.Errorf("unexpected reload output: %q", out.String())
+	}
+}
+
+func TestShellLoadPluginsConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	var expected bytes.Buffer
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("p%02d", i)
+		script := fmt.Sprintf("print(%q)\ncommand(name = %q, fn = lambda args: None)\n", name, name)
+		if err := ioutil.WriteFile(filepath.Join(dir, name+"_command.star"), []byte(script), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintln(&expected, name)
+	}
+
+	defer func(n int) { maxPluginLoaders = n }(maxPluginLoaders)
+	maxPluginLoaders = 4
+	shell := newTestShell()
+	shell.pluginsDir = dir
+	out := bytes.NewBufferString("")
+	if err := shell.Init(api.WithStdout(context.TODO(), out)); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != expected.String() {
+		t.Errorf("plugin output should be in file order, got %q", out.String())
+	}
+	if len(shell.plugins) != 20 {
+		t.Errorf("expected 20 plugins, got %d", len(shell.plugins))
+	}
+	if _, ok := shell.commands.Lookup("p19"); !ok {
+		t.Error("missing command of the last plugin")
+	}
+}
+
+func TestShellPluginConflicts(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		script := fmt.Sprintf("command(name = \"greet\", fn = lambda args: print(%q))\n", name)
+		if err := ioutil.WriteFile(filepath.Join(dir, name+"_command.star"), []byte(script), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	shell := newTestShell()
+	shell.pluginsDir = dir
+	out := bytes.NewBufferString("")
+	if err := shell.Init(api.WithStdout(context.TODO(), out)); err != nil {
+		t.Fatal(err)
+	}
+
+	wd, _ := os.Getwd()
+	tests := []struct {
+		line, expected string
+	}{
+		{"greet", "a\n"},
+		{"a:greet", "a\n"},
+		{"b:greet", "b\n"},
+		{"builtins:pwd", wd + "\n"},
+	}
+	for _, test := range tests {
+		out.Reset()
+		if _, err := shell.handle(shell.ctx, test.line); err != nil {
+			t.Errorf("%s: %v", test.line, err)
+		} else if out.String() != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.line, test.expected, out.String())
+		}
+	}
+	if _, err := shell.handle(shell.ctx, "c:greet"); err == nil {
+		t.Error("expected the command of an unknown plugin not to be found")
+	}
+
+	shell.pluginOrder = []string{"b"}
+	shell.buildRegistry()
+	out.Reset()
+	if _, err := shell.handle(shell.ctx, "greet"); err != nil || out.String() != "b\n" {
+		t.Errorf("expected the command of b to take precedence, got %q, %v", out.String(), err)
+	}
+	if conflicts := shell.conflicts["greet"]; len(conflicts) != 2 || filepath.Base(conflicts[0]) != "b_command.star" {
+		t.Errorf("unexpected conflicts %v", conflicts)
+	}
+}
+
+// flagsCmd is a command with flags for the help and usage tests
+type flagsCmd string
+
+func (c flagsCmd) Name() string      { return string(c) }
+func (c flagsCmd) Usage() string     { return "flags [-v] name" }
+func (c flagsCmd) ShortDesc() string { return "tests flags" }
+func (c flagsCmd) LongDesc() string  { return "" }
+func (c flagsCmd) Flags() []api.Flag {
+	return []api.Flag{
+		{Name: "verbose", Short: "v", Kind: api.BoolFlag, Usage: "prints more"},
+		{Name: "count", Kind: api.IntFlag, Default: "1", Usage: "number of runs"},
+	}
+}
+func (c flagsCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	if len(args) < 2 {
+		return ctx, api.Result{}, api.NewUsageError("missing name")
+	}
+	flags := api.GetFlags(ctx)
+	fmt.Fprintf(api.GetStdout(ctx), "verbose=%v count=%d args=%v\n", flags.Bool("verbose"), flags.Int("count"), args[1:])
+	return ctx, api.Result{Data: args[1:]}, nil
+}
+
+func TestShellPrintErr(t *testing.T) {
+	shell := newTestShell()
+	defer style.SetMode(style.Auto)
+
+	tests := []struct {
+		mode     style.Mode
+		expected string
+	}{
+		{mode: style.Auto, expected: "failed\n"},
+		{mode: style.Always, expected: "\x1b[31mfailed\x1b[0m\n"},
+		{mode: style.Never, expected: "failed\n"},
+	}
+	for _, test := range tests {
+		style.SetMode(test.mode)
+		out := bytes.NewBufferString("")
+		shell.printErr(api.WithStderr(context.TODO(), out), errors.New("failed"))
+		if out.String() != test.expected {
+			t.Errorf("mode %d: expected %q, got %q", test.mode, test.expected, out.String())
+		}
+	}
+}
+
+func TestShellUsage(t *testing.T) {
+	shell := newTestShell()
+	shell.pluginsDir = t.TempDir()
+	out := bytes.NewBufferString("")
+	if err := shell.Init(api.WithStdout(context.TODO(), out)); err != nil {
+		t.Fatal(err)
+	}
+	shell.commands.set("flags", flagsCmd("flags"))
+
+	if _, err := shell.handle(shell.ctx, "help flags"); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"  Usage: flags [-v] name\n",
+		"    -v, --verbose            prints more\n",
+		"        --count int          number of runs (default 1)\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("help should contain %q, got %q", expected, out.String())
+		}
+	}
+
+	_, err := shell.handle(shell.ctx, "flags")
+	if api.ExitStatus(err) != 2 {
+		t.Errorf("usage errors should have status 2, got %v", err)
+	}
+	if err == nil || !strings.HasPrefix(err.Error(), "flags: missing name\n  Usage: flags [-v] name\n  Flags:") {
+		t.Errorf("unexpected usage error: %v", err)
+	}
+}
+
+// describedCmd is a command with a category and examples for the help tests
+type describedCmd struct {
+	flagsCmd
+}
+
+func (c describedCmd) Category() string { return "testing" }
+func (c describedCmd) Examples() []api.Example {
+	return []api.Example{{Command: "flags -v world", Desc: "runs verbosely"}}
+}
+
+func TestShellHelp(t *testing.T) {
+	shell := newTestShell()
+	shell.pluginsDir = t.TempDir()
+	shell.Register("flags", describedCmd{"flags"})
+	shell.Register("greet", flagsCmd("greet"))
+	if err := shell.Init(api.WithStdout(context.TODO(), ioutil.Discard)); err != nil {
+		t.Fatal(err)
+	}
+
+	out := bytes.NewBufferString("")
+	if _, err := shell.Eval(api.WithStdout(context.TODO(), out), "help"); err != nil {
+		t.Fatal(err)
+	}
+	builtins := strings.Index(out.String(), "\nbuiltins\n--------\n")
+	commands := strings.Index(out.String(), "\ncommands\n--------\n       greet:\ttests flags\n")
+	described := strings.Index(out.String(), "\ntesting\n-------\n       flags:\ttests flags\n")
+	if builtins < 0 || commands < builtins || described < commands {
+		t.Errorf("unexpected help groups: %q", out.String())
+	}
+
+	out.Reset()
+	if _, err := shell.Eval(api.WithStdout(context.TODO(), out), "help flags"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out.String(), "  Examples:\n    flags -v world\n        runs verbosely\n\n") {
+		t.Errorf("help should list the examples, got %q", out.String())
+	}
+}
+
+func TestShellFlags(t *testing.T) {
+	shell := newTestShell()
+	shell.pluginsDir = t.TempDir()
+	out := bytes.NewBufferString("")
+	if err := shell.Init(api.WithStdout(context.TODO(), out)); err != nil {
+		t.Fatal(err)
+	}
+	shell.commands.set("flags", flagsCmd("flags"))
+
+	tests := []struct {
+		line     string
+		expected string
+		err      string
+	}{
+		{line: "flags bob", expected: "verbose=false count=1 args=[bob]\n"},
+		{line: "flags -v --count 3 bob", expected: "verbose=true count=3 args=[bob]\n"},
+		{line: "flags --verbose=false --count=2 bob -v", expected: "verbose=false count=2 args=[bob -v]\n"},
+		{line: "flags -v -- --count", expected: "verbose=true count=1 args=[--count]\n"},
+		{line: "flags --help", expected: "  Usage: flags [-v] name\n"},
+		{line: "flags --quiet bob", err: "flags: unknown flag: --quiet\n  Usage: flags [-v] name"},
+		{line: "flags -x bob", err: "flags: unknown flag: -x\n"},
+		{line: "flags --count", err: "flags: flag needs an argument: --count\n"},
+		{line: "flags --count=many bob", err: `flags: invalid value "many" for flag --count: expected an integer`},
+	}
+	for _, test := range tests {
+		out.Reset()
+		_, err := shell.handle(shell.ctx, test.line)
+		if test.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("%s: expected error %q, got %v", test.line, test.err, err)
+			} else if api.ExitStatus(err) != 2 {
+				t.Errorf("%s: flag errors should have status 2, got %d", test.line, api.ExitStatus(err))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.line, err)
+			continue
+		}
+		if !strings.HasPrefix(out.String(), test.expected) {
+			t.Errorf("%s: expected output %q, got %q", test.line, test.expected, out.String())
+		}
+	}
+
+	if flags := api.GetFlags(shell.ctx); flags != nil {
+		t.Errorf("parsed flags should not be kept in the shell context: %v", flags.Values())
+	}
+}
+
+func TestShellCapture(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	shell.RegisterCommand(
+		rpcTestCmd{"greet", func(ctx context.Context, args []string) error {
+			fmt.Fprintf(api.GetStdout(ctx), "hello %s\n", strings.Join(args[1:], " "))
+			return nil
+		}},
+		rpcTestCmd{"shout", func(ctx context.Context, args []string) error {
+			greet, _ := api.GetRegistry(ctx).Lookup("greet")
+			text, err := api.Capture(ctx, func(ctx context.Context) error {
+				_, _, err := greet.Exec(ctx, args)
+				return err
+			})
+			fmt.Fprint(api.GetStdout(ctx), strings.ToUpper(text))
+			return err
+		}},
+	)
+	var out bytes.Buffer
+	if err := shell.Init(api.WithStdout(context.Background(), &out)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shell.Eval(shell.ctx, "shout gosh"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "HELLO GOSH\n" {
+		t.Errorf("expected the captured output to be shouted, got %q", out.String())
+	}
+}
+
+func TestShellRun(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	shell.roles = map[string][]string{"alice": {"ops"}}
+	shell.Register("flags", flagsCmd("flags"))
+	shell.Register("deploy", restrictedCmd{rpcTestCmd{"deploy", func(ctx context.Context, args []string) error {
+		return nil
+	}}, []string{"ops"}})
+	shell.Register("both", rpcTestCmd{"both", func(ctx context.Context, args []string) error {
+		if _, err := api.Run(ctx, "flags", "-v", "--count", "2", "$HOME"); err != nil {
+			return err
+		}
+		_, err := api.Run(ctx, "deploy", "prod")
+		return err
+	}})
+	var out bytes.Buffer
+	if err := shell.Init(api.WithStdout(context.Background(), &out)); err != nil {
+		t.Fatal(err)
+	}
+
+	shell.user = "alice"
+	if _, err := shell.Eval(shell.ctx, "both"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "verbose=true count=2 args=[$HOME]\n" {
+		t.Errorf("expected the flags to be parsed and the arguments kept, got %q", out.String())
+	}
+	shell.user = "bob"
+	if _, err := shell.Eval(shell.ctx, "both"); api.ExitStatus(err) != deniedStatus {
+		t.Errorf("expected the run command to be denied, got %v", err)
+	}
+	if res, err := api.Run(shell.ctx, "missing"); res.Code == 0 || err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected a missing command to fail, got %d, %v", res.Code, err)
+	}
+	if _, err := api.Run(context.Background(), "flags"); err == nil {
+		t.Error("expected Run to fail without a shell")
+	}
+}
@@ -0,0 +1,206 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	historyFileName = ".gosh_history"
+	historyMaxSize  = 1000
+)
+
+// history records command lines entered in the shell
+// and persists them to a file
+type history struct {
+	path    string
+	max     int
+	entries []string
+	file    *os.File
+}
+
+func newHistory(path string, max int) *history {
+	return &history{path: path, max: max}
+}
+
+// defaultHistoryPath returns the location of the history file
+// in the user's home directory
+func defaultHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, historyFileName)
+}
+
+// load reads previously saved entries from the history file.
+// A missing file is not an error.
+func (h *history) load() error {
+	if h.path == "" {
+		return nil
+	}
+	file, err := os.Open(h.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	// entries spanning several lines are joined back into statements
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		for incomplete(line) && scanner.Scan() {
+			line += "\n" + scanner.Text()
+		}
+		if line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// trim the file if it grew past the max size
+	if len(h.entries) > h.max {
+		h.entries = h.entries[len(h.entries)-h.max:]
+		return h.save()
+	}
+	return nil
+}
+
+// save overwrites the history file with the current entries
+func (h *history) save() error {
+	if h.path == "" {
+		return nil
+	}
+	data := strings.Join(h.entries, "\n")
+	if len(h.entries) > 0 {
+		data += "\n"
+	}
+	return os.WriteFile(h.path, []byte(data), 0600)
+}
+
+// add records a line and appends it to the history file.
+// Empty lines and repeats of the last entry are ignored.
+func (h *history) add(line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == line {
+		return nil
+	}
+	h.entries = append(h.entries, line)
+	if len(h.entries) > h.max {
+		h.entries = h.entries[len(h.entries)-h.max:]
+	}
+
+	if h.path == "" {
+		return nil
+	}
+	if h.file == nil {
+		file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		h.file = file
+	}
+	_, err := h.file.WriteString(line + "\n")
+	return err
+}
+
+// close flushes the history file to disk and closes it
+func (h *history) close() error {
+	if h.file == nil {
+		return nil
+	}
+	defer func() { h.file = nil }()
+	if err := h.file.Sync(); err != nil {
+		h.file.Close()
+		return err
+	}
+	return h.file.Close()
+}
+
+// len returns the number of recorded entries
+func (h *history) len() int {
+	return len(h.entries)
+}
+
+// Lines returns a copy of the entries, the oldest first
+func (h *history) Lines() []string {
+	return append([]string(nil), h.entries...)
+}
+
+// get returns the entry at index i
+func (h *history) get(i int) string {
+	if i < 0 || i >= len(h.entries) {
+		return ""
+	}
+	return h.entries[i]
+}
+
+// expand replaces the history references in line: !! is the last
+// entry, !n is entry n as numbered by the history builtin and !prefix
+// is the last entry starting with prefix. References inside single
+// quotes, after a backslash or followed by a space or = are kept. It
+// reports whether line changed.
+func (h *history) expand(line string) (string, bool, error) {
+	runes := []rune(line)
+	var b strings.Builder
+	changed, quoted := false, false
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == '\\' && !quoted && i+1 < len(runes):
+			b.WriteRune(c)
+			i++
+			c = runes[i]
+		case c == '!' && !quoted && i+1 < len(runes) && !strings.ContainsRune(" \t\n=(", runes[i+1]):
+			end := i + 1
+			if runes[end] == '!' {
+				end++
+			} else {
+				for end < len(runes) && !strings.ContainsRune(" \t\n;|&<>()'\"", runes[end]) {
+					end++
+				}
+			}
+			event := string(runes[i+1 : end])
+			entry, ok := h.event(event)
+			if !ok {
+				return line, false, fmt.Errorf("!%s: event not found", event)
+			}
+			b.WriteString(entry)
+			changed = true
+			i = end - 1
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String(), changed, nil
+}
+
+// event returns the entry an event designator of expand refers to
+func (h *history) event(event string) (string, bool) {
+	if event == "!" {
+		return h.get(h.len() - 1), h.len() > 0
+	}
+	if n, err := strconv.Atoi(event); err == nil {
+		return h.get(n - 1), n > 0 && n <= h.len()
+	}
+	for i := h.len() - 1; i >= 0; i-- {
+		if strings.HasPrefix(h.entries[i], event) {
+			return h.entries[i], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,65 @@
+package shell
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestHistoryAddLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), historyFileName)
+	hist := newHistory(path, 3)
+	for _, line := range []string{"hello", "hello", "", "goodbye", "sys", "prompt >"} {
+		if err := hist.add(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hist.len() != 3 {
+		t.Fatalf("expected 3 entries, got %d", hist.len())
+	}
+	if hist.get(0) != "goodbye" {
+		t.Error("oldest entry not trimmed:", hist.get(0))
+	}
+
+	loaded := newHistory(path, 3)
+	if err := loaded.load(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.len() != 3 || loaded.get(2) != "prompt >" {
+		t.Error("history not restored from file:", loaded.entries)
+	}
+}
+
+func TestHistoryExpand(t *testing.T) {
+	hist := newHistory("", 10)
+	for _, line := range []string{"deploy staging", "ls -l", "echo hi"} {
+		hist.add(line)
+	}
+	tests := []struct {
+		line     string
+		expanded string
+		changed  bool
+	}{
+		{"!!", "echo hi", true},
+		{"sudo !! | cat", "sudo echo hi | cat", true},
+		{"!2", "ls -l", true},
+		{"!dep --force", "deploy staging --force", true},
+		{"!ec;!l", "echo hi;ls -l", true},
+		{"echo '!!' \\!! ! a!=b", "echo '!!' \\!! ! a!=b", false},
+	}
+	for _, test := range tests {
+		expanded, changed, err := hist.expand(test.line)
+		if err != nil {
+			t.Errorf("%s: %v", test.line, err)
+			continue
+		}
+		if expanded != test.expanded || changed != test.changed {
+			t.Errorf("%s: expected %q (%v), got %q (%v)", test.line, test.expanded, test.changed, expanded, changed)
+		}
+	}
+
+	for _, line := range []string{"!4", "!0", "!missing"} {
+		if _, _, err := hist.expand(line); err == nil {
+			t.Errorf("%s: expected an event not found error", line)
+		}
+	}
+}
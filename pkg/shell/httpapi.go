@@ -0,0 +1,127 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxExecRequestSize bounds the size of the body of an exec request
+const maxExecRequestSize = 1 << 20
+
+// APIServer serves an HTTP API that runs command lines, for CI systems
+// and dashboards that drive the shell without a terminal. A command line
+// is posted to /v1/exec as {"command": "plugin list"}, run in a shell
+// from NewShell, and answered with its output, exit code and duration:
+//
+//	{"output": "...", "stderr": "", "exit_code": 0, "duration_ms": 12}
+type APIServer struct {
+	// NewShell returns the shell of a new request
+	NewShell func() *Goshell
+
+	// Token, when set, must be passed in the Authorization header as
+	// "Bearer <token>"
+	Token string
+
+	requests sync.WaitGroup
+}
+
+// apiExecRequest is the body of an exec request
+type apiExecRequest struct {
+	Command string `json:"command"`
+}
+
+// apiExecResponse is the result of an exec request
+type apiExecResponse struct {
+	Output     string `json:"output"`
+	Stderr     string `json:"stderr"`
+	ExitCode   int    `json:"exit_code"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// ListenAndServe listens on the TCP address addr and serves the API
+// until ctx is cancelled
+func (s *APIServer) ListenAndServe(ctx context.Context, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, l)
+}
+
+// Serve accepts connections on l until ctx is cancelled, then waits for
+// the running commands to end. Commands are interrupted along with ctx.
+func (s *APIServer) Serve(ctx context.Context, l net.Listener) error {
+	err := serveHTTP(ctx, l, s)
+	s.requests.Wait()
+	return err
+}
+
+// ServeHTTP serves the endpoints of the API
+func (s *APIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	if r.URL.Path != "/v1/exec" {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req apiExecRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxExecRequestSize)).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request: "+err.Error())
+		return
+	}
+	if strings.TrimSpace(req.Command) == "" {
+		writeJSONError(w, http.StatusBadRequest, "missing command")
+		return
+	}
+	s.requests.Add(1)
+	defer s.requests.Done()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.exec(r.Context(), req.Command))
+}
+
+// authorized reports whether r has the token of the server
+func (s *APIServer) authorized(r *http.Request) bool {
+	if s.Token == "" {
+		return true
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1
+}
+
+// exec runs a command line in a new shell, which reads no input, and
+// returns its result. The command is interrupted when ctx is cancelled,
+// as it is when the client goes away.
+func (s *APIServer) exec(ctx context.Context, line string) apiExecResponse {
+	var stdout, stderr bytes.Buffer
+	start := time.Now()
+	code := runSession(ctx, s.NewShell(), strings.NewReader(""), &stdout, &stderr, line)
+	return apiExecResponse{
+		Output:     stdout.String(),
+		Stderr:     stderr.String(),
+		ExitCode:   code,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+}
+
+// writeJSONError answers a request with an error status and message
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
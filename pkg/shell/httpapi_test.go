@@ -0,0 +1,62 @@
+package shell
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIServer(t *testing.T) {
+	server := httptest.NewServer(&APIServer{
+		NewShell: func() *Goshell {
+			shell := New(WithoutPlugins())
+			shell.history = newHistory("", 10)
+			shell.aliases = newAliasTable("")
+			shell.rcFiles = nil
+			return shell
+		},
+		Token: "secret",
+	})
+	defer server.Close()
+
+	post := func(token, body string) (*http.Response, apiExecResponse) {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/v1/exec", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var res apiExecResponse
+		json.NewDecoder(resp.Body).Decode(&res)
+		return resp, res
+	}
+
+	resp, res := post("secret", `{"command": "set output json; set output"}`)
+	if resp.StatusCode != http.StatusOK || res.ExitCode != 0 || res.Output != "{\n  \"output\": \"json\"\n}\n" {
+		t.Errorf("unexpected response %d: %+v", resp.StatusCode, res)
+	}
+	resp, res = post("secret", `{"command": "unset"}`)
+	if resp.StatusCode != http.StatusOK || res.ExitCode != 2 || res.Stderr == "" {
+		t.Errorf("unexpected response %d: %+v", resp.StatusCode, res)
+	}
+	// the stages of a pipeline write to stderr concurrently
+	_, res = post("secret", `{"command": "retry --attempts 2 --backoff 0 unset | retry --attempts 2 --backoff 0 unset"}`)
+	if strings.Count(res.Stderr, "retry: attempt 1 of 2 failed") != 2 {
+		t.Errorf("expected the errors of both stages, got %q", res.Stderr)
+	}
+	if resp, _ = post("wrong", `{"command": "set"}`); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected a wrong token to be refused, got %d", resp.StatusCode)
+	}
+	if resp, _ = post("secret", `{}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected a missing command to be refused, got %d", resp.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/v1/exec", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected GET to be refused: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package shell
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// userInput is a line read from the user, or the error ending the read
+type userInput struct {
+	line string
+	err  error
+}
+
+// inputReader reads the statements of the user in a single goroutine.
+// A statement is only read when requested, at the prompt, so that the
+// reader does not take the input of the running commands.
+type inputReader struct {
+	requests chan context.Context
+	inputs   chan userInput
+	done     chan struct{}
+}
+
+// startInputReader starts the goroutine reading statements from r until
+// ctx is cancelled or the input ends. A line left unfinished at the end
+// of the input is discarded, as it is in other shells.
+func (gosh *Goshell) startInputReader(ctx context.Context, r *bufio.Reader) *inputReader {
+	reader := &inputReader{
+		requests: make(chan context.Context),
+		inputs:   make(chan userInput),
+		done:     make(chan struct{}),
+	}
+	go func() {
+		defer close(reader.done)
+		for {
+			var reqCtx context.Context
+			select {
+			case <-ctx.Done():
+				return
+			case reqCtx = <-reader.requests:
+			}
+			// an input that fails, as a closed terminal does,
+			// cannot be read again and ends like at EOF
+			line, err := gosh.readStatement(reqCtx, r)
+			if err != nil && err != errInterrupt && err != io.EOF && ctx.Err() == nil {
+				fmt.Fprintf(api.GetStderr(reqCtx), "%v\n", err)
+				err = io.EOF
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case reader.inputs <- userInput{line: line, err: err}:
+			}
+			if err == io.EOF {
+				return
+			}
+		}
+	}()
+	return reader
+}
+
+// request asks for the next statement, read with the prompt of ctx. It
+// does nothing once the reader ended.
+func (reader *inputReader) request(ctx context.Context) {
+	select {
+	case reader.requests <- ctx:
+	case <-reader.done:
+	}
+}
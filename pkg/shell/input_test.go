@@ -0,0 +1,122 @@
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestShellOpenInputReader(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	marks := make(chan struct{})
+	shell.Register("mark", rpcTestCmd{"mark", func(ctx context.Context, args []string) error {
+		marks <- struct{}{}
+		return nil
+	}})
+	ctx, cancel := context.WithCancel(api.WithStdout(context.TODO(), ioutil.Discard))
+	defer cancel()
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	goroutines := runtime.NumGoroutine()
+	r, w := io.Pipe()
+	go shell.Open(bufio.NewReader(r))
+	running := 0
+	for i := 0; i < 20; i++ {
+		io.WriteString(w, "mark\n")
+		select {
+		case <-marks:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the command was not run")
+		}
+		if i == 0 {
+			running = runtime.NumGoroutine()
+		}
+	}
+	if n := waitGoroutines(running); n > running {
+		t.Errorf("%d goroutines started by the prompts are still running", n-running)
+	}
+
+	// cancelling the shell while the reader waits for input ends Open,
+	// and the reader once its read returns
+	cancel()
+	select {
+	case <-shell.Closed():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Open did not return when the shell was cancelled")
+	}
+	w.Close()
+	if n := waitGoroutines(goroutines); n > goroutines {
+		t.Errorf("%d goroutines leaked", n-goroutines)
+	}
+}
+
+func TestShellOpenEndOfInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		input string
+		runs  int
+		out   string
+	}{
+		{"eof", nil, "mark\n", 1, ""},
+		{"eof mid-line", nil, "mark\nmark", 1, ""},
+		{"read error", errors.New("input/output error"), "mark\n", 1, "input/output error\n"},
+	}
+	for _, test := range tests {
+		shell := New(WithoutPlugins())
+		shell.history = newHistory("", 10)
+		shell.aliases = newAliasTable("")
+		shell.rcFiles = nil
+		runs := 0
+		shell.Register("mark", rpcTestCmd{"mark", func(ctx context.Context, args []string) error {
+			runs++
+			return nil
+		}})
+		var stderr bytes.Buffer
+		ctx := api.WithStderr(api.WithStdout(context.TODO(), ioutil.Discard), &stderr)
+		if err := shell.Init(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		r, w := io.Pipe()
+		go func() {
+			io.WriteString(w, test.input)
+			w.CloseWithError(test.err)
+		}()
+		go shell.Open(bufio.NewReader(r))
+		select {
+		case <-shell.Closed():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: Open did not return at the end of the input", test.name)
+		}
+		if runs != test.runs {
+			t.Errorf("%s: expected %d run(s), got %d", test.name, test.runs, runs)
+		}
+		if stderr.String() != test.out {
+			t.Errorf("%s: expected %q on stderr, got %q", test.name, test.out, stderr.String())
+		}
+	}
+}
+
+// waitGoroutines waits a few seconds at most for the number of running
+// goroutines to drop to max, and returns it
+func waitGoroutines(max int) int {
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > max && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return runtime.NumGoroutine()
+}
@@ -0,0 +1,192 @@
+package shell
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// rawInput puts the terminal of the stdin of ctx in raw mode for reading
+// keys, unless it is a remote terminal, which already is. It returns a
+// function restoring the terminal, or false when stdin is not a
+// terminal.
+func (gosh *Goshell) rawInput(ctx context.Context) (func(), bool, error) {
+	if gosh.remoteTerm {
+		return func() {}, true, nil
+	}
+	f, ok := api.GetStdin(ctx).(*os.File)
+	if !ok || !isTerminal(f.Fd()) {
+		return nil, false, nil
+	}
+	state, err := makeRaw(f.Fd())
+	if err != nil {
+		return nil, false, err
+	}
+	return func() { restoreTerm(f.Fd(), state) }, true, nil
+}
+
+// interactor asks the questions of api.Confirm, api.Select and
+// api.Password by reading keys from the terminal in raw mode. Without a
+// terminal, questions are asked a line at a time.
+type interactor struct {
+	gosh *Goshell
+}
+
+// ask runs question with the keys typed on the terminal and where to
+// write, or returns false when stdin is not a terminal
+func (i interactor) ask(ctx context.Context, question func(in *bufio.Reader, out io.Writer) error) (bool, error) {
+	restore, ok, err := i.gosh.rawInput(ctx)
+	if err != nil || !ok {
+		return ok, err
+	}
+	defer restore()
+	return true, question(bufio.NewReader(api.GetStdin(ctx)), api.GetStderr(ctx))
+}
+
+// Confirm reads a single key: y for yes, n or Enter for no
+func (i interactor) Confirm(ctx context.Context, msg string) (bool, error) {
+	var yes bool
+	ok, err := i.ask(ctx, func(in *bufio.Reader, out io.Writer) error {
+		fmt.Fprintf(out, "%s [y/N] ", msg)
+		for {
+			r, _, err := in.ReadRune()
+			if err != nil {
+				return err
+			}
+			switch r {
+			case 'y', 'Y':
+				yes = true
+				io.WriteString(out, "y\r\n")
+				return nil
+			case 'n', 'N', keyEnter, keyNewline:
+				io.WriteString(out, "n\r\n")
+				return nil
+			case keyCtrlC, keyEscape:
+				io.WriteString(out, "\r\n")
+				return api.ErrCanceled
+			}
+		}
+	})
+	if !ok && err == nil {
+		return api.LineInteractor{}.Confirm(ctx, msg)
+	}
+	return yes, err
+}
+
+// Select shows the options with the selected one highlighted. The
+// arrows, Ctrl-P and Ctrl-N move the highlight, Enter picks it and the
+// digits pick an option by its number.
+func (i interactor) Select(ctx context.Context, options []string) (int, error) {
+	selected := 0
+	ok, err := i.ask(ctx, func(in *bufio.Reader, out io.Writer) error {
+		drawOptions(out, options, selected, false)
+		defer func() { clearOptions(out, len(options)) }()
+		for {
+			r, _, err := in.ReadRune()
+			if err != nil {
+				return err
+			}
+			switch {
+			case r == keyEnter || r == keyNewline:
+				return nil
+			case r == keyCtrlC:
+				return api.ErrCanceled
+			case r == keyEscape:
+				if in.Buffered() < 2 {
+					return api.ErrCanceled
+				}
+				seq := make([]byte, 2)
+				io.ReadFull(in, seq)
+				switch string(seq) {
+				case "[A", "OA":
+					r = keyCtrlP
+				case "[B", "OB":
+					r = keyCtrlN
+				}
+			case r >= '1' && r <= '9' && int(r-'0') <= len(options):
+				selected = int(r - '1')
+				return nil
+			}
+			switch {
+			case (r == keyCtrlP || r == 'k') && selected > 0:
+				selected--
+			case (r == keyCtrlN || r == 'j') && selected < len(options)-1:
+				selected++
+			}
+			drawOptions(out, options, selected, true)
+		}
+	})
+	if !ok && err == nil {
+		return api.LineInteractor{}.Select(ctx, options)
+	}
+	if err != nil {
+		return -1, err
+	}
+	fmt.Fprintf(api.GetStderr(ctx), "%s\r\n", options[selected])
+	return selected, nil
+}
+
+// drawOptions draws a line per option, going back up over the previous
+// drawing when redraw is set
+func drawOptions(out io.Writer, options []string, selected int, redraw bool) {
+	var b strings.Builder
+	if redraw {
+		fmt.Fprintf(&b, "\x1b[%dA", len(options))
+	}
+	for i, option := range options {
+		line := "  " + option
+		if i == selected {
+			line = currentTheme().selected.Sprint("> " + option)
+		}
+		fmt.Fprintf(&b, "\r\x1b[K%s\r\n", line)
+	}
+	io.WriteString(out, b.String())
+}
+
+// clearOptions erases the lines drawn by drawOptions
+func clearOptions(out io.Writer, n int) {
+	fmt.Fprintf(out, "\x1b[%dA\r\x1b[J", n)
+}
+
+// Password masks each typed character with a *. Backspace erases the
+// last one and Ctrl-U all of them.
+func (i interactor) Password(ctx context.Context, msg string) (string, error) {
+	var secret []rune
+	ok, err := i.ask(ctx, func(in *bufio.Reader, out io.Writer) error {
+		fmt.Fprintf(out, "%s ", msg)
+		for {
+			r, _, err := in.ReadRune()
+			if err != nil {
+				return err
+			}
+			switch {
+			case r == keyEnter || r == keyNewline:
+				io.WriteString(out, "\r\n")
+				return nil
+			case r == keyCtrlC:
+				io.WriteString(out, "\r\n")
+				return api.ErrCanceled
+			case r == keyBackspace || r == keyCtrlH:
+				if len(secret) > 0 {
+					secret = secret[:len(secret)-1]
+					io.WriteString(out, "\b \b")
+				}
+			case r == keyCtrlU:
+				io.WriteString(out, strings.Repeat("\b \b", len(secret)))
+				secret = nil
+			case r >= ' ':
+				secret = append(secret, r)
+				io.WriteString(out, "*")
+			}
+		}
+	})
+	if !ok && err == nil {
+		return api.LineInteractor{}.Password(ctx, msg)
+	}
+	return string(secret), err
+}
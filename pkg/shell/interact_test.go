@@ -0,0 +1,81 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestInteractorTerminal(t *testing.T) {
+	shell := &Goshell{remoteTerm: true}
+	ask := func(input string) (context.Context, *bytes.Buffer) {
+		var out bytes.Buffer
+		ctx := api.WithStdin(context.Background(), strings.NewReader(input))
+		ctx = api.WithStderr(ctx, &out)
+		return api.WithInteractor(ctx, interactor{shell}), &out
+	}
+
+	ctx, _ := ask("xY")
+	if yes, err := api.Confirm(ctx, "sure?"); err != nil || !yes {
+		t.Errorf("confirm: expected yes, got %v, %v", yes, err)
+	}
+	ctx, _ = ask("\r")
+	if yes, err := api.Confirm(ctx, "sure?"); err != nil || yes {
+		t.Errorf("confirm: expected no, got %v, %v", yes, err)
+	}
+	ctx, _ = ask("\x03")
+	if _, err := api.Confirm(ctx, "sure?"); !errors.Is(err, api.ErrCanceled) {
+		t.Errorf("confirm: expected canceled, got %v", err)
+	}
+
+	options := []string{"dev", "staging", "prod"}
+	ctx, out := ask("\x1b[B\x1b[Bk\r")
+	if i, err := api.Select(ctx, options); err != nil || i != 1 {
+		t.Errorf("select: expected 1, got %d, %v", i, err)
+	}
+	if !strings.HasSuffix(out.String(), "staging\r\n") {
+		t.Errorf("select: expected the choice to be shown, got %q", out.String())
+	}
+	ctx, _ = ask("3")
+	if i, err := api.Select(ctx, options); err != nil || i != 2 {
+		t.Errorf("select: expected 2, got %d, %v", i, err)
+	}
+
+	ctx, out = ask("secrex\x7ft\r")
+	if secret, err := api.Password(ctx, "password:"); err != nil || secret != "secret" {
+		t.Errorf("password: expected secret, got %q, %v", secret, err)
+	}
+	if strings.Contains(out.String(), "secre") {
+		t.Errorf("password: expected masked input, got %q", out.String())
+	}
+}
+
+func TestInteractorLines(t *testing.T) {
+	shell := &Goshell{}
+	stdin := strings.NewReader("yes\n2\nmy secret\nrest\n")
+	var out bytes.Buffer
+	ctx := api.WithStdin(context.Background(), stdin)
+	ctx = api.WithStderr(ctx, &out)
+	ctx = api.WithInteractor(ctx, interactor{shell})
+
+	if yes, err := api.Confirm(ctx, "sure?"); err != nil || !yes {
+		t.Errorf("confirm: expected yes, got %v, %v", yes, err)
+	}
+	if i, err := api.Select(ctx, []string{"a", "b"}); err != nil || i != 1 {
+		t.Errorf("select: expected 1, got %d, %v", i, err)
+	}
+	if secret, err := api.Password(ctx, "password:"); err != nil || secret != "my secret" {
+		t.Errorf("password: expected my secret, got %q, %v", secret, err)
+	}
+	if stdin.Len() != len("rest\n") {
+		t.Errorf("expected the rest of stdin to be left, got %d bytes", stdin.Len())
+	}
+	expected := "sure? [y/N] 1) a\n2) b\n? password: "
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
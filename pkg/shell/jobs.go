@@ -0,0 +1,286 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// job is a pipeline running in the background
+type job struct {
+	id     int
+	line   string
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+func (j *job) finished() bool {
+	select {
+	case <-j.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (j *job) state() string {
+	if !j.finished() {
+		return "Running"
+	}
+	if j.err != nil {
+		return fmt.Sprintf("Exit (%v)", j.err)
+	}
+	return "Done"
+}
+
+func (j *job) String() string {
+	return fmt.Sprintf("[%d]  %-12s %s", j.id, j.state(), j.line)
+}
+
+// jobTable keeps track of background jobs
+type jobTable struct {
+	mu     sync.Mutex
+	nextID int
+	jobs   map[int]*job
+}
+
+func newJobTable() *jobTable {
+	return &jobTable{nextID: 1, jobs: make(map[int]*job)}
+}
+
+// start runs fn in a background goroutine as a new job
+func (t *jobTable) start(ctx context.Context, line string, fn func(context.Context) error) *job {
+	jobCtx, cancel := context.WithCancel(ctx)
+	t.mu.Lock()
+	j := &job{id: t.nextID, line: line, cancel: cancel, done: make(chan struct{})}
+	t.jobs[j.id] = j
+	t.nextID++
+	t.mu.Unlock()
+
+	go func() {
+		defer cancel()
+		j.err = fn(jobCtx)
+		close(j.done)
+	}()
+	return j
+}
+
+// list returns the jobs ordered by id
+func (t *jobTable) list() []*job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	jobs := make([]*job, 0, len(t.jobs))
+	for _, j := range t.jobs {
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].id < jobs[k].id })
+	return jobs
+}
+
+// find returns the job identified by spec ("%n" or "n"), or the
+// most recent job when spec is empty
+func (t *jobTable) find(spec string) (*job, error) {
+	jobs := t.list()
+	if spec == "" {
+		if len(jobs) == 0 {
+			return nil, fmt.Errorf("no current job")
+		}
+		return jobs[len(jobs)-1], nil
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(spec, "%"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid job spec: %s", spec)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	j, ok := t.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("no such job: %s", spec)
+	}
+	return j, nil
+}
+
+func (t *jobTable) remove(j *job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.jobs, j.id)
+}
+
+// cancelAll cancels the running jobs and waits for them to end, or for
+// ctx to be done
+func (t *jobTable) cancelAll(ctx context.Context) {
+	jobs := t.list()
+	for _, j := range jobs {
+		j.cancel()
+	}
+	for _, j := range jobs {
+		select {
+		case <-j.done:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// notify reports jobs that finished since the last call
+// and removes them from the table
+func (t *jobTable) notify(out io.Writer) {
+	for _, j := range t.list() {
+		if j.finished() {
+			fmt.Fprintln(out, j)
+			t.remove(j)
+		}
+	}
+}
+
+// startJob runs a pipeline in the background with stdin detached
+// from the terminal. The job outlives the command line that started it.
+func (gosh *Goshell) startJob(ctx context.Context, node pipelineNode) {
+	if gosh.ctx != nil {
+		ctx = detach(gosh.ctx, ctx)
+	}
+	ctx = apart(api.WithStdin(ctx, strings.NewReader("")), api.Result{})
+	j := gosh.jobs.start(ctx, node.String(), func(ctx context.Context) error {
+		_, _, err := gosh.runNode(ctx, node)
+		return err
+	})
+	fmt.Fprintf(api.GetStderr(ctx), "[%d] %s\n", j.id, j.line)
+}
+
+// jobsCmd lists background jobs
+type jobsCmd struct {
+	jobs *jobTable
+}
+
+func (c jobsCmd) Name() string      { return "jobs" }
+func (c jobsCmd) Usage() string     { return "jobs" }
+func (c jobsCmd) LongDesc() string  { return "" }
+func (c jobsCmd) ShortDesc() string { return `lists background jobs` }
+func (c jobsCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	out := api.GetStdout(ctx)
+	for _, j := range c.jobs.list() {
+		fmt.Fprintln(out, j)
+		if j.finished() {
+			c.jobs.remove(j)
+		}
+	}
+	return ctx, api.Result{}, nil
+}
+
+// fgCmd waits for a background job in the foreground
+type fgCmd struct {
+	jobs *jobTable
+}
+
+func (c fgCmd) Name() string  { return "fg" }
+func (c fgCmd) Usage() string { return "fg [%job]" }
+func (c fgCmd) LongDesc() string {
+	return `Waits for the job to complete. Press Ctrl-Z to send it back to the background.`
+}
+func (c fgCmd) ShortDesc() string { return `brings a background job to the foreground` }
+func (c fgCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	j, err := c.jobs.find(jobSpec(args))
+	if err != nil {
+		return ctx, api.Result{}, err
+	}
+	fmt.Fprintln(api.GetStdout(ctx), j.line)
+
+	suspend := make(chan os.Signal, 1)
+	if len(suspendSignals) > 0 {
+		signal.Notify(suspend, suspendSignals...)
+		defer signal.Stop(suspend)
+	}
+
+	select {
+	case <-j.done:
+		c.jobs.remove(j)
+		return ctx, api.Result{}, j.err
+	case <-suspend:
+		fmt.Fprintf(api.GetStdout(ctx), "\n%s\n", j)
+		return ctx, api.Result{}, nil
+	case <-ctx.Done():
+		return ctx, api.Result{}, ctx.Err()
+	}
+}
+
+// bgCmd resumes a job in the background. Jobs are goroutines that
+// cannot be suspended, so a job left with Ctrl-Z from fg is already
+// running and bg only reports it.
+type bgCmd struct {
+	jobs *jobTable
+}
+
+func (c bgCmd) Name() string      { return "bg" }
+func (c bgCmd) Usage() string     { return "bg [%job]" }
+func (c bgCmd) LongDesc() string  { return "" }
+func (c bgCmd) ShortDesc() string { return `continues a job in the background` }
+func (c bgCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	j, err := c.jobs.find(jobSpec(args))
+	if err != nil {
+		return ctx, api.Result{}, err
+	}
+	fmt.Fprintf(api.GetStdout(ctx), "[%d] %s &\n", j.id, j.line)
+	return ctx, api.Result{}, nil
+}
+
+// killCmd cancels background jobs or signals processes
+type killCmd struct {
+	jobs *jobTable
+}
+
+func (c killCmd) Name() string     { return "kill" }
+func (c killCmd) Usage() string    { return "kill [-signum] %job | pid ..." }
+func (c killCmd) LongDesc() string { return "" }
+func (c killCmd) ShortDesc() string {
+	return `cancels background jobs, or sends a signal (default SIGTERM) to processes`
+}
+func (c killCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	if len(args) < 2 {
+		return ctx, api.Result{}, api.NewUsageError("missing job or pid")
+	}
+	sig := syscall.SIGTERM
+	targets := args[1:]
+	if strings.HasPrefix(targets[0], "-") {
+		num, err := strconv.Atoi(targets[0][1:])
+		if err != nil {
+			return ctx, api.Result{}, fmt.Errorf("kill: invalid signal: %s", targets[0])
+		}
+		sig = syscall.Signal(num)
+		targets = targets[1:]
+	}
+	for _, arg := range targets {
+		if strings.HasPrefix(arg, "%") {
+			j, err := c.jobs.find(arg)
+			if err != nil {
+				return ctx, api.Result{}, err
+			}
+			j.cancel()
+			continue
+		}
+		pid, err := strconv.Atoi(arg)
+		if err != nil {
+			return ctx, api.Result{}, fmt.Errorf("kill: invalid pid: %s", arg)
+		}
+		if err := killProcess(pid, sig); err != nil {
+			return ctx, api.Result{}, fmt.Errorf("kill %d: %v", pid, err)
+		}
+	}
+	return ctx, api.Result{}, nil
+}
+
+func jobSpec(args []string) string {
+	if len(args) > 1 {
+		return args[1]
+	}
+	return ""
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package shell
+
+import (
+	"os"
+	"syscall"
+)
+
+// suspendSignals are the signals of Ctrl-Z, which send a job waited
+// for by fg back to the background
+var suspendSignals = []os.Signal{syscall.SIGTSTP}
+
+// killProcess sends sig to the process pid
+func killProcess(pid int, sig syscall.Signal) error {
+	return syscall.Kill(pid, sig)
+}
@@ -0,0 +1,20 @@
+package shell
+
+import (
+	"os"
+	"syscall"
+)
+
+// suspendSignals is empty: Windows consoles have no Ctrl-Z signal, so a
+// job waited for by fg runs until it completes or is interrupted
+var suspendSignals []os.Signal
+
+// killProcess terminates the process pid. Windows processes cannot be
+// sent signals, so sig is ignored.
+func killProcess(pid int, sig syscall.Signal) error {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return proc.Kill()
+}
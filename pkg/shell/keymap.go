@@ -0,0 +1,297 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// defaultEditingMode is the editing mode of a new shell
+const defaultEditingMode = "emacs"
+
+// errAcceptLine is returned by the accept-line action to end the line
+var errAcceptLine = errors.New("accept line")
+
+// editActions are the editing functions of the line editor that keys
+// are bound to, by their readline names
+var editActions = map[string]func(e *lineEditor) error{
+	"accept-line": func(e *lineEditor) error {
+		e.pos = len(e.buf)
+		e.suggest = false
+		e.refresh()
+		fmt.Fprint(e.out, "\n")
+		return errAcceptLine
+	},
+	"interrupt": func(e *lineEditor) error {
+		e.suggest = false
+		e.refresh()
+		fmt.Fprint(e.out, "^C\n")
+		return errInterrupt
+	},
+	"end-of-file": func(e *lineEditor) error {
+		if len(e.buf) == 0 {
+			fmt.Fprint(e.out, "\n")
+			return io.EOF
+		}
+		e.delete()
+		return nil
+	},
+	"self-insert": func(e *lineEditor) error {
+		keys := []rune(e.key)
+		e.insert(keys[len(keys)-1])
+		return nil
+	},
+	"backward-delete-char":   func(e *lineEditor) error { e.backspace(); return nil },
+	"delete-char":            func(e *lineEditor) error { e.delete(); return nil },
+	"complete":               func(e *lineEditor) error { e.completeWord(); return nil },
+	"beginning-of-line":      func(e *lineEditor) error { e.moveTo(0); return nil },
+	"backward-char":          func(e *lineEditor) error { e.moveTo(e.pos - 1); return nil },
+	"backward-word":          func(e *lineEditor) error { e.moveTo(e.wordStart()); return nil },
+	"kill-line":              func(e *lineEditor) error { e.killLine(); return nil },
+	"unix-line-discard":      func(e *lineEditor) error { e.discardLine(); return nil },
+	"unix-word-rubout":       func(e *lineEditor) error { e.deleteWord(); return nil },
+	"kill-word":              func(e *lineEditor) error { e.killWord(); return nil },
+	"previous-history":       func(e *lineEditor) error { e.historyPrev(); return nil },
+	"next-history":           func(e *lineEditor) error { e.historyNext(); return nil },
+	"reverse-search-history": func(e *lineEditor) error { return e.reverseSearch() },
+	"command-palette":        func(e *lineEditor) error { return e.openPalette() },
+
+	// at the end of the line, the motions forward accept the
+	// suggestion from the history, or its next word
+	"end-of-line": func(e *lineEditor) error {
+		if !e.acceptSuggestion(false) {
+			e.moveTo(len(e.buf))
+		}
+		return nil
+	},
+	"forward-char": func(e *lineEditor) error {
+		if !e.acceptSuggestion(false) {
+			e.moveTo(e.pos + 1)
+		}
+		return nil
+	},
+	"forward-word": func(e *lineEditor) error {
+		if !e.acceptSuggestion(true) {
+			e.moveTo(e.wordEnd())
+		}
+		return nil
+	},
+}
+
+// emacsBindings are the default bindings of the emacs editing mode.
+// The arrow, home, end and delete keys are bound in both the forms
+// terminals send them in.
+var emacsBindings = map[string]string{
+	"\r":     "accept-line",
+	"\n":     "accept-line",
+	"\x03":   "interrupt",
+	"\x04":   "end-of-file",
+	"\x7f":   "backward-delete-char",
+	"\x08":   "backward-delete-char",
+	"\t":     "complete",
+	"\x01":   "beginning-of-line",
+	"\x05":   "end-of-line",
+	"\x02":   "backward-char",
+	"\x06":   "forward-char",
+	"\x0b":   "kill-line",
+	"\x15":   "unix-line-discard",
+	"\x17":   "unix-word-rubout",
+	"\x10":   "command-palette",
+	"\x0e":   "next-history",
+	"\x12":   "reverse-search-history",
+	"\x1bb":  "backward-word",
+	"\x1bf":  "forward-word",
+	"\x1bd":  "kill-word",
+	"\x1b[A": "previous-history",
+	"\x1bOA": "previous-history",
+	"\x1b[B": "next-history",
+	"\x1bOB": "next-history",
+	"\x1b[C": "forward-char",
+	"\x1bOC": "forward-char",
+	"\x1b[D": "backward-char",
+	"\x1bOD": "backward-char",
+	"\x1b[H": "beginning-of-line",
+	"\x1bOH": "beginning-of-line",
+	"\x1b[F": "end-of-line",
+	"\x1bOF": "end-of-line",
+
+	"\x1b[1~": "beginning-of-line",
+	"\x1b[7~": "beginning-of-line",
+	"\x1b[4~": "end-of-line",
+	"\x1b[8~": "end-of-line",
+	"\x1b[3~": "delete-char",
+}
+
+// editingModes are the default bindings of each editing mode
+var editingModes = map[string]map[string]string{
+	"emacs": emacsBindings,
+}
+
+// keymap binds key sequences to the editing actions of the line editor.
+// Keys that are not bound insert themselves when they are printable.
+type keymap struct {
+	mode     string
+	bindings map[string]string
+}
+
+// newKeymap returns the default bindings of an editing mode
+func newKeymap(mode string) (*keymap, error) {
+	bindings, ok := editingModes[mode]
+	if !ok {
+		return nil, fmt.Errorf("unknown editing mode %q", mode)
+	}
+	k := &keymap{mode: mode, bindings: make(map[string]string)}
+	for seq, action := range bindings {
+		k.bindings[seq] = action
+	}
+	return k, nil
+}
+
+// defaultKeymap returns the bindings of the default editing mode
+func defaultKeymap() *keymap {
+	k, _ := newKeymap(defaultEditingMode)
+	return k
+}
+
+func (k *keymap) clone() *keymap {
+	c := &keymap{mode: k.mode, bindings: make(map[string]string)}
+	for seq, action := range k.bindings {
+		c.bindings[seq] = action
+	}
+	return c
+}
+
+// bind binds the key sequence seq, in readline notation, to action
+func (k *keymap) bind(seq, action string) error {
+	keys, err := parseKeySeq(seq)
+	if err != nil {
+		return err
+	}
+	if _, ok := editActions[action]; !ok {
+		return fmt.Errorf("unknown editing action %q", action)
+	}
+	k.bindings[keys] = action
+	return nil
+}
+
+// unbind removes the binding of the key sequence seq
+func (k *keymap) unbind(seq string) error {
+	keys, err := parseKeySeq(seq)
+	if err != nil {
+		return err
+	}
+	if _, ok := k.bindings[keys]; !ok {
+		return fmt.Errorf("%s is not bound", seq)
+	}
+	delete(k.bindings, keys)
+	return nil
+}
+
+// lookup returns the action bound to the keys
+func (k *keymap) lookup(keys string) (string, bool) {
+	action, ok := k.bindings[keys]
+	return action, ok
+}
+
+// isPrefix reports whether keys start a longer bound sequence
+func (k *keymap) isPrefix(keys string) bool {
+	for seq := range k.bindings {
+		if len(seq) > len(keys) && strings.HasPrefix(seq, keys) {
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the bound key sequences in readline notation with their
+// actions, sorted by sequence
+func (k *keymap) list() [][2]string {
+	var list [][2]string
+	for keys, action := range k.bindings {
+		list = append(list, [2]string{formatKeySeq(keys), action})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i][0] < list[j][0] })
+	return list
+}
+
+// parseKeySeq parses a key sequence in readline notation: \C-x for
+// Control-x, \M-x or \ex for Meta-x, as Escape then x, and the escapes
+// \e, \t, \n, \r, \\, \" and \' for the keys they stand for. The caret
+// notation of bindkey, ^X for Control-x, is accepted as well.
+func parseKeySeq(s string) (string, error) {
+	var keys []rune
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '^' && i+1 < len(runes):
+			i++
+			keys = append(keys, control(runes[i]))
+		case r == '\\' && i+1 < len(runes):
+			i++
+			switch runes[i] {
+			case 'C', 'M':
+				if i+2 >= len(runes) || runes[i+1] != '-' {
+					return "", fmt.Errorf("invalid key sequence %q", s)
+				}
+				mod := runes[i]
+				i += 2
+				key := runes[i]
+				if mod == 'C' {
+					keys = append(keys, control(key))
+				} else {
+					keys = append(keys, keyEscape, key)
+				}
+			case 'e':
+				keys = append(keys, keyEscape)
+			case 't':
+				keys = append(keys, '\t')
+			case 'n':
+				keys = append(keys, '\n')
+			case 'r':
+				keys = append(keys, '\r')
+			case '\\', '"', '\'':
+				keys = append(keys, runes[i])
+			default:
+				return "", fmt.Errorf("invalid key sequence %q", s)
+			}
+		default:
+			keys = append(keys, r)
+		}
+	}
+	if len(keys) == 0 {
+		return "", errors.New("empty key sequence")
+	}
+	return string(keys), nil
+}
+
+// control returns the control character of r, ? standing for Delete
+func control(r rune) rune {
+	if r == '?' {
+		return keyBackspace
+	}
+	return unicode.ToUpper(r) & 0x1f
+}
+
+// formatKeySeq formats keys in the readline notation of parseKeySeq
+func formatKeySeq(keys string) string {
+	var b strings.Builder
+	for _, r := range keys {
+		switch {
+		case r == keyEscape:
+			b.WriteString(`\e`)
+		case r == keyBackspace:
+			b.WriteString(`\C-?`)
+		case r < ' ':
+			fmt.Fprintf(&b, `\C-%c`, unicode.ToLower(r|0x40))
+		case r == '\\' || r == '"':
+			b.WriteString(`\` + string(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
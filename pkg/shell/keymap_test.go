@@ -0,0 +1,62 @@
+package shell
+
+import (
+	"bufio"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestParseKeySeq(t *testing.T) {
+	tests := []struct {
+		seq  string
+		keys string
+		text string
+	}{
+		{`\C-a`, "\x01", `\C-a`},
+		{`^T`, "\x14", `\C-t`},
+		{`\M-b`, "\x1bb", `\eb`},
+		{`\e[A`, "\x1b[A", `\e[A`},
+		{`\C-?`, "\x7f", `\C-?`},
+		{`x\\`, `x\`, `x\\`},
+	}
+	for _, test := range tests {
+		keys, err := parseKeySeq(test.seq)
+		if err != nil || keys != test.keys {
+			t.Errorf("%s: expected %q, got %q: %v", test.seq, test.keys, keys, err)
+		}
+		if text := formatKeySeq(keys); text != test.text {
+			t.Errorf("%s: expected to format as %s, got %s", test.seq, test.text, text)
+		}
+	}
+	for _, seq := range []string{"", `\C`, `\q`} {
+		if _, err := parseKeySeq(seq); err == nil {
+			t.Errorf("%q: expected an error", seq)
+		}
+	}
+}
+
+func TestLineEditorKeymap(t *testing.T) {
+	keys := defaultKeymap()
+	if err := keys.bind(`\C-t`, "kill-word"); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.unbind(`\C-a`); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.bind(`\C-t`, "no-such-action"); err == nil {
+		t.Error("expected unknown actions to be refused")
+	}
+
+	// Ctrl-A no longer moves to the start, and binding Escape alone
+	// keeps the sequences it starts when they are sent at once
+	keys.bind(`\e`, "end-of-line")
+	in := bufio.NewReader(strings.NewReader("hello bad world\x1bb\x1bb\x14\x01\r"))
+	line, err := newLineEditor(in, ioutil.Discard, ">", keys, newHistory("", 10), nil).readLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != "hello  world\n" {
+		t.Errorf("unexpected line %q", line)
+	}
+}
@@ -0,0 +1,292 @@
+package shell
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+const indexFileName = "plugins.json"
+
+// defaultIndexPath returns the path of the plugin index in the user
+// cache directory
+func defaultIndexPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "gosh", indexFileName)
+}
+
+// pluginIndex maps Go plugin files to the commands they provide, so that
+// a plugin seen before is only opened the first time one of its commands
+// is run. An entry is valid as long as the file keeps its modification
+// time and size.
+type pluginIndex struct {
+	path    string
+	entries map[string]indexEntry
+	dirty   bool
+}
+
+type indexEntry struct {
+	ModTime  time.Time                  `json:"mod_time"`
+	Size     int64                      `json:"size"`
+	Commands map[string]api.CommandInfo `json:"commands"`
+	Segments []string                   `json:"segments,omitempty"`
+	Banner   bool                       `json:"banner,omitempty"`
+}
+
+// loadPluginIndex reads the index at path. A missing or unreadable
+// index is empty.
+func loadPluginIndex(path string) *pluginIndex {
+	index := &pluginIndex{path: path, entries: make(map[string]indexEntry)}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return index
+	}
+	if err := json.Unmarshal(data, &index.entries); err != nil {
+		index.entries = make(map[string]indexEntry)
+	}
+	return index
+}
+
+// lookup returns the entry of a plugin file if it is up to date
+func (idx *pluginIndex) lookup(path string, info os.FileInfo) (indexEntry, bool) {
+	entry, ok := idx.entries[absPath(path)]
+	if !ok || !entry.ModTime.Equal(info.ModTime()) || entry.Size != info.Size() {
+		return indexEntry{}, false
+	}
+	return entry, true
+}
+
+// record stores the commands of an opened plugin
+func (idx *pluginIndex) record(plug *pluginFile) {
+	entry := indexEntry{
+		ModTime:  plug.modTime,
+		Size:     plug.size,
+		Commands: make(map[string]api.CommandInfo),
+	}
+	for name, cmd := range plug.registry {
+		info := api.CommandInfo{
+			Name:      name,
+			Usage:     cmd.Usage(),
+			ShortDesc: cmd.ShortDesc(),
+			LongDesc:  cmd.LongDesc(),
+		}
+		if flagger, ok := cmd.(api.Flagger); ok {
+			info.Flags = flagger.Flags()
+		}
+		if describer, ok := cmd.(api.Describer); ok {
+			info.Category = describer.Category()
+			info.Examples = describer.Examples()
+		}
+		if restricted, ok := cmd.(api.Restricted); ok {
+			info.Roles = restricted.Roles()
+		}
+		if cacheable, ok := cmd.(api.Cacheable); ok {
+			info.CacheTTL = cacheable.CacheTTL()
+		}
+		entry.Commands[name] = info
+	}
+	if segmenter, ok := plug.module.(api.PromptSegmenter); ok {
+		for name := range segmenter.PromptSegments() {
+			entry.Segments = append(entry.Segments, name)
+		}
+		sort.Strings(entry.Segments)
+	}
+	_, entry.Banner = plug.module.(api.Banner)
+	idx.entries[absPath(plug.path)] = entry
+	idx.dirty = true
+}
+
+// save writes the index if it changed, dropping the entries of files
+// that no longer exist
+func (idx *pluginIndex) save() error {
+	for path := range idx.entries {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			delete(idx.entries, path)
+			idx.dirty = true
+		}
+	}
+	if !idx.dirty {
+		return nil
+	}
+	data, err := json.MarshalIndent(idx.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(idx.path), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(idx.path, data, 0644); err != nil {
+		return err
+	}
+	idx.dirty = false
+	return nil
+}
+
+// indexPlugin records the commands of an opened Go plugin in the index
+func (gosh *Goshell) indexPlugin(plug *pluginFile) {
+	if gosh.indexPath == "" || !strings.HasSuffix(plug.path, ".so") {
+		return
+	}
+	if gosh.index == nil {
+		gosh.index = loadPluginIndex(gosh.indexPath)
+	}
+	gosh.index.record(plug)
+}
+
+// saveIndex writes the plugin index
+func (gosh *Goshell) saveIndex() {
+	if gosh.index == nil {
+		return
+	}
+	if err := gosh.index.save(); err != nil {
+		gosh.log().Warn("failed to save plugin index", "err", err)
+	}
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// lazyPlugin returns a plugin that is opened on first use when the
+// index has an up to date entry for the Go plugin file
+func (gosh *Goshell) lazyPlugin(dir string, file os.FileInfo, version int) (*pluginFile, bool) {
+	if gosh.indexPath == "" || !strings.HasSuffix(file.Name(), ".so") {
+		return nil, false
+	}
+	if gosh.index == nil {
+		gosh.index = loadPluginIndex(gosh.indexPath)
+	}
+	path := filepath.Join(dir, file.Name())
+	entry, ok := gosh.index.lookup(path, file)
+	if !ok {
+		return nil, false
+	}
+	// the manifest is checked again when the plugin opens; one that
+	// does not load has the plugin opened now to report the error
+	manifest, err := loadManifest(path)
+	if err != nil {
+		return nil, false
+	}
+	plug := &pluginFile{
+		path:     path,
+		dir:      dir,
+		modTime:  file.ModTime(),
+		size:     file.Size(),
+		version:  version,
+		registry: make(map[string]api.Command),
+		segments: entry.Segments,
+		banner:   entry.Banner,
+		manifest: manifest,
+		lazy:     true,
+	}
+	for name, info := range entry.Commands {
+		plug.registry[name] = &lazyCmd{gosh: gosh, plug: plug, info: info}
+	}
+	return plug, true
+}
+
+// openLazy opens a lazily loaded plugin the first time it is needed and
+// returns its commands
+func (gosh *Goshell) openLazy(plug *pluginFile) (map[string]api.Command, error) {
+	plug.mu.Lock()
+	defer plug.mu.Unlock()
+	if plug.commands != nil || plug.loadErr != nil {
+		return plug.commands, plug.loadErr
+	}
+	info, err := os.Stat(plug.path)
+	if err != nil {
+		plug.loadErr = err
+		return nil, err
+	}
+	opened, err := gosh.openPlugin(gosh.ctx, plug.dir, info, plug.version)
+	if err != nil {
+		plug.loadErr = err
+		return nil, err
+	}
+	plug.module = opened.module
+	plug.commands = opened.registry
+	return plug.commands, nil
+}
+
+// lazyCmd stands for a command of a plugin that is not opened yet. Its
+// descriptions come from the index; running it opens the plugin.
+type lazyCmd struct {
+	gosh *Goshell
+	plug *pluginFile
+	info api.CommandInfo
+}
+
+func (c *lazyCmd) Name() string            { return c.info.Name }
+func (c *lazyCmd) Usage() string           { return c.info.Usage }
+func (c *lazyCmd) ShortDesc() string       { return c.info.ShortDesc }
+func (c *lazyCmd) LongDesc() string        { return c.info.LongDesc }
+func (c *lazyCmd) Flags() []api.Flag       { return c.info.Flags }
+func (c *lazyCmd) Category() string        { return c.info.Category }
+func (c *lazyCmd) Examples() []api.Example { return c.info.Examples }
+func (c *lazyCmd) Roles() []string         { return c.info.Roles }
+func (c *lazyCmd) CacheTTL() time.Duration { return c.info.CacheTTL }
+
+// command returns the command of the opened plugin
+func (c *lazyCmd) command() (api.Command, error) {
+	commands, err := c.gosh.openLazy(c.plug)
+	if err != nil {
+		return nil, err
+	}
+	cmd, ok := commands[c.info.Name]
+	if !ok {
+		return nil, fmt.Errorf("plugin %s does not provide command %s", filepath.Base(c.plug.path), c.info.Name)
+	}
+	return cmd, nil
+}
+
+func (c *lazyCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	cmd, err := c.command()
+	if err != nil {
+		return ctx, api.Result{}, err
+	}
+	return cmd.Exec(ctx, args)
+}
+
+// Complete opens the plugin to complete the arguments of its command
+func (c *lazyCmd) Complete(ctx context.Context, args []string, cursorPos int) []string {
+	cmd, err := c.command()
+	if err != nil {
+		return nil
+	}
+	if completer, ok := cmd.(api.Completer); ok {
+		return completer.Complete(ctx, args, cursorPos)
+	}
+	return nil
+}
+
+// lazySegment returns a prompt segment that opens a lazily loaded plugin
+// to render its segment. It renders nothing if the plugin fails to open.
+func (gosh *Goshell) lazySegment(plug *pluginFile, name string) api.PromptSegment {
+	return func(ctx context.Context) string {
+		if _, err := gosh.openLazy(plug); err != nil {
+			return ""
+		}
+		segmenter, ok := plug.module.(api.PromptSegmenter)
+		if !ok {
+			return ""
+		}
+		if segment, ok := segmenter.PromptSegments()[name]; ok {
+			return segment(ctx)
+		}
+		return ""
+	}
+}
@@ -0,0 +1,57 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestShellLazyPlugins(t *testing.T) {
+	indexPath := filepath.Join(t.TempDir(), indexFileName)
+
+	// the first run opens the plugins and indexes their commands
+	shell := newTestShell()
+	shell.indexPath = indexPath
+	if err := shell.Init(api.WithStdout(context.TODO(), bytes.NewBufferString(""))); err != nil {
+		t.Fatal(err)
+	}
+	if len(loadPluginIndex(indexPath).entries) == 0 {
+		t.Fatal("plugins should be indexed")
+	}
+
+	// the next run only opens a plugin when one of its commands runs
+	shell = newTestShell()
+	shell.indexPath = indexPath
+	out := bytes.NewBufferString("")
+	if err := shell.Init(api.WithStdout(context.TODO(), out)); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("plugins should not be initialized yet: %q", out.String())
+	}
+	cmd, _ := shell.commands.Lookup("hello")
+	hello, ok := cmd.(*lazyCmd)
+	if !ok {
+		t.Fatalf("expected a lazy command, got %T", cmd)
+	}
+	if hello.ShortDesc() != `prints greeting "hello there"` {
+		t.Errorf("description should come from the index: %q", hello.ShortDesc())
+	}
+	if hello.plug.opened() {
+		t.Error("plugin should not be opened yet")
+	}
+
+	if _, err := shell.handle(shell.ctx, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "hello there") {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+	if !hello.plug.opened() {
+		t.Error("plugin should be opened by its first command")
+	}
+}
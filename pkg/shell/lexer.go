@@ -0,0 +1,521 @@
+package shell
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	errUnterminatedQuote = errors.New("syntax error: unterminated quote")
+	errUnterminatedSubst = errors.New("syntax error: unterminated command substitution")
+	errUnterminatedHere  = errors.New("syntax error: unterminated here-document")
+)
+
+// quoteKind describes how a part of a word was quoted
+type quoteKind int
+
+const (
+	unquoted quoteKind = iota
+	// literal text comes from single quotes or backslash escapes
+	literal
+	doubleQuoted
+)
+
+// wordPart is a run of characters in a word sharing the same quoting,
+// or, when subst is set, the command line of a command substitution
+// $(...), unquoted or in double quotes
+type wordPart struct {
+	text  string
+	quote quoteKind
+	subst bool
+}
+
+// word is a shell word made of parts. Quoting is kept so that later
+// expansion stages can tell which characters were quoted.
+type word []wordPart
+
+// String returns the text of the word with quotes removed
+func (w word) String() string {
+	var b strings.Builder
+	for _, part := range w {
+		if part.subst {
+			b.WriteString("$(" + part.text + ")")
+			continue
+		}
+		b.WriteString(part.text)
+	}
+	return b.String()
+}
+
+// operators recognized by the lexer, longest first
+var operators = []string{"&&", "||", ">>", "<<<", "<<", "|&", "|", ">", "<", ";", "&"}
+
+// token is either an operator or a word. The << operator of a
+// here-document holds its body.
+type token struct {
+	op   string
+	word word
+	body word
+}
+
+// lexer splits a command line into tokens, handling single quotes,
+// double quotes and backslash escapes. An unquoted # at the start
+// of a word begins a comment that runs to the end of the line. An
+// unquoted newline is a "\n" operator, of which consecutive ones and
+// those leading the line are dropped. The bodies of the here-documents
+// of a line follow the newline ending it.
+type lexer struct {
+	input []rune
+	pos   int
+
+	tokens []token
+	word   word
+	inWord bool
+	buf    []rune
+	quote  quoteKind
+
+	// heredocs are the indexes of the << tokens whose body is not
+	// read yet
+	heredocs []int
+}
+
+// lex splits line into operator and word tokens
+func lex(line string) ([]token, error) {
+	l := &lexer{input: []rune(line)}
+	if err := l.run(); err != nil {
+		return nil, err
+	}
+	return l.tokens, nil
+}
+
+func (l *lexer) run() error {
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			l.endWord()
+			l.pos++
+		case c == '\n':
+			l.endWord()
+			if n := len(l.tokens); n > 0 && l.tokens[n-1].op != "\n" {
+				l.tokens = append(l.tokens, token{op: "\n"})
+			}
+			l.pos++
+			if err := l.heredocBodies(); err != nil {
+				return err
+			}
+		case c == '\\':
+			if l.pos+1 >= len(l.input) {
+				l.pos++
+				continue
+			}
+			l.addPart(string(l.input[l.pos+1]), literal)
+			l.pos += 2
+		case c == '\'':
+			end := l.indexFrom(l.pos+1, '\'')
+			if end < 0 {
+				return errUnterminatedQuote
+			}
+			l.addPart(string(l.input[l.pos+1:end]), literal)
+			l.inWord = true
+			l.pos = end + 1
+		case c == '"':
+			if err := l.doubleQuote(); err != nil {
+				return err
+			}
+		case c == '#' && !l.inWord:
+			for l.pos < len(l.input) && l.input[l.pos] != '\n' {
+				l.pos++
+			}
+		case c == '2' && !l.inWord && l.hasPrefix("2>"):
+			l.addOp("2>")
+		case c == '$' && l.hasPrefix("$("):
+			if err := l.substitution(unquoted); err != nil {
+				return err
+			}
+		default:
+			if op := l.operator(); op != "" {
+				l.endWord()
+				if op == "<<" {
+					l.heredocs = append(l.heredocs, len(l.tokens))
+				}
+				l.addOp(op)
+				continue
+			}
+			l.addRune(c, unquoted)
+			l.pos++
+		}
+	}
+	l.endWord()
+	if len(l.heredocs) > 0 {
+		return errUnterminatedHere
+	}
+	return nil
+}
+
+// heredocBodies reads the bodies of the pending here-documents, in
+// order, from the start of a line. A body ends at the line made of its
+// delimiter alone. The variables and command substitutions of a body
+// are expanded unless its delimiter is quoted, as in <<'EOF'.
+func (l *lexer) heredocBodies() error {
+	for _, i := range l.heredocs {
+		if i+1 >= len(l.tokens) || l.tokens[i+1].op != "" {
+			// the parser reports the missing delimiter
+			continue
+		}
+		delim := l.tokens[i+1].word
+		text, end, ok := heredocBody(l.input, l.pos, delim.String())
+		if !ok {
+			return errUnterminatedHere
+		}
+		l.pos = end
+		if _, ok := unquotedWord(delim); !ok {
+			l.tokens[i].body = word{{text: text, quote: literal}}
+			continue
+		}
+		body, err := lexHeredoc(text)
+		if err != nil {
+			return err
+		}
+		l.tokens[i].body = body
+	}
+	l.heredocs = nil
+	return nil
+}
+
+// heredocBody returns the lines of input from start up to the line
+// delim, and the position following that line. It reports false when
+// no line ends the body.
+func heredocBody(input []rune, start int, delim string) (string, int, bool) {
+	var b strings.Builder
+	for pos := start; pos < len(input); {
+		end := pos
+		for end < len(input) && input[end] != '\n' {
+			end++
+		}
+		line := strings.TrimSuffix(string(input[pos:end]), "\r")
+		if end < len(input) {
+			end++
+		}
+		if line == delim {
+			return b.String(), end, true
+		}
+		b.WriteString(line + "\n")
+		pos = end
+	}
+	return "", len(input), false
+}
+
+// lexHeredoc lexes the body of a here-document like the inside of
+// double quotes, but for ", which is not special
+func lexHeredoc(text string) (word, error) {
+	l := &lexer{input: []rune(text), quote: doubleQuoted}
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		switch {
+		case c == '\\' && l.pos+1 < len(l.input) && strings.ContainsRune("\\$`", l.input[l.pos+1]):
+			l.addPart(string(l.input[l.pos+1]), literal)
+			l.pos += 2
+		case c == '$' && l.hasPrefix("$("):
+			if err := l.substitution(doubleQuoted); err != nil {
+				return nil, err
+			}
+		default:
+			l.addRune(c, doubleQuoted)
+			l.pos++
+		}
+	}
+	l.flushPart()
+	if l.word == nil {
+		return word{{quote: literal}}, nil
+	}
+	return l.word, nil
+}
+
+// doubleQuote lexes a double quoted string. Inside double quotes a
+// backslash only escapes ", \, $ and `.
+func (l *lexer) doubleQuote() error {
+	l.inWord = true
+	l.pos++
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return nil
+		case c == '\\' && l.pos+1 < len(l.input) && strings.ContainsRune("\"\\$`", l.input[l.pos+1]):
+			l.addPart(string(l.input[l.pos+1]), literal)
+			l.pos += 2
+		case c == '$' && l.hasPrefix("$("):
+			if err := l.substitution(doubleQuoted); err != nil {
+				return err
+			}
+		default:
+			l.addRune(c, doubleQuoted)
+			l.pos++
+		}
+	}
+	return errUnterminatedQuote
+}
+
+// substitution lexes a command substitution $(...) up to its matching
+// parenthesis. The parentheses of quoted strings and escapes inside are
+// skipped, and substitutions nest.
+func (l *lexer) substitution(quote quoteKind) error {
+	start := l.pos + 2
+	depth := 1
+	for i := start; i < len(l.input); i++ {
+		switch l.input[i] {
+		case '\\':
+			i++
+		case '\'':
+			if i = l.indexFrom(i+1, '\''); i < 0 {
+				return errUnterminatedQuote
+			}
+		case '"':
+			for i++; i < len(l.input) && l.input[i] != '"'; i++ {
+				if l.input[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(l.input) {
+				return errUnterminatedQuote
+			}
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				l.flushPart()
+				l.word = append(l.word, wordPart{text: string(l.input[start:i]), quote: quote, subst: true})
+				l.inWord = true
+				l.pos = i + 1
+				return nil
+			}
+		}
+	}
+	return errUnterminatedSubst
+}
+
+func (l *lexer) operator() string {
+	for _, op := range operators {
+		if l.hasPrefix(op) {
+			return op
+		}
+	}
+	return ""
+}
+
+func (l *lexer) hasPrefix(s string) bool {
+	return strings.HasPrefix(string(l.input[l.pos:]), s)
+}
+
+func (l *lexer) indexFrom(start int, c rune) int {
+	for i := start; i < len(l.input); i++ {
+		if l.input[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+func (l *lexer) addOp(op string) {
+	l.tokens = append(l.tokens, token{op: op})
+	l.pos += len([]rune(op))
+}
+
+// addRune appends c to the current part, starting a new part
+// when the quoting changes
+func (l *lexer) addRune(c rune, quote quoteKind) {
+	if l.quote != quote {
+		l.flushPart()
+		l.quote = quote
+	}
+	l.buf = append(l.buf, c)
+	l.inWord = true
+}
+
+func (l *lexer) addPart(text string, quote quoteKind) {
+	l.flushPart()
+	l.word = append(l.word, wordPart{text: text, quote: quote})
+	l.inWord = true
+}
+
+func (l *lexer) flushPart() {
+	if len(l.buf) > 0 {
+		l.word = append(l.word, wordPart{text: string(l.buf), quote: l.quote})
+		l.buf = nil
+	}
+}
+
+func (l *lexer) endWord() {
+	l.flushPart()
+	if l.inWord {
+		if l.word == nil {
+			// an empty quoted string is still a word
+			l.word = word{{quote: literal}}
+		}
+		l.tokens = append(l.tokens, token{word: l.word})
+	}
+	l.word = nil
+	l.inWord = false
+}
+
+// incomplete reports whether input is a statement that continues on
+// the next line: it ends with a backslash or with one of the operators
+// |, |&, && and ||, or it has an unterminated quote, an unclosed brace, an
+// unclosed command substitution, an if, for or while command without
+// its fi or done or a here-document without its delimiter line
+func incomplete(input string) bool {
+	more, _ := scanStatement(input)
+	return more
+}
+
+// scanStatement reports whether input is incomplete and whether that
+// is because of a trailing backslash escaping the newline
+func scanStatement(input string) (more, escapedNewline bool) {
+	runes := []rune(strings.TrimRight(input, "\r\n"))
+	var quote rune
+	var heredocs []string
+	depth := 0
+	pendingOp, amp := false, false
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		if quote == '\'' {
+			if c == '\'' {
+				quote = 0
+			}
+			continue
+		}
+		if c == '\\' {
+			if i+1 == len(runes) {
+				return true, true
+			}
+			i++
+			pendingOp, amp = false, false
+			continue
+		}
+		if quote == '"' {
+			if c == '"' {
+				quote = 0
+			}
+			continue
+		}
+		switch {
+		case c == '\n' && len(heredocs) > 0:
+			for _, delim := range heredocs {
+				_, end, ok := heredocBody(runes, i+1, delim)
+				if !ok {
+					return true, false
+				}
+				i = end - 1
+			}
+			heredocs = nil
+			continue
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			continue
+		case c == '<' && i+2 < len(runes) && runes[i+1] == '<' && runes[i+2] == '<':
+			i += 2
+			pendingOp = false
+		case c == '<' && i+1 < len(runes) && runes[i+1] == '<':
+			var delim string
+			delim, i = heredocDelim(runes, i+2)
+			heredocs = append(heredocs, delim)
+			pendingOp = false
+		case c == '#' && (i == 0 || strings.ContainsRune(" \t\n;|&", runes[i-1])):
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+			continue
+		case c == '&' && i > 0 && runes[i-1] == '|':
+			// |& pipes like |
+		case c == '&':
+			pendingOp, amp = amp, !amp
+			continue
+		case c == '|':
+			pendingOp = true
+		case c == '\'' || c == '"':
+			quote = c
+			pendingOp = false
+		case c == '{' || (c == '(' && i > 0 && runes[i-1] == '$'):
+			depth++
+			pendingOp = false
+		case c == '}' || c == ')':
+			if depth > 0 {
+				depth--
+			}
+			pendingOp = false
+		default:
+			pendingOp = false
+		}
+		amp = false
+	}
+	if quote != 0 || depth > 0 || pendingOp || len(heredocs) > 0 {
+		return true, false
+	}
+	tokens, err := lex(string(runes))
+	return err == nil && openCompounds(tokens) > 0, false
+}
+
+// heredocDelim returns the delimiter of a here-document starting at
+// start, with its quotes removed, and the index of its last character
+func heredocDelim(runes []rune, start int) (string, int) {
+	i := start
+	for i < len(runes) && (runes[i] == ' ' || runes[i] == '\t') {
+		i++
+	}
+	var b strings.Builder
+	for ; i < len(runes) && !strings.ContainsRune(" \t\r\n;|&<>()", runes[i]); i++ {
+		switch c := runes[i]; c {
+		case '\\':
+			if i+1 < len(runes) {
+				i++
+				b.WriteRune(runes[i])
+			}
+		case '\'', '"':
+			for i++; i < len(runes) && runes[i] != c; i++ {
+				b.WriteRune(runes[i])
+			}
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String(), i - 1
+}
+
+// openCompounds returns how many of the if, for and while commands of
+// tokens are not closed by their fi or done
+func openCompounds(tokens []token) int {
+	depth := 0
+	cmdPos := true
+	for _, tok := range tokens {
+		if tok.op != "" {
+			cmdPos = isPipeOp(tok.op) || isListOp(tok.op)
+			continue
+		}
+		name, _ := unquotedWord(tok.word)
+		if !cmdPos || !reservedWords[name] {
+			cmdPos = false
+			continue
+		}
+		switch name {
+		case "if", "for", "while":
+			depth++
+		case "fi", "done":
+			depth--
+		}
+		// names follow for and fn, commands follow the others
+		cmdPos = name != "for" && name != "fn"
+	}
+	return depth
+}
+
+// continueLine appends a continuation line to an incomplete statement.
+// A trailing backslash and its newline are removed; otherwise the
+// newline is kept, so that it stays part of a quoted string.
+func continueLine(input, line string) string {
+	trimmed := strings.TrimRight(input, "\r\n")
+	if _, escaped := scanStatement(trimmed); escaped {
+		return strings.TrimSuffix(trimmed, `\`) + line
+	}
+	return trimmed + "\n" + line
+}
@@ -0,0 +1,164 @@
+package shell
+
+import (
+	"reflect"
+	"testing"
+)
+
+func tokenStrings(tokens []token) []string {
+	var strs []string
+	for _, tok := range tokens {
+		if tok.op != "" {
+			strs = append(strs, tok.op)
+			continue
+		}
+		strs = append(strs, tok.word.String())
+	}
+	return strs
+}
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		line   string
+		tokens []string
+	}{
+		{`echo hello world`, []string{"echo", "hello", "world"}},
+		{`echo "hello world"`, []string{"echo", "hello world"}},
+		{`echo 'it''s'`, []string{"echo", "its"}},
+		{`echo "it's \"quoted\""`, []string{"echo", `it's "quoted"`}},
+		{`echo hello\ world \\`, []string{"echo", "hello world", `\`}},
+		{`echo "a\nb"`, []string{"echo", `a\nb`}},
+		{`echo ""`, []string{"echo", ""}},
+		{`hello|tr a-z A-Z>out`, []string{"hello", "|", "tr", "a-z", "A-Z", ">", "out"}},
+		{`cmd 2>err >>out <in`, []string{"cmd", "2>", "err", ">>", "out", "<", "in"}},
+		{`echo a2>b "|"`, []string{"echo", "a2", ">", "b", "|"}},
+		{`echo a#b '#' # comment`, []string{"echo", "a#b", "#"}},
+	}
+	for _, test := range tests {
+		tokens, err := lex(test.line)
+		if err != nil {
+			t.Errorf("%s: %v", test.line, err)
+			continue
+		}
+		if got := tokenStrings(tokens); !reflect.DeepEqual(got, test.tokens) {
+			t.Errorf("%s: expected %q, got %q", test.line, test.tokens, got)
+		}
+	}
+}
+
+func TestLexQuoting(t *testing.T) {
+	tokens, err := lex(`a'b'"c"\d`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := word{{text: "a", quote: unquoted}, {text: "b", quote: literal}, {text: "c", quote: doubleQuoted}, {text: "d", quote: literal}}
+	if !reflect.DeepEqual(tokens[0].word, expected) {
+		t.Errorf("unexpected word parts: %v", tokens[0].word)
+	}
+
+	for _, line := range []string{`echo "hello`, `echo 'hello`} {
+		if _, err := lex(line); err != errUnterminatedQuote {
+			t.Errorf("%s: expected unterminated quote error, got %v", line, err)
+		}
+	}
+}
+
+func TestLexSubstitution(t *testing.T) {
+	tokens, err := lex(`a$(ls "x)" $(pwd))"b $(echo ')')"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := word{
+		{text: "a", quote: unquoted},
+		{text: `ls "x)" $(pwd)`, quote: unquoted, subst: true},
+		{text: "b ", quote: doubleQuoted},
+		{text: `echo ')'`, quote: doubleQuoted, subst: true},
+	}
+	if len(tokens) != 1 || !reflect.DeepEqual(tokens[0].word, expected) {
+		t.Errorf("unexpected tokens: %v", tokens)
+	}
+	if _, err := lex("echo $(ls (x)"); err != errUnterminatedSubst {
+		t.Errorf("expected unterminated substitution error, got %v", err)
+	}
+}
+
+func TestLexHeredoc(t *testing.T) {
+	tokens, err := lex("cat <<EOF; cat <<'END'\nhi $USER \\$ \"$(pwd)\"\nEOF\n$USER\nEND\necho")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 9 || tokens[1].op != "<<" || tokens[5].op != "<<" {
+		t.Fatalf("unexpected tokens: %v", tokens)
+	}
+	expected := word{
+		{text: "hi $USER ", quote: doubleQuoted},
+		{text: "$", quote: literal},
+		{text: ` "`, quote: doubleQuoted},
+		{text: "pwd", quote: doubleQuoted, subst: true},
+		{text: "\"\n", quote: doubleQuoted},
+	}
+	if !reflect.DeepEqual(tokens[1].body, expected) {
+		t.Errorf("unexpected body: %v", tokens[1].body)
+	}
+	if expected := (word{{text: "$USER\n", quote: literal}}); !reflect.DeepEqual(tokens[5].body, expected) {
+		t.Errorf("unexpected quoted body: %v", tokens[5].body)
+	}
+	if tokens[8].word.String() != "echo" {
+		t.Errorf("expected the command following the bodies, got %v", tokens[8])
+	}
+
+	for _, line := range []string{"cat <<EOF", "cat <<EOF\nhi\nEOF2"} {
+		if _, err := lex(line); err != errUnterminatedHere {
+			t.Errorf("%q: expected unterminated here-document error, got %v", line, err)
+		}
+	}
+}
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input string
+		more  bool
+	}{
+		{"echo hello\n", false},
+		{"echo hello \\\n", true},
+		{`echo hello \\`, false},
+		{`echo "hello`, true},
+		{"echo 'it\\", true},
+		{`echo "a" 'b'`, false},
+		{"ls |", true},
+		{"make |&", true},
+		{"make |& tee log", false},
+		{"true && # comment", true},
+		{"sleep 1 &", false},
+		{`echo \|`, false},
+		{"echo ${HOME", true},
+		{"echo {a} }", false},
+		{"echo $(ls", true},
+		{"echo $(ls $(pwd))", false},
+		{"if ok; then", true},
+		{"if ok; then a; fi", false},
+		{"for x in a b; do\necho done", true},
+		{"while a; do if b; then c; fi", true},
+		{"while a; do if b; then c; fi; done", false},
+		{"echo 'while' if; for x in 'done'", true},
+		{"fn deploy() {\n build", true},
+		{"fn deploy() {\n build }", false},
+		{"cat <<EOF", true},
+		{"cat <<EOF\nit's \\", true},
+		{"cat <<EOF | tr a-z A-Z\nit's\nEOF", false},
+		{"cat <<'A' <<B\na\nA\nb", true},
+		{"cat <<< 'a b'", false},
+	}
+	for _, test := range tests {
+		if more := incomplete(test.input); more != test.more {
+			t.Errorf("%q: expected incomplete %v, got %v", test.input, test.more, more)
+		}
+	}
+
+	if line := continueLine("echo a\\\n", "b\n"); line != "echo ab\n" {
+		t.Errorf("unexpected joined line: %q", line)
+	}
+	if line := continueLine("echo 'a\\\n", "b'\n"); line != "echo 'a\\\nb'\n" {
+		t.Errorf("unexpected joined line: %q", line)
+	}
+}
@@ -0,0 +1,473 @@
+package shell
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+var errInterrupt = errors.New("interrupt")
+
+const (
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlG     = 7
+	keyCtrlH     = 8
+	keyNewline   = '\n'
+	keyEnter     = '\r'
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// completeFunc returns the completion candidates for the
+// last word in words
+type completeFunc func(words []string) []string
+
+// lineEditor reads a line of input key by key from a terminal
+// in raw mode. It echoes input and runs the editing actions the keys
+// are bound to in its keymap, which by default supports cursor movement
+// and emacs-style editing keys, recalls history with the up and
+// down arrow keys and searches it backwards with Ctrl-R.
+type lineEditor struct {
+	in       *bufio.Reader
+	out      io.Writer
+	prompt   string
+	keymap   *keymap
+	history  *history
+	complete completeFunc
+
+	buf     []rune
+	pos     int
+	histPos int
+	saved   []rune
+
+	// key is the key sequence of the running action
+	key string
+
+	// suggest shows the rest of the latest history entry that starts
+	// with the line after the cursor, dimmed
+	suggest bool
+
+	// palette returns the items of the command palette, shown on a
+	// screen of rows rows
+	palette func() []paletteItem
+	rows    int
+
+	vi viState
+}
+
+func newLineEditor(in *bufio.Reader, out io.Writer, prompt string, keys *keymap, hist *history, complete completeFunc) *lineEditor {
+	return &lineEditor{
+		in:       in,
+		out:      out,
+		prompt:   prompt,
+		keymap:   keys,
+		history:  hist,
+		complete: complete,
+		histPos:  hist.len(),
+	}
+}
+
+// readLine returns the line entered by the user, including the
+// trailing newline. Each key sequence runs the action it is bound to in
+// the keymap; by default Ctrl-C discards the line and returns
+// errInterrupt, and Ctrl-D on an empty line returns io.EOF.
+func (e *lineEditor) readLine() (string, error) {
+	e.refresh()
+	for {
+		var err error
+		if e.vi.command {
+			err = e.viCommand()
+		} else {
+			err = e.readAction()
+		}
+		switch err {
+		case nil:
+		case errAcceptLine:
+			return string(e.buf) + "\n", nil
+		default:
+			return "", err
+		}
+	}
+}
+
+// readAction reads a key sequence and runs the action it is bound to.
+// Printable keys that are not bound are inserted.
+func (e *lineEditor) readAction() error {
+	keys, err := e.readKey()
+	if err != nil {
+		return err
+	}
+	action, ok := e.keymap.lookup(keys)
+	if !ok {
+		if r := []rune(keys); len(r) == 1 && r[0] >= ' ' {
+			e.insert(r[0])
+		}
+		return nil
+	}
+	e.key = keys
+	return editActions[action](e)
+}
+
+// readKey reads a key sequence: keys are read while they start a longer
+// bound sequence. A sequence that is bound itself ends there unless more
+// keys were already sent, as they are with the escape sequences of the
+// arrow keys.
+func (e *lineEditor) readKey() (string, error) {
+	var keys []rune
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		keys = append(keys, r)
+		seq := string(keys)
+		if !e.keymap.isPrefix(seq) {
+			// a bound sequence followed by another key, as Escape
+			// then a command key in vi mode, ends before that key
+			prev := string(keys[:len(keys)-1])
+			if _, bound := e.keymap.lookup(seq); !bound && len(keys) > 1 {
+				if _, ok := e.keymap.lookup(prev); ok {
+					return prev, e.in.UnreadRune()
+				}
+			}
+			return seq, nil
+		}
+		if _, bound := e.keymap.lookup(seq); bound && e.in.Buffered() == 0 {
+			return seq, nil
+		}
+	}
+}
+
+func (e *lineEditor) insert(r rune) {
+	e.buf = append(e.buf, 0)
+	copy(e.buf[e.pos+1:], e.buf[e.pos:])
+	e.buf[e.pos] = r
+	e.pos++
+	e.refresh()
+}
+
+// backspace deletes the character before the cursor
+func (e *lineEditor) backspace() {
+	if e.pos == 0 {
+		return
+	}
+	e.buf = append(e.buf[:e.pos-1], e.buf[e.pos:]...)
+	e.pos--
+	e.refresh()
+}
+
+// delete deletes the character under the cursor
+func (e *lineEditor) delete() {
+	if e.pos >= len(e.buf) {
+		return
+	}
+	e.buf = append(e.buf[:e.pos], e.buf[e.pos+1:]...)
+	e.refresh()
+}
+
+// deleteWord deletes the word before the cursor
+func (e *lineEditor) deleteWord() {
+	start := e.wordStart()
+	e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+	e.pos = start
+	e.refresh()
+}
+
+// killWord deletes the word after the cursor
+func (e *lineEditor) killWord() {
+	end := e.wordEnd()
+	e.buf = append(e.buf[:e.pos], e.buf[end:]...)
+	e.refresh()
+}
+
+// killLine deletes the line after the cursor
+func (e *lineEditor) killLine() {
+	e.buf = e.buf[:e.pos]
+	e.refresh()
+}
+
+// discardLine deletes the line before the cursor
+func (e *lineEditor) discardLine() {
+	e.buf = append([]rune{}, e.buf[e.pos:]...)
+	e.pos = 0
+	e.refresh()
+}
+
+// wordStart returns the start of the word before the cursor
+func (e *lineEditor) wordStart() int {
+	start := e.pos
+	for start > 0 && unicode.IsSpace(e.buf[start-1]) {
+		start--
+	}
+	for start > 0 && !unicode.IsSpace(e.buf[start-1]) {
+		start--
+	}
+	return start
+}
+
+// wordEnd returns the end of the word after the cursor
+func (e *lineEditor) wordEnd() int {
+	end := e.pos
+	for end < len(e.buf) && unicode.IsSpace(e.buf[end]) {
+		end++
+	}
+	for end < len(e.buf) && !unicode.IsSpace(e.buf[end]) {
+		end++
+	}
+	return end
+}
+
+func (e *lineEditor) moveTo(pos int) {
+	if pos < 0 || pos > len(e.buf) {
+		return
+	}
+	e.pos = pos
+	e.refresh()
+}
+
+func (e *lineEditor) setLine(line []rune) {
+	e.buf = line
+	e.pos = len(line)
+	e.refresh()
+}
+
+func (e *lineEditor) historyPrev() {
+	if e.histPos <= 0 {
+		return
+	}
+	if e.histPos == e.history.len() {
+		e.saved = e.buf
+	}
+	e.histPos--
+	e.setLine([]rune(e.history.get(e.histPos)))
+}
+
+func (e *lineEditor) historyNext() {
+	if e.histPos >= e.history.len() {
+		return
+	}
+	e.histPos++
+	if e.histPos == e.history.len() {
+		e.setLine(e.saved)
+	} else {
+		e.setLine([]rune(e.history.get(e.histPos)))
+	}
+}
+
+// reverseSearch searches the history backwards for the entries that
+// contain the query typed so far. Ctrl-R moves to the next older match
+// and Ctrl-G cancels the search. Any other key ends the search with the
+// match in the line and is then handled like it was typed in the line,
+// so that Enter runs the match and the arrow keys start editing it.
+func (e *lineEditor) reverseSearch() error {
+	saved, savedPos := e.buf, e.pos
+	var query []rune
+	match := e.history.len()
+	failed := false
+	for {
+		e.refreshSearch(query, failed)
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return err
+		}
+		switch {
+		case r == keyCtrlR:
+			if len(query) > 0 {
+				match, failed = e.searchHistory(query, match-1, match)
+			}
+		case r == keyBackspace || r == keyCtrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				match, failed = e.searchHistory(query, e.history.len()-1, match)
+			}
+		case r == keyCtrlG:
+			e.buf, e.pos = saved, savedPos
+			e.refresh()
+			return nil
+		case r >= ' ':
+			query = append(query, r)
+			from := match
+			if from >= e.history.len() {
+				from = e.history.len() - 1
+			}
+			match, failed = e.searchHistory(query, from, match)
+		default:
+			if match < e.history.len() {
+				if e.histPos == e.history.len() {
+					e.saved = saved
+				}
+				e.histPos = match
+			}
+			e.refresh()
+			return e.in.UnreadRune()
+		}
+	}
+}
+
+// searchHistory puts the most recent entry at or before index from
+// that contains query in the line, with the cursor at the start of the
+// query. It returns the index of that entry, or current and true when
+// no entry matches.
+func (e *lineEditor) searchHistory(query []rune, from, current int) (int, bool) {
+	for i := from; i >= 0; i-- {
+		entry := e.history.get(i)
+		if j := strings.Index(entry, string(query)); j >= 0 {
+			e.buf = []rune(entry)
+			e.pos = len([]rune(entry[:j]))
+			return i, false
+		}
+	}
+	return current, true
+}
+
+// refreshSearch redraws the line with the search prompt
+func (e *lineEditor) refreshSearch(query []rune, failed bool) {
+	label := "(reverse-i-search)"
+	if failed {
+		label = "(failed reverse-i-search)"
+	}
+	fmt.Fprintf(e.out, "\r%s`%s': %s\x1b[K", label, string(query), string(e.buf))
+	if n := len(e.buf) - e.pos; n > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", n)
+	}
+}
+
+// openPalette runs the command palette and inserts the selected item at
+// the cursor, followed by a space when it is a command
+func (e *lineEditor) openPalette() error {
+	if e.palette == nil {
+		return nil
+	}
+	p := &palette{in: e.in, out: e.out, items: e.palette(), rows: e.rows}
+	item, ok, err := p.run()
+	if err != nil {
+		return err
+	}
+	if ok {
+		text := item.text
+		if item.command {
+			text += " "
+		}
+		e.replaceWord("", text)
+		return nil
+	}
+	e.refresh()
+	return nil
+}
+
+// completeWord completes the word before the cursor. A single candidate
+// is inserted directly, followed by a space unless it is a directory;
+// multiple candidates are extended to their common prefix or, when no
+// progress can be made, listed below the prompt.
+func (e *lineEditor) completeWord() {
+	if e.complete == nil {
+		return
+	}
+	line := string(e.buf[:e.pos])
+	words := reCmd.FindAllString(line, -1)
+	if len(words) == 0 || unicode.IsSpace(e.buf[e.pos-1]) {
+		words = append(words, "")
+	}
+	word := words[len(words)-1]
+
+	candidates := e.complete(words)
+	switch len(candidates) {
+	case 0:
+		return
+	case 1:
+		if strings.HasSuffix(candidates[0], "/") {
+			e.replaceWord(word, candidates[0])
+			return
+		}
+		e.replaceWord(word, candidates[0]+" ")
+	default:
+		prefix := commonPrefix(candidates)
+		if len(prefix) > len(word) {
+			e.replaceWord(word, prefix)
+			return
+		}
+		styled := make([]string, len(candidates))
+		for i, candidate := range candidates {
+			styled[i] = currentTheme().completion.Sprint(candidate)
+		}
+		fmt.Fprintf(e.out, "\n%s\n", strings.Join(styled, "  "))
+		e.refresh()
+	}
+}
+
+// replaceWord replaces word before the cursor with repl
+func (e *lineEditor) replaceWord(word, repl string) {
+	start := e.pos - len([]rune(word))
+	tail := append([]rune(repl), e.buf[e.pos:]...)
+	e.buf = append(e.buf[:start], tail...)
+	e.pos = start + len([]rune(repl))
+	e.refresh()
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, w := range words[1:] {
+		for !strings.HasPrefix(w, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// refresh redraws the prompt, the current line and its suggestion,
+// then places the cursor at its position in the line
+func (e *lineEditor) refresh() {
+	fmt.Fprintf(e.out, "\r%s %s\x1b[K", e.prompt, string(e.buf))
+	if suggestion := e.suggestion(); suggestion != "" {
+		fmt.Fprintf(e.out, "%s\x1b[%dD", currentTheme().suggestion.Sprint(suggestion), len([]rune(suggestion)))
+	}
+	if n := len(e.buf) - e.pos; n > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", n)
+	}
+}
+
+// suggestion returns the rest of the latest history entry that starts
+// with the line, when the cursor is at its end. Entries spanning
+// several lines are not suggested.
+func (e *lineEditor) suggestion() string {
+	if !e.suggest || len(e.buf) == 0 || e.pos != len(e.buf) {
+		return ""
+	}
+	line := string(e.buf)
+	for i := e.history.len() - 1; i >= 0; i-- {
+		entry := e.history.get(i)
+		if len(entry) > len(line) && strings.HasPrefix(entry, line) && !strings.Contains(entry, "\n") {
+			return entry[len(line):]
+		}
+	}
+	return ""
+}
+
+// acceptSuggestion inserts the suggestion, or only its first word, in
+// the line. It reports false when there is no suggestion.
+func (e *lineEditor) acceptSuggestion(word bool) bool {
+	suggestion := []rune(e.suggestion())
+	if len(suggestion) == 0 {
+		return false
+	}
+	if word {
+		end := 0
+		for end < len(suggestion) && unicode.IsSpace(suggestion[end]) {
+			end++
+		}
+		for end < len(suggestion) && !unicode.IsSpace(suggestion[end]) {
+			end++
+		}
+		suggestion = suggestion[:end]
+	}
+	e.setLine(append(e.buf, suggestion...))
+	return true
+}
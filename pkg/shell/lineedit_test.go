@@ -0,0 +1,116 @@
+package shell
+
+import (
+	"bufio"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestLineEditorEditing(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		line  string
+	}{
+		{"plain", "hello\r", "hello"},
+		{"backspace", "hexx\x7f\x7fllo\r", "hello"},
+		{"left insert", "hllo\x1b[D\x1b[D\x1b[De\r", "hello"},
+		{"home end", "ello\x01h\x05!\r", "hello!"},
+		{"delete", "hxello\x01\x1b[C\x1b[3~\r", "hello"},
+		{"kill to end", "hello world\x01\x1b[C\x1b[C\x1b[C\x1b[C\x1b[C\x0b\r", "hello"},
+		{"kill to start", "junk hello\x1b[D\x1b[D\x1b[D\x1b[D\x1b[D\x15\r", "hello"},
+		{"delete word", "hello bad word\x17\x17world\r", "hello world"},
+		{"word motion", "hello world\x1bb\x1bbbig \x1bf\x1bf!\r", "big hello world!"},
+		{"kill word", "hello bad world\x01\x1bf\x1bd\r", "hello world"},
+	}
+	for _, test := range tests {
+		in := bufio.NewReader(strings.NewReader(test.input))
+		e := newLineEditor(in, ioutil.Discard, ">", defaultKeymap(), newHistory("", 10), nil)
+		line, err := e.readLine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(line) != test.line {
+			t.Errorf("%s: expected %q, got %q", test.name, test.line, line)
+		}
+	}
+}
+
+func TestLineEditorHistory(t *testing.T) {
+	hist := newHistory("", 10)
+	hist.add("hello")
+	hist.add("goodbye")
+	in := bufio.NewReader(strings.NewReader("\x1b[A\x1b[A\x1b[B\r"))
+	line, err := newLineEditor(in, ioutil.Discard, ">", defaultKeymap(), hist, nil).readLine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(line) != "goodbye" {
+		t.Error("unexpected history recall:", line)
+	}
+}
+
+func TestLineEditorReverseSearch(t *testing.T) {
+	hist := newHistory("", 10)
+	for _, line := range []string{"deploy staging", "ls -l", "deploy prod", "echo hi"} {
+		hist.add(line)
+	}
+	tests := []struct {
+		name  string
+		input string
+		line  string
+	}{
+		{"latest match", "\x12dep\r", "deploy prod"},
+		{"older match", "\x12dep\x12\r", "deploy staging"},
+		{"no older match", "\x12dep\x12\x12\r", "deploy staging"},
+		{"backspace", "\x12lsx\x7f\r", "ls -l"},
+		{"edit match", "\x12ls\x05 -a\r", "ls -l -a"},
+		{"cancel", "draft\x12dep\x07\r", "draft"},
+		{"history after match", "\x12ls\x1b[A\r", "deploy staging"},
+	}
+	for _, test := range tests {
+		in := bufio.NewReader(strings.NewReader(test.input))
+		line, err := newLineEditor(in, ioutil.Discard, ">", defaultKeymap(), hist, nil).readLine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(line) != test.line {
+			t.Errorf("%s: expected %q, got %q", test.name, test.line, line)
+		}
+	}
+}
+
+func TestLineEditorSuggestions(t *testing.T) {
+	hist := newHistory("", 10)
+	hist.add("git commit -m fix")
+	hist.add("git status")
+	tests := []struct {
+		name    string
+		input   string
+		suggest bool
+		line    string
+	}{
+		{"right arrow", "git c\x1b[C\r", true, "git commit -m fix"},
+		{"end", "git s\x05\r", true, "git status"},
+		{"next word", "git c\x1bf\x1bf\r", true, "git commit -m"},
+		{"typed over", "git cx\x1b[C\r", true, "git cx"},
+		{"disabled", "git c\x1b[C\r", false, "git c"},
+	}
+	for _, test := range tests {
+		in := bufio.NewReader(strings.NewReader(test.input))
+		var out strings.Builder
+		e := newLineEditor(in, &out, ">", defaultKeymap(), hist, nil)
+		e.suggest = test.suggest
+		line, err := e.readLine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != test.line+"\n" {
+			t.Errorf("%s: expected %q, got %q", test.name, test.line, line)
+		}
+		if test.suggest && !strings.Contains(out.String(), currentTheme().suggestion.Code()) {
+			t.Errorf("%s: suggestion not shown: %q", test.name, out.String())
+		}
+	}
+}
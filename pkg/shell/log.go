@@ -0,0 +1,134 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// ParseLogLevel parses a log level: debug, info, warn or error
+func ParseLogLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", name)
+	}
+	return level, nil
+}
+
+// NewLogger returns a logger writing the records of level and above to
+// w, a terminal or a stream read by people. Records are written as their
+// message followed by their attributes, debug records being marked as
+// such. Log files are better written by the handlers of log/slog.
+func NewLogger(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(&consoleHandler{mu: new(sync.Mutex), w: w, level: level})
+}
+
+// consoleHandler writes records as lines of text without their time
+type consoleHandler struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	level  slog.Leveler
+	attrs  string
+	prefix string
+}
+
+func (h *consoleHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *consoleHandler) Handle(ctx context.Context, r slog.Record) error {
+	var b strings.Builder
+	if r.Level < slog.LevelInfo {
+		b.WriteString("debug: ")
+	}
+	b.WriteString(r.Message)
+	b.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		b.WriteString(formatAttr(h.prefix, a))
+		return true
+	})
+	b.WriteByte('\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *consoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	for _, a := range attrs {
+		clone.attrs += formatAttr(h.prefix, a)
+	}
+	return &clone
+}
+
+func (h *consoleHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix += name + "."
+	return &clone
+}
+
+// formatAttr formats an attribute as " key=value", quoting values with
+// spaces. The attributes of groups are prefixed with the group name.
+func formatAttr(prefix string, a slog.Attr) string {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return ""
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		var b strings.Builder
+		for _, ga := range a.Value.Group() {
+			b.WriteString(formatAttr(prefix+a.Key+".", ga))
+		}
+		return b.String()
+	}
+	value := a.Value.String()
+	if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+		value = strconv.Quote(value)
+	}
+	return " " + prefix + a.Key + "=" + value
+}
+
+// WithLogger sets the logger of the shell diagnostics, which commands
+// get from api.Logger. By default they are written to the stderr of each
+// session at the level set by WithLogLevel.
+func WithLogger(logger *slog.Logger) Option {
+	return func(gosh *Goshell) { gosh.logger = logger }
+}
+
+// WithLogLevel sets the level of the diagnostics written to stderr,
+// info by default. Debugging lowers it to debug.
+func WithLogLevel(level slog.Level) Option {
+	return func(gosh *Goshell) { gosh.logLevel = level }
+}
+
+// newLogger returns the logger of the shell, writing to w unless
+// WithLogger set one
+func (gosh *Goshell) newLogger(w io.Writer) *slog.Logger {
+	if gosh.logger != nil {
+		return gosh.logger
+	}
+	level := gosh.logLevel
+	if gosh.debug && level > slog.LevelDebug {
+		level = slog.LevelDebug
+	}
+	return NewLogger(w, level)
+}
+
+// log returns the logger of the shell
+func (gosh *Goshell) log() *slog.Logger {
+	if gosh.ctx == nil {
+		return gosh.newLogger(os.Stderr)
+	}
+	return api.Logger(gosh.ctx)
+}
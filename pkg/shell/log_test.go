@@ -0,0 +1,67 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestNewLogger(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewLogger(&out, slog.LevelInfo)
+	logger.Debug("hidden")
+	logger.With("plugin", "sys.so").WithGroup("load").Warn("slow plugin", "elapsed", "2s", "err", errors.New("timed out"))
+	expected := "slow plugin plugin=sys.so load.elapsed=2s load.err=\"timed out\"\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+
+	out.Reset()
+	NewLogger(&out, slog.LevelDebug).Debug("opened plugin", "path", "")
+	if expected := "debug: opened plugin path=\"\"\n"; out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	if level, err := ParseLogLevel("warn"); err != nil || level != slog.LevelWarn {
+		t.Errorf("expected warn, got %v, %v", level, err)
+	}
+	if _, err := ParseLogLevel("loud"); err == nil {
+		t.Error("expected an invalid level to fail")
+	}
+}
+
+func TestShellLogger(t *testing.T) {
+	var stderr bytes.Buffer
+	shell := New(WithoutPlugins(), WithLogLevel(slog.LevelWarn))
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	ctx := api.WithStderr(context.Background(), &stderr)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	api.Logger(shell.ctx).Info("hidden")
+	api.Logger(shell.ctx).Warn("shown")
+	if stderr.String() != "shown\n" {
+		t.Errorf("expected the warning on stderr, got %q", stderr.String())
+	}
+
+	var logged bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logged, nil))
+	session := New(WithoutPlugins(), WithLogger(logger)).NewSession()
+	session.history = newHistory("", 10)
+	session.aliases = newAliasTable("")
+	session.rcFiles = nil
+	if err := session.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if api.Logger(session.ctx) != logger {
+		t.Error("expected the session to use the logger of the shell")
+	}
+}
@@ -0,0 +1,278 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/vladimirvivien/gosh/api"
+	"github.com/vladimirvivien/gosh/api/style"
+)
+
+const (
+	// manWidth is the width of a manual written to a file or a pipe
+	manWidth = 80
+
+	// manIndent is the indentation of the text of the manual sections
+	manIndent = 4
+)
+
+var (
+	// reListItem matches the marker of a markdown list item
+	reListItem = regexp.MustCompile(`^([-*+]|\d+[.)])\s+`)
+
+	// reInline matches the inline markup of markdown: code spans,
+	// strong and emphasized text, and links
+	reInline = regexp.MustCompile("`([^`]+)`|\\*\\*([^*]+)\\*\\*|\\*([^*\\s][^*]*)\\*|\\[([^\\]]+)\\]\\(([^)\\s]+)\\)")
+
+	// reEscape matches the escape sequences of styles
+	reEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+)
+
+// manCmd renders the manual of a command: its usage, flags and
+// examples, and its long description, written in markdown
+type manCmd struct {
+	gosh *Goshell
+}
+
+func (c manCmd) Name() string      { return "man" }
+func (c manCmd) Usage() string     { return "man <command-name>" }
+func (c manCmd) LongDesc() string  { return "" }
+func (c manCmd) ShortDesc() string { return `prints the manual of a command` }
+func (c manCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	if len(args) < 2 {
+		return ctx, api.Result{}, api.NewUsageError("missing command name")
+	}
+	commands := api.GetCommands(ctx)
+	if commands == nil {
+		return ctx, api.Result{}, errors.New("no commands registered")
+	}
+	cmd, found := commands[args[1]]
+	if !found {
+		return ctx, api.Result{}, fmt.Errorf("command %s not found", args[1])
+	}
+
+	stdout := api.GetStdout(ctx)
+	width := manWidth
+	if f, ok := stdout.(*os.File); ok && isTerminal(f.Fd()) {
+		if cols, _, err := termSize(f.Fd()); err == nil && cols > 2*manIndent {
+			width = cols
+		}
+	}
+	out := api.Paged(ctx)
+	defer out.Close()
+	renderManual(out, args[1], cmd, width, style.Enabled(stdout))
+	return ctx, api.Result{}, nil
+}
+
+// Complete completes the command name argument of man
+func (c manCmd) Complete(ctx context.Context, args []string, cursorPos int) []string {
+	return completeCommandName(ctx, args, cursorPos)
+}
+
+// renderManual writes the manual of a command in sections, with its
+// text wrapped to width columns
+func renderManual(w io.Writer, name string, cmd api.Command, width int, styled bool) {
+	r := &manRenderer{w: w, width: width, styled: styled}
+
+	r.section("NAME")
+	r.paragraph(manIndent, manIndent, strings.TrimSuffix(fmt.Sprintf("%s - %s", name, cmd.ShortDesc()), " - "))
+	if cmd.Usage() != "" {
+		r.section("SYNOPSIS")
+		r.verbatim(manIndent, cmd.Usage())
+	}
+	if flagger, ok := cmd.(api.Flagger); ok && len(flagger.Flags()) > 0 {
+		r.section("FLAGS")
+		for _, flag := range flagger.Flags() {
+			name := "--" + flag.Name
+			if flag.Short != "" {
+				name = "-" + flag.Short + ", " + name
+			}
+			if flag.Kind != api.BoolFlag {
+				name += " " + flag.Kind.String()
+			}
+			usage := flag.Usage
+			if flag.Default != "" {
+				usage += fmt.Sprintf(" (default %s)", flag.Default)
+			}
+			r.verbatim(manIndent, r.style(currentTheme().code, name))
+			r.paragraph(2*manIndent, 2*manIndent, usage)
+		}
+	}
+	if cmd.LongDesc() != "" {
+		r.section("DESCRIPTION")
+		r.markdown(cmd.LongDesc())
+	}
+	if describer, ok := cmd.(api.Describer); ok && len(describer.Examples()) > 0 {
+		r.section("EXAMPLES")
+		for _, example := range describer.Examples() {
+			r.verbatim(manIndent, example.Command)
+			if example.Desc != "" {
+				r.paragraph(2*manIndent, 2*manIndent, example.Desc)
+			}
+		}
+	}
+}
+
+// manRenderer writes the sections of a manual and the blocks of their
+// text, separating them with blank lines
+type manRenderer struct {
+	w        io.Writer
+	width    int
+	styled   bool
+	sections int
+	blocks   int
+}
+
+// separate starts a block
+func (r *manRenderer) separate() {
+	if r.blocks > 0 {
+		fmt.Fprintln(r.w)
+	}
+	r.blocks++
+}
+
+// section writes the heading of a section
+func (r *manRenderer) section(title string) {
+	if r.sections > 0 {
+		fmt.Fprintln(r.w)
+	}
+	r.sections++
+	fmt.Fprintln(r.w, r.style(currentTheme().heading, title))
+	r.blocks = 0
+}
+
+// heading writes a heading of the markdown of the description, the
+// top level ones as sections
+func (r *manRenderer) heading(level int, title string) {
+	if level == 1 {
+		r.section(strings.ToUpper(title))
+		return
+	}
+	r.separate()
+	fmt.Fprintln(r.w, strings.Repeat(" ", manIndent/2)+r.style(currentTheme().heading, title))
+	r.blocks = 0
+}
+
+// verbatim writes lines as they are
+func (r *manRenderer) verbatim(indent int, lines ...string) {
+	for _, line := range lines {
+		if line == "" {
+			fmt.Fprintln(r.w)
+			continue
+		}
+		fmt.Fprintln(r.w, strings.Repeat(" ", indent)+line)
+	}
+}
+
+// paragraph writes text wrapped to the width, its first line indented
+// by first and the others by indent
+func (r *manRenderer) paragraph(first, indent int, text string) {
+	text = r.inline(text)
+	line, lineWidth := strings.Repeat(" ", first), first
+	empty := true
+	for _, word := range strings.Fields(text) {
+		wordWidth := visibleWidth(word)
+		if !empty && lineWidth+1+wordWidth > r.width {
+			fmt.Fprintln(r.w, line)
+			line, lineWidth, empty = strings.Repeat(" ", indent), indent, true
+		}
+		if !empty {
+			line += " "
+			lineWidth++
+		}
+		line += word
+		lineWidth += wordWidth
+		empty = false
+	}
+	fmt.Fprintln(r.w, line)
+}
+
+// markdown writes the blocks of a markdown text: headings, paragraphs,
+// list items and fenced code blocks, which are written as they are
+func (r *manRenderer) markdown(text string) {
+	lines := strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	var para []string
+	paraIndent := manIndent
+	// list items follow each other without blank lines
+	item, prevItem := false, false
+	flush := func() {
+		if len(para) == 0 {
+			return
+		}
+		if !item || !prevItem {
+			r.separate()
+		}
+		r.paragraph(manIndent, paraIndent, strings.Join(para, " "))
+		para, prevItem = nil, item
+	}
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		switch {
+		case strings.HasPrefix(line, "```"):
+			flush()
+			r.separate()
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				r.verbatim(2*manIndent, strings.TrimRight(lines[i], " \t"))
+			}
+			prevItem = false
+		case line == "":
+			flush()
+			prevItem = false
+		case strings.HasPrefix(line, "#"):
+			flush()
+			level := len(line) - len(strings.TrimLeft(line, "#"))
+			r.heading(level, strings.TrimSpace(line[level:]))
+			prevItem = false
+		case reListItem.MatchString(line):
+			flush()
+			marker := reListItem.FindString(line)
+			bullet := strings.TrimSpace(marker)
+			if bullet == "*" || bullet == "+" {
+				bullet = "-"
+			}
+			para, paraIndent, item = []string{bullet + " " + line[len(marker):]}, manIndent+len(bullet)+1, true
+		default:
+			if len(para) == 0 {
+				paraIndent, item = manIndent, false
+			}
+			para = append(para, line)
+		}
+	}
+	flush()
+}
+
+// inline replaces the inline markup of text by its styles, or drops it
+// when the output is not styled. Links are written as their text
+// followed by their target.
+func (r *manRenderer) inline(text string) string {
+	return reInline.ReplaceAllStringFunc(text, func(m string) string {
+		groups := reInline.FindStringSubmatch(m)
+		switch {
+		case groups[1] != "":
+			return r.style(currentTheme().code, groups[1])
+		case groups[2] != "":
+			return r.style(currentTheme().strong, groups[2])
+		case groups[3] != "":
+			return r.style(currentTheme().emphasis, groups[3])
+		}
+		return groups[4] + " <" + groups[5] + ">"
+	})
+}
+
+func (r *manRenderer) style(s style.Style, text string) string {
+	if !r.styled {
+		return text
+	}
+	return s.Sprint(text)
+}
+
+// visibleWidth returns the number of characters of s shown on a
+// terminal, leaving out the escape sequences of styles
+func visibleWidth(s string) int {
+	return len([]rune(reEscape.ReplaceAllString(s, "")))
+}
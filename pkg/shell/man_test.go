@@ -0,0 +1,87 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// manTestCmd is a command with a markdown description for the man tests
+type manTestCmd struct {
+	describedCmd
+}
+
+func (c manTestCmd) LongDesc() string {
+	return "Runs the flags test with a **long** description\nover two lines.\n\n" +
+		"## Notes\n\n- first item\n- second item that wraps past the width\n\n" +
+		"```\nflags  -v\n```\nSee [the docs](http://example.com) and `flags`."
+}
+
+func TestRenderManual(t *testing.T) {
+	out := bytes.NewBufferString("")
+	renderManual(out, "flags", manTestCmd{describedCmd{"flags"}}, 40, false)
+	expected := `NAME
+    flags - tests flags
+
+SYNOPSIS
+    flags [-v] name
+
+FLAGS
+    -v, --verbose
+        prints more
+    --count int
+        number of runs (default 1)
+
+DESCRIPTION
+    Runs the flags test with a long
+    description over two lines.
+
+  Notes
+    - first item
+    - second item that wraps past the
+      width
+
+        flags  -v
+
+    See the docs <http://example.com>
+    and flags.
+
+EXAMPLES
+    flags -v world
+        runs verbosely
+`
+	if out.String() != expected {
+		t.Errorf("unexpected manual:\n%s", out.String())
+	}
+
+	out.Reset()
+	renderManual(out, "flags", manTestCmd{describedCmd{"flags"}}, 80, true)
+	if !strings.Contains(out.String(), currentTheme().strong.Sprint("long")) || !strings.Contains(out.String(), currentTheme().code.Sprint("flags")+".") {
+		t.Errorf("expected styled markup, got %q", out.String())
+	}
+}
+
+func TestManCmd(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	shell.Register("flags", manTestCmd{describedCmd{"flags"}})
+	out := bytes.NewBufferString("")
+	ctx := api.WithStdout(context.TODO(), out)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shell.Eval(api.WithStdout(shell.ctx, out), "man flags"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "NAME\n    flags - tests flags\n") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+	if _, err := shell.Eval(shell.ctx, "man"); api.ExitStatus(err) != 2 {
+		t.Errorf("expected a usage error, got %v", err)
+	}
+}
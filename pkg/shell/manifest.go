@@ -0,0 +1,218 @@
+package shell
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vladimirvivien/gosh/api"
+	"gopkg.in/yaml.v3"
+)
+
+// manifestSuffix ends the name of the manifest of a plugin, which starts
+// with the name of the plugin, such as greet.plugin.yaml for
+// greet_command.wasm
+const manifestSuffix = ".plugin.yaml"
+
+// pluginManifest describes a plugin: its name and version, the minimum
+// version of the plugin API it needs, the commands it provides, the
+// checksums of its file and, for process and WebAssembly plugins, the
+// capabilities of its sandbox.
+//
+//	name: greet
+//	version: 1.2.0
+//	api_version: "1.0"
+//	commands: [greet]
+//	checksums:
+//	  sha256: <hex digest of the plugin file>
+//	capabilities:
+//	  read: [/usr/share/dict]
+//	  write: [/tmp/greet]
+//	  network: false
+//	  exec: false
+type pluginManifest struct {
+	Name         string              `yaml:"name"`
+	Version      string              `yaml:"version"`
+	APIVersion   string              `yaml:"api_version"`
+	Commands     []string            `yaml:"commands"`
+	Checksums    map[string]string   `yaml:"checksums"`
+	Capabilities *pluginCapabilities `yaml:"capabilities"`
+}
+
+// pluginCapabilities are what the commands of a sandboxed plugin may do:
+// read the files beneath the Read paths, read and change the files
+// beneath the Write paths, use the network and run other programs.
+// Everything else is denied.
+type pluginCapabilities struct {
+	Read    []string `json:"read,omitempty" yaml:"read"`
+	Write   []string `json:"write,omitempty" yaml:"write"`
+	Network bool     `json:"network,omitempty" yaml:"network"`
+	Exec    bool     `json:"exec,omitempty" yaml:"exec"`
+}
+
+// manifestPath returns the path of the manifest of the plugin at path
+func manifestPath(path string) string {
+	return filepath.Join(filepath.Dir(path), pluginName(path)+manifestSuffix)
+}
+
+// loadManifest reads the manifest of the plugin at path, which is nil
+// when the plugin has none. Relative paths of the capabilities are
+// relative to the directory of the plugin.
+func loadManifest(path string) (*pluginManifest, error) {
+	file, err := os.Open(manifestPath(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	manifest := &pluginManifest{}
+	dec := yaml.NewDecoder(file)
+	dec.KnownFields(true)
+	if err := dec.Decode(manifest); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: %v", file.Name(), err)
+	}
+	if caps := manifest.Capabilities; caps != nil {
+		for _, paths := range [][]string{caps.Read, caps.Write} {
+			for i, p := range paths {
+				if !filepath.IsAbs(p) {
+					paths[i] = filepath.Join(filepath.Dir(path), p)
+				}
+			}
+		}
+	}
+	return manifest, nil
+}
+
+// openManifest loads the manifest of the plugin at path and checks the
+// plugin against it. Only process and WebAssembly plugins have
+// capabilities.
+func openManifest(path string) (*pluginManifest, error) {
+	manifest, err := loadManifest(path)
+	if err != nil || manifest == nil {
+		return nil, err
+	}
+	if err := manifest.check(path); err != nil {
+		return nil, err
+	}
+	if kind := pluginKind(path); manifest.Capabilities != nil && kind != "process" && kind != "wasm" {
+		return nil, fmt.Errorf("%s plugins cannot be sandboxed", kind)
+	}
+	return manifest, nil
+}
+
+// check verifies that the plugin file at path matches the manifest: the
+// shell provides the API version it needs and the file has its
+// checksums
+func (m *pluginManifest) check(path string) error {
+	if m.APIVersion != "" {
+		newer, err := newerVersion(m.APIVersion, api.APIVersion)
+		if err != nil {
+			return fmt.Errorf("invalid api_version: %v", err)
+		}
+		if newer {
+			return fmt.Errorf("requires plugin API %s, the shell provides %s", m.APIVersion, api.APIVersion)
+		}
+	}
+	for algo, sum := range m.Checksums {
+		if algo != "sha256" {
+			return fmt.Errorf("unsupported checksum %s", algo)
+		}
+		actual, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(actual, sum) {
+			return fmt.Errorf("sha256 checksum mismatch: the file has %s", actual)
+		}
+	}
+	return nil
+}
+
+// undeclared returns the commands of the registry the manifest does not
+// list, when it lists any
+func (m *pluginManifest) undeclared(registry map[string]api.Command) []string {
+	if len(m.Commands) == 0 {
+		return nil
+	}
+	declared := make(map[string]bool)
+	for _, name := range m.Commands {
+		declared[name] = true
+	}
+	var names []string
+	for name := range registry {
+		if !declared[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkAPIVersion checks that the shell provides the version of the
+// plugin API a plugin was built against: the same major version, and a
+// minor version at least as new
+func checkAPIVersion(version string) error {
+	newer, err := newerVersion(version, api.APIVersion)
+	if err != nil {
+		return fmt.Errorf("invalid plugin API version: %v", err)
+	}
+	major := func(v string) int {
+		n, _ := strconv.Atoi(strings.SplitN(strings.TrimPrefix(v, "v"), ".", 2)[0])
+		return n
+	}
+	switch {
+	case major(version) != major(api.APIVersion):
+		return fmt.Errorf("built against plugin API %s, which is incompatible with the %s of the shell: rebuild it against the api package of the shell",
+			version, api.APIVersion)
+	case newer:
+		return fmt.Errorf("built against plugin API %s, newer than the %s of the shell: upgrade the shell",
+			version, api.APIVersion)
+	}
+	return nil
+}
+
+// newerVersion reports whether the dotted version a is newer than b
+func newerVersion(a, b string) (bool, error) {
+	as, bs := strings.Split(strings.TrimPrefix(a, "v"), "."), strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var an, bn int
+		var err error
+		if i < len(as) {
+			if an, err = strconv.Atoi(as[i]); err != nil {
+				return false, fmt.Errorf("invalid version %q", a)
+			}
+		}
+		if i < len(bs) {
+			if bn, err = strconv.Atoi(bs[i]); err != nil {
+				return false, fmt.Errorf("invalid version %q", b)
+			}
+		}
+		if an != bn {
+			return an > bn, nil
+		}
+	}
+	return false, nil
+}
+
+// fileSHA256 returns the hex SHA-256 digest of the file at path
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
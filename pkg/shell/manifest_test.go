@@ -0,0 +1,150 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestLoadManifest(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "greet_command.wasm")
+	if m, err := loadManifest(path); err != nil || m != nil {
+		t.Fatalf("expected no manifest, got %+v, %v", m, err)
+	}
+
+	doc := "name: greet\nversion: 1.2.0\napi_version: \"1.0\"\ncommands: [greet]\n" +
+		"capabilities:\n  read: [/usr/share/dict, data]\n  write: [/tmp/greet]\n  network: true\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "greet.plugin.yaml"), []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := loadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &pluginManifest{
+		Name:       "greet",
+		Version:    "1.2.0",
+		APIVersion: "1.0",
+		Commands:   []string{"greet"},
+		Capabilities: &pluginCapabilities{
+			Read:    []string{"/usr/share/dict", filepath.Join(dir, "data")},
+			Write:   []string{"/tmp/greet"},
+			Network: true,
+		},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("unexpected manifest %+v", m)
+	}
+
+	for _, doc := range []string{"capabilities:\n  network: yes please\n", "capabilities:\n  sockets: true\n", "versoin: 1\n"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, "greet.plugin.yaml"), []byte(doc), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadManifest(path); err == nil {
+			t.Errorf("expected an error for %q", doc)
+		}
+	}
+}
+
+func TestManifestCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hi_command.star")
+	if err := ioutil.WriteFile(path, []byte("hi"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := "8f434346648f6b96df89dda901c5176b10a6d83961dd3c1ac88b59b2dc327aa4"
+	tests := []struct {
+		manifest pluginManifest
+		err      string
+	}{
+		{pluginManifest{APIVersion: "1.0", Checksums: map[string]string{"sha256": sum}}, ""},
+		{pluginManifest{APIVersion: "0.9"}, ""},
+		{pluginManifest{APIVersion: "1.1"}, ""},
+		{pluginManifest{APIVersion: "1.2"}, "requires plugin API 1.2"},
+		{pluginManifest{APIVersion: "2"}, "requires plugin API 2"},
+		{pluginManifest{APIVersion: "one"}, "invalid api_version"},
+		{pluginManifest{Checksums: map[string]string{"sha256": strings.Repeat("0", 64)}}, "checksum mismatch"},
+		{pluginManifest{Checksums: map[string]string{"md5": ""}}, "unsupported checksum md5"},
+	}
+	for _, test := range tests {
+		err := test.manifest.check(path)
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%+v: expected %q, got %v", test.manifest, test.err, err)
+		}
+	}
+}
+
+func TestCheckAPIVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		err     string
+	}{
+		{"1.0", ""},
+		{"1.1", ""},
+		{"v1", ""},
+		{"0.9", "incompatible with the 1.1 of the shell"},
+		{"2.0", "incompatible with the 1.1 of the shell"},
+		{"1.2", "newer than the 1.1 of the shell"},
+		{"latest", "invalid plugin API version"},
+	}
+	for _, test := range tests {
+		err := checkAPIVersion(test.version)
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: expected %q, got %v", test.version, test.err, err)
+		}
+	}
+}
+
+func TestShellPluginManifests(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	files := map[string]string{
+		filepath.Join(dirs[0], "hi_command.star"):    `command(name = "hi", fn = lambda args: print("hi"))`,
+		filepath.Join(dirs[0], "hi.plugin.yaml"):     "name: greetings\nversion: 2.1.0\ncommands: [hi]\n",
+		filepath.Join(dirs[1], "hello_command.star"): `command(name = "hi", fn = lambda args: print("hello"))` + "\n" + `command(name = "hello", fn = lambda args: None)`,
+		filepath.Join(dirs[1], "hello.plugin.yaml"):  "commands: [hello]\n",
+		filepath.Join(dirs[1], "new_command.star"):   `command(name = "new", fn = lambda args: None)`,
+		filepath.Join(dirs[1], "new.plugin.yaml"):    "api_version: \"99.0\"\n",
+	}
+	for path, content := range files {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	shell := New()
+	shell.indexPath = ""
+	shell.pluginsDir = strings.Join(dirs, string(filepath.ListSeparator))
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	out := bytes.NewBufferString("")
+	if err := shell.Init(api.WithStdout(context.TODO(), out)); err != nil {
+		t.Fatal(err)
+	}
+	hi := filepath.Join(dirs[0], "hi_command.star")
+	hello := filepath.Join(dirs[1], "hello_command.star")
+	if conflicts := shell.conflicts["hi"]; !reflect.DeepEqual(conflicts, []string{hi, hello}) {
+		t.Errorf("expected hi to conflict, got %v", shell.conflicts)
+	}
+	if undeclared := shell.plugins[hello].manifest.undeclared(shell.plugins[hello].registry); !reflect.DeepEqual(undeclared, []string{"hi"}) {
+		t.Errorf("expected hi to be undeclared, got %v", undeclared)
+	}
+	if _, ok := shell.commands.Lookup("new"); ok {
+		t.Error("the plugin requiring a newer API should not be loaded")
+	}
+
+	out.Reset()
+	if _, err := shell.handle(shell.ctx, "plugin list"); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"VERSION", "greetings  2.1.0", "hello, hi (shadowed)\n"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("plugin list should contain %q, got %q", expected, out.String())
+		}
+	}
+}
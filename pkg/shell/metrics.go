@@ -0,0 +1,145 @@
+package shell
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the buckets of
+// the command duration histograms, the default buckets of Prometheus
+var durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metrics counts the commands run by a shell and its sessions, the
+// sessions open and the plugins loaded, for the MetricsServer
+type metrics struct {
+	mu       sync.Mutex
+	commands map[string]*commandMetrics
+	sessions atomic.Int64
+	plugins  atomic.Int64
+}
+
+// commandMetrics are the runs of a command, the failed ones and the
+// histogram of their durations
+type commandMetrics struct {
+	runs    uint64
+	errors  uint64
+	buckets []uint64
+	sum     float64
+}
+
+func newMetrics() *metrics {
+	return &metrics{commands: make(map[string]*commandMetrics)}
+}
+
+// record counts a run of the command name that took elapsed and
+// returned status
+func (m *metrics) record(name string, elapsed time.Duration, status int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cm, ok := m.commands[name]
+	if !ok {
+		cm = &commandMetrics{buckets: make([]uint64, len(durationBuckets))}
+		m.commands[name] = cm
+	}
+	cm.runs++
+	if status != 0 {
+		cm.errors++
+	}
+	seconds := elapsed.Seconds()
+	cm.sum += seconds
+	for i, bound := range durationBuckets {
+		if seconds <= bound {
+			cm.buckets[i]++
+		}
+	}
+}
+
+// write writes the metrics in the text format of Prometheus
+func (m *metrics) write(w io.Writer) error {
+	m.mu.Lock()
+	names := make([]string, 0, len(m.commands))
+	for name := range m.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	commands := make([]commandMetrics, len(names))
+	for i, name := range names {
+		commands[i] = *m.commands[name]
+		commands[i].buckets = append([]uint64(nil), commands[i].buckets...)
+	}
+	m.mu.Unlock()
+
+	b := bufio.NewWriter(w)
+	fmt.Fprint(b, "# HELP gosh_commands_total Commands run.\n# TYPE gosh_commands_total counter\n")
+	for i, name := range names {
+		fmt.Fprintf(b, "gosh_commands_total{command=%s} %d\n", labelValue(name), commands[i].runs)
+	}
+	fmt.Fprint(b, "# HELP gosh_command_errors_total Commands that returned a non-zero status.\n# TYPE gosh_command_errors_total counter\n")
+	for i, name := range names {
+		fmt.Fprintf(b, "gosh_command_errors_total{command=%s} %d\n", labelValue(name), commands[i].errors)
+	}
+	fmt.Fprint(b, "# HELP gosh_command_duration_seconds Duration of the commands.\n# TYPE gosh_command_duration_seconds histogram\n")
+	for i, name := range names {
+		label := labelValue(name)
+		for j, bound := range durationBuckets {
+			fmt.Fprintf(b, "gosh_command_duration_seconds_bucket{command=%s,le=%q} %d\n",
+				label, strconv.FormatFloat(bound, 'g', -1, 64), commands[i].buckets[j])
+		}
+		fmt.Fprintf(b, "gosh_command_duration_seconds_bucket{command=%s,le=\"+Inf\"} %d\n", label, commands[i].runs)
+		fmt.Fprintf(b, "gosh_command_duration_seconds_sum{command=%s} %s\n", label, strconv.FormatFloat(commands[i].sum, 'g', -1, 64))
+		fmt.Fprintf(b, "gosh_command_duration_seconds_count{command=%s} %d\n", label, commands[i].runs)
+	}
+	fmt.Fprintf(b, "# HELP gosh_sessions_active Sessions open.\n# TYPE gosh_sessions_active gauge\ngosh_sessions_active %d\n", m.sessions.Load())
+	fmt.Fprintf(b, "# HELP gosh_plugins_loaded Plugin files loaded.\n# TYPE gosh_plugins_loaded gauge\ngosh_plugins_loaded %d\n", m.plugins.Load())
+	return b.Flush()
+}
+
+// labelValue quotes a label value, escaping backslashes, quotes and
+// newlines
+func labelValue(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// MetricsServer serves the metrics of a shell and its sessions on
+// /metrics, in the text format of Prometheus: the commands run, the
+// failed ones and their durations by command, the sessions open and the
+// plugins loaded.
+type MetricsServer struct {
+	// Shell is the shell whose metrics are served
+	Shell *Goshell
+}
+
+// ListenAndServe listens on the TCP address addr and serves the metrics
+// until ctx is cancelled
+func (s *MetricsServer) ListenAndServe(ctx context.Context, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, l)
+}
+
+// Serve accepts connections on l until ctx is cancelled
+func (s *MetricsServer) Serve(ctx context.Context, l net.Listener) error {
+	return serveHTTP(ctx, l, s)
+}
+
+// ServeHTTP serves the metrics
+func (s *MetricsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/metrics" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.Shell.metrics.write(w)
+}
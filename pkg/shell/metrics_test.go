@@ -0,0 +1,52 @@
+package shell
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsServer(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	apiServer := httptest.NewServer(&APIServer{NewShell: shell.NewSession})
+	defer apiServer.Close()
+	for _, body := range []string{`{"command": "pwd"}`, `{"command": "pwd; unset"}`} {
+		resp, err := http.Post(apiServer.URL+"/v1/exec", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	server := httptest.NewServer(&MetricsServer{Shell: shell})
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	for _, expected := range []string{
+		`gosh_commands_total{command="pwd"} 2`,
+		`gosh_commands_total{command="unset"} 1`,
+		`gosh_command_errors_total{command="pwd"} 0`,
+		`gosh_command_errors_total{command="unset"} 1`,
+		`gosh_command_duration_seconds_bucket{command="pwd",le="10"} 2`,
+		`gosh_command_duration_seconds_count{command="unset"} 1`,
+		"gosh_sessions_active 0\n",
+		"gosh_plugins_loaded 0\n",
+	} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("expected %s in the metrics, got:\n%s", expected, body)
+		}
+	}
+
+	if resp, err := http.Get(server.URL + "/"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected other paths to be not found: %v", err)
+	}
+}
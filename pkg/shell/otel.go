@@ -0,0 +1,72 @@
+package shell
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// tracer creates the spans of the commands with the tracer provider
+// set with otel.SetTracerProvider, which records nothing by default
+var tracer = otel.Tracer("github.com/vladimirvivien/gosh/pkg/shell")
+
+// startSpan starts the span of a run of the command of the stage. The
+// arguments are recorded as a hash, as they may hold secrets.
+func (stage pipeStage) startSpan(ctx context.Context, args []string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("gosh.command", args[0]),
+		attribute.String("gosh.args.hash", hashArgs(args[1:])),
+	}
+	if stage.origin != "" {
+		attrs = append(attrs, attribute.String("gosh.origin", stage.origin))
+	}
+	if plugin := strings.TrimPrefix(stage.origin, "plugin "); plugin != stage.origin {
+		attrs = append(attrs, attribute.String("gosh.plugin", plugin))
+	}
+	return tracer.Start(ctx, args[0], trace.WithAttributes(attrs...))
+}
+
+// endSpan records the exit status of a command in its span and ends it
+func endSpan(span trace.Span, res api.Result, err error) {
+	span.SetAttributes(attribute.Int("gosh.exit_code", api.Status(res, err)))
+	if err != nil && err != errExit {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// withoutSpan returns the context returned by a command run in spanCtx
+// with the span of ctx in place of the span of the command, which ended
+func withoutSpan(newCtx, spanCtx, ctx context.Context) context.Context {
+	if newCtx == spanCtx {
+		return ctx
+	}
+	return trace.ContextWithSpan(newCtx, trace.SpanFromContext(ctx))
+}
+
+// hashArgs returns a short hash of the arguments of a command
+func hashArgs(args []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(args, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// traceContext returns the W3C trace context of the span of ctx, with
+// the traceparent and tracestate keys, for the processes it runs
+func traceContext(ctx context.Context) map[string]string {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return nil
+	}
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier
+}
@@ -0,0 +1,75 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestShellSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(prev)
+
+	var remote trace.SpanContext
+	cmds := rpcTestCmds{"remote": rpcTestCmd{"remote", func(ctx context.Context, args []string) error {
+		remote = trace.SpanContextFromContext(ctx)
+		return nil
+	}}}
+	shellConn, pluginConn := net.Pipe()
+	go api.ServeConn(cmds, pluginConn)
+	plug, err := newRPCPlugin(shellConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plug.Close(context.TODO())
+
+	var stderr bytes.Buffer
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	shell.Register("remote", plug.Registry()["remote"])
+	if err := shell.Init(api.WithStderr(context.Background(), &stderr)); err != nil {
+		t.Fatal(err)
+	}
+	shell.Eval(shell.ctx, "remote secret; unset")
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	attrs := func(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+		m := make(map[attribute.Key]attribute.Value)
+		for _, kv := range span.Attributes() {
+			m[kv.Key] = kv.Value
+		}
+		return m
+	}
+	first, second := spans[0], spans[1]
+	if first.Name() != "remote" || attrs(first)["gosh.origin"].AsString() != "registered" ||
+		attrs(first)["gosh.args.hash"].AsString() != hashArgs([]string{"secret"}) ||
+		attrs(first)["gosh.exit_code"].AsInt64() != 0 {
+		t.Errorf("unexpected span %s: %v", first.Name(), first.Attributes())
+	}
+	if second.Name() != "unset" || attrs(second)["gosh.exit_code"].AsInt64() != 2 || second.Status().Code != codes.Error {
+		t.Errorf("unexpected span %s: %v %v", second.Name(), second.Attributes(), second.Status())
+	}
+	if remote.TraceID() != first.SpanContext().TraceID() || remote.SpanID() != first.SpanContext().SpanID() {
+		t.Errorf("expected the plugin to get the trace context of the span, got %v", remote)
+	}
+	if trace.SpanContextFromContext(shell.ctx).IsValid() {
+		t.Error("expected the span to be left out of the shell context")
+	}
+}
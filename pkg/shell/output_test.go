@@ -0,0 +1,153 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+	"github.com/vladimirvivien/gosh/api/output"
+)
+
+// fileRecord is a struct record for the output tests
+type fileRecord struct {
+	Name   string `json:"name"`
+	Size   int    `json:"size"`
+	hidden bool
+}
+
+// recordsCmd returns structured records for the shell to render
+type recordsCmd string
+
+func (c recordsCmd) Name() string      { return string(c) }
+func (c recordsCmd) Usage() string     { return string(c) }
+func (c recordsCmd) ShortDesc() string { return "returns records" }
+func (c recordsCmd) LongDesc() string  { return "" }
+func (c recordsCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	return ctx, api.Result{Data: output.Records{fileRecord{Name: "a.txt", Size: 3}}}, nil
+}
+
+func TestOutputRenderers(t *testing.T) {
+	table := output.NewTable("NAME", "DESCRIPTION")
+	table.AddRow("hello", "prints a greeting")
+	table.AddRow("sysinfo", 42)
+	kvs := output.KeyValues{
+		{Key: "name", Value: "sys"},
+		{Key: "commands", Value: []string{"exit", "prompt"}},
+		{Key: "details", Value: output.KeyValues{{Key: "size", Value: 10}}},
+	}
+	records := output.Records{
+		fileRecord{Name: "a.txt", Size: 3},
+		map[string]interface{}{"name": "bin", "dir": true},
+	}
+
+	tests := []struct {
+		name     string
+		renderer output.Renderer
+		format   output.Format
+		width    int
+		expected string
+	}{
+		{
+			name:     "table",
+			renderer: table,
+			width:    80,
+			expected: "NAME     DESCRIPTION\nhello    prints a greeting\nsysinfo  42\n",
+		},
+		{
+			name:     "narrow table",
+			renderer: table,
+			width:    20,
+			expected: "NAME     DESCRIPTION\nhello    prints a...\nsysinfo  42\n",
+		},
+		{
+			name:     "json table",
+			renderer: table,
+			format:   output.JSON,
+			expected: "[\n  {\n    \"NAME\": \"hello\",\n    \"DESCRIPTION\": \"prints a greeting\"\n  },\n  {\n    \"NAME\": \"sysinfo\",\n    \"DESCRIPTION\": \"42\"\n  }\n]\n",
+		},
+		{
+			name:     "yaml table",
+			renderer: table,
+			format:   output.YAML,
+			expected: "- NAME: hello\n  DESCRIPTION: prints a greeting\n- NAME: sysinfo\n  DESCRIPTION: \"42\"\n",
+		},
+		{
+			name:     "key values",
+			renderer: kvs,
+			width:    80,
+			expected: "name:      sys\ncommands:  exit, prompt\ndetails:\n  size:  10\n",
+		},
+		{
+			name:     "yaml key values",
+			renderer: kvs,
+			format:   output.YAML,
+			expected: "name: sys\ncommands:\n  - exit\n  - prompt\ndetails:\n  size: 10\n",
+		},
+		{
+			name:     "records",
+			renderer: records,
+			width:    80,
+			expected: "name   size  dir\na.txt  3\nbin          true\n",
+		},
+		{
+			name:     "json records",
+			renderer: records,
+			format:   output.JSON,
+			expected: "[\n  {\n    \"name\": \"a.txt\",\n    \"size\": 3\n  },\n  {\n    \"dir\": true,\n    \"name\": \"bin\"\n  }\n]\n",
+		},
+		{
+			name:     "columns",
+			renderer: output.Columns{"a", "bb", "c", "d", "e"},
+			width:    10,
+			expected: "a   c   e\nbb  d\n",
+		},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		if err := test.renderer.Write(&out, test.format, test.width); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if out.String() != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, out.String())
+		}
+	}
+
+	if _, err := output.ParseFormat("xml"); err == nil {
+		t.Error("unknown formats should be rejected")
+	}
+}
+
+func TestShellOutputFormat(t *testing.T) {
+	shell := newTestShell()
+	shell.pluginsDir = t.TempDir()
+	out := bytes.NewBufferString("")
+	ctx := api.WithStdout(context.TODO(), out)
+	ctx = api.WithStderr(ctx, ioutil.Discard)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	shell.commands.set("records", recordsCmd("records"))
+
+	script := strings.Join([]string{
+		"records",
+		"set output json",
+		"records",
+		"set",
+		"set output xml",
+		"echo $?",
+		"set output yaml; records | cat",
+	}, "\n")
+	shell.RunScript(strings.NewReader(script), "test.gsh", false)
+	expected := "name   size\na.txt  3\n" +
+		"[\n  {\n    \"name\": \"a.txt\",\n    \"size\": 3\n  }\n]\n" +
+		"{\n  \"output\": \"json\",\n  \"editing-mode\": \"emacs\",\n  \"command-timeout\": \"0s\",\n  \"slow-command\": \"0s\",\n  \"noglob\": \"off\",\n  \"complete-hidden\": \"off\",\n  \"xtrace\": \"off\"\n}\n" +
+		"1\n" +
+		"- name: a.txt\n  size: 3\n"
+	if out.String() != expected {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+}
@@ -0,0 +1,315 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/vladimirvivien/gosh/api"
+	"github.com/vladimirvivien/gosh/api/style"
+)
+
+// pager returns the writer given to commands by api.Paged. Output is only
+// paged when paging is enabled and both stdin and stdout are terminals.
+// It goes through $PAGER when it is set, or the built-in pager otherwise.
+func (gosh *Goshell) pager(ctx context.Context) io.WriteCloser {
+	out := api.GetStdout(ctx)
+	stdout, ok := out.(*os.File)
+	if !ok || !gosh.paging || !isTerminal(stdout.Fd()) || !isTerminal(os.Stdin.Fd()) {
+		return nopWriteCloser{out}
+	}
+	cols, rows, err := termSize(stdout.Fd())
+	if err != nil || cols < 1 || rows < 2 {
+		return nopWriteCloser{out}
+	}
+
+	var command string
+	var environ []string
+	if env := api.GetEnv(ctx); env != nil {
+		command, _ = env.Get("PAGER")
+		environ = env.Environ()
+	}
+	start := func() (pagerProc, error) {
+		if command != "" {
+			return startExternalPager(command, stdout, api.GetStderr(ctx), environ)
+		}
+		return startBuiltinPager(os.Stdin, stdout, cols, rows), nil
+	}
+	return newPagerWriter(stdout, cols, rows, start)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// pagerProc is a running pager that shows what is written to it
+type pagerProc interface {
+	io.WriteCloser
+	// Wait waits for the user to leave the pager
+	Wait() error
+}
+
+// pagerWriter holds back output until it no longer fits the terminal,
+// then starts a pager and sends the output there. Output that fits is
+// written as is when the writer is closed.
+type pagerWriter struct {
+	out        io.Writer
+	cols, rows int
+	start      func() (pagerProc, error)
+
+	buf       bytes.Buffer
+	used, col int
+	escape    bool
+	proc      pagerProc
+}
+
+func newPagerWriter(out io.Writer, cols, rows int, start func() (pagerProc, error)) *pagerWriter {
+	return &pagerWriter{out: out, cols: cols, rows: rows, start: start}
+}
+
+// Write never fails: once the user leaves the pager, the rest of the
+// output is dropped
+func (w *pagerWriter) Write(p []byte) (int, error) {
+	if w.proc != nil {
+		w.proc.Write(p)
+		return len(p), nil
+	}
+	w.buf.Write(p)
+	w.count(p)
+	if w.used < w.rows-1 {
+		return len(p), nil
+	}
+
+	proc, err := w.start()
+	if err != nil {
+		proc = nopPager{w.out}
+	}
+	w.proc = proc
+	w.proc.Write(w.buf.Bytes())
+	w.buf.Reset()
+	return len(p), nil
+}
+
+// count adds the terminal rows taken by p, ignoring escape sequences
+// and wrapping lines longer than the terminal width
+func (w *pagerWriter) count(p []byte) {
+	for _, c := range p {
+		switch {
+		case w.escape:
+			w.escape = c < 0x40 || c > 0x7e || c == '['
+		case c == 0x1b:
+			w.escape = true
+		case c == '\n':
+			w.used++
+			w.col = 0
+		case c&0xc0 == 0x80:
+			// continuation byte of a UTF-8 character
+		default:
+			w.col++
+			if w.col > w.cols {
+				w.used++
+				w.col = 1
+			}
+		}
+	}
+}
+
+// Close writes the output that fit the terminal, or ends the input of
+// the pager and waits for the user to leave it
+func (w *pagerWriter) Close() error {
+	if w.proc == nil {
+		_, err := w.out.Write(w.buf.Bytes())
+		w.buf.Reset()
+		return err
+	}
+	w.proc.Close()
+	return w.proc.Wait()
+}
+
+// nopPager shows the output as is when a pager cannot be started
+type nopPager struct {
+	io.Writer
+}
+
+func (nopPager) Close() error { return nil }
+func (nopPager) Wait() error  { return nil }
+
+// externalPager is a pager program such as less
+type externalPager struct {
+	io.WriteCloser
+	proc *exec.Cmd
+}
+
+func startExternalPager(command string, out, errOut io.Writer, env []string) (*externalPager, error) {
+	proc := exec.Command("sh", "-c", command)
+	proc.Stdout = out
+	proc.Stderr = errOut
+	proc.Env = env
+	in, err := proc.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := proc.Start(); err != nil {
+		return nil, err
+	}
+	return &externalPager{WriteCloser: in, proc: proc}, nil
+}
+
+func (p *externalPager) Wait() error { return p.proc.Wait() }
+
+// builtinPager shows its input a screen at a time. Space shows the next
+// page, Enter, j or the down arrow the next line, b and k or the up
+// arrow go back, and q leaves the pager. It ends by itself once the
+// last line of a closed input is shown.
+type builtinPager struct {
+	in         io.Reader
+	out        io.Writer
+	cols, rows int
+
+	mu      sync.Mutex
+	changed *sync.Cond
+	lines   []string
+	partial string
+	closed  bool
+	quit    bool
+	done    chan struct{}
+}
+
+func startBuiltinPager(in io.Reader, out io.Writer, cols, rows int) *builtinPager {
+	p := &builtinPager{in: in, out: out, cols: cols, rows: rows, done: make(chan struct{})}
+	p.changed = sync.NewCond(&p.mu)
+	go p.run()
+	return p
+}
+
+func (p *builtinPager) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.quit {
+		return len(b), nil
+	}
+	parts := strings.Split(p.partial+string(b), "\n")
+	p.lines = append(p.lines, parts[:len(parts)-1]...)
+	p.partial = parts[len(parts)-1]
+	p.changed.Broadcast()
+	return len(b), nil
+}
+
+func (p *builtinPager) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.partial != "" {
+		p.lines = append(p.lines, p.partial)
+		p.partial = ""
+	}
+	p.closed = true
+	p.changed.Broadcast()
+	return nil
+}
+
+func (p *builtinPager) Wait() error {
+	<-p.done
+	return nil
+}
+
+// page returns the end of the page starting at line top and whether
+// the page is filled
+func (p *builtinPager) page(top int) (int, bool) {
+	end, used := top, 0
+	for end < len(p.lines) {
+		n := (len([]rune(p.lines[end])) + p.cols - 1) / p.cols
+		if n == 0 {
+			n = 1
+		}
+		if used+n > p.rows-1 && end > top {
+			return end, true
+		}
+		used += n
+		end++
+	}
+	return end, used >= p.rows-1
+}
+
+func (p *builtinPager) run() {
+	defer close(p.done)
+	if f, ok := p.in.(*os.File); ok {
+		if state, err := makeRaw(f.Fd()); err == nil {
+			defer restoreTerm(f.Fd(), state)
+		}
+	}
+
+	top := 0
+	for {
+		p.mu.Lock()
+		end, full := p.page(top)
+		for !full && !p.closed {
+			p.changed.Wait()
+			end, full = p.page(top)
+		}
+		last := p.closed && end >= len(p.lines)
+		io.WriteString(p.out, "\x1b[H\x1b[2J")
+		for _, line := range p.lines[top:end] {
+			io.WriteString(p.out, line+"\n")
+		}
+		p.mu.Unlock()
+		if last {
+			return
+		}
+
+		style.New(style.Reverse).Fprint(p.out, "--More--")
+		key := p.readKey()
+		io.WriteString(p.out, "\r\x1b[K")
+		p.mu.Lock()
+		switch key {
+		case 'q', 'Q', 3, 4, 0:
+			p.quit = true
+			p.lines = nil
+			p.mu.Unlock()
+			return
+		case ' ', 'f':
+			top = end
+		case '\r', '\n', 'j':
+			top++
+		case 'b':
+			top -= p.rows - 1
+		case 'k':
+			top--
+		}
+		if top < 0 {
+			top = 0
+		}
+		if top > len(p.lines) {
+			top = len(p.lines)
+		}
+		p.mu.Unlock()
+	}
+}
+
+// readKey reads a key press, mapping the up and down arrows to k and j.
+// It returns 0 when the input fails.
+func (p *builtinPager) readKey() byte {
+	buf := make([]byte, 1)
+	if _, err := p.in.Read(buf); err != nil {
+		return 0
+	}
+	if buf[0] != 0x1b {
+		return buf[0]
+	}
+	seq := make([]byte, 2)
+	if _, err := io.ReadFull(p.in, seq); err != nil || seq[0] != '[' {
+		return 0x1b
+	}
+	switch seq[1] {
+	case 'A':
+		return 'k'
+	case 'B':
+		return 'j'
+	}
+	return 0x1b
+}
@@ -0,0 +1,73 @@
+package shell
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// recordingPager collects what is written to it
+type recordingPager struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (p *recordingPager) Close() error { p.closed = true; return nil }
+func (p *recordingPager) Wait() error  { return nil }
+
+func TestPagerWriter(t *testing.T) {
+	var out bytes.Buffer
+	var pager *recordingPager
+	start := func() (pagerProc, error) {
+		pager = &recordingPager{}
+		return pager, nil
+	}
+
+	w := newPagerWriter(&out, 10, 4, start)
+	fmt.Fprint(w, "one\n\x1b[31mtwo\x1b[0m\n")
+	if out.Len() != 0 {
+		t.Error("output should be held back until the writer is closed")
+	}
+	w.Close()
+	if pager != nil || out.String() != "one\n\x1b[31mtwo\x1b[0m\n" {
+		t.Errorf("short output should not be paged, got %q", out.String())
+	}
+
+	out.Reset()
+	w = newPagerWriter(&out, 10, 4, start)
+	fmt.Fprint(w, "short\n")
+	fmt.Fprint(w, strings.Repeat("x", 25))
+	if pager == nil {
+		t.Fatal("output wrapping past the terminal height should start the pager")
+	}
+	fmt.Fprint(w, "\nlast\n")
+	w.Close()
+	if out.Len() != 0 || !pager.closed || pager.String() != "short\n"+strings.Repeat("x", 25)+"\nlast\n" {
+		t.Errorf("unexpected paged output: %q, direct output: %q", pager.String(), out.String())
+	}
+}
+
+func TestBuiltinPager(t *testing.T) {
+	lines := "1\n2\n3\n4\n5\n6\n7\n"
+
+	var out bytes.Buffer
+	p := startBuiltinPager(strings.NewReader("  "), &out, 80, 4)
+	fmt.Fprint(p, lines)
+	p.Close()
+	p.Wait()
+	pages := strings.Split(out.String(), "\x1b[H\x1b[2J")
+	if len(pages) != 4 || pages[1] != "1\n2\n3\n--More--\r\x1b[K" || pages[3] != "7\n" {
+		t.Errorf("unexpected pages: %q", pages)
+	}
+
+	out.Reset()
+	p = startBuiltinPager(strings.NewReader("jbq"), &out, 80, 4)
+	fmt.Fprint(p, lines)
+	p.Wait()
+	fmt.Fprint(p, "8\n")
+	pages = strings.Split(out.String(), "\x1b[H\x1b[2J")
+	if len(pages) != 4 || pages[2] != "2\n3\n4\n--More--\r\x1b[K" || pages[3] != "1\n2\n3\n--More--\r\x1b[K" {
+		t.Errorf("unexpected pages: %q", pages)
+	}
+}
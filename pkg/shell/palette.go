@@ -0,0 +1,256 @@
+package shell
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// paletteItem is an entry of the command palette: a command with its
+// short description, or a line of the history
+type paletteItem struct {
+	text    string
+	desc    string
+	command bool
+}
+
+// paletteItems returns the commands of the shell by name, followed by
+// the lines of the history, the most recent first and without repeats
+func (gosh *Goshell) paletteItems() []paletteItem {
+	commands := gosh.commands.Commands()
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	items := make([]paletteItem, 0, len(names)+gosh.history.len())
+	for _, name := range names {
+		items = append(items, paletteItem{text: name, desc: commands[name].ShortDesc(), command: true})
+	}
+	seen := make(map[string]bool)
+	for i := gosh.history.len() - 1; i >= 0; i-- {
+		line := gosh.history.get(i)
+		if !seen[line] {
+			seen[line] = true
+			items = append(items, paletteItem{text: line})
+		}
+	}
+	return items
+}
+
+// fuzzyScore reports whether the characters of query appear in text in
+// order, ignoring case, and scores the match: characters following each
+// other, starting a word or starting the text score higher.
+func fuzzyScore(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	t := []rune(strings.ToLower(text))
+	score, qi, prev := 0, 0, -2
+	for ti := 0; ti < len(t) && qi < len(q); ti++ {
+		if t[ti] != q[qi] {
+			continue
+		}
+		score++
+		switch {
+		case ti == prev+1:
+			score += 3
+		case ti == 0 || !unicode.IsLetter(t[ti-1]) && !unicode.IsDigit(t[ti-1]):
+			score += 2
+		}
+		if ti == 0 {
+			score += 2
+		}
+		prev = ti
+		qi++
+	}
+	return score, qi == len(q)
+}
+
+// filterPalette returns the items matching query, the best matches
+// first. Items scoring the same keep their order.
+func filterPalette(items []paletteItem, query string) []paletteItem {
+	if query == "" {
+		return items
+	}
+	type match struct {
+		item  paletteItem
+		score int
+	}
+	var matches []match
+	for _, item := range items {
+		if score, ok := fuzzyScore(query, item.text); ok {
+			matches = append(matches, match{item, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	filtered := make([]paletteItem, len(matches))
+	for i, m := range matches {
+		filtered[i] = m.item
+	}
+	return filtered
+}
+
+// palette is a full-screen fuzzy finder over items, drawn on the
+// alternate screen of a terminal in raw mode
+type palette struct {
+	in    *bufio.Reader
+	out   io.Writer
+	items []paletteItem
+	rows  int
+
+	query    []rune
+	matches  []paletteItem
+	selected int
+}
+
+// run shows the palette until Enter selects the highlighted item, which
+// is returned, or Escape, Ctrl-G or Ctrl-C cancel it. Typing filters the
+// items, and the up and down arrows, Ctrl-P and Ctrl-N move the
+// highlight.
+func (p *palette) run() (paletteItem, bool, error) {
+	io.WriteString(p.out, "\x1b[?1049h")
+	defer io.WriteString(p.out, "\x1b[?1049l")
+	p.matches = p.items
+	for {
+		p.draw()
+		r, _, err := p.in.ReadRune()
+		if err != nil {
+			return paletteItem{}, false, err
+		}
+		switch {
+		case r == keyEnter || r == keyNewline:
+			if len(p.matches) == 0 {
+				continue
+			}
+			return p.matches[p.selected], true, nil
+		case r == keyCtrlC || r == keyCtrlG:
+			return paletteItem{}, false, nil
+		case r == keyEscape:
+			if p.in.Buffered() < 2 {
+				return paletteItem{}, false, nil
+			}
+			seq := make([]byte, 2)
+			io.ReadFull(p.in, seq)
+			switch string(seq) {
+			case "[A", "OA":
+				p.move(-1)
+			case "[B", "OB":
+				p.move(1)
+			}
+		case r == keyCtrlP:
+			p.move(-1)
+		case r == keyCtrlN:
+			p.move(1)
+		case r == keyBackspace || r == keyCtrlH:
+			if len(p.query) > 0 {
+				p.filter(p.query[:len(p.query)-1])
+			}
+		case r == keyCtrlU:
+			p.filter(nil)
+		case r >= ' ':
+			p.filter(append(p.query, r))
+		}
+	}
+}
+
+func (p *palette) move(delta int) {
+	if n := p.selected + delta; n >= 0 && n < len(p.matches) {
+		p.selected = n
+	}
+}
+
+func (p *palette) filter(query []rune) {
+	p.query = query
+	p.matches = filterPalette(p.items, string(query))
+	p.selected = 0
+}
+
+// draw draws the query, then as many matches as fit the screen, the
+// view following the highlighted one
+func (p *palette) draw() {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\x1b[H\x1b[2J> %s\r\n", string(p.query))
+	height := p.rows - 2
+	if height < 1 {
+		height = 1
+	}
+	top := 0
+	if p.selected >= height {
+		top = p.selected - height + 1
+	}
+	end := top + height
+	if end > len(p.matches) {
+		end = len(p.matches)
+	}
+	for i := top; i < end; i++ {
+		item := p.matches[i]
+		line := item.text
+		if i == p.selected {
+			line = currentTheme().selected.Sprint(item.text)
+		}
+		if item.desc != "" {
+			line += "  " + currentTheme().suggestion.Sprint(item.desc)
+		}
+		b.WriteString(line + "\r\n")
+	}
+	fmt.Fprintf(&b, "%d/%d\x1b[1;%dH", len(p.matches), len(p.items), len([]rune(string(p.query)))+3)
+	io.WriteString(p.out, b.String())
+}
+
+// termRows returns the number of rows of the terminal of the session:
+// the size of the terminal of stdout, or $LINES for remote terminals,
+// or 24 when neither is known
+func (gosh *Goshell) termRows(ctx context.Context) int {
+	if stdout, ok := api.GetStdout(ctx).(*os.File); ok && isTerminal(stdout.Fd()) {
+		if _, rows, err := termSize(stdout.Fd()); err == nil && rows > 0 {
+			return rows
+		}
+	}
+	if rows, err := strconv.Atoi(getenv(ctx, "LINES")); err == nil && rows > 0 {
+		return rows
+	}
+	return 24
+}
+
+// paletteCmd opens the command palette and puts the selection in the
+// next input line
+type paletteCmd struct {
+	gosh *Goshell
+}
+
+func (c paletteCmd) Name() string  { return "palette" }
+func (c paletteCmd) Usage() string { return "palette" }
+func (c paletteCmd) LongDesc() string {
+	return `The palette lists the commands, with their description, and the lines
+of the history. Typing filters them, keeping those containing the typed
+characters in order, best matches first. The arrows move the highlight,
+Enter selects it and Escape leaves. The selection is put in the next
+input line, to be edited or run. Ctrl-P opens the palette at the prompt,
+inserting the selection at the cursor.`
+}
+func (c paletteCmd) ShortDesc() string { return `finds commands and history lines to run` }
+func (c paletteCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	restore, ok, err := c.gosh.rawInput(ctx)
+	if err != nil {
+		return ctx, api.Result{}, err
+	}
+	if !ok {
+		return ctx, api.Result{}, errors.New("palette: stdin is not a terminal")
+	}
+	defer restore()
+	p := &palette{in: bufio.NewReader(api.GetStdin(ctx)), out: api.GetStdout(ctx), items: c.gosh.paletteItems(), rows: c.gosh.termRows(ctx)}
+	item, ok, err := p.run()
+	if err != nil || !ok {
+		return ctx, api.Result{}, err
+	}
+	c.gosh.nextLine = item.text
+	return ctx, api.Result{}, nil
+}
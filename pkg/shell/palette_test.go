@@ -0,0 +1,69 @@
+package shell
+
+import (
+	"bufio"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilterPalette(t *testing.T) {
+	items := []paletteItem{
+		{text: "deploy", command: true},
+		{text: "plugin", command: true},
+		{text: "help", command: true},
+		{text: "git push origin main"},
+		{text: "docker ps"},
+	}
+	tests := []struct {
+		query string
+		texts []string
+	}{
+		{"", []string{"deploy", "plugin", "help", "git push origin main", "docker ps"}},
+		{"pl", []string{"plugin", "deploy"}},
+		{"DP", []string{"docker ps", "deploy"}},
+		{"gpom", []string{"git push origin main"}},
+		{"xyz", []string{}},
+	}
+	for _, test := range tests {
+		texts := []string{}
+		for _, item := range filterPalette(items, test.query) {
+			texts = append(texts, item.text)
+		}
+		if !reflect.DeepEqual(texts, test.texts) {
+			t.Errorf("%q: expected %q, got %q", test.query, test.texts, texts)
+		}
+	}
+}
+
+func TestLineEditorPalette(t *testing.T) {
+	items := func() []paletteItem {
+		return []paletteItem{
+			{text: "deploy", desc: "deploys", command: true},
+			{text: "plugin", desc: "manages plugins", command: true},
+			{text: "make test"},
+		}
+	}
+	tests := []struct {
+		name  string
+		input string
+		line  string
+	}{
+		{"command", "\x10plug\r--list\r", "plugin --list"},
+		{"history", "sudo \x10\x1b[B\x1b[B\x1b[A\x0e\r\r", "sudo make test"},
+		{"cancel", "ls\x10de\x07\r", "ls"},
+	}
+	for _, test := range tests {
+		in := bufio.NewReader(strings.NewReader(test.input))
+		e := newLineEditor(in, ioutil.Discard, ">", defaultKeymap(), newHistory("", 10), nil)
+		e.palette, e.rows = items, 10
+		line, err := e.readLine()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimRight(line, "\n") != test.line {
+			t.Errorf("%s: expected %q, got %q", test.name, test.line, line)
+		}
+	}
+}
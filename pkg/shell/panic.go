@@ -0,0 +1,91 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// panicError is the error of a command that panicked
+type panicError struct {
+	cmd   string
+	value interface{}
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("%s: panic: %v", e.cmd, e.value)
+}
+
+// panicGuard counts the panics of the commands, and disables a command
+// once it panicked max times, until the plugins are reloaded. A max of
+// 0 never disables commands.
+type panicGuard struct {
+	mu     sync.Mutex
+	max    int
+	counts map[string]int
+}
+
+func newPanicGuard(max int) *panicGuard {
+	return &panicGuard{max: max, counts: make(map[string]int)}
+}
+
+// check returns an error when the command name is disabled
+func (g *panicGuard) check(name string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.max > 0 && g.counts[name] >= g.max {
+		return fmt.Errorf("%s: disabled after %d panics, reload the plugins to enable it again", name, g.counts[name])
+	}
+	return nil
+}
+
+// record counts a panic of the command name and reports whether this
+// disabled it
+func (g *panicGuard) record(name string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.counts[name]++
+	return g.max > 0 && g.counts[name] == g.max
+}
+
+// reset enables the disabled commands again
+func (g *panicGuard) reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.counts = make(map[string]int)
+}
+
+// execCommand calls the Exec method of the command of the stage. The
+// stack trace of a panic of the command is printed to stderr and the
+// panic returned as an error, so that a buggy plugin fails its command
+// rather than the shell. Panics in goroutines started by the command
+// cannot be recovered. The run is counted in the metrics of the shell
+// and traced in a span of its own.
+func (stage pipeStage) execCommand(ctx context.Context, args []string) (newCtx context.Context, res api.Result, err error) {
+	spanCtx, span := stage.startSpan(ctx, args)
+	start := time.Now()
+	defer func() {
+		if stage.metrics != nil {
+			stage.metrics.record(args[0], time.Since(start), api.Status(res, err))
+		}
+		endSpan(span, res, err)
+		newCtx = withoutSpan(newCtx, spanCtx, ctx)
+	}()
+	defer func() {
+		value := recover()
+		if value == nil {
+			return
+		}
+		name := stage.cmd.Name()
+		api.GetStderr(ctx).Write(debug.Stack())
+		if stage.panics != nil && stage.panics.record(name) {
+			fmt.Fprintf(api.GetStderr(ctx), "%s is disabled until the plugins are reloaded\n", name)
+		}
+		newCtx, res, err = ctx, api.Result{Code: 1}, &panicError{cmd: name, value: value}
+	}()
+	return stage.cmd.Exec(spanCtx, args)
+}
@@ -0,0 +1,44 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestShellPanickingCommand(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	shell.panics = newPanicGuard(2)
+	shell.Register("boom", rpcTestCmd{"boom", func(ctx context.Context, args []string) error {
+		panic("boom")
+	}})
+	if err := shell.Init(api.WithStdout(context.TODO(), bytes.NewBufferString(""))); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		stderr := bytes.NewBufferString("")
+		_, err := shell.Eval(api.WithStderr(shell.ctx, stderr), "boom")
+		if err == nil || err.Error() != "boom: panic: boom" || api.ExitStatus(err) != 1 {
+			t.Errorf("unexpected error %v", err)
+		}
+		if !strings.Contains(stderr.String(), "goroutine ") {
+			t.Errorf("expected a stack trace, got %q", stderr.String())
+		}
+	}
+	if _, err := shell.Eval(shell.ctx, "boom"); err == nil || !strings.Contains(err.Error(), "disabled after 2 panics") {
+		t.Errorf("expected the command to be disabled, got %v", err)
+	}
+	if _, err := shell.reloadPlugins(shell.ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := shell.Eval(api.WithStderr(shell.ctx, bytes.NewBufferString("")), "boom"); err == nil || strings.Contains(err.Error(), "disabled") {
+		t.Errorf("reloading should enable the command again, got %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// maxParallelStatus is the exit status of parallel when more commands
+// failed than a status counts, as in GNU parallel
+const maxParallelStatus = 101
+
+// parallelCmd runs command lines concurrently
+type parallelCmd struct {
+	gosh *Goshell
+}
+
+func (c parallelCmd) Name() string { return "parallel" }
+func (c parallelCmd) Usage() string {
+	return "parallel [-j <jobs>] [--] <command> [<args>...] [:: <command> [<args>...]]..."
+}
+func (c parallelCmd) LongDesc() string {
+	return `The commands are separated by ::, and a command line with operators is
+quoted, as in parallel -j2 -- build :: 'test || report'. -j runs at most
+that many commands at once, all of them by default. Each line of output
+and errors is prefixed with the number of its command, [1] for the first,
+and written as soon as it is complete. parallel fails when a command
+fails, with the number of failed commands as its status, up to 100, or
+101 for more.`
+}
+func (c parallelCmd) ShortDesc() string { return `runs commands concurrently` }
+func (c parallelCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	jobs, args, err := parseParallelArgs(args[1:])
+	if err != nil {
+		return ctx, api.Result{}, api.NewUsageError("%v", err)
+	}
+	var lists [][]pipelineNode
+	for _, cmd := range splitArgs(args, "::") {
+		if len(cmd) == 0 {
+			return ctx, api.Result{}, api.NewUsageError("expected a command between ::")
+		}
+		list, err := c.gosh.parseLine(commandLine(cmd))
+		if err != nil {
+			return ctx, api.Result{}, err
+		}
+		lists = append(lists, list)
+	}
+	if jobs == 0 || jobs > len(lists) {
+		jobs = len(lists)
+	}
+
+	// the lines of the commands interleave, but never mix
+	var mu sync.Mutex
+	stdout, stderr := api.GetStdout(ctx), api.GetStderr(ctx)
+	slots := make(chan struct{}, jobs)
+	errs := make([]error, len(lists))
+	var wg sync.WaitGroup
+	for i, list := range lists {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			continue
+		}
+		wg.Add(1)
+		go func(i int, list []pipelineNode) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			prefix := "[" + strconv.Itoa(i+1) + "] "
+			out := &prefixWriter{mu: &mu, w: stdout, prefix: prefix}
+			errOut := &prefixWriter{mu: &mu, w: stderr, prefix: prefix}
+			runCtx := api.WithStderr(api.WithStdout(api.WithStdin(ctx, strings.NewReader("")), out), errOut)
+			_, errs[i] = c.gosh.runApart(runCtx, list)
+			if errs[i] != nil {
+				c.gosh.printErr(runCtx, errs[i])
+			}
+			out.Flush()
+			errOut.Flush()
+		}(i, list)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return ctx, api.Result{}, nil
+	}
+	status := failed
+	if status >= maxParallelStatus {
+		status = maxParallelStatus
+	}
+	return ctx, api.Result{Code: status}, api.NewExitError(status, fmt.Errorf("%d of %d commands failed", failed, len(lists)))
+}
+
+// Complete completes the commands run by parallel
+func (c parallelCmd) Complete(ctx context.Context, args []string, cursorPos int) []string {
+	first := 1
+	for i := 1; i < cursorPos; i++ {
+		switch {
+		case args[i] == "::" || args[i] == "--":
+			first = i + 1
+		case i == first && args[i] == "-j":
+			first = i + 2
+			i++
+		case i == first && strings.HasPrefix(args[i], "-j"):
+			first = i + 1
+		}
+	}
+	if cursorPos < first {
+		return nil
+	}
+	return c.gosh.complete(ctx, args[first:cursorPos+1])
+}
+
+// parseParallelArgs parses the options of parallel, -j4 or -j 4 and --,
+// and returns the arguments left
+func parseParallelArgs(args []string) (int, []string, error) {
+	jobs := 0
+	for len(args) > 0 {
+		switch arg := args[0]; {
+		case arg == "--":
+			return jobs, args[1:], nil
+		case arg == "-j" && len(args) > 1, strings.HasPrefix(arg, "-j") && len(arg) > 2:
+			value := strings.TrimPrefix(arg, "-j")
+			if value == "" {
+				value, args = args[1], args[1:]
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return 0, nil, fmt.Errorf("invalid number of jobs %q", value)
+			}
+			jobs = n
+		case arg == "-j":
+			return 0, nil, fmt.Errorf("-j expects a number of jobs")
+		default:
+			return jobs, args, nil
+		}
+		args = args[1:]
+	}
+	return 0, nil, fmt.Errorf("expected a command")
+}
+
+// splitArgs splits args at each sep
+func splitArgs(args []string, sep string) [][]string {
+	var parts [][]string
+	start := 0
+	for i, arg := range args {
+		if arg == sep {
+			parts = append(parts, args[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, args[start:])
+}
+
+// prefixWriter writes the complete lines written to it to w, each with
+// a prefix. The writers sharing mu write their lines one at a time.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf = append(p.buf, b...)
+	i := bytes.LastIndexByte(p.buf, '\n')
+	if i < 0 {
+		return len(b), nil
+	}
+	lines := p.buf[:i+1]
+	var out bytes.Buffer
+	for len(lines) > 0 {
+		n := bytes.IndexByte(lines, '\n')
+		out.WriteString(p.prefix)
+		out.Write(lines[:n+1])
+		lines = lines[n+1:]
+	}
+	p.buf = append(p.buf[:0], p.buf[i+1:]...)
+	if _, err := p.w.Write(out.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Flush writes the incomplete line left, if any
+func (p *prefixWriter) Flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.buf) == 0 {
+		return
+	}
+	fmt.Fprintf(p.w, "%s%s\n", p.prefix, p.buf)
+	p.buf = nil
+}
@@ -0,0 +1,106 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestParseParallelArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		jobs int
+		rest []string
+	}{
+		{[]string{"a", "::", "b"}, 0, []string{"a", "::", "b"}},
+		{[]string{"-j4", "--", "a"}, 4, []string{"a"}},
+		{[]string{"-j", "2", "a", "-j3"}, 2, []string{"a", "-j3"}},
+	}
+	for _, test := range tests {
+		jobs, rest, err := parseParallelArgs(test.args)
+		if err != nil || jobs != test.jobs || !reflect.DeepEqual(rest, test.rest) {
+			t.Errorf("parseParallelArgs(%q) = %d, %q, %v", test.args, jobs, rest, err)
+		}
+	}
+	for _, args := range [][]string{{}, {"--"}, {"-j"}, {"-j0", "a"}, {"-jx", "a"}} {
+		if _, rest, err := parseParallelArgs(args); err == nil && len(rest) > 0 {
+			t.Errorf("parseParallelArgs(%q) should have failed", args)
+		}
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	var w prefixWriter
+	w.mu, w.w, w.prefix = new(sync.Mutex), &out, "[1] "
+	fmt.Fprint(&w, "one\ntw")
+	fmt.Fprint(&w, "o\nthree")
+	w.Flush()
+	if out.String() != "[1] one\n[1] two\n[1] three\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
+
+func TestShellParallel(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	var running, most int32
+	shell.Register("work", rpcTestCmd{"work", func(ctx context.Context, args []string) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprintln(api.GetStdout(ctx), "done", args[1])
+		if args[1] == "fail" {
+			return errors.New("failed")
+		}
+		return nil
+	}})
+	if err := shell.Init(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"parallel", "parallel -j0 work a", "parallel work a :: :: work b"} {
+		if _, err := shell.handle(shell.ctx, line); err == nil {
+			t.Errorf("%s should have failed", line)
+		}
+	}
+
+	var out bytes.Buffer
+	ctx := api.WithStderr(api.WithStdout(shell.ctx, &out), &out)
+	_, err := shell.handle(ctx, "parallel -j2 -- work a :: work fail :: 'work b && work c' :: work fail")
+	if api.ExitStatus(err) != 2 || err.Error() != "2 of 4 commands failed" {
+		t.Errorf("expected 2 failed commands, got %v", err)
+	}
+	if most != 2 {
+		t.Errorf("expected 2 commands at once, got %d", most)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	sort.Strings(lines)
+	expected := []string{"[1] done a", "[2] done fail", "[2] failed", "[3] done b", "[3] done c", "[4] done fail", "[4] failed"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("expected the prefixed lines %q, got %q", expected, lines)
+	}
+
+	// compound commands and substitutions keep their results apart
+	if _, err := shell.handle(ctx, "parallel 'if work a; then work $(work b); fi' :: 'if work c; then work fail; fi'"); api.ExitStatus(err) != 1 {
+		t.Errorf("expected 1 failed command, got %v", err)
+	}
+}
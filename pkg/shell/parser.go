@@ -0,0 +1,446 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// commandNode is a simple command with its redirections. The stderr
+// of a command followed by |& goes down the pipe with its stdout.
+type commandNode struct {
+	args       []word
+	redirs     []redirectNode
+	pipeStderr bool
+}
+
+// redirectNode is a redirection whose target has not been expanded yet.
+// The target of a here-document is its delimiter, followed by its body.
+type redirectNode struct {
+	op     string
+	target word
+	body   word
+}
+
+// pipelineNode is a pipeline in a list, joined to the previous
+// pipeline by op: "&&", "||" or ";" (empty for the first pipeline).
+// A pipeline terminated by & runs in the background. A compound
+// command takes the place of the commands of a pipeline.
+type pipelineNode struct {
+	op         string
+	cmds       []commandNode
+	compound   *compoundNode
+	background bool
+}
+
+// compoundNode is an if, for or while command, or the definition of a
+// function. The clauses of an if are its if and elif conditions with
+// their bodies, the clause of a while is its condition; body is the body
+// of a for or while, repeated for each of the words of a for, with the
+// variable name set to it, or the body of the function name.
+type compoundNode struct {
+	keyword  string
+	clauses  []clauseNode
+	elseBody []pipelineNode
+	name     string
+	words    []word
+	body     []pipelineNode
+}
+
+// clauseNode is a condition and the body it guards
+type clauseNode struct {
+	cond []pipelineNode
+	body []pipelineNode
+}
+
+// String returns the pipeline as a command line
+func (n pipelineNode) String() string {
+	if n.compound != nil {
+		return n.compound.String()
+	}
+	var b strings.Builder
+	for i, cmd := range n.cmds {
+		if i > 0 {
+			if n.cmds[i-1].pipeStderr {
+				b.WriteString(" |& ")
+			} else {
+				b.WriteString(" | ")
+			}
+		}
+		var words []string
+		for _, arg := range cmd.args {
+			words = append(words, arg.String())
+		}
+		for _, r := range cmd.redirs {
+			words = append(words, r.op, r.target.String())
+		}
+		b.WriteString(strings.Join(words, " "))
+	}
+	return b.String()
+}
+
+// String returns the compound command on a single line
+func (n *compoundNode) String() string {
+	var b strings.Builder
+	switch n.keyword {
+	case "if":
+		for i, c := range n.clauses {
+			if i > 0 {
+				b.WriteString("; el")
+			}
+			fmt.Fprintf(&b, "if %s; then %s", listString(c.cond), listString(c.body))
+		}
+		if n.elseBody != nil {
+			fmt.Fprintf(&b, "; else %s", listString(n.elseBody))
+		}
+		b.WriteString("; fi")
+		return b.String()
+	case "while":
+		fmt.Fprintf(&b, "while %s", listString(n.clauses[0].cond))
+	case "for":
+		fmt.Fprintf(&b, "for %s in", n.name)
+		for _, w := range n.words {
+			b.WriteString(" " + w.String())
+		}
+	case "fn":
+		return fmt.Sprintf("fn %s() { %s }", n.name, listString(n.body))
+	}
+	fmt.Fprintf(&b, "; do %s; done", listString(n.body))
+	return b.String()
+}
+
+// listString returns a list of pipelines as a command line
+func listString(list []pipelineNode) string {
+	var b strings.Builder
+	for i, node := range list {
+		switch {
+		case i == 0:
+		case list[i-1].background:
+			b.WriteString(" ")
+		case node.op == ";":
+			b.WriteString("; ")
+		default:
+			b.WriteString(" " + node.op + " ")
+		}
+		b.WriteString(node.String())
+		if node.background {
+			b.WriteString(" &")
+		}
+	}
+	return b.String()
+}
+
+// isListOp reports if op separates pipelines in a list. An unquoted
+// newline separates them like ;.
+func isListOp(op string) bool {
+	return op == "&&" || op == "||" || op == ";" || op == "&" || op == "\n"
+}
+
+// isPipeOp reports if op connects the commands of a pipeline: | pipes
+// the stdout of a command to the next one, |& its stdout and stderr
+func isPipeOp(op string) bool {
+	return op == "|" || op == "|&"
+}
+
+// reservedWords start and end the parts of compound commands. They are
+// only recognized unquoted, as the first word of a command, except for
+// the } closing the body of a function, which may follow the words of
+// its last command.
+var reservedWords = map[string]bool{
+	"if": true, "then": true, "elif": true, "else": true, "fi": true,
+	"for": true, "in": true, "while": true, "do": true, "done": true,
+	"fn": true, "}": true,
+}
+
+// parseList parses tokens into a list of pipelines joined
+// by &&, || and ;. A pipeline followed by & runs in the background
+// and the next one runs as if it followed a ;. A trailing ; or &
+// is allowed.
+func parseList(tokens []token) ([]pipelineNode, error) {
+	p := &parser{tokens: tokens}
+	list, err := p.list()
+	if err != nil {
+		return nil, err
+	}
+	if !p.atEnd() {
+		return nil, fmt.Errorf("syntax error near %s", p.text())
+	}
+	return list, nil
+}
+
+// parser parses tokens by recursive descent, compound commands
+// containing lists of their own
+type parser struct {
+	tokens []token
+	pos    int
+	// braces is the number of function bodies being parsed
+	braces int
+}
+
+func (p *parser) atEnd() bool {
+	return p.pos >= len(p.tokens)
+}
+
+// text returns the current token as it is written in error messages
+func (p *parser) text() string {
+	if p.atEnd() {
+		return "end of line"
+	}
+	if tok := p.tokens[p.pos]; tok.op != "" {
+		if tok.op == "\n" {
+			return "newline"
+		}
+		return tok.op
+	}
+	return p.tokens[p.pos].word.String()
+}
+
+// keyword returns the reserved word at the current token, if any
+func (p *parser) keyword() string {
+	if p.atEnd() || p.tokens[p.pos].op != "" {
+		return ""
+	}
+	name, ok := unquotedWord(p.tokens[p.pos].word)
+	if !ok || !reservedWords[name] {
+		return ""
+	}
+	return name
+}
+
+// skipNewlines skips the newlines, which may follow an operator or
+// start a list
+func (p *parser) skipNewlines() {
+	for !p.atEnd() && p.tokens[p.pos].op == "\n" {
+		p.pos++
+	}
+}
+
+// expect consumes the reserved word kw
+func (p *parser) expect(kw string) error {
+	if p.keyword() != kw {
+		if p.atEnd() {
+			return fmt.Errorf("syntax error: missing %s", kw)
+		}
+		return fmt.Errorf("syntax error near %s", p.text())
+	}
+	p.pos++
+	return nil
+}
+
+// list parses pipelines up to the end of the tokens or to one of the
+// reserved words in end, which stays unconsumed
+func (p *parser) list(end ...string) ([]pipelineNode, error) {
+	var list []pipelineNode
+	op := ""
+	for {
+		p.skipNewlines()
+		kw := p.keyword()
+		if p.atEnd() || (kw != "" && contains(end, kw)) {
+			if op == "&&" || op == "||" {
+				return nil, fmt.Errorf("syntax error: missing command after %s", op)
+			}
+			break
+		}
+		if isListOp(p.tokens[p.pos].op) {
+			return nil, fmt.Errorf("syntax error near %s", p.tokens[p.pos].op)
+		}
+		if kw != "" && kw != "if" && kw != "for" && kw != "while" && kw != "fn" {
+			return nil, fmt.Errorf("syntax error near %s", kw)
+		}
+		node, err := p.pipeline()
+		if err != nil {
+			return nil, err
+		}
+		node.op = op
+		list = append(list, node)
+		if p.atEnd() || !isListOp(p.tokens[p.pos].op) {
+			break
+		}
+		op = p.tokens[p.pos].op
+		p.pos++
+		switch op {
+		case "&":
+			list[len(list)-1].background = true
+			op = ";"
+		case "\n":
+			op = ";"
+		}
+	}
+	if len(end) > 0 && len(list) == 0 {
+		return nil, fmt.Errorf("syntax error near %s", p.text())
+	}
+	return list, nil
+}
+
+// pipeline parses a compound command or the commands of a pipeline
+func (p *parser) pipeline() (pipelineNode, error) {
+	switch kw := p.keyword(); kw {
+	case "if", "for", "while", "fn":
+		p.pos++
+		c, err := p.compound(kw)
+		return pipelineNode{compound: c}, err
+	}
+	var cmds []commandNode
+	var cmd commandNode
+	for ; !p.atEnd() && !isListOp(p.tokens[p.pos].op); p.pos++ {
+		if p.braces > 0 && p.keyword() == "}" {
+			break
+		}
+		tok := p.tokens[p.pos]
+		switch tok.op {
+		case "":
+			cmd.args = append(cmd.args, tok.word)
+		case "|", "|&":
+			if len(cmd.args) == 0 {
+				return pipelineNode{}, fmt.Errorf("syntax error near %s", tok.op)
+			}
+			cmd.pipeStderr = tok.op == "|&"
+			cmds = append(cmds, cmd)
+			cmd = commandNode{}
+			for p.pos+1 < len(p.tokens) && p.tokens[p.pos+1].op == "\n" {
+				p.pos++
+			}
+		default:
+			if p.pos+1 >= len(p.tokens) || p.tokens[p.pos+1].op != "" {
+				return pipelineNode{}, fmt.Errorf("syntax error: missing file for %s", tok.op)
+			}
+			p.pos++
+			cmd.redirs = append(cmd.redirs, redirectNode{op: tok.op, target: p.tokens[p.pos].word, body: tok.body})
+		}
+	}
+	if len(cmd.args) == 0 {
+		return pipelineNode{}, errors.New("syntax error: missing command")
+	}
+	return pipelineNode{cmds: append(cmds, cmd)}, nil
+}
+
+// compound parses the rest of the compound command started by kw
+func (p *parser) compound(kw string) (*compoundNode, error) {
+	node := &compoundNode{keyword: kw}
+	var err error
+	switch kw {
+	case "if":
+		for {
+			var c clauseNode
+			if c.cond, err = p.list("then"); err != nil {
+				return nil, err
+			}
+			if err := p.expect("then"); err != nil {
+				return nil, err
+			}
+			if c.body, err = p.list("elif", "else", "fi"); err != nil {
+				return nil, err
+			}
+			node.clauses = append(node.clauses, c)
+			if p.keyword() != "elif" {
+				break
+			}
+			p.pos++
+		}
+		if p.keyword() == "else" {
+			p.pos++
+			if node.elseBody, err = p.list("fi"); err != nil {
+				return nil, err
+			}
+		}
+		return node, p.expect("fi")
+	case "while":
+		var c clauseNode
+		if c.cond, err = p.list("do"); err != nil {
+			return nil, err
+		}
+		node.clauses = []clauseNode{c}
+	case "for":
+		name, ok := "", false
+		if !p.atEnd() && p.tokens[p.pos].op == "" {
+			name, ok = unquotedWord(p.tokens[p.pos].word)
+		}
+		if !ok || !isName(name) {
+			return nil, fmt.Errorf("syntax error: invalid for variable %s", p.text())
+		}
+		node.name = name
+		p.pos++
+		if err := p.expect("in"); err != nil {
+			return nil, err
+		}
+		for ; !p.atEnd() && p.tokens[p.pos].op == ""; p.pos++ {
+			node.words = append(node.words, p.tokens[p.pos].word)
+		}
+		if !p.atEnd() && (p.tokens[p.pos].op == ";" || p.tokens[p.pos].op == "\n") {
+			p.pos++
+		}
+		p.skipNewlines()
+	case "fn":
+		return p.function(node)
+	}
+	if err := p.expect("do"); err != nil {
+		return nil, err
+	}
+	if node.body, err = p.list("done"); err != nil {
+		return nil, err
+	}
+	return node, p.expect("done")
+}
+
+// function parses the rest of the definition of a function:
+//
+//	fn name() { list }
+//
+// The parentheses are optional and may be separated from the name.
+func (p *parser) function(node *compoundNode) (*compoundNode, error) {
+	name, ok := "", false
+	if !p.atEnd() && p.tokens[p.pos].op == "" {
+		name, ok = unquotedWord(p.tokens[p.pos].word)
+		p.pos++
+	}
+	if strings.HasSuffix(name, "()") {
+		name = strings.TrimSuffix(name, "()")
+	} else if p.isWord("()") {
+		p.pos++
+	}
+	if !ok || !isFuncName(name) || reservedWords[name] {
+		return nil, fmt.Errorf("syntax error: invalid function name %s", name)
+	}
+	node.name = name
+	p.skipNewlines()
+	if !p.isWord("{") {
+		if p.atEnd() {
+			return nil, errors.New("syntax error: missing {")
+		}
+		return nil, fmt.Errorf("syntax error near %s", p.text())
+	}
+	p.pos++
+	p.braces++
+	body, err := p.list("}")
+	if err != nil {
+		return nil, err
+	}
+	p.braces--
+	node.body = body
+	return node, p.expect("}")
+}
+
+// isWord reports whether the current token is the unquoted word s
+func (p *parser) isWord(s string) bool {
+	if p.atEnd() || p.tokens[p.pos].op != "" {
+		return false
+	}
+	text, ok := unquotedWord(p.tokens[p.pos].word)
+	return ok && text == s
+}
+
+// isFuncName reports if s may name a function: a variable name that may
+// also contain dashes after its first character
+func isFuncName(s string) bool {
+	return s != "" && s[0] != '-' && isName(strings.Replace(s, "-", "_", -1))
+}
+
+// contains reports whether list contains s
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
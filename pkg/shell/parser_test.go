@@ -0,0 +1,70 @@
+package shell
+
+import "testing"
+
+func TestParseList(t *testing.T) {
+	tokens, err := lex("build && deploy || rollback; echo done;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := parseList(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops := []string{"", "&&", "||", ";"}
+	if len(list) != len(ops) {
+		t.Fatalf("expected %d pipelines, got %d", len(ops), len(list))
+	}
+	for i, node := range list {
+		if node.op != ops[i] {
+			t.Errorf("pipeline %d: expected op %q, got %q", i, ops[i], node.op)
+		}
+	}
+
+	for _, line := range []string{"&& echo", "echo &&", "echo ;; echo", "echo | && echo"} {
+		tokens, _ := lex(line)
+		if _, err := parseList(tokens); err == nil {
+			t.Errorf("%s: expected syntax error", line)
+		}
+	}
+}
+
+func TestParseCompound(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"if ok; then echo yes; fi", "if ok; then echo yes; fi"},
+		{"if a\nthen b\nelif c; then d && e\nelse f; fi; g", "if a; then b; elif c; then d && e; else f; fi"},
+		{"for f in *.go ~/src; do echo $f; done", "for f in *.go ~/src; do echo $f; done"},
+		{"while\n check |\n grep up\ndo sleep 1 & done", "while check | grep up; do sleep 1 &; done"},
+		{"echo if then fi", "echo if then fi"},
+		{"make |&\n tee log | wc -l", "make |& tee log | wc -l"},
+		{"fn deploy() { build && push }", "fn deploy() { build && push }"},
+		{"fn greet-all ()\n{\n  echo hi $1\n  echo bye }", "fn greet-all() { echo hi $1; echo bye }"},
+	}
+	for _, test := range tests {
+		tokens, err := lex(test.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		list, err := parseList(tokens)
+		if err != nil {
+			t.Fatalf("%q: %v", test.line, err)
+		}
+		if got := list[0].String(); got != test.want {
+			t.Errorf("%q: expected %q, got %q", test.line, test.want, got)
+		}
+	}
+
+	for _, line := range []string{
+		"if ok; fi", "if ok; then fi", "if; then a; fi", "fi", "for 1 in a; do b; done",
+		"for x a; do b; done", "while a; do b; done c", "if a; then b; fi | c", "'if' a; then b; fi",
+		"fn 1x() { a }", "fn f() { }", "fn f() { a", "fn f() a", "} a",
+	} {
+		tokens, _ := lex(line)
+		if _, err := parseList(tokens); err == nil {
+			t.Errorf("%q: expected syntax error", line)
+		}
+	}
+}
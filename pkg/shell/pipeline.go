@@ -0,0 +1,203 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/vladimirvivien/gosh/api"
+	"github.com/vladimirvivien/gosh/api/output"
+)
+
+// pipeStage is a single command in a pipeline, with the assignments
+// exported to it and where the command comes from. A stage piping its
+// stderr writes it to the next stage along with its stdout.
+type pipeStage struct {
+	cmd        api.Command
+	args       []string
+	assigns    []assignment
+	redirs     []redirect
+	panics     *panicGuard
+	metrics    *metrics
+	cache      *resultCache
+	origin     string
+	pipeStderr bool
+}
+
+// exec runs the stage with its assignments and redirections applied.
+// Stream and environment changes are scoped to the command and are not
+// kept in the returned context. The code of the returned result is the
+// exit status of the command.
+func (stage pipeStage) exec(ctx context.Context) (context.Context, api.Result, error) {
+	if len(stage.assigns) > 0 {
+		return stage.withAssignments(ctx)
+	}
+	if len(stage.redirs) == 0 {
+		return stage.runCached(ctx)
+	}
+	cmdCtx, files, err := openRedirects(ctx, stage.redirs)
+	if err != nil {
+		return ctx, api.Result{Code: 1}, err
+	}
+	defer closeAll(files)
+	newCtx, res, err := stage.runCached(cmdCtx)
+	return withIOFrom(newCtx, ctx), res, err
+}
+
+// render writes the data of a successful result to the stdout of ctx
+// when it is an output.Renderer, such as output.Records, in the output
+// format of the shell
+func render(ctx context.Context, res api.Result, err error) (api.Result, error) {
+	r, ok := res.Data.(output.Renderer)
+	if err != nil || !ok {
+		return res, err
+	}
+	if err := output.Render(ctx, r); err != nil {
+		return api.Result{Code: 1, Data: res.Data}, err
+	}
+	return res, nil
+}
+
+// rendered returns the result of a command run by another command,
+// such as env, without the data its stage has rendered already, so that
+// the stage of the other command does not render it again
+func rendered(res api.Result) api.Result {
+	if _, ok := res.Data.(output.Renderer); ok {
+		res.Data = nil
+	}
+	return res
+}
+
+// run parses the flags of a command that implements api.Flagger and
+// calls Exec with the arguments left after the flags. The parsed flags
+// are only visible to the command. Asking for help with -h or --help
+// prints the usage of the command.
+func (stage pipeStage) run(ctx context.Context) (context.Context, api.Result, error) {
+	flagger, ok := stage.cmd.(api.Flagger)
+	if !ok || len(flagger.Flags()) == 0 {
+		newCtx, res, err := stage.execCommand(ctx, stage.args)
+		res, err = exitResult(res, stage.usageError(err))
+		return newCtx, res, err
+	}
+
+	flags := api.NewFlagSet(flagger.Flags())
+	err := flags.Parse(stage.args[1:])
+	if errors.Is(err, api.ErrHelp) {
+		fmt.Fprint(api.GetStdout(ctx), api.FormatUsage(stage.cmd))
+		return ctx, api.Result{}, nil
+	}
+	if err != nil {
+		res, err := exitResult(api.Result{}, stage.usageError(err))
+		return ctx, res, err
+	}
+	args := append([]string{stage.args[0]}, flags.Args()...)
+	flagsCtx := api.WithFlags(ctx, flags)
+	newCtx, res, err := stage.execCommand(flagsCtx, args)
+	switch {
+	case newCtx == flagsCtx:
+		newCtx = ctx
+	case api.GetFlags(newCtx) == flags:
+		newCtx = api.WithFlags(newCtx, nil)
+	}
+	res, err = exitResult(res, stage.usageError(err))
+	return newCtx, res, err
+}
+
+// exitResult sets the code of the result of a command to its exit
+// status. A failing command that returned no error gets an exit error,
+// so that the shell reports it like any other failure. The result of
+// the exit builtin is kept as the exit code of the shell.
+func exitResult(res api.Result, err error) (api.Result, error) {
+	if err == errExit {
+		return res, err
+	}
+	res.Code = api.Status(res, err)
+	if err == nil && res.Code != 0 {
+		err = api.NewExitError(res.Code, nil)
+	}
+	return res, err
+}
+
+// usageError adds the command name and usage to a usage error
+func (stage pipeStage) usageError(err error) error {
+	var usageErr *api.UsageError
+	if !errors.As(err, &usageErr) {
+		return err
+	}
+	usage := strings.TrimRight(api.FormatUsage(stage.cmd), "\n")
+	return fmt.Errorf("%s: %w\n%s", stage.cmd.Name(), err, usage)
+}
+
+// runPipeline runs the stages concurrently, connecting the stdout of
+// each stage, and its stderr when it pipes it, to the stdin of the next
+// one. The first stage reads from the stdin in ctx and the last stage
+// writes to the stdout in ctx. Like a shell without pipefail, the
+// result and error of the last stage are returned. Context changes made
+// by the stages are discarded.
+func runPipeline(ctx context.Context, stages []pipeStage) (api.Result, error) {
+	type pipe struct{ r, w *os.File }
+	pipes := make([]pipe, len(stages)-1)
+	for i := range pipes {
+		r, w, err := os.Pipe()
+		if err != nil {
+			for _, p := range pipes[:i] {
+				p.r.Close()
+				p.w.Close()
+			}
+			return api.Result{Code: 1}, err
+		}
+		pipes[i] = pipe{r, w}
+	}
+
+	// the stages write concurrently to the stderr they share
+	if _, ok := api.GetStderr(ctx).(*os.File); !ok {
+		ctx = api.WithStderr(ctx, &syncWriter{w: api.GetStderr(ctx)})
+	}
+	results := make([]api.Result, len(stages))
+	errs := make([]error, len(stages))
+	var wg sync.WaitGroup
+	for i, stage := range stages {
+		stageCtx := ctx
+		if i > 0 {
+			stageCtx = api.WithStdin(stageCtx, pipes[i-1].r)
+		}
+		if i < len(pipes) {
+			stageCtx = api.WithStdout(stageCtx, pipes[i].w)
+			if stage.pipeStderr {
+				stageCtx = api.WithStderr(stageCtx, pipes[i].w)
+			}
+		}
+
+		wg.Add(1)
+		go func(i int, stage pipeStage, stageCtx context.Context) {
+			defer wg.Done()
+			_, results[i], errs[i] = stage.exec(stageCtx)
+			// signal EOF downstream and stop writes from upstream
+			if i < len(pipes) {
+				pipes[i].w.Close()
+			}
+			if i > 0 {
+				pipes[i-1].r.Close()
+			}
+		}(i, stage, stageCtx)
+	}
+	wg.Wait()
+	return results[len(results)-1], errs[len(errs)-1]
+}
+
+// syncWriter serializes the writes of concurrent commands to a writer
+// that is not safe for concurrent use, such as a bytes.Buffer
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
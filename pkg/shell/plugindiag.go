@@ -0,0 +1,90 @@
+package shell
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// differentPackage starts the part of the errors of plugin.Open naming
+// the first package that differs between a plugin and the shell
+const differentPackage = "different version of package "
+
+// pluginOpenError explains an error of plugin.Open, which is terse, with
+// its likely cause and the command rebuilding the plugin at path to
+// match the shell
+func pluginOpenError(path string, err error) error {
+	msg := err.Error()
+	var cause string
+	switch {
+	case strings.Contains(msg, differentPackage):
+		cause = packageMismatch(strings.TrimSpace(msg[strings.LastIndex(msg, differentPackage)+len(differentPackage):]))
+	case strings.Contains(msg, "invalid ELF header"), strings.Contains(msg, "wrong ELF class"),
+		strings.Contains(msg, "file too short"), strings.Contains(msg, "not a mach-o file"):
+		cause = fmt.Sprintf("the file is not a Go plugin built for %s/%s, as -buildmode=plugin builds", runtime.GOOS, runtime.GOARCH)
+	case strings.Contains(msg, "undefined symbol"):
+		cause = "the plugin needs a symbol the shell does not have; it was likely built with other build flags or cgo settings than the shell"
+	case strings.Contains(msg, "plugin: not implemented"):
+		return fmt.Errorf("failed to open plugin %s: the shell was built without cgo, which Go plugins need: rebuild it with CGO_ENABLED=1", filepath.Base(path))
+	default:
+		return fmt.Errorf("failed to open plugin %s: %v", filepath.Base(path), err)
+	}
+	return fmt.Errorf("failed to open plugin %s: %v\n  cause: %s\n  rebuild it with %s: %s",
+		filepath.Base(path), err, cause, runtime.Version(), rebuildCommand(path))
+}
+
+// packageMismatch describes why the package pkg of a plugin differs
+// from the one of the shell: a standard library package differs when
+// the Go toolchain or the build flags do, other packages when their
+// module version or source paths do
+func packageMismatch(pkg string) string {
+	if !strings.Contains(strings.SplitN(pkg, "/", 2)[0], ".") {
+		return fmt.Sprintf("the plugin was built with another Go toolchain, or other build flags, than the %s of the shell", runtime.Version())
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return fmt.Sprintf("the plugin was built against another version of %s than the shell", pkg)
+	}
+	modules := append([]*debug.Module{&info.Main}, info.Deps...)
+	for _, m := range modules {
+		if m.Replace != nil {
+			m = m.Replace
+		}
+		if pkg != m.Path && !strings.HasPrefix(pkg, m.Path+"/") {
+			continue
+		}
+		if m.Version == "" || m.Version == "(devel)" {
+			return fmt.Sprintf("the plugin was built against another version of %s than the shell, "+
+				"or from sources at other paths (a different GOPATH or module cache) without -trimpath", m.Path)
+		}
+		return fmt.Sprintf("the plugin was built against another version of %s than the %s of the shell, "+
+			"or from sources at other paths without -trimpath: require %s %s in its go.mod", m.Path, m.Version, m.Path, m.Version)
+	}
+	return fmt.Sprintf("the plugin was built against another version of %s than the shell", pkg)
+}
+
+// rebuildCommand returns the go build command building the plugin at
+// path with the build flags of the shell that must match
+func rebuildCommand(path string) string {
+	args := append([]string{"go", "build", "-buildmode=plugin"}, pluginBuildFlags()...)
+	return strings.Join(append(args, "-o", path, "."), " ")
+}
+
+// pluginBuildFlags returns the flags the shell was built with that Go
+// plugins must be built with too
+func pluginBuildFlags() []string {
+	var flags []string
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			switch {
+			case (s.Key == "-trimpath" || s.Key == "-race") && s.Value == "true":
+				flags = append(flags, s.Key)
+			case s.Key == "-tags" || s.Key == "-gcflags":
+				flags = append(flags, s.Key+"="+quoteWord(s.Value))
+			}
+		}
+	}
+	return flags
+}
@@ -0,0 +1,45 @@
+package shell
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPluginOpenError(t *testing.T) {
+	path := "plugins/sys_command.so"
+	tests := []struct {
+		err      string
+		expected []string
+	}{
+		{
+			`plugin.Open("plugins/sys_command"): plugin was built with a different version of package internal/abi`,
+			[]string{"another Go toolchain", "rebuild it with " + runtime.Version(), "go build -buildmode=plugin", "-o plugins/sys_command.so ."},
+		},
+		{
+			`plugin.Open("plugins/sys_command"): plugin was built with a different version of package example.com/lib/util`,
+			[]string{"another version of example.com/lib/util than the shell"},
+		},
+		{
+			`plugin.Open("plugins/sys_command"): plugins/sys_command.so: invalid ELF header`,
+			[]string{"not a Go plugin built for " + runtime.GOOS},
+		},
+		{
+			`plugin: not implemented`,
+			[]string{"built without cgo", "CGO_ENABLED=1"},
+		},
+		{
+			`plugin.Open("plugins/sys_command"): realpath failed`,
+			[]string{"failed to open plugin sys_command.so: plugin.Open"},
+		},
+	}
+	for _, test := range tests {
+		msg := pluginOpenError(path, errors.New(test.err)).Error()
+		for _, expected := range test.expected {
+			if !strings.Contains(msg, expected) {
+				t.Errorf("%s: expected %q in %q", test.err, expected, msg)
+			}
+		}
+	}
+}
@@ -0,0 +1,366 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/vladimirvivien/gosh/api"
+	"github.com/vladimirvivien/gosh/api/output"
+)
+
+// rePluginSuffix matches the part of a plugin file name after its name
+var rePluginSuffix = regexp.MustCompile(`_command(\.so|\.wasm|\.star|\.exe)?$`)
+
+// pluginName returns the name of a plugin file, such as "sys" for
+// sys_command.so
+func pluginName(file string) string {
+	return rePluginSuffix.ReplaceAllString(filepath.Base(file), "")
+}
+
+// pluginKind describes the kind of a plugin file
+func pluginKind(file string) string {
+	name := filepath.Base(file)
+	switch {
+	case reWasm.MatchString(name):
+		return "wasm"
+	case reStarlark.MatchString(name):
+		return "starlark"
+	case rePlugin.MatchString(name):
+		return "go"
+	default:
+		return "process"
+	}
+}
+
+// findPlugin returns the loaded plugin with the given name, file name or
+// name in its manifest, looking in the search path order
+func (gosh *Goshell) findPlugin(name string) (*pluginFile, bool) {
+	for _, plug := range gosh.sortedPlugins() {
+		if pluginName(plug.path) == name || filepath.Base(plug.path) == name ||
+			plug.manifest != nil && plug.manifest.Name == name {
+			return plug, true
+		}
+	}
+	return nil, false
+}
+
+// sortedPlugins returns the loaded plugins in search path order
+func (gosh *Goshell) sortedPlugins() []*pluginFile {
+	order := make(map[string]int)
+	for i, dir := range gosh.pluginDirs() {
+		if _, ok := order[dir]; !ok {
+			order[dir] = i
+		}
+	}
+	plugins := make([]*pluginFile, 0, len(gosh.plugins))
+	for _, plug := range gosh.plugins {
+		plugins = append(plugins, plug)
+	}
+	sort.Slice(plugins, func(i, j int) bool {
+		if order[plugins[i].dir] != order[plugins[j].dir] {
+			return order[plugins[i].dir] < order[plugins[j].dir]
+		}
+		return plugins[i].path < plugins[j].path
+	})
+	return plugins
+}
+
+// installDir returns the directory plugins are installed to, the first
+// one of the search path
+func (gosh *Goshell) installDir() (string, error) {
+	dirs := gosh.pluginDirs()
+	if len(dirs) == 0 {
+		return "", errors.New("no plugins directory")
+	}
+	if err := os.MkdirAll(dirs[0], 0755); err != nil {
+		return "", err
+	}
+	return dirs[0], nil
+}
+
+// pluginCmd manages the plugin files
+type pluginCmd struct {
+	gosh *Goshell
+}
+
+var pluginSubcommands = []string{"list", "info", "install", "remove"}
+
+func (c pluginCmd) Name() string { return "plugin" }
+func (c pluginCmd) Usage() string {
+	return "plugin list | info <name> | install <url|package> | remove <name>"
+}
+func (c pluginCmd) LongDesc() string {
+	return `list prints the loaded plugins and info the details of one of them,
+with its manifest. Commands shadowed by the same command of another plugin
+are marked. install downloads a plugin file from an http(s) URL, or builds
+the Go plugin package at a module path (such as
+example.com/plugins/foo@latest), into the first directory of the plugins
+search path. remove deletes a plugin file. Commands are reloaded after
+install and remove.`
+}
+func (c pluginCmd) ShortDesc() string { return `lists, installs and removes plugins` }
+func (c pluginCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	if len(args) < 2 {
+		return ctx, api.Result{}, api.NewUsageError("missing subcommand")
+	}
+	switch {
+	case args[1] == "list" && len(args) == 2:
+		return ctx, api.Result{}, c.list(ctx)
+	case args[1] == "info" && len(args) == 3:
+		return ctx, api.Result{}, c.info(ctx, args[2])
+	case args[1] == "install" && len(args) == 3:
+		return ctx, api.Result{}, c.install(ctx, args[2])
+	case args[1] == "remove" && len(args) == 3:
+		return ctx, api.Result{}, c.remove(ctx, args[2])
+	}
+	return ctx, api.Result{}, api.NewUsageError("invalid subcommand %s", args[1])
+}
+
+// Complete completes the subcommands and the names of loaded plugins
+func (c pluginCmd) Complete(ctx context.Context, args []string, cursorPos int) []string {
+	var candidates []string
+	switch {
+	case cursorPos == 1:
+		candidates = pluginSubcommands
+	case cursorPos == 2 && (args[1] == "info" || args[1] == "remove"):
+		for _, plug := range c.gosh.sortedPlugins() {
+			candidates = append(candidates, pluginName(plug.path))
+		}
+	}
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, args[cursorPos]) {
+			matches = append(matches, candidate)
+		}
+	}
+	return matches
+}
+
+func (c pluginCmd) list(ctx context.Context) error {
+	// the version column is left out when no manifest sets one
+	var rows [][]interface{}
+	versions := false
+	for _, plug := range c.gosh.sortedPlugins() {
+		names := make([]string, 0, len(plug.registry))
+		for name := range plug.registry {
+			if c.shadowed(plug, name) {
+				name += " (shadowed)"
+			}
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		name, version := pluginName(plug.path), ""
+		if plug.manifest != nil {
+			if plug.manifest.Name != "" {
+				name = plug.manifest.Name
+			}
+			version = plug.manifest.Version
+		}
+		versions = versions || version != ""
+		rows = append(rows, []interface{}{name, version, pluginKind(plug.path), plug.path, strings.Join(names, ", ")})
+	}
+	table := output.NewTable("NAME", "VERSION", "KIND", "PATH", "COMMANDS")
+	if !versions {
+		table = output.NewTable("NAME", "KIND", "PATH", "COMMANDS")
+	}
+	for _, row := range rows {
+		if !versions {
+			row = append(row[:1], row[2:]...)
+		}
+		table.AddRow(row...)
+	}
+	out := api.Paged(ctx)
+	defer out.Close()
+	return table.Write(out, output.GetFormat(ctx), output.Width(api.GetStdout(ctx)))
+}
+
+func (c pluginCmd) info(ctx context.Context, name string) error {
+	plug, ok := c.gosh.findPlugin(name)
+	if !ok {
+		return fmt.Errorf("plugin %s not found", name)
+	}
+	names := make([]string, 0, len(plug.registry))
+	for name := range plug.registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	commands := make(output.KeyValues, len(names))
+	for i, name := range names {
+		desc := plug.registry[name].ShortDesc()
+		if c.shadowed(plug, name) {
+			desc += fmt.Sprintf(" (shadowed by %s)", c.gosh.conflicts[name][0])
+		}
+		commands[i] = output.KeyValue{Key: name, Value: desc}
+	}
+	info := output.KeyValues{
+		{Key: "name", Value: pluginName(plug.path)},
+		{Key: "kind", Value: pluginKind(plug.path)},
+		{Key: "path", Value: plug.path},
+		{Key: "size", Value: plug.size},
+		{Key: "modified", Value: plug.modTime.Format("2006-01-02 15:04:05")},
+		{Key: "version", Value: plug.version},
+		{Key: "opened", Value: plug.opened()},
+		{Key: "commands", Value: commands},
+	}
+	if m := plug.manifest; m != nil {
+		manifest := output.KeyValues{
+			{Key: "name", Value: m.Name},
+			{Key: "version", Value: m.Version},
+			{Key: "api_version", Value: m.APIVersion},
+			{Key: "commands", Value: strings.Join(m.Commands, ", ")},
+		}
+		if caps := m.Capabilities; caps != nil {
+			manifest = append(manifest, output.KeyValue{Key: "capabilities", Value: output.KeyValues{
+				{Key: "read", Value: strings.Join(caps.Read, ", ")},
+				{Key: "write", Value: strings.Join(caps.Write, ", ")},
+				{Key: "network", Value: caps.Network},
+				{Key: "exec", Value: caps.Exec},
+			}})
+		}
+		info = append(info, output.KeyValue{Key: "manifest", Value: manifest})
+	}
+	return output.Render(ctx, info)
+}
+
+// shadowed reports whether the command name of plug is shadowed by the
+// one of another plugin
+func (c pluginCmd) shadowed(plug *pluginFile, name string) bool {
+	paths, ok := c.gosh.conflicts[name]
+	return ok && paths[0] != plug.path
+}
+
+func (c pluginCmd) install(ctx context.Context, source string) error {
+	dir, err := c.gosh.installDir()
+	if err != nil {
+		return err
+	}
+	var file string
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		file, err = downloadPlugin(ctx, source, dir)
+	} else {
+		file, err = buildPlugin(ctx, source, dir)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(api.GetStdout(ctx), "installed %s\n", file)
+	_, err = c.gosh.reloadPlugins(ctx)
+	return err
+}
+
+func (c pluginCmd) remove(ctx context.Context, name string) error {
+	plug, ok := c.gosh.findPlugin(name)
+	if !ok {
+		return fmt.Errorf("plugin %s not found", name)
+	}
+	if err := os.Remove(plug.path); err != nil {
+		return err
+	}
+	fmt.Fprintf(api.GetStdout(ctx), "removed %s\n", plug.path)
+	_, err := c.gosh.reloadPlugins(ctx)
+	return err
+}
+
+// downloadPlugin downloads a plugin file into dir. The last element of
+// the URL path is used as the file name and must be a plugin file name.
+func downloadPlugin(ctx context.Context, source, dir string) (string, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(u.Path)
+	if !isPluginFile(name) {
+		return "", fmt.Errorf("%s is not a plugin file name", name)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, source, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download %s: %s", source, resp.Status)
+	}
+
+	// download to a temporary file first, so that the plugin watcher
+	// never sees a partial file
+	tmp, err := ioutil.TempFile(dir, ".download-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, name)
+	return file, os.Rename(tmp.Name(), file)
+}
+
+// buildPlugin builds a Go plugin from a package path with an optional
+// @version (latest by default) in a temporary module
+func buildPlugin(ctx context.Context, source, dir string) (string, error) {
+	pkg, version := source, "latest"
+	if i := strings.LastIndex(source, "@"); i > 0 {
+		pkg, version = source[:i], source[i+1:]
+	}
+	file, err := filepath.Abs(filepath.Join(dir, path.Base(pkg)+"_command.so"))
+	if err != nil {
+		return "", err
+	}
+
+	work, err := ioutil.TempDir("", "gosh-plugin-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(work)
+
+	// build to a temporary file first, so that the plugin watcher never
+	// sees a partial file
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".build-*")
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+	build := tmp.Name()
+	defer os.Remove(build)
+	steps := [][]string{
+		{"go", "mod", "init", "gosh-plugin"},
+		{"go", "get", pkg + "@" + version},
+		{"go", "build", "-buildmode=plugin", "-o", build, pkg},
+	}
+	for _, step := range steps {
+		cmd := exec.CommandContext(ctx, step[0], step[1:]...)
+		cmd.Dir = work
+		cmd.Env = append(os.Environ(), "GO111MODULE=on")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("%s: %v\n%s", strings.Join(step, " "), err, output)
+		}
+	}
+	if err := os.Chmod(build, 0755); err != nil {
+		return "", err
+	}
+	return file, os.Rename(build, file)
+}
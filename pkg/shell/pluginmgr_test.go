@@ -0,0 +1,67 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestPluginCmd(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`command(name = "hi", fn = lambda args: print("hi"), short_desc = "says hi")`))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	shell := New()
+	shell.indexPath = ""
+	shell.pluginsDir = dir
+	out := bytes.NewBufferString("")
+	if err := shell.Init(api.WithStdout(context.TODO(), out)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := shell.handle(shell.ctx, "plugin install "+server.URL+"/hi_command.star"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "hi_command.star")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := shell.commands.Lookup("hi"); !ok {
+		t.Fatal("installed plugin should be loaded")
+	}
+	if _, err := shell.handle(shell.ctx, "plugin install "+server.URL+"/hi.txt"); err == nil {
+		t.Error("non plugin files should not be installed")
+	}
+
+	out.Reset()
+	if _, err := shell.handle(shell.ctx, "plugin list; plugin info hi"); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"NAME", "starlark", "hi_command.star  hi\n", "  hi:  says hi\n"} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("output should contain %q, got %q", expected, out.String())
+		}
+	}
+
+	if got := (pluginCmd{shell}).Complete(shell.ctx, []string{"plugin", "remove", "h"}, 2); len(got) != 1 || got[0] != "hi" {
+		t.Errorf("unexpected completion: %v", got)
+	}
+
+	if _, err := shell.handle(shell.ctx, "plugin remove hi"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := shell.commands.Lookup("hi"); ok {
+		t.Error("removed plugin should be unloaded")
+	}
+	if _, err := shell.handle(shell.ctx, "plugin info hi"); err == nil {
+		t.Error("removed plugin should not be found")
+	}
+}
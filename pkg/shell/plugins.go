@@ -0,0 +1,646 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"plugin"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/vladimirvivien/gosh/api"
+)
+
+const (
+	pluginPattern = `_command\.so$`
+
+	// reloadDelay groups the file events of a plugin build into one reload
+	reloadDelay = 500 * time.Millisecond
+)
+
+// maxPluginLoaders bounds the number of plugins opened concurrently
+var maxPluginLoaders = runtime.NumCPU()
+
+// openedPlugins holds the Go plugins opened by the process by the hash
+// of their file. A Go plugin is only loaded once per process, whatever
+// the path it is opened from.
+var openedPlugins = struct {
+	mu      sync.Mutex
+	plugins map[[sha256.Size]byte]*plugin.Plugin
+}{plugins: make(map[[sha256.Size]byte]*plugin.Plugin)}
+
+var (
+	rePlugin   = regexp.MustCompile(pluginPattern)
+	reProcess  = regexp.MustCompile(processPattern)
+	reWasm     = regexp.MustCompile(wasmPattern)
+	reStarlark = regexp.MustCompile(starlarkPattern)
+)
+
+// pluginFile is a plugin shared object loaded into the shell. Go plugins
+// cannot be unloaded, so when the file changes it is loaded again as a
+// new version whose registry shadows the one of the previous version.
+type pluginFile struct {
+	path     string
+	dir      string
+	modTime  time.Time
+	size     int64
+	version  int
+	module   api.Commands
+	registry map[string]api.Command
+	segments []string
+	banner   bool
+	manifest *pluginManifest
+
+	// a lazy plugin is opened by the first run of one of its commands,
+	// whose registry entries stand for the actual commands
+	lazy     bool
+	mu       sync.Mutex
+	commands map[string]api.Command
+	loadErr  error
+}
+
+// opened reports whether the plugin was opened, which a lazy plugin
+// only is when one of its commands runs
+func (p *pluginFile) opened() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !p.lazy || p.commands != nil
+}
+
+func (p *pluginFile) changed(info os.FileInfo) bool {
+	return !info.ModTime().Equal(p.modTime) || info.Size() != p.size
+}
+
+// loadCommands loads the command plugins of each directory in the
+// plugins search path, a list of directories separated by the OS path
+// list separator (colon on Unix), and rebuilds the command registry.
+func (gosh *Goshell) loadCommands() error {
+	_, err := gosh.scanPlugins()
+	gosh.buildRegistry()
+	return err
+}
+
+// pluginLoad is a plugin file to open during a scan
+type pluginLoad struct {
+	dir     string
+	file    os.FileInfo
+	version int
+	prev    *pluginFile
+	plug    *pluginFile
+	output  bytes.Buffer
+	err     error
+	elapsed time.Duration
+}
+
+// scanPlugins loads the plugin files that are new or changed since the
+// last scan and forgets the ones that were removed. It returns the
+// number of plugin files loaded.
+func (gosh *Goshell) scanPlugins() (int, error) {
+	var loads []*pluginLoad
+	lazy := 0
+	seen := make(map[string]bool)
+	for _, dir := range gosh.pluginDirs() {
+		if _, err := os.Stat(dir); err != nil {
+			// the default directory is optional
+			if !os.IsNotExist(err) || dir != api.PluginsDir {
+				gosh.log().Warn("skipping plugins directory", "err", err)
+			}
+			continue
+		}
+		files, err := listPluginFiles(dir)
+		if err != nil {
+			return 0, err
+		}
+		for _, file := range files {
+			path := filepath.Join(dir, file.Name())
+			seen[path] = true
+			prev, known := gosh.plugins[path]
+			if known && !prev.changed(file) {
+				continue
+			}
+			load := &pluginLoad{dir: dir, file: file, version: 1}
+			if known {
+				load.prev = prev
+				load.version = prev.version + 1
+			}
+			if plug, ok := gosh.lazyPlugin(dir, file, load.version); ok {
+				if known {
+					gosh.closePlugin(gosh.ctx, prev)
+				}
+				gosh.plugins[path] = plug
+				gosh.warnUndeclared(plug)
+				lazy++
+				continue
+			}
+			loads = append(loads, load)
+		}
+	}
+
+	start := time.Now()
+	gosh.openPlugins(loads)
+	loaded := 0
+	for _, load := range loads {
+		io.Copy(api.GetStdout(gosh.ctx), &load.output)
+		gosh.log().Debug("opened plugin", "path", filepath.Join(load.dir, load.file.Name()), "elapsed", load.elapsed)
+		if load.err != nil {
+			gosh.log().Error(load.err.Error())
+			continue
+		}
+		if load.prev != nil {
+			gosh.closePlugin(gosh.ctx, load.prev)
+		}
+		gosh.plugins[load.plug.path] = load.plug
+		gosh.indexPlugin(load.plug)
+		gosh.warnUndeclared(load.plug)
+		loaded++
+	}
+	if len(loads) > 0 {
+		gosh.log().Debug("loaded plugins", "loaded", loaded, "total", len(loads), "elapsed", time.Since(start))
+	}
+
+	for path, plug := range gosh.plugins {
+		if !seen[path] {
+			gosh.closePlugin(gosh.ctx, plug)
+			delete(gosh.plugins, path)
+		}
+	}
+	gosh.saveIndex()
+	gosh.metrics.plugins.Store(int64(len(gosh.plugins)))
+	return loaded + lazy, nil
+}
+
+// warnUndeclared logs the commands of a plugin missing from the commands
+// of its manifest
+func (gosh *Goshell) warnUndeclared(plug *pluginFile) {
+	if plug.manifest == nil {
+		return
+	}
+	if names := plug.manifest.undeclared(plug.registry); len(names) > 0 {
+		gosh.log().Warn("plugin provides commands missing from its manifest",
+			"plugin", filepath.Base(plug.path), "commands", strings.Join(names, ","))
+	}
+}
+
+// openPlugins opens the plugin files with a pool of at most
+// maxPluginLoaders goroutines. Output written by the plugins while they
+// initialize is kept in the output of each load, so that it can be
+// shown in a deterministic order.
+func (gosh *Goshell) openPlugins(loads []*pluginLoad) {
+	workers := maxPluginLoaders
+	if len(loads) < workers {
+		workers = len(loads)
+	}
+	parent := gosh.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	queue := make(chan *pluginLoad)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for load := range queue {
+				start := time.Now()
+				ctx := api.WithStdout(parent, &load.output)
+				load.plug, load.err = gosh.openPlugin(ctx, load.dir, load.file, load.version)
+				load.elapsed = time.Since(start)
+			}
+		}()
+	}
+	for _, load := range loads {
+		queue <- load
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// openPlugin opens and initializes a plugin file. A Go plugin can only be
+// opened once per path, so later versions are opened from a temporary copy.
+// So are signed plugins: the private copy is verified and opened, so
+// that the plugin file cannot be replaced in between. Other kinds of
+// plugins are opened by openModulePlugin.
+func (gosh *Goshell) openPlugin(ctx context.Context, dir string, file os.FileInfo, version int) (*pluginFile, error) {
+	path := filepath.Join(dir, file.Name())
+	if !strings.HasSuffix(path, ".so") {
+		return gosh.openModulePlugin(ctx, dir, file, version)
+	}
+	openPath := path
+	if version > 1 || !gosh.allowUnsigned {
+		copyPath, err := copyPluginFile(path, version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy plugin %s: %v", file.Name(), err)
+		}
+		defer os.Remove(copyPath)
+		openPath = copyPath
+	}
+
+	if err := gosh.verifyPlugin(path, openPath); err != nil {
+		return nil, fmt.Errorf("refusing to load plugin %s: %v", file.Name(), err)
+	}
+	manifest, err := openManifest(path)
+	if err != nil {
+		return nil, fmt.Errorf("refusing to load plugin %s: %v", file.Name(), err)
+	}
+
+	plug, err := openGoPlugin(openPath)
+	if err != nil {
+		return nil, pluginOpenError(path, err)
+	}
+	versionSymbol, err := plug.Lookup(api.VersionSymbolName)
+	if err != nil {
+		gosh.log().Warn("plugin does not export the version of the plugin API it was built against",
+			"plugin", file.Name(), "symbol", api.VersionSymbolName)
+	} else if version, ok := versionSymbol.(*string); !ok {
+		return nil, fmt.Errorf("refusing to load plugin %s: symbol %s is a %T, not a string",
+			file.Name(), api.VersionSymbolName, versionSymbol)
+	} else if err := checkAPIVersion(*version); err != nil {
+		return nil, fmt.Errorf("refusing to load plugin %s: %v", file.Name(), err)
+	}
+	cmdSymbol, err := plug.Lookup(api.CmdSymbolName)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s does not export symbol \"%s\"",
+			file.Name(), api.CmdSymbolName)
+	}
+	commands, ok := cmdSymbol.(api.Commands)
+	if !ok {
+		return nil, fmt.Errorf("symbol %s of plugin %s is a %T, which does not implement api.Commands: rebuild it against the api package of the shell",
+			api.CmdSymbolName, file.Name(), cmdSymbol)
+	}
+	if err := commands.Init(ctx); err != nil {
+		return nil, fmt.Errorf("%s initialization failed: %v", file.Name(), err)
+	}
+	return &pluginFile{
+		path:     path,
+		dir:      dir,
+		modTime:  file.ModTime(),
+		size:     file.Size(),
+		version:  version,
+		module:   commands,
+		registry: commands.Registry(),
+		manifest: manifest,
+	}, nil
+}
+
+// openModulePlugin opens a process, WebAssembly or Starlark plugin. Unlike Go
+// plugins, these are opened again from the same path on every version.
+// Process and WebAssembly plugins are sandboxed to the capabilities
+// declared by their manifest, if it has any.
+func (gosh *Goshell) openModulePlugin(ctx context.Context, dir string, file os.FileInfo, version int) (*pluginFile, error) {
+	path := filepath.Join(dir, file.Name())
+	manifest, err := openManifest(path)
+	if err != nil {
+		return nil, fmt.Errorf("refusing to load plugin %s: %v", file.Name(), err)
+	}
+	var caps *pluginCapabilities
+	if manifest != nil {
+		caps = manifest.Capabilities
+	}
+	var module api.Commands
+	switch {
+	case reWasm.MatchString(file.Name()):
+		module, err = openWasmPlugin(path, caps)
+	case reStarlark.MatchString(file.Name()):
+		module, err = openStarlarkPlugin(ctx, path)
+	default:
+		module, err = startRPCPlugin(path, caps)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plugin %s: %v", file.Name(), err)
+	}
+	if rpc, ok := module.(*rpcPlugin); ok && rpc.apiVersion == "" {
+		gosh.log().Warn("plugin does not report the version of the plugin API it was built against", "plugin", file.Name())
+	}
+	return &pluginFile{
+		path:     path,
+		dir:      dir,
+		modTime:  file.ModTime(),
+		size:     file.Size(),
+		version:  version,
+		module:   module,
+		registry: module.Registry(),
+		manifest: manifest,
+	}, nil
+}
+
+// openGoPlugin opens the Go plugin at path, or returns the plugin of the
+// same content opened before from another path, such as a previous
+// temporary copy
+func openGoPlugin(path string) (*plugin.Plugin, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	openedPlugins.mu.Lock()
+	defer openedPlugins.mu.Unlock()
+	if plug, ok := openedPlugins.plugins[sum]; ok {
+		return plug, nil
+	}
+	plug, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	openedPlugins.plugins[sum] = plug
+	return plug, nil
+}
+
+// copyPluginFile copies a plugin to a temporary file named after its version
+func copyPluginFile(path string, version int) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	name := strings.TrimSuffix(filepath.Base(path), ".so")
+	dst, err := ioutil.TempFile("", fmt.Sprintf("%s.v%d.*.so", name, version))
+	if err != nil {
+		return "", err
+	}
+	defer dst.Close()
+	if _, err := io.Copy(dst, src); err != nil {
+		os.Remove(dst.Name())
+		return "", err
+	}
+	return dst.Name(), nil
+}
+
+// closePlugin runs the shutdown hook of a plugin
+func (gosh *Goshell) closePlugin(ctx context.Context, plug *pluginFile) {
+	plug.mu.Lock()
+	module := plug.module
+	plug.mu.Unlock()
+	if closer, ok := module.(api.Closer); ok {
+		if err := closer.Close(ctx); err != nil {
+			gosh.log().Error("plugin shutdown failed", "plugin", filepath.Base(plug.path), "err", err)
+		}
+	}
+}
+
+// buildRegistry fills the command registry with the builtins, the
+// commands of the current version of each plugin and the registered
+// commands. Plugin commands take precedence over builtins; when several
+// plugins provide the same command, the first one of the precedence
+// order of the configuration wins, then the first one in the search
+// path. Registered commands take precedence over both. The group of
+// each command, listed by help, is the plugin it comes from.
+func (gosh *Goshell) buildRegistry() {
+	commands := make(map[string]api.Command)
+	groups := make(map[string]string)
+	for name, cmd := range gosh.builtins() {
+		commands[name] = cmd
+		groups[name] = builtinsGroup
+	}
+
+	plugins := gosh.sortedPlugins()
+	sort.SliceStable(plugins, func(i, j int) bool {
+		return gosh.precedence(plugins[i]) < gosh.precedence(plugins[j])
+	})
+	providers := make(map[string][]string)
+	used := make(map[string]string)
+	for _, plug := range plugins {
+		for name, cmd := range plug.registry {
+			providers[name] = append(providers[name], plug.path)
+			if _, ok := used[name]; ok {
+				continue
+			}
+			used[name] = plug.path
+			commands[name] = cmd
+			groups[name] = pluginName(plug.path)
+		}
+	}
+	gosh.commands.replace(commands, groups)
+	gosh.buildSegments()
+	gosh.detectConflicts(providers, used)
+}
+
+// lookupNamespaced resolves a name of the form plugin:command to the
+// command of the plugin, or to a builtin for builtins:command
+func (gosh *Goshell) lookupNamespaced(name string) (api.Command, bool) {
+	i := strings.LastIndex(name, ":")
+	if i <= 0 || i == len(name)-1 {
+		return nil, false
+	}
+	if name[:i] == builtinsGroup {
+		cmd, ok := gosh.builtins()[name[i+1:]]
+		return cmd, ok
+	}
+	plug, ok := gosh.findPlugin(name[:i])
+	if !ok {
+		return nil, false
+	}
+	cmd, ok := plug.registry[name[i+1:]]
+	return cmd, ok
+}
+
+// precedence returns the rank of a plugin in the precedence order, the
+// plugins not in it ranking after the others
+func (gosh *Goshell) precedence(plug *pluginFile) int {
+	for i, name := range gosh.pluginOrder {
+		if name == pluginName(plug.path) || plug.manifest != nil && name == plug.manifest.Name {
+			return i
+		}
+	}
+	return len(gosh.pluginOrder)
+}
+
+// detectConflicts records the commands provided by several plugins,
+// given the plugin files providing each command and the ones used, and
+// reports the conflicts that are new
+func (gosh *Goshell) detectConflicts(providers map[string][]string, used map[string]string) {
+	conflicts := make(map[string][]string)
+	for name, paths := range providers {
+		if len(paths) < 2 {
+			continue
+		}
+		list := []string{used[name]}
+		for _, path := range paths {
+			if path != used[name] {
+				list = append(list, path)
+			}
+		}
+		conflicts[name] = list
+	}
+	names := make([]string, 0, len(conflicts))
+	for name := range conflicts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.Join(gosh.conflicts[name], ":") != strings.Join(conflicts[name], ":") {
+			gosh.log().Warn("command is provided by several plugins, run them as <plugin>:<command>",
+				"command", name, "using", conflicts[name][0], "over", strings.Join(conflicts[name][1:], ","))
+		}
+	}
+	gosh.conflicts = conflicts
+}
+
+// pluginDirs returns the directories of the plugins search path, none
+// when plugin discovery is disabled
+func (gosh *Goshell) pluginDirs() []string {
+	if gosh.noPlugins {
+		return nil
+	}
+	return filepath.SplitList(gosh.pluginsDir)
+}
+
+// reloadPlugins loads new and changed plugins and drops the commands
+// of removed ones
+func (gosh *Goshell) reloadPlugins(ctx context.Context) (int, error) {
+	gosh.loadMu.Lock()
+	defer gosh.loadMu.Unlock()
+	loaded, err := gosh.scanPlugins()
+	gosh.buildRegistry()
+	gosh.panics.reset()
+	if err != nil {
+		return loaded, err
+	}
+	if loaded > 0 {
+		fmt.Fprintf(api.GetStdout(ctx), "\nreloaded %d plugin(s)\n", loaded)
+	}
+	return loaded, nil
+}
+
+// watchPlugins starts watching the plugin directories. Changes to plugin
+// files are reported to the input loop, which reloads them between commands.
+func (gosh *Goshell) watchPlugins() error {
+	if gosh.noPlugins {
+		return nil
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	for _, dir := range gosh.pluginDirs() {
+		if _, err := os.Stat(dir); err != nil {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+	gosh.watcher = watcher
+
+	go func() {
+		var timer *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !isPluginFile(filepath.Base(event.Name)) {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(reloadDelay, gosh.requestReload)
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// requestReload asks the input loop to reload plugins
+func (gosh *Goshell) requestReload() {
+	select {
+	case gosh.reloadReq <- struct{}{}:
+	default:
+	}
+}
+
+// listPluginFiles lists the Go, WebAssembly and Starlark plugins and
+// the process plugin executables in dir. Go plugins are left out where
+// they are not supported.
+func listPluginFiles(dir string) ([]os.FileInfo, error) {
+	patterns := []string{pluginPattern, wasmPattern, starlarkPattern}
+	if !goPlugins {
+		patterns = patterns[1:]
+	}
+	var files []os.FileInfo
+	for _, pattern := range patterns {
+		matched, err := listFiles(dir, pattern)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matched...)
+	}
+	procs, err := listFiles(dir, processPattern)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range procs {
+		if isExecutable(file) {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// isPluginFile reports whether name is the name of a plugin file
+func isPluginFile(name string) bool {
+	for _, re := range []*regexp.Regexp{rePlugin, reProcess, reWasm, reStarlark} {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func listFiles(dir, pattern string) ([]os.FileInfo, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	filteredFiles := []os.FileInfo{}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		matched, err := regexp.MatchString(pattern, file.Name())
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			filteredFiles = append(filteredFiles, file)
+		}
+	}
+	return filteredFiles, nil
+}
+
+// reloadCmd reloads the command plugins
+type reloadCmd struct {
+	gosh *Goshell
+}
+
+func (c reloadCmd) Name() string     { return "reload" }
+func (c reloadCmd) Usage() string    { return "reload" }
+func (c reloadCmd) LongDesc() string { return "" }
+func (c reloadCmd) ShortDesc() string {
+	return `loads new and changed plugins without restarting the shell`
+}
+func (c reloadCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	loaded, err := c.gosh.reloadPlugins(ctx)
+	if err == nil && loaded == 0 {
+		fmt.Fprintln(api.GetStdout(ctx), "no plugin changes")
+	}
+	return ctx, api.Result{}, err
+}
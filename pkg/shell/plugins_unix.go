@@ -0,0 +1,7 @@
+//go:build !windows
+
+package shell
+
+// goPlugins reports whether Go plugins are looked for in the plugins
+// directories
+const goPlugins = true
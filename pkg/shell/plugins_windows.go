@@ -0,0 +1,6 @@
+package shell
+
+// goPlugins reports whether Go plugins are looked for in the plugins
+// directories. The plugin package does not support Windows, where the
+// process, WebAssembly and Starlark plugins provide the commands.
+const goPlugins = false
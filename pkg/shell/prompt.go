@@ -0,0 +1,176 @@
+package shell
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+	"github.com/vladimirvivien/gosh/api/style"
+)
+
+// segmentTimeout is how long the prompt waits for a segment to render
+var segmentTimeout = 200 * time.Millisecond
+
+// promptData holds the values available to the prompt template
+type promptData struct {
+	Cwd      string
+	User     string
+	Host     string
+	Time     promptTime
+	LastExit int
+}
+
+// promptTime prints as the time of day and keeps the methods of
+// time.Time, so a template can also use {{.Time.Format "15:04"}}
+type promptTime struct{ time.Time }
+
+func (t promptTime) String() string { return t.Format("15:04:05") }
+
+// renderPrompt evaluates the prompt of ctx as a template. Color
+// functions produce nothing unless color is set, in which case a prompt
+// that sets no colors gets the prompt style of the theme. A prompt that
+// is not a valid template is shown as is.
+func (gosh *Goshell) renderPrompt(ctx context.Context, color bool) string {
+	prompt := api.GetPrompt(ctx)
+	text := gosh.renderTemplate(ctx, prompt, color)
+	if color && !strings.Contains(prompt, "{{color") {
+		text = currentTheme().prompt.Sprint(text)
+	}
+	return text
+}
+
+// renderTemplate evaluates text as a template with the values and
+// functions of the prompt, or returns it as is when it is not a valid
+// template
+func (gosh *Goshell) renderTemplate(ctx context.Context, text string, color bool) string {
+	if !strings.Contains(text, "{{") {
+		return text
+	}
+
+	colorFunc := func(names ...string) (string, error) {
+		s, err := style.Parse(names...)
+		if err != nil || !color {
+			return "", err
+		}
+		return s.Code(), nil
+	}
+	funcs := template.FuncMap{
+		"color": colorFunc,
+		"reset": func() (string, error) { return colorFunc("reset") },
+		"segment": func(name string) string {
+			if segment, ok := gosh.segments[name]; ok {
+				return segment(ctx)
+			}
+			return ""
+		},
+	}
+	tmpl, err := template.New("prompt").Funcs(funcs).Parse(text)
+	if err != nil {
+		return text
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, gosh.promptData(ctx)); err != nil {
+		return text
+	}
+	return b.String()
+}
+
+// promptData returns the current values for the prompt template
+func (gosh *Goshell) promptData(ctx context.Context) promptData {
+	data := promptData{
+		Time:     promptTime{time.Now()},
+		LastExit: gosh.last.Code,
+	}
+	if cwd := api.GetWorkDir(ctx); cwd != "" {
+		data.Cwd = shortenHome(ctx, cwd)
+	}
+	if env := api.GetEnv(ctx); env != nil {
+		data.User, _ = env.Get("USER")
+	}
+	if data.User == "" {
+		if u, err := user.Current(); err == nil {
+			data.User = u.Username
+		}
+	}
+	data.Host, _ = os.Hostname()
+	return data
+}
+
+// buildSegments collects the prompt segments of the plugins. Like
+// commands, a segment comes from the first plugin in the search path
+// that provides it. The segments of a plugin that is not opened yet
+// open it when rendered. Rendering a segment is limited to
+// segmentTimeout.
+func (gosh *Goshell) buildSegments() {
+	gosh.segments = make(map[string]api.PromptSegment)
+	add := func(name string, segment api.PromptSegment) {
+		if _, ok := gosh.segments[name]; !ok {
+			gosh.segments[name] = timedSegment(segment)
+		}
+	}
+	for _, plug := range gosh.sortedPlugins() {
+		if plug.lazy {
+			for _, name := range plug.segments {
+				add(name, gosh.lazySegment(plug, name))
+			}
+			continue
+		}
+		if segmenter, ok := plug.module.(api.PromptSegmenter); ok {
+			for name, segment := range segmenter.PromptSegments() {
+				add(name, segment)
+			}
+		}
+	}
+}
+
+// timedSegment renders segment with a context cancelled after
+// segmentTimeout. A segment that does not return in time shows the text
+// it rendered last, and is not called again until it returns, so that a
+// slow segment neither delays the prompt nor piles up calls.
+func timedSegment(segment api.PromptSegment) api.PromptSegment {
+	var (
+		mu      sync.Mutex
+		last    string
+		running bool
+	)
+	return func(ctx context.Context) string {
+		mu.Lock()
+		if running {
+			defer mu.Unlock()
+			return last
+		}
+		running = true
+		mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(ctx, segmentTimeout)
+		defer cancel()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			text := ""
+			defer func() {
+				recover()
+				mu.Lock()
+				// a segment cancelled at the deadline keeps its last text
+				if text != "" || ctx.Err() == nil {
+					last = text
+				}
+				running = false
+				mu.Unlock()
+			}()
+			text = segment(ctx)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}
+}
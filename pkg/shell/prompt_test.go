@@ -0,0 +1,98 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// segmentCmds is a plugin module that provides prompt segments
+type segmentCmds map[string]api.PromptSegment
+
+func (s segmentCmds) Init(ctx context.Context) error               { return nil }
+func (s segmentCmds) Registry() map[string]api.Command             { return nil }
+func (s segmentCmds) PromptSegments() map[string]api.PromptSegment { return s }
+
+func TestRenderPrompt(t *testing.T) {
+	shell := newTestShell()
+	shell.plugins["seg"] = &pluginFile{path: "seg_command.so", module: segmentCmds{
+		"branch": func(ctx context.Context) string { return "main" },
+	}}
+	shell.buildSegments()
+	shell.last = api.Result{Code: 3}
+	ctx := api.WithEnv(context.TODO(), api.NewEnv([]string{"USER=gopher"}))
+	host, _ := os.Hostname()
+
+	tests := []struct {
+		prompt   string
+		color    bool
+		expected string
+	}{
+		{prompt: "gosh>", expected: "gosh>"},
+		{prompt: "{{.User}}@{{.Host}} [{{.LastExit}}]>", expected: fmt.Sprintf("gopher@%s [3]>", host)},
+		{prompt: "{{color \"red\" \"bold\"}}x{{reset}}>", expected: "x>"},
+		{prompt: "{{color \"red\" \"bold\"}}x{{reset}}>", color: true, expected: "\x1b[31;1mx\x1b[0m>"},
+		{prompt: "({{segment \"branch\"}}{{segment \"missing\"}})>", expected: "(main)>"},
+		{prompt: "{{.Nope}}>", expected: "{{.Nope}}>"},
+		{prompt: "{{if}}>", expected: "{{if}}>"},
+	}
+	for _, test := range tests {
+		got := shell.renderPrompt(api.WithPrompt(ctx, test.prompt), test.color)
+		if got != test.expected {
+			t.Errorf("prompt %q: expected %q, got %q", test.prompt, test.expected, got)
+		}
+	}
+
+	if got := shell.renderPrompt(api.WithPrompt(ctx, "{{.Time}}"), false); len(got) != len("15:04:05") || strings.Count(got, ":") != 2 {
+		t.Errorf("unexpected time: %q", got)
+	}
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := shell.renderPrompt(api.WithPrompt(ctx, "{{.Cwd}}"), false); !strings.HasSuffix(dir, strings.TrimPrefix(got, "~")) {
+		t.Errorf("unexpected working directory: %q, expected %q", got, dir)
+	}
+}
+
+func TestTimedSegment(t *testing.T) {
+	defer func(d time.Duration) { segmentTimeout = d }(segmentTimeout)
+	segmentTimeout = 20 * time.Millisecond
+
+	release := make(chan struct{})
+	var calls int32
+	segment := timedSegment(func(ctx context.Context) string {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return "fast"
+		}
+		<-release
+		return "slow"
+	})
+	if got := segment(context.TODO()); got != "fast" {
+		t.Errorf("expected the segment text, got %q", got)
+	}
+	if got := segment(context.TODO()); got != "fast" {
+		t.Errorf("expected a late segment to show its last text, got %q", got)
+	}
+	if got := segment(context.TODO()); got != "fast" || atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("expected a running segment not to be called again, got %q after %d calls", got, calls)
+	}
+	close(release)
+	time.Sleep(10 * time.Millisecond)
+	if got := segment(context.TODO()); got != "slow" {
+		t.Errorf("expected the text of the late segment, got %q", got)
+	}
+
+	panicking := timedSegment(func(ctx context.Context) string { panic("boom") })
+	if got := panicking(context.TODO()); got != "" {
+		t.Errorf("expected a panicking segment to render nothing, got %q", got)
+	}
+}
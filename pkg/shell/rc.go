@@ -0,0 +1,42 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+const (
+	systemRCFile = "/etc/goshrc"
+	userRCFile   = ".goshrc"
+)
+
+// defaultRCFiles returns the startup files in the order they are run:
+// the system-wide file first, then the one in the user's home directory
+func defaultRCFiles() []string {
+	files := []string{systemRCFile}
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, userRCFile))
+	}
+	return files
+}
+
+// LoadRC runs the startup files of the shell so that aliases, environment
+// variables and other settings are in place before the first prompt.
+// Missing files are skipped and failing lines are reported without
+// stopping the file.
+func (gosh *Goshell) LoadRC() {
+	for _, path := range gosh.rcFiles {
+		file, err := os.Open(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				fmt.Fprintf(api.GetStderr(gosh.ctx), "%v\n", err)
+			}
+			continue
+		}
+		gosh.ctx, _ = gosh.runScript(gosh.ctx, file, path, false)
+		file.Close()
+	}
+}
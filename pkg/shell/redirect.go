@@ -0,0 +1,90 @@
+package shell
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// redirect redirects a standard stream of a command to or from a file,
+// relative to the working directory of the shell. The target of a
+// here-document (<<) or here-string (<<<) is the text read from stdin.
+type redirect struct {
+	op     string
+	target string
+}
+
+// openRedirects opens the files of the redirections and returns a context
+// with the standard streams replaced. The returned files must be closed
+// once the command completes.
+func openRedirects(ctx context.Context, redirs []redirect) (context.Context, []io.Closer, error) {
+	var files []io.Closer
+	for _, r := range redirs {
+		var file *os.File
+		var err error
+		var with func(context.Context, *os.File) context.Context
+		target := r.target
+		if r.op != "<<" && r.op != "<<<" {
+			target = workPath(ctx, target)
+		}
+		switch r.op {
+		case ">":
+			with = withStdout
+			file, err = os.Create(target)
+		case ">>":
+			with = withStdout
+			file, err = os.OpenFile(target, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		case "2>":
+			with = withStderr
+			file, err = os.Create(target)
+		case "<":
+			with = withStdin
+			file, err = os.Open(target)
+		case "<<", "<<<":
+			ctx = api.WithStdin(ctx, strings.NewReader(target))
+			continue
+		}
+		if err != nil {
+			closeAll(files)
+			return ctx, nil, err
+		}
+		files = append(files, file)
+		ctx = with(ctx, file)
+	}
+	return ctx, files, nil
+}
+
+// withIOFrom returns ctx with the standard streams of src, discarding
+// any stream changes a command made for its own execution
+func withIOFrom(ctx, src context.Context) context.Context {
+	session, from := api.GetSession(ctx), api.GetSession(src)
+	changed := false
+	if from.Stdin != nil && from.Stdin != session.Stdin {
+		session.Stdin, changed = from.Stdin, true
+	}
+	if from.Stdout != nil && from.Stdout != session.Stdout {
+		session.Stdout, changed = from.Stdout, true
+	}
+	if from.Stderr != nil && from.Stderr != session.Stderr {
+		session.Stderr, changed = from.Stderr, true
+	}
+	if !changed {
+		return ctx
+	}
+	return api.WithSession(ctx, session)
+}
+
+// withStdin, withStdout and withStderr replace a standard stream of ctx
+// with a file
+func withStdin(ctx context.Context, f *os.File) context.Context  { return api.WithStdin(ctx, f) }
+func withStdout(ctx context.Context, f *os.File) context.Context { return api.WithStdout(ctx, f) }
+func withStderr(ctx context.Context, f *os.File) context.Context { return api.WithStderr(ctx, f) }
+
+func closeAll(files []io.Closer) {
+	for _, f := range files {
+		f.Close()
+	}
+}
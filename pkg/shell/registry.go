@@ -0,0 +1,123 @@
+package shell
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// registry is the command registry shared by a shell and its sessions,
+// with the group of each command listed by help. The sessions look
+// commands up while plugins are loaded and reloaded, so the commands
+// are kept in an immutable snapshot that writers replace atomically:
+// readers never lock and always see a consistent registry.
+type registry struct {
+	// mu serializes the writers
+	mu       sync.Mutex
+	snapshot atomic.Pointer[registrySnapshot]
+
+	// registered holds the commands registered by the program
+	// embedding the shell, which take precedence over the others
+	registered map[string]api.Command
+}
+
+// registrySnapshot is a version of the registry, never modified once
+// stored
+type registrySnapshot struct {
+	commands map[string]api.Command
+	groups   map[string]string
+}
+
+func newRegistry() *registry {
+	r := &registry{registered: make(map[string]api.Command)}
+	r.snapshot.Store(&registrySnapshot{
+		commands: make(map[string]api.Command),
+		groups:   make(map[string]string),
+	})
+	return r
+}
+
+// Lookup returns the command registered under name
+func (r *registry) Lookup(name string) (api.Command, bool) {
+	cmd, ok := r.snapshot.Load().commands[name]
+	return cmd, ok
+}
+
+// Commands returns a copy of the registered commands by name
+func (r *registry) Commands() map[string]api.Command {
+	commands := r.snapshot.Load().commands
+	copied := make(map[string]api.Command, len(commands))
+	for name, cmd := range commands {
+		copied[name] = cmd
+	}
+	return copied
+}
+
+// names returns the names of the registered commands in order
+func (r *registry) names() []string {
+	commands := r.snapshot.Load().commands
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// len returns the number of registered commands
+func (r *registry) len() int {
+	return len(r.snapshot.Load().commands)
+}
+
+// group returns the group of the command registered under name, if it
+// has one
+func (r *registry) group(name string) (string, bool) {
+	group, ok := r.snapshot.Load().groups[name]
+	return group, ok
+}
+
+// replace replaces the commands of the registry and their groups,
+// which the registry owns from then on. The registered commands are
+// kept, in place of the commands of the same names.
+func (r *registry) replace(commands map[string]api.Command, groups map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name, cmd := range r.registered {
+		commands[name] = cmd
+		delete(groups, name)
+	}
+	r.snapshot.Store(&registrySnapshot{commands: commands, groups: groups})
+}
+
+// register registers cmd under name, without a group, in place of the
+// command of that name, if any. Unlike the commands set, it is kept
+// when the commands are replaced.
+func (r *registry) register(name string, cmd api.Command) {
+	r.mu.Lock()
+	r.registered[name] = cmd
+	r.mu.Unlock()
+	r.set(name, cmd)
+}
+
+// set puts cmd under name, without a group, in place of the command of
+// that name, if any, until the commands are replaced
+func (r *registry) set(name string, cmd api.Command) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old := r.snapshot.Load()
+	next := &registrySnapshot{
+		commands: make(map[string]api.Command, len(old.commands)+1),
+		groups:   make(map[string]string, len(old.groups)),
+	}
+	for name, cmd := range old.commands {
+		next.commands[name] = cmd
+	}
+	for name, group := range old.groups {
+		next.groups[name] = group
+	}
+	next.commands[name] = cmd
+	delete(next.groups, name)
+	r.snapshot.Store(next)
+}
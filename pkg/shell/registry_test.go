@@ -0,0 +1,71 @@
+package shell
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestRegistry(t *testing.T) {
+	r := newRegistry()
+	r.replace(map[string]api.Command{"pwd": pwdCmd("pwd")}, map[string]string{"pwd": builtinsGroup})
+	r.set("hello", pwdCmd("hello"))
+	if _, ok := r.Lookup("hello"); !ok {
+		t.Error("expected hello to be registered")
+	}
+	if group, _ := r.group("pwd"); group != builtinsGroup {
+		t.Errorf("expected pwd in the builtins group, got %q", group)
+	}
+	if _, ok := r.group("hello"); ok {
+		t.Error("expected hello to have no group")
+	}
+
+	// the copies returned by Commands are not the registry
+	commands := r.Commands()
+	delete(commands, "pwd")
+	if names := r.names(); len(names) != 2 || names[0] != "hello" || names[1] != "pwd" {
+		t.Errorf("unexpected names: %v", names)
+	}
+	if api.GetRegistry(api.WithRegistry(context.Background(), r)).Commands()["pwd"] == nil {
+		t.Error("expected the registry of the context to hold pwd")
+	}
+}
+
+func TestRegistryConcurrency(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	if err := shell.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// sessions look commands up while plugins are reloaded and
+	// commands registered, which the race detector checks
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				shell.reloadPlugins(shell.ctx)
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				shell.Register("cmd"+strconv.Itoa(i), pwdCmd("cmd"))
+				if _, err := shell.lookup("pwd"); err != nil {
+					t.Error(err)
+					return
+				}
+				shell.complete(shell.ctx, []string{"p"})
+				api.GetCommands(shell.ctx)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,139 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// The defaults of the retry options
+const (
+	defaultRetryAttempts = 3
+	defaultRetryBackoff  = time.Second
+	maxRetryBackoff      = 5 * time.Minute
+)
+
+// retryCmd reruns a failing command line with exponential backoff
+type retryCmd struct {
+	gosh *Goshell
+}
+
+func (c retryCmd) Name() string { return "retry" }
+func (c retryCmd) Usage() string {
+	return "retry [--attempts <n>] [--backoff <delay>] [--] <command> [<args>...]"
+}
+func (c retryCmd) LongDesc() string {
+	return `The command runs up to --attempts times, 3 by default, until it succeeds.
+The delay before the second attempt is --backoff, a number of seconds or a
+Go duration such as 500ms, 1 second by default, and it doubles for each
+attempt after that, up to 5 minutes or --backoff when it is longer.
+Each failed attempt is reported on stderr. retry fails with the status
+of the last attempt. A command line with operators is quoted, as in
+retry 'fetch && verify'.`
+}
+func (c retryCmd) ShortDesc() string { return `reruns a failing command with backoff` }
+func (c retryCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	attempts, backoff, args, err := parseRetryArgs(args[1:])
+	if err != nil {
+		return ctx, api.Result{}, api.NewUsageError("%v", err)
+	}
+	line := commandLine(args)
+	list, err := c.gosh.parseLine(line)
+	if err != nil {
+		return ctx, api.Result{}, err
+	}
+
+	stderr := api.GetStderr(ctx)
+	limit := maxRetryBackoff
+	if backoff > limit {
+		limit = backoff
+	}
+	delay := backoff
+	for attempt := 1; ; attempt++ {
+		res, err := c.gosh.runApart(ctx, list)
+		status := api.Status(res, err)
+		if status == 0 || attempt == attempts || ctx.Err() != nil {
+			return ctx, rendered(res), err
+		}
+		reason := fmt.Sprintf("status %d", status)
+		if err != nil {
+			reason = err.Error()
+		}
+		fmt.Fprintf(stderr, "retry: attempt %d of %d failed: %s; retrying in %v\n", attempt, attempts, reason, delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx, rendered(res), err
+		case <-timer.C:
+		}
+		delay = nextBackoff(delay, limit)
+	}
+}
+
+// nextBackoff returns twice delay, but no more than limit
+func nextBackoff(delay, limit time.Duration) time.Duration {
+	if delay > limit/2 {
+		return limit
+	}
+	return delay * 2
+}
+
+// Complete completes the command run by retry
+func (c retryCmd) Complete(ctx context.Context, args []string, cursorPos int) []string {
+	first := 1
+	for first < cursorPos && strings.HasPrefix(args[first], "--") {
+		if args[first] == "--" {
+			first++
+			break
+		}
+		first += 2
+	}
+	if cursorPos < first {
+		return nil
+	}
+	return c.gosh.complete(ctx, args[first:cursorPos+1])
+}
+
+// parseRetryArgs parses the options of retry and returns the arguments
+// left
+func parseRetryArgs(args []string) (int, time.Duration, []string, error) {
+	attempts, backoff := defaultRetryAttempts, defaultRetryBackoff
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		opt := args[0]
+		if opt == "--" {
+			args = args[1:]
+			break
+		}
+		if len(args) < 2 {
+			return 0, 0, nil, fmt.Errorf("%s expects a value", opt)
+		}
+		value := args[1]
+		switch opt {
+		case "--attempts":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return 0, 0, nil, fmt.Errorf("invalid number of attempts %q", value)
+			}
+			attempts = n
+		case "--backoff":
+			d, err := parseTimeout(value)
+			if err != nil {
+				return 0, 0, nil, fmt.Errorf("invalid backoff %q", value)
+			}
+			backoff = d
+		default:
+			return 0, 0, nil, fmt.Errorf("unknown option %s", opt)
+		}
+		args = args[2:]
+	}
+	if len(args) == 0 {
+		return 0, 0, nil, fmt.Errorf("expected a command")
+	}
+	return attempts, backoff, args, nil
+}
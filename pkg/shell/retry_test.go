@@ -0,0 +1,100 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestParseRetryArgs(t *testing.T) {
+	attempts, backoff, rest, err := parseRetryArgs([]string{"--backoff", "2s", "--attempts", "5", "--", "fetch", "--all"})
+	if err != nil || attempts != 5 || backoff != 2*time.Second || !reflect.DeepEqual(rest, []string{"fetch", "--all"}) {
+		t.Errorf("unexpected options %d, %v, %q, %v", attempts, backoff, rest, err)
+	}
+	attempts, backoff, _, err = parseRetryArgs([]string{"fetch"})
+	if err != nil || attempts != defaultRetryAttempts || backoff != defaultRetryBackoff {
+		t.Errorf("expected the default options, got %d, %v, %v", attempts, backoff, err)
+	}
+	for _, args := range [][]string{{}, {"--"}, {"--attempts"}, {"--attempts", "0", "a"}, {"--backoff", "soon", "a"}, {"--tries", "2", "a"}} {
+		if _, _, _, err := parseRetryArgs(args); err == nil {
+			t.Errorf("parseRetryArgs(%q) should have failed", args)
+		}
+	}
+}
+
+func TestNextBackoff(t *testing.T) {
+	tests := []struct {
+		delay, limit, next time.Duration
+	}{
+		{time.Second, maxRetryBackoff, 2 * time.Second},
+		{3 * time.Minute, maxRetryBackoff, maxRetryBackoff},
+		{maxRetryBackoff, maxRetryBackoff, maxRetryBackoff},
+		{math.MaxInt64, math.MaxInt64, math.MaxInt64},
+	}
+	for _, test := range tests {
+		if next := nextBackoff(test.delay, test.limit); next != test.next {
+			t.Errorf("nextBackoff(%v, %v) = %v, expected %v", test.delay, test.limit, next, test.next)
+		}
+	}
+}
+
+func TestShellRetry(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	var calls []time.Time
+	shell.Register("flaky", rpcTestCmd{"flaky", func(ctx context.Context, args []string) error {
+		calls = append(calls, time.Now())
+		if len(calls) < 3 {
+			return api.NewExitError(3, fmt.Errorf("unavailable"))
+		}
+		fmt.Fprintln(api.GetStdout(ctx), "ok")
+		return nil
+	}})
+	shell.Register("fail", rpcTestCmd{"fail", func(ctx context.Context, args []string) error {
+		return fmt.Errorf("failed")
+	}})
+	if err := shell.Init(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	var out, errOut bytes.Buffer
+	ctx := api.WithStderr(api.WithStdout(shell.ctx, &out), &errOut)
+	if _, err := shell.handle(ctx, "retry --attempts 5 --backoff 0.02 flaky"); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "ok\n" || len(calls) != 3 {
+		t.Errorf("expected 3 attempts, got %d with output %q", len(calls), out.String())
+	}
+	expected := "retry: attempt 1 of 5 failed: unavailable; retrying in 20ms\n" +
+		"retry: attempt 2 of 5 failed: unavailable; retrying in 40ms\n"
+	if errOut.String() != expected {
+		t.Errorf("expected the attempts reported, got %q", errOut.String())
+	}
+	if calls[2].Sub(calls[1]) < 40*time.Millisecond {
+		t.Error("the backoff should double for each attempt")
+	}
+
+	calls = nil
+	errOut.Reset()
+	_, err := shell.handle(ctx, "retry --attempts 2 --backoff 0 'flaky || fail'")
+	if api.ExitStatus(err) != 1 || len(calls) != 2 {
+		t.Errorf("expected the status of the last of 2 attempts, got %v after %d", err, len(calls))
+	}
+	if !strings.Contains(errOut.String(), "attempt 1 of 2 failed") {
+		t.Errorf("unexpected report %q", errOut.String())
+	}
+
+	out.Reset()
+	if _, err := shell.handle(ctx, "retry set output"); err != nil || out.String() != "output:  text\n" {
+		t.Errorf("expected the setting to be printed once, got %q, %v", out.String(), err)
+	}
+}
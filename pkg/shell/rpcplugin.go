@@ -0,0 +1,255 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// processPattern matches the executables of process plugins
+const processPattern = `_command(\.exe)?$`
+
+// rpcPlugin is a plugin that runs as a separate process and serves its
+// commands with JSON-RPC over its standard input and output (see
+// api.Serve). Unlike Go plugins it does not have to be built with the
+// same toolchain as the shell, or in Go at all.
+type rpcPlugin struct {
+	proc     *exec.Cmd
+	client   *rpc.Client
+	registry map[string]api.Command
+	segments map[string]api.PromptSegment
+	lastID   uint64
+
+	// apiVersion is the version of the plugin API the plugin was
+	// built against, empty for plugins older than Plugin.Version
+	apiVersion string
+}
+
+// rpcConn joins the pipes connected to a plugin process
+type rpcConn struct {
+	io.ReadCloser
+	w io.WriteCloser
+}
+
+func (c rpcConn) Write(p []byte) (int, error) { return c.w.Write(p) }
+
+func (c rpcConn) Close() error {
+	err := c.w.Close()
+	if rerr := c.ReadCloser.Close(); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// startRPCPlugin starts the plugin executable at path, in a sandbox
+// restricting it to caps if it has any
+func startRPCPlugin(path string, caps *pluginCapabilities) (*rpcPlugin, error) {
+	proc := exec.Command(path)
+	if caps != nil {
+		var err error
+		if proc, err = sandboxCommand(path, caps); err != nil {
+			return nil, err
+		}
+	}
+	proc.Stderr = os.Stderr
+	in, err := proc.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := proc.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := proc.Start(); err != nil {
+		return nil, err
+	}
+
+	plug, err := newRPCPlugin(rpcConn{out, in})
+	if err != nil {
+		proc.Process.Kill()
+		proc.Wait()
+		return nil, err
+	}
+	plug.proc = proc
+	return plug, nil
+}
+
+// newRPCPlugin connects to a plugin over conn, checks the version of
+// the plugin API it was built against and fetches its commands
+func newRPCPlugin(conn io.ReadWriteCloser) (*rpcPlugin, error) {
+	plug := &rpcPlugin{
+		client:   jsonrpc.NewClient(conn),
+		registry: make(map[string]api.Command),
+	}
+	if err := plug.client.Call(api.RPCServiceName+".Version", struct{}{}, &plug.apiVersion); err == nil {
+		if err := checkAPIVersion(plug.apiVersion); err != nil {
+			plug.client.Close()
+			return nil, err
+		}
+	}
+	var infos []api.CommandInfo
+	if err := plug.client.Call(api.RPCServiceName+".Commands", struct{}{}, &infos); err != nil {
+		plug.client.Close()
+		return nil, err
+	}
+	for _, info := range infos {
+		plug.registry[info.Name] = &rpcCommand{plug: plug, info: info}
+	}
+	// plugins served by older versions of the api have no segments
+	var segments []string
+	if err := plug.client.Call(api.RPCServiceName+".Segments", struct{}{}, &segments); err == nil && len(segments) > 0 {
+		plug.segments = make(map[string]api.PromptSegment)
+		for _, name := range segments {
+			plug.segments[name] = plug.segment(name)
+		}
+	}
+	return plug, nil
+}
+
+// segment returns the prompt segment name rendered by the plugin, which
+// renders nothing when the call fails or ctx is done first
+func (p *rpcPlugin) segment(name string) api.PromptSegment {
+	return func(ctx context.Context) string {
+		req := api.SegmentRequest{Name: name}
+		if env := api.GetEnv(ctx); env != nil {
+			req.Env = env.Environ()
+		}
+		var text string
+		call := p.client.Go(api.RPCServiceName+".Segment", req, &text, make(chan *rpc.Call, 1))
+		select {
+		case <-call.Done:
+			if call.Error != nil {
+				return ""
+			}
+			return text
+		case <-ctx.Done():
+			return ""
+		}
+	}
+}
+
+// PromptSegments returns the prompt segments of the plugin
+func (p *rpcPlugin) PromptSegments() map[string]api.PromptSegment { return p.segments }
+
+// Init does nothing; the plugin process initializes itself when it starts
+func (p *rpcPlugin) Init(ctx context.Context) error { return nil }
+
+func (p *rpcPlugin) Registry() map[string]api.Command { return p.registry }
+
+// Close disconnects from the plugin and waits for its process to exit,
+// killing it if ctx is done first
+func (p *rpcPlugin) Close(ctx context.Context) error {
+	err := p.client.Close()
+	if p.proc == nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- p.proc.Wait() }()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		p.proc.Process.Kill()
+		<-done
+	}
+	return err
+}
+
+// rpcCommand is a command served by a process plugin
+type rpcCommand struct {
+	plug *rpcPlugin
+	info api.CommandInfo
+}
+
+func (c *rpcCommand) Name() string            { return c.info.Name }
+func (c *rpcCommand) Usage() string           { return c.info.Usage }
+func (c *rpcCommand) ShortDesc() string       { return c.info.ShortDesc }
+func (c *rpcCommand) LongDesc() string        { return c.info.LongDesc }
+func (c *rpcCommand) Flags() []api.Flag       { return c.info.Flags }
+func (c *rpcCommand) Category() string        { return c.info.Category }
+func (c *rpcCommand) Examples() []api.Example { return c.info.Examples }
+func (c *rpcCommand) Roles() []string         { return c.info.Roles }
+func (c *rpcCommand) CacheTTL() time.Duration { return c.info.CacheTTL }
+
+// Exec sends the command to the plugin process. Its input is read up
+// front, as told by sendsInput, and its output is written once the
+// command is done. Canceling ctx cancels the command in the plugin.
+func (c *rpcCommand) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	req := api.ExecRequest{
+		ID:   atomic.AddUint64(&c.plug.lastID, 1),
+		Name: c.info.Name,
+		Args: args,
+	}
+	if flags := api.GetFlags(ctx); flags != nil {
+		req.Flags = flags.Values()
+	}
+	if env := api.GetEnv(ctx); env != nil {
+		req.Env = env.Environ()
+	}
+	req.Dir = api.GetWorkDir(ctx)
+	req.Trace = traceContext(ctx)
+	if stdin := api.GetStdin(ctx); sendsInput(stdin, args) {
+		data, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return ctx, api.Result{}, err
+		}
+		req.Stdin = string(data)
+	}
+
+	var resp api.ExecResponse
+	call := c.plug.client.Go(api.RPCServiceName+".Exec", req, &resp, nil)
+	select {
+	case <-call.Done:
+	case <-ctx.Done():
+		c.plug.client.Go(api.RPCServiceName+".Cancel", api.CancelRequest{ID: req.ID}, nil, nil)
+		<-call.Done
+	}
+	if call.Error != nil {
+		return ctx, api.Result{}, fmt.Errorf("plugin: %v", call.Error)
+	}
+
+	io.WriteString(api.GetStdout(ctx), resp.Stdout)
+	io.WriteString(api.GetStderr(ctx), resp.Stderr)
+	res := api.Result{Code: resp.Status, Data: resp.Data}
+	if resp.Error != "" {
+		return ctx, res, api.NewExitError(resp.Status, errors.New(resp.Error))
+	}
+	return ctx, res, nil
+}
+
+// sendsInput reports whether the input of a command run by a plugin is
+// read up front and sent along with it. A terminal and the input of a
+// remote session are not read: they never end. Neither is the input of
+// the shell itself for a command with arguments, which rarely reads it,
+// while piped and redirected input is.
+func sendsInput(stdin io.Reader, args []string) bool {
+	if isSessionInput(stdin) {
+		return false
+	}
+	f, ok := stdin.(*os.File)
+	if !ok {
+		return true
+	}
+	if isTerminal(f.Fd()) {
+		return false
+	}
+	return f != os.Stdin || len(args) <= 1
+}
+
+// isExecutable reports whether a file can be run as a process plugin
+func isExecutable(info os.FileInfo) bool {
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	return info.Mode()&0111 != 0
+}
@@ -0,0 +1,213 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// rpcTestCmd runs fn as the Exec of a command named name
+type rpcTestCmd struct {
+	name string
+	fn   func(ctx context.Context, args []string) error
+}
+
+func (c rpcTestCmd) Name() string      { return c.name }
+func (c rpcTestCmd) Usage() string     { return c.name }
+func (c rpcTestCmd) ShortDesc() string { return "test " + c.name }
+func (c rpcTestCmd) LongDesc() string  { return "" }
+func (c rpcTestCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	return ctx, api.Result{}, c.fn(ctx, args)
+}
+
+type rpcTestCmds map[string]api.Command
+
+func (c rpcTestCmds) Init(ctx context.Context) error   { return nil }
+func (c rpcTestCmds) Registry() map[string]api.Command { return c }
+
+func TestRPCPlugin(t *testing.T) {
+	cmds := rpcTestCmds{
+		"echo": rpcTestCmd{"echo", func(ctx context.Context, args []string) error {
+			input, _ := ioutil.ReadAll(api.GetStdin(ctx))
+			home, _ := api.GetEnv(ctx).Get("HOME")
+			fmt.Fprintf(api.GetStdout(ctx), "%s %s %s", strings.Join(args, ","), input, home)
+			return nil
+		}},
+		"fail": rpcTestCmd{"fail", func(ctx context.Context, args []string) error {
+			fmt.Fprint(api.GetStderr(ctx), "oops")
+			return api.NewExitError(3, errors.New("failed"))
+		}},
+		"block": rpcTestCmd{"block", func(ctx context.Context, args []string) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}},
+	}
+	shellConn, pluginConn := net.Pipe()
+	go api.ServeConn(cmds, pluginConn)
+	plug, err := newRPCPlugin(shellConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plug.Close(context.TODO())
+
+	if plug.apiVersion != api.APIVersion {
+		t.Errorf("expected plugin API %s, got %q", api.APIVersion, plug.apiVersion)
+	}
+	registry := plug.Registry()
+	if len(registry) != 3 || registry["fail"].ShortDesc() != "test fail" {
+		t.Fatalf("unexpected registry: %v", registry)
+	}
+
+	var stdout, stderr bytes.Buffer
+	ctx := api.WithStdout(context.TODO(), &stdout)
+	ctx = api.WithStderr(ctx, &stderr)
+	ctx = api.WithStdin(ctx, strings.NewReader("input"))
+	ctx = api.WithEnv(ctx, api.NewEnv([]string{"HOME=/home/gosh"}))
+
+	if _, _, err := registry["echo"].Exec(ctx, []string{"echo", "a", "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := stdout.String(); got != "echo,a,b input /home/gosh" {
+		t.Errorf("unexpected output: %q", got)
+	}
+
+	_, res, err := registry["fail"].Exec(ctx, []string{"fail"})
+	if api.ExitStatus(err) != 3 || err.Error() != "failed" || res.Code != 3 {
+		t.Errorf("unexpected result: %+v, %v", res, err)
+	}
+	if stderr.String() != "oops" {
+		t.Errorf("unexpected stderr: %q", stderr.String())
+	}
+
+	cancelCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, _, err := registry["block"].Exec(cancelCtx, []string{"block"}); err == nil {
+		t.Error("canceled command should fail")
+	}
+}
+
+func TestSendsInput(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	tests := []struct {
+		stdin io.Reader
+		args  []string
+		sends bool
+	}{
+		{strings.NewReader("input"), []string{"echo", "a"}, true},
+		{r, []string{"echo", "a"}, true},
+		{sessionInput{strings.NewReader("keys")}, []string{"echo"}, false},
+		{os.Stdin, []string{"echo", "a"}, false},
+	}
+	for i, test := range tests {
+		if sends := sendsInput(test.stdin, test.args); sends != test.sends {
+			t.Errorf("%d: expected sendsInput to be %v", i, test.sends)
+		}
+	}
+}
+
+// versionService serves the version of a plugin built against another
+// plugin API
+type versionService string
+
+func (v versionService) Version(_ struct{}, version *string) error {
+	*version = string(v)
+	return nil
+}
+
+func TestRPCPluginVersion(t *testing.T) {
+	shellConn, pluginConn := net.Pipe()
+	server := rpc.NewServer()
+	server.RegisterName(api.RPCServiceName, versionService("2.0"))
+	go server.ServeCodec(jsonrpc.NewServerCodec(pluginConn))
+	_, err := newRPCPlugin(shellConn)
+	if err == nil || !strings.Contains(err.Error(), "built against plugin API 2.0") {
+		t.Errorf("expected an incompatible plugin to be refused, got %v", err)
+	}
+}
+
+func TestRPCPluginFlags(t *testing.T) {
+	shellConn, pluginConn := net.Pipe()
+	go api.ServeConn(rpcTestCmds{"flags": flagsCmd("flags")}, pluginConn)
+	plug, err := newRPCPlugin(shellConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plug.Close(context.TODO())
+
+	cmd := plug.Registry()["flags"]
+	if flagger, ok := cmd.(api.Flagger); !ok || len(flagger.Flags()) != 2 {
+		t.Fatalf("the flags of the command should be listed: %v", cmd)
+	}
+	var stdout bytes.Buffer
+	stage := pipeStage{cmd: cmd, args: []string{"flags", "-v", "--count", "4", "bob"}}
+	_, res, err := stage.exec(api.WithStdout(context.TODO(), &stdout))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := res.Data.([]interface{}); !ok || len(data) != 1 || data[0] != "bob" {
+		t.Errorf("unexpected result data: %#v", res.Data)
+	}
+	if got := stdout.String(); got != "verbose=true count=4 args=[bob]\n" {
+		t.Errorf("unexpected output: %q", got)
+	}
+}
+
+// segmentRPCCmds is a process plugin module with prompt segments
+type segmentRPCCmds struct {
+	rpcTestCmds
+	segments map[string]api.PromptSegment
+}
+
+func (c segmentRPCCmds) PromptSegments() map[string]api.PromptSegment { return c.segments }
+
+func TestRPCPluginSegments(t *testing.T) {
+	shellConn, pluginConn := net.Pipe()
+	go api.ServeConn(segmentRPCCmds{rpcTestCmds{}, map[string]api.PromptSegment{
+		"ctx": func(ctx context.Context) string {
+			kube, _ := api.GetEnv(ctx).Get("KUBE_CONTEXT")
+			return "k8s:" + kube
+		},
+	}}, pluginConn)
+	plug, err := newRPCPlugin(shellConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plug.Close(context.TODO())
+
+	segment, ok := plug.PromptSegments()["ctx"]
+	if !ok {
+		t.Fatalf("expected the segment of the plugin, got %v", plug.PromptSegments())
+	}
+	ctx := api.WithEnv(context.TODO(), api.NewEnv([]string{"KUBE_CONTEXT=prod"}))
+	if got := segment(ctx); got != "k8s:prod" {
+		t.Errorf("unexpected segment %q", got)
+	}
+
+	shellConn, pluginConn = net.Pipe()
+	go api.ServeConn(rpcTestCmds{}, pluginConn)
+	plug, err = newRPCPlugin(shellConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plug.Close(context.TODO())
+	if len(plug.PromptSegments()) != 0 {
+		t.Errorf("expected no segments, got %v", plug.PromptSegments())
+	}
+}
@@ -0,0 +1,32 @@
+package shell
+
+import (
+	"context"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// runner runs commands for api.Run through the same checks as the
+// command lines of the shell
+type runner struct {
+	gosh *Goshell
+}
+
+// Run runs the command name with args as a single stage pipeline whose
+// arguments are already expanded. The context changes of the command
+// are discarded.
+func (r runner) Run(ctx context.Context, name string, args ...string) (api.Result, error) {
+	stage, err := r.gosh.commandStage(ctx, append([]string{name}, args...))
+	if err != nil {
+		return api.Result{Code: api.ExitStatus(err)}, err
+	}
+	stages := []pipeStage{stage}
+	r.gosh.traceStages(ctx, stages)
+	start := time.Now()
+	_, res, err := stage.exec(ctx)
+	elapsed := time.Since(start)
+	r.gosh.traceResult(ctx, stages, res, err, elapsed)
+	r.gosh.reportSlow(ctx, stages, elapsed)
+	return res, err
+}
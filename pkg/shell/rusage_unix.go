@@ -0,0 +1,22 @@
+//go:build !windows
+
+package shell
+
+import (
+	"syscall"
+	"time"
+)
+
+// cpuTimes returns the user and system CPU time used so far by the shell
+// and by the processes it waited for
+func cpuTimes() (user, sys time.Duration) {
+	for _, who := range []int{syscall.RUSAGE_SELF, syscall.RUSAGE_CHILDREN} {
+		var usage syscall.Rusage
+		if err := syscall.Getrusage(who, &usage); err != nil {
+			continue
+		}
+		user += time.Duration(usage.Utime.Nano())
+		sys += time.Duration(usage.Stime.Nano())
+	}
+	return user, sys
+}
@@ -0,0 +1,24 @@
+package shell
+
+import (
+	"syscall"
+	"time"
+)
+
+// cpuTimes returns the user and system CPU time used so far by the
+// shell. Windows does not account for the processes it waited for.
+func cpuTimes() (user, sys time.Duration) {
+	var creation, exit, kernel, usr syscall.Filetime
+	proc, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return 0, 0
+	}
+	if err := syscall.GetProcessTimes(proc, &creation, &exit, &kernel, &usr); err != nil {
+		return 0, 0
+	}
+	// filetimes count 100ns intervals
+	ticks := func(ft syscall.Filetime) time.Duration {
+		return time.Duration(int64(ft.HighDateTime)<<32|int64(ft.LowDateTime)) * 100
+	}
+	return ticks(usr), ticks(kernel)
+}
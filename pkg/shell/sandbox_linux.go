@@ -0,0 +1,221 @@
+package shell
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// sandboxEnv is the environment variable passing the plugin to run and
+// its capabilities to the sandbox process
+const sandboxEnv = "GOSH_SANDBOX"
+
+// sandboxSpec is what the sandbox process runs
+type sandboxSpec struct {
+	Path string             `json:"path"`
+	Caps pluginCapabilities `json:"caps"`
+}
+
+// landlock file access rights, by the Landlock ABI version introducing
+// them; rights of later versions are not restricted on older kernels
+var landlockRights = []uint64{
+	1: unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_WRITE_FILE | unix.LANDLOCK_ACCESS_FS_READ_FILE |
+		unix.LANDLOCK_ACCESS_FS_READ_DIR | unix.LANDLOCK_ACCESS_FS_REMOVE_DIR | unix.LANDLOCK_ACCESS_FS_REMOVE_FILE |
+		unix.LANDLOCK_ACCESS_FS_MAKE_CHAR | unix.LANDLOCK_ACCESS_FS_MAKE_DIR | unix.LANDLOCK_ACCESS_FS_MAKE_REG |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SOCK | unix.LANDLOCK_ACCESS_FS_MAKE_FIFO | unix.LANDLOCK_ACCESS_FS_MAKE_BLOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SYM,
+	2: unix.LANDLOCK_ACCESS_FS_REFER,
+	3: unix.LANDLOCK_ACCESS_FS_TRUNCATE,
+	5: unix.LANDLOCK_ACCESS_FS_IOCTL_DEV,
+}
+
+// landlockFileRights are the rights that apply to files rather than
+// directories
+const landlockFileRights = unix.LANDLOCK_ACCESS_FS_EXECUTE | unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+	unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_TRUNCATE | unix.LANDLOCK_ACCESS_FS_IOCTL_DEV
+
+// the shell runs as the sandbox process of a plugin when started with
+// sandboxEnv set, before anything else
+func init() {
+	spec := os.Getenv(sandboxEnv)
+	if spec == "" {
+		return
+	}
+	os.Unsetenv(sandboxEnv)
+	err := runSandboxed(spec)
+	fmt.Fprintf(os.Stderr, "gosh: sandbox: %v\n", err)
+	os.Exit(126)
+}
+
+// sandboxCommand returns the command starting the plugin executable at
+// path with its capabilities. The shell executable starts again as the
+// sandbox process, in a network namespace of its own unless the plugin
+// may use the network, and restricts the file system with Landlock
+// before it executes the plugin.
+func sandboxCommand(path string, caps *pluginCapabilities) (*exec.Cmd, error) {
+	if _, err := landlockABI(); err != nil {
+		return nil, err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	spec, err := json.Marshal(sandboxSpec{Path: path, Caps: *caps})
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(self)
+	cmd.Env = append(os.Environ(), sandboxEnv+"="+string(spec))
+	if !caps.Network {
+		cmd.SysProcAttr = &syscall.SysProcAttr{
+			Cloneflags:  syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET,
+			UidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}},
+			GidMappings: []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}},
+		}
+	}
+	return cmd, nil
+}
+
+// runSandboxed restricts the process to the capabilities of the spec
+// and executes its plugin. It only returns on error.
+func runSandboxed(encoded string) error {
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(encoded), &spec); err != nil {
+		return err
+	}
+	// Landlock restricts the calling thread, which executes the plugin
+	runtime.LockOSThread()
+	abi, err := landlockABI()
+	if err != nil {
+		return err
+	}
+	var handled uint64
+	for version, rights := range landlockRights {
+		if version <= abi {
+			handled |= rights
+		}
+	}
+	attr := unix.LandlockRulesetAttr{Access_fs: handled}
+	fd, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("landlock: %v", errno)
+	}
+	ruleset := int(fd)
+
+	caps := spec.Caps
+	read := uint64(unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_READ_DIR)
+	write := handled &^ unix.LANDLOCK_ACCESS_FS_EXECUTE
+	if caps.Exec {
+		read |= unix.LANDLOCK_ACCESS_FS_EXECUTE
+		write = handled
+	}
+	rules := map[string]uint64{}
+	for _, p := range caps.Read {
+		rules[p] |= read
+	}
+	for _, p := range caps.Write {
+		rules[p] |= write
+	}
+	// the plugin and the interpreters it is started with, such as the
+	// shell of a script and its dynamic loader, are executed even when
+	// the plugin may not run other programs
+	exe := uint64(unix.LANDLOCK_ACCESS_FS_READ_FILE | unix.LANDLOCK_ACCESS_FS_EXECUTE)
+	for p, depth := spec.Path, 0; p != "" && depth < 4; p, depth = interpreter(p), depth+1 {
+		rules[p] |= exe
+	}
+	for p, rights := range rules {
+		if err := landlockAllow(ruleset, p, rights&handled); err != nil {
+			return err
+		}
+	}
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("no_new_privs: %v", err)
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, uintptr(ruleset), 0, 0); errno != 0 {
+		return fmt.Errorf("landlock: %v", errno)
+	}
+	unix.Close(ruleset)
+	return syscall.Exec(spec.Path, []string{spec.Path}, os.Environ())
+}
+
+// landlockABI returns the Landlock ABI version of the kernel
+func landlockABI() (int, error) {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		return 0, fmt.Errorf("sandboxing needs Landlock, which the kernel does not provide: %v", errno)
+	}
+	return int(abi), nil
+}
+
+// landlockAllow adds the rule allowing rights beneath path to the
+// ruleset. Paths that do not exist are skipped.
+func landlockAllow(ruleset int, path string, rights uint64) error {
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		if errors.Is(err, unix.ENOENT) {
+			return nil
+		}
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	defer unix.Close(fd)
+	var stat unix.Stat_t
+	if err := unix.Fstat(fd, &stat); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFDIR {
+		rights &= landlockFileRights
+	}
+	attr := unix.LandlockPathBeneathAttr{Allowed_access: rights, Parent_fd: int32(fd)}
+	_, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(ruleset), unix.LANDLOCK_RULE_PATH_BENEATH,
+		uintptr(unsafe.Pointer(&attr)), 0, 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("%s: landlock: %v", path, errno)
+	}
+	return nil
+}
+
+// interpreter returns the interpreter of a script, from its #! line,
+// or the dynamic loader of an ELF executable
+func interpreter(path string) string {
+	head := make([]byte, 256)
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	n, _ := file.Read(head)
+	head = head[:n]
+	if bytes.HasPrefix(head, []byte("#!")) {
+		line := strings.SplitN(string(head[2:]), "\n", 2)[0]
+		if fields := strings.Fields(line); len(fields) > 0 {
+			return fields[0]
+		}
+		return ""
+	}
+	exe, err := elf.NewFile(file)
+	if err != nil {
+		return ""
+	}
+	for _, prog := range exe.Progs {
+		if prog.Type == elf.PT_INTERP {
+			data, err := ioutil.ReadAll(prog.Open())
+			if err != nil {
+				return ""
+			}
+			return strings.TrimRight(string(data), "\x00")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,71 @@
+package shell
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSandboxCommand(t *testing.T) {
+	if _, err := landlockABI(); err != nil {
+		t.Skip(err)
+	}
+	sh, err := filepath.EvalSymlinks("/bin/sh")
+	if err != nil {
+		t.Skip(err)
+	}
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	if err := os.Mkdir(data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secret, []byte("secret\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the shell and its libraries
+	system := []string{"/bin", "/lib", "/lib64", "/usr", "/etc/ld.so.cache", filepath.Dir(sh)}
+
+	script := func(body string) string {
+		path := filepath.Join(dir, "test_command")
+		if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	run := func(path string, caps *pluginCapabilities) string {
+		cmd, err := sandboxCommand(path, caps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &out, &out
+		cmd.Run()
+		return strings.TrimSpace(out.String())
+	}
+
+	path := script("echo written > " + data + "/out && echo ok; read s < " + secret + " && echo $s; /bin/true && echo exec")
+	out := run(path, &pluginCapabilities{Read: system, Write: []string{data}})
+	if lines := strings.Split(out, "\n"); lines[0] != "ok" || strings.Contains(out, "\nsecret") || lines[len(lines)-1] == "exec" {
+		t.Errorf("unexpected output of the sandboxed plugin %q", out)
+	}
+	if written, err := ioutil.ReadFile(filepath.Join(data, "out")); err != nil || string(written) != "written\n" {
+		t.Errorf("expected the plugin to write to its write path: %v", err)
+	}
+
+	out = run(path, &pluginCapabilities{Read: append(system, dir), Exec: true})
+	if !strings.HasSuffix(out, "secret\nexec") {
+		t.Errorf("expected the plugin to read and exec, got %q", out)
+	}
+
+	// without the network capability the plugin only has a loopback
+	// interface in a network namespace of its own
+	path = script("while read l; do echo $l; done < /proc/net/dev")
+	out = run(path, &pluginCapabilities{Read: append(system, "/proc")})
+	if lines := strings.Split(out, "\n"); len(lines) != 3 || !strings.HasPrefix(lines[2], "lo:") {
+		t.Errorf("expected only the loopback interface, got %q", out)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package shell
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// sandboxCommand fails: process plugins are only sandboxed on Linux
+func sandboxCommand(path string, caps *pluginCapabilities) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("process plugins cannot be sandboxed on %s", runtime.GOOS)
+}
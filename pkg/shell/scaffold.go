@@ -0,0 +1,191 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// goshModule is the module path of the shell, which plugins require
+const goshModule = "github.com/vladimirvivien/gosh"
+
+var (
+	rePluginName = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+	reGoVersion  = regexp.MustCompile(`go(\d+\.\d+(\.\d+)?)`)
+)
+
+// scaffoldFiles are the templates of the files of a new plugin module,
+// by file name
+var scaffoldFiles = map[string]string{
+	"go.mod": `module {{.Module}}
+
+go {{.GoVersion}}
+{{if .GoshVersion}}
+require {{.GoshModule}} {{.GoshVersion}}
+{{end}}`,
+
+	"{{.Name}}.go": `package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"{{.GoshModule}}/api"
+)
+
+// {{.Type}} greets the names given as arguments
+type {{.Type}} string
+
+func (c {{.Type}}) Name() string      { return string(c) }
+func (c {{.Type}}) Usage() string     { return "{{.Name}} [<name> ...]" }
+func (c {{.Type}}) ShortDesc() string { return "greets the given names" }
+func (c {{.Type}}) LongDesc() string {
+	return "Prints a greeting to each name given as argument, or to the world."
+}
+func (c {{.Type}}) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	names := "world"
+	if len(args) > 1 {
+		names = strings.Join(args[1:], " and ")
+	}
+	fmt.Fprintf(api.GetStdout(ctx), "hello %s, from {{.Name}}\n", names)
+	return ctx, api.Result{}, nil
+}
+
+// commands is the module of the plugin, which registers its commands
+type commands struct{}
+
+func (commands) Init(ctx context.Context) error { return nil }
+
+func (commands) Registry() map[string]api.Command {
+	return map[string]api.Command{
+		"{{.Name}}": {{.Type}}("{{.Name}}"),
+	}
+}
+
+// Commands is looked up by the shell when it opens the plugin
+var Commands commands
+
+// APIVersion is the version of the plugin API the plugin is built
+// against, which the shell checks
+var APIVersion = api.APIVersion
+`,
+
+	"{{.Name}}_test.go": `package main
+
+import (
+	"testing"
+
+	"{{.GoshModule}}/api/goshtest"
+)
+
+func TestCommand(t *testing.T) {
+	res := goshtest.Run(Commands.Registry()["{{.Name}}"], []string{"{{.Name}}", "gosh"})
+	res.ExpectCode(t, 0)
+	res.ExpectStdout(t, "hello gosh, from {{.Name}}\n")
+}
+`,
+
+	"Makefile": `# The plugin must be built with the Go toolchain ({{.GoToolchain}}), the
+# build flags and the dependency versions of the shell loading it.
+PLUGIN = {{.Name}}_command.so
+BUILDFLAGS = -buildmode=plugin{{range .BuildFlags}} {{.}}{{end}}
+PLUGINS_DIR ?= $(or $(GOSH_PLUGINS_DIR),plugins)
+
+.PHONY: build test install clean
+
+build: go.sum
+	go build $(BUILDFLAGS) -o $(PLUGIN) .
+
+go.sum: go.mod
+	go mod tidy
+
+test: go.sum
+	go test ./...
+
+install: build
+	mkdir -p $(PLUGINS_DIR)
+	cp $(PLUGIN) $(PLUGINS_DIR)/
+
+clean:
+	rm -f $(PLUGIN)
+`,
+}
+
+// scaffold holds what the templates of a new plugin module fill in
+type scaffold struct {
+	Name        string
+	Type        string
+	Module      string
+	GoVersion   string
+	GoToolchain string
+	GoshModule  string
+	GoshVersion string
+	BuildFlags  []string
+}
+
+// ScaffoldPlugin writes in dir, which must not exist or be empty, a Go
+// plugin module named module providing the command name: its go.mod,
+// the command and a test of it, and a Makefile building the plugin with
+// the Go version, build flags and version of the shell it runs in.
+// It returns the paths of the files written.
+func ScaffoldPlugin(dir, name, module string) ([]string, error) {
+	if !rePluginName.MatchString(name) {
+		return nil, fmt.Errorf("invalid plugin name %q: use lowercase letters and digits, starting with a letter", name)
+	}
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		return nil, fmt.Errorf("%s already exists and is not empty", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	data := scaffold{
+		Name:        name,
+		Type:        name + "Cmd",
+		Module:      module,
+		GoVersion:   "1.21",
+		GoToolchain: runtime.Version(),
+		GoshModule:  goshModule,
+		BuildFlags:  pluginBuildFlags(),
+	}
+	if m := reGoVersion.FindStringSubmatch(runtime.Version()); m != nil {
+		data.GoVersion = m[1]
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, m := range append([]*debug.Module{&info.Main}, info.Deps...) {
+			if m.Path == goshModule && m.Version != "" && m.Version != "(devel)" {
+				data.GoshVersion = m.Version
+			}
+		}
+	}
+
+	var paths []string
+	for nameTmpl, text := range scaffoldFiles {
+		path := filepath.Join(dir, strings.ReplaceAll(nameTmpl, "{{.Name}}", name))
+		tmpl, err := template.New(nameTmpl).Parse(text)
+		if err != nil {
+			return paths, err
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return paths, err
+		}
+		err = tmpl.Execute(file, data)
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return paths, err
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
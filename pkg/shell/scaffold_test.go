@@ -0,0 +1,53 @@
+package shell
+
+import (
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScaffoldPlugin(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "greet")
+	paths, err := ScaffoldPlugin(dir, "greet", "example.com/greet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, path := range paths {
+		names = append(names, filepath.Base(path))
+	}
+	if strings.Join(names, " ") != "Makefile go.mod greet.go greet_test.go" {
+		t.Fatalf("unexpected files: %v", names)
+	}
+
+	for _, name := range []string{"greet.go", "greet_test.go"} {
+		src, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		formatted, err := format.Source(src)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if string(formatted) != string(src) {
+			t.Errorf("%s is not formatted:\n%s", name, src)
+		}
+	}
+	mod, _ := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if !strings.HasPrefix(string(mod), "module example.com/greet\n\ngo 1.") {
+		t.Errorf("unexpected go.mod:\n%s", mod)
+	}
+	makefile, _ := os.ReadFile(filepath.Join(dir, "Makefile"))
+	if !strings.Contains(string(makefile), "PLUGIN = greet_command.so\nBUILDFLAGS = -buildmode=plugin") {
+		t.Errorf("unexpected Makefile:\n%s", makefile)
+	}
+
+	if _, err := ScaffoldPlugin(dir, "greet", "example.com/greet"); err == nil {
+		t.Error("expected a non-empty directory to be refused")
+	}
+	if _, err := ScaffoldPlugin(t.TempDir(), "Greet-Me", "example.com/greet"); err == nil {
+		t.Error("expected an invalid name to be refused")
+	}
+}
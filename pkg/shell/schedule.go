@@ -0,0 +1,375 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+	"github.com/vladimirvivien/gosh/api/output"
+)
+
+// scheduled is a command line run by the shell on an interval or on
+// the times of a cron expression
+type scheduled struct {
+	id     int
+	spec   string
+	line   string
+	every  time.Duration
+	cron   *cronSpec
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu   sync.Mutex
+	next time.Time
+	runs int
+	err  error
+}
+
+// nextRun returns the time of the run following t
+func (s *scheduled) nextRun(t time.Time) time.Time {
+	if s.cron != nil {
+		return s.cron.next(t)
+	}
+	return t.Add(s.every)
+}
+
+// status returns the result of the last run
+func (s *scheduled) status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.runs == 0:
+		return "-"
+	case s.err != nil:
+		return fmt.Sprintf("Exit %d", api.ExitStatus(s.err))
+	}
+	return "Done"
+}
+
+// scheduleTable keeps track of the scheduled command lines of a session
+type scheduleTable struct {
+	mu        sync.Mutex
+	nextID    int
+	schedules map[int]*scheduled
+}
+
+func newScheduleTable() *scheduleTable {
+	return &scheduleTable{nextID: 1, schedules: make(map[int]*scheduled)}
+}
+
+// start runs fn at each time of s, from s.next on, in a background
+// goroutine until s is removed or has no next time. A run that lasts
+// past the next time delays the next run.
+func (t *scheduleTable) start(ctx context.Context, s *scheduled, fn func(context.Context) error) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+	t.mu.Lock()
+	s.id = t.nextID
+	t.schedules[s.id] = s
+	t.nextID++
+	t.mu.Unlock()
+
+	go func() {
+		defer close(s.done)
+		for {
+			s.mu.Lock()
+			next := s.next
+			s.mu.Unlock()
+			if next.IsZero() {
+				return
+			}
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			err := fn(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			s.mu.Lock()
+			s.err = err
+			s.runs++
+			s.next = s.nextRun(time.Now())
+			s.mu.Unlock()
+		}
+	}()
+}
+
+// list returns the schedules ordered by id
+func (t *scheduleTable) list() []*scheduled {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	schedules := make([]*scheduled, 0, len(t.schedules))
+	for _, s := range t.schedules {
+		schedules = append(schedules, s)
+	}
+	sort.Slice(schedules, func(i, k int) bool { return schedules[i].id < schedules[k].id })
+	return schedules
+}
+
+// remove cancels the schedule identified by spec and forgets it. A run
+// in progress is cancelled as well.
+func (t *scheduleTable) remove(spec string) error {
+	id, err := strconv.Atoi(spec)
+	if err != nil {
+		return fmt.Errorf("invalid schedule id: %s", spec)
+	}
+	t.mu.Lock()
+	s, ok := t.schedules[id]
+	delete(t.schedules, id)
+	t.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no such schedule: %s", spec)
+	}
+	s.cancel()
+	return nil
+}
+
+// cancelAll cancels the schedules and waits for their runs to end, or
+// for ctx to be done
+func (t *scheduleTable) cancelAll(ctx context.Context) {
+	schedules := t.list()
+	for _, s := range schedules {
+		s.cancel()
+	}
+	for _, s := range schedules {
+		select {
+		case <-s.done:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// scheduleCmd runs command lines on an interval or a cron expression
+type scheduleCmd struct {
+	gosh *Goshell
+}
+
+func (c scheduleCmd) Name() string { return "schedule" }
+func (c scheduleCmd) Usage() string {
+	return "schedule [list] | <interval|cron> <command> [<args>...] | remove <id>"
+}
+func (c scheduleCmd) LongDesc() string {
+	return `The interval is a Go duration such as 30s or 1h30m. A cron expression
+has the five fields minute, hour, day of month, month and day of week,
+as in '*/15 9-17 * * 1-5', or is one of @hourly, @daily, @weekly,
+@monthly and @yearly. A command line with operators is quoted, as in
+schedule 5m 'check || notify'. The command runs in the shell, with the
+output going to the terminal, until it is removed or the shell exits.
+list prints the schedules with the time of their next run and the status
+of their last one; remove cancels a schedule and its run in progress.`
+}
+func (c scheduleCmd) ShortDesc() string {
+	return `runs a command on an interval or cron expression`
+}
+func (c scheduleCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	switch {
+	case len(args) == 1 || args[1] == "list" && len(args) == 2:
+		return ctx, api.Result{Data: c.list()}, nil
+	case args[1] == "remove" && len(args) == 3:
+		return ctx, api.Result{}, c.gosh.schedules.remove(args[2])
+	case len(args) < 3:
+		return ctx, api.Result{}, api.NewUsageError("expected a schedule and a command")
+	}
+
+	s := &scheduled{spec: args[1]}
+	if strings.ContainsAny(s.spec, " @") {
+		cron, err := parseCron(s.spec)
+		if err != nil {
+			return ctx, api.Result{}, api.NewUsageError("%v", err)
+		}
+		s.cron = cron
+	} else {
+		every, err := time.ParseDuration(s.spec)
+		if err != nil || every <= 0 {
+			return ctx, api.Result{}, api.NewUsageError("invalid interval %q", s.spec)
+		}
+		s.every = every
+	}
+	s.line = commandLine(args[2:])
+	list, err := c.gosh.parseLine(s.line)
+	if err != nil {
+		return ctx, api.Result{}, err
+	}
+	s.next = s.nextRun(time.Now())
+	if s.next.IsZero() {
+		return ctx, api.Result{}, fmt.Errorf("%s never runs", s.spec)
+	}
+
+	// the schedule outlives the command line, like a background job
+	runCtx := ctx
+	if c.gosh.ctx != nil {
+		runCtx = detach(c.gosh.ctx, ctx)
+	}
+	runCtx = api.WithStdin(runCtx, strings.NewReader(""))
+	c.gosh.schedules.start(runCtx, s, func(ctx context.Context) error {
+		_, err := c.gosh.runApart(ctx, list)
+		if err != nil {
+			c.gosh.printErr(ctx, err)
+		}
+		return err
+	})
+	fmt.Fprintf(api.GetStderr(ctx), "[schedule %d] next run at %s\n", s.id, s.next.Format(time.Stamp))
+	return ctx, api.Result{}, nil
+}
+
+func (c scheduleCmd) list() *output.Table {
+	table := output.NewTable("ID", "SCHEDULE", "NEXT", "RUNS", "LAST", "COMMAND")
+	for _, s := range c.gosh.schedules.list() {
+		s.mu.Lock()
+		next, runs := s.next.Format(time.Stamp), s.runs
+		s.mu.Unlock()
+		table.AddRow(s.id, s.spec, next, runs, s.status(), s.line)
+	}
+	return table
+}
+
+// Complete completes the subcommands, the ids of the schedules to
+// remove, and the scheduled commands
+func (c scheduleCmd) Complete(ctx context.Context, args []string, cursorPos int) []string {
+	var candidates []string
+	switch {
+	case cursorPos == 1:
+		candidates = []string{"list", "remove"}
+	case cursorPos == 2 && args[1] == "remove":
+		for _, s := range c.gosh.schedules.list() {
+			candidates = append(candidates, strconv.Itoa(s.id))
+		}
+	case cursorPos >= 2 && args[1] != "list" && args[1] != "remove":
+		return c.gosh.complete(ctx, args[2:cursorPos+1])
+	}
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, args[cursorPos]) {
+			matches = append(matches, candidate)
+		}
+	}
+	return matches
+}
+
+// cronSpec is a parsed cron expression, with a bit set per field
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+
+	// anyDay is set when the day of month or the day of week is *:
+	// a day then has to match both fields, and either of them
+	// otherwise, as in cron(8)
+	anyDay bool
+}
+
+// cronMacros are the cron expressions with a name
+var cronMacros = map[string]string{
+	"@yearly":  "0 0 1 1 *",
+	"@monthly": "0 0 1 * *",
+	"@weekly":  "0 0 * * 0",
+	"@daily":   "0 0 * * *",
+	"@hourly":  "0 * * * *",
+}
+
+// parseCron parses a cron expression of five fields or a macro
+func parseCron(expr string) (*cronSpec, error) {
+	if macro, ok := cronMacros[expr]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields", expr)
+	}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %v", expr, err)
+		}
+		sets[i] = set
+	}
+	// 7 is another name for Sunday
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+	return &cronSpec{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		anyDay: fields[2] == "*" || fields[4] == "*",
+	}, nil
+}
+
+// parseCronField parses a comma separated list of *, n, a-b, with an
+// optional /step, into the set of the values between min and max
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rng, step = part[:i], n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+// next returns the first time after t matching the expression, or the
+// zero time when none does within five years
+func (c *cronSpec) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *cronSpec) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.anyDay {
+		return dom && dow
+	}
+	return dom || dow
+}
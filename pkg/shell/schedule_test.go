@@ -0,0 +1,118 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestParseCron(t *testing.T) {
+	from := time.Date(2024, time.January, 31, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2024, time.January, 31, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, time.January, 31, 10, 15, 0, 0, time.UTC)},
+		{"0 9-17 * * *", time.Date(2024, time.January, 31, 11, 0, 0, 0, time.UTC)},
+		{"30 2 * * *", time.Date(2024, time.February, 1, 2, 30, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 6,7", time.Date(2024, time.February, 3, 12, 0, 0, 0, time.UTC)},
+		// either the day of month or the day of week matches
+		{"0 0 15 * 5", time.Date(2024, time.February, 2, 0, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, test := range tests {
+		spec, err := parseCron(test.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", test.expr, err)
+			continue
+		}
+		if next := spec.next(from); !next.Equal(test.next) {
+			t.Errorf("next time of %q: expected %v, got %v", test.expr, test.next, next)
+		}
+	}
+
+	for _, expr := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "@often"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) should have failed", expr)
+		}
+	}
+}
+
+func TestShellSchedule(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	var ticks int32
+	shell.Register("tick", rpcTestCmd{"tick", func(ctx context.Context, args []string) error {
+		atomic.AddInt32(&ticks, 1)
+		return nil
+	}})
+	if err := shell.Init(api.WithStderr(context.TODO(), ioutil.Discard)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"schedule 20ms", "schedule soon tick", "schedule '0 0 31 2 *' tick", "schedule remove 1"} {
+		if _, err := shell.handle(shell.ctx, line); err == nil {
+			t.Errorf("%s should have failed", line)
+		}
+	}
+
+	if _, err := shell.handle(shell.ctx, "schedule 20ms 'tick && tick'"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&ticks) < 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if atomic.LoadInt32(&ticks) < 4 {
+		t.Fatalf("expected the schedule to run twice, tick ran %d times", ticks)
+	}
+	if shell.last.Code != 0 {
+		t.Errorf("the schedule should leave the last status alone, got %d", shell.last.Code)
+	}
+
+	var out bytes.Buffer
+	if _, err := shell.handle(api.WithStdout(shell.ctx, &out), "schedule list"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "20ms") || !strings.Contains(out.String(), "tick && tick") {
+		t.Errorf("unexpected schedule list:\n%s", out.String())
+	}
+
+	if _, err := shell.handle(shell.ctx, "schedule remove 1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(shell.schedules.list()) != 0 {
+		t.Error("the schedule was not removed")
+	}
+	time.Sleep(50 * time.Millisecond)
+	removed := atomic.LoadInt32(&ticks)
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt32(&ticks) != removed {
+		t.Error("the schedule still runs after it was removed")
+	}
+
+	if _, err := shell.handle(shell.ctx, "schedule @hourly tick"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	shell.Close(ctx)
+	for _, s := range shell.schedules.list() {
+		select {
+		case <-s.done:
+		default:
+			t.Errorf("schedule %d was not cancelled", s.id)
+		}
+	}
+}
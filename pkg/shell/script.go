@@ -0,0 +1,57 @@
+package shell
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// RunScript runs each statement read from r through the shell without
+// a prompt and returns the exit status of the script. A statement
+// continues on the next lines while it is incomplete, as when a line
+// ends with a backslash or an if, for or while is not closed yet. When
+// stopOnError is set, the script stops at the first failing line.
+// Context changes made by the script, such as a new prompt, are kept.
+func (gosh *Goshell) RunScript(r io.Reader, name string, stopOnError bool) int {
+	ctx, status := gosh.runScript(gosh.ctx, r, name, stopOnError)
+	gosh.ctx = ctx
+	return status
+}
+
+func (gosh *Goshell) runScript(ctx context.Context, r io.Reader, name string, stopOnError bool) (context.Context, int) {
+	status := 0
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		if gosh.ctx.Err() != nil {
+			return ctx, 1
+		}
+
+		// errors are reported at the first line of a statement
+		stmt, start := scanner.Text(), lineNum
+		for incomplete(stmt) && scanner.Scan() {
+			stmt = continueLine(stmt, scanner.Text())
+			lineNum++
+		}
+
+		var err error
+		ctx, err = gosh.exec(ctx, stmt)
+		if err == errExit {
+			return ctx, gosh.last.Code
+		}
+		status = api.ExitStatus(err)
+		if err != nil {
+			fmt.Fprintf(api.GetStderr(ctx), "%s:%d: %v\n", name, start, err)
+			if stopOnError {
+				return ctx, status
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(api.GetStderr(ctx), "%s: %v\n", name, err)
+		return ctx, 1
+	}
+	return ctx, status
+}
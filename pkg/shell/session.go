@@ -0,0 +1,83 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// sessionCloseTimeout bounds the time the plugins of a session get to
+// shut down when it ends
+const sessionCloseTimeout = 5 * time.Second
+
+// runSession runs an interactive shell on the given streams of a remote
+// session, or a single command line when line is not empty, then closes
+// the shell. It returns the exit status of the session.
+func runSession(ctx context.Context, sh *Goshell, stdin io.Reader, stdout, stderr io.Writer, line string) int {
+	ctx = api.WithStdin(ctx, sessionInput{stdin})
+	ctx = api.WithStdout(ctx, stdout)
+	ctx = api.WithStderr(ctx, stderr)
+
+	sh.metrics.sessions.Add(1)
+	defer sh.metrics.sessions.Add(-1)
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), sessionCloseTimeout)
+		defer cancel()
+		if err := sh.Close(closeCtx); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+		}
+	}()
+
+	if line == "" {
+		if err := sh.Run(ctx); err != nil {
+			fmt.Fprintf(stderr, "failed to initialize: %v\n", err)
+			return 1
+		}
+		return sh.last.Code
+	}
+	if err := sh.Init(ctx); err != nil {
+		fmt.Fprintf(stderr, "failed to initialize: %v\n", err)
+		return 1
+	}
+	res, err := sh.Eval(ctx, line)
+	if err != nil && err != errExit {
+		sh.printErr(ctx, err)
+	}
+	return res.Code
+}
+
+// sessionInput is the input of a remote session
+type sessionInput struct {
+	io.Reader
+}
+
+// isSessionInput reports whether r is the input of a remote session
+func isSessionInput(r io.Reader) bool {
+	_, ok := r.(sessionInput)
+	return ok
+}
+
+// setWindowSize stores the size of a remote terminal in the COLUMNS
+// and LINES variables of env
+func setWindowSize(env *api.Env, cols, rows int) {
+	env.Set("COLUMNS", strconv.Itoa(cols))
+	env.Set("LINES", strconv.Itoa(rows))
+}
+
+// crlfWriter translates newlines to the CRLF sequence of terminals
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (c crlfWriter) Write(p []byte) (int, error) {
+	if _, err := c.w.Write(bytes.ReplaceAll(p, []byte("\n"), []byte("\r\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
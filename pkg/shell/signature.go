@@ -0,0 +1,66 @@
+package shell
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// signatureExt is the extension of the detached signature of a plugin
+const signatureExt = ".sig"
+
+// errUnsigned is returned when a plugin has no signature file
+var errUnsigned = errors.New("plugin is not signed")
+
+// parsePublicKey decodes a base64 encoded ed25519 public key
+func parsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key: expected %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// verifySignature checks that the file at path is signed by one of the
+// trusted keys. The signature is the base64 encoded ed25519 signature of
+// the whole file, stored in sigPath.
+func verifySignature(path, sigPath string, keys []ed25519.PublicKey) error {
+	encoded, err := ioutil.ReadFile(sigPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return errUnsigned
+		}
+		return err
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("invalid signature: %v", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if ed25519.Verify(key, data, sig) {
+			return nil
+		}
+	}
+	return errors.New("signature does not match any trusted key")
+}
+
+// verifyPlugin checks the signature of a Go plugin before it is opened
+// from openPath, a private copy of the plugin at path. It always
+// succeeds when unsigned plugins are allowed.
+func (gosh *Goshell) verifyPlugin(path, openPath string) error {
+	if gosh.allowUnsigned {
+		return nil
+	}
+	return verifySignature(openPath, path+signatureExt, gosh.trustedKeys)
+}
@@ -0,0 +1,99 @@
+package shell
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifySignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := parsePublicKey(base64.StdEncoding.EncodeToString(pub))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test_command.so")
+	data := []byte("plugin")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifySignature(path, path+signatureExt, []ed25519.PublicKey{key}); err != errUnsigned {
+		t.Errorf("expected unsigned error, got %v", err)
+	}
+
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data))
+	if err := ioutil.WriteFile(path+signatureExt, []byte(sig+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifySignature(path, path+signatureExt, []ed25519.PublicKey{other, key}); err != nil {
+		t.Errorf("valid signature should verify: %v", err)
+	}
+	if err := verifySignature(path, path+signatureExt, []ed25519.PublicKey{other}); err == nil {
+		t.Error("signature of an untrusted key should fail")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifySignature(path, path+signatureExt, []ed25519.PublicKey{key}); err == nil {
+		t.Error("signature of a modified plugin should fail")
+	}
+
+	if _, err := parsePublicKey("a2V5"); err == nil {
+		t.Error("expected error for short key")
+	}
+}
+
+func TestShellRefusesUnsignedPlugins(t *testing.T) {
+	shell := New()
+	shell.indexPath = ""
+	shell.pluginsDir = testPluginsDir
+	if err := shell.loadCommands(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := shell.commands.Lookup("hello"); ok {
+		t.Error("unsigned plugin should not be loaded")
+	}
+}
+
+func TestShellLoadsSignedPlugins(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(testPluginsDir, "test_command.so"))
+	if err != nil {
+		t.Skip("test plugin not built:", err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test_command.so")
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data))
+	if err := ioutil.WriteFile(path, data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path+signatureExt, []byte(sig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	shell := New()
+	shell.indexPath = ""
+	shell.pluginsDir = dir
+	shell.trustedKeys = []ed25519.PublicKey{pub}
+	if err := shell.loadCommands(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := shell.commands.Lookup("hello"); !ok {
+		t.Error("signed plugin should be loaded")
+	}
+}
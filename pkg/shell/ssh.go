@@ -0,0 +1,273 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSHServer serves shell sessions over SSH. Each session gets its own
+// shell from NewShell, usually the NewSession method of a shell whose
+// plugins the sessions share. Clients that request a PTY get the line editor;
+// a command sent with the session, as with "ssh host plugin list", is
+// run on its own and its exit status returned.
+type SSHServer struct {
+	// NewShell returns the shell of a new session
+	NewShell func() *Goshell
+
+	// HostKey is the private key identifying the server
+	HostKey ssh.Signer
+
+	// AuthorizedKeys are the public keys allowed to log in
+	AuthorizedKeys []ssh.PublicKey
+}
+
+// ListenAndServe listens on the TCP address addr and serves sessions
+// until ctx is cancelled
+func (s *SSHServer) ListenAndServe(ctx context.Context, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, l)
+}
+
+// Serve accepts connections on l until ctx is cancelled, then waits for
+// the open sessions to end
+func (s *SSHServer) Serve(ctx context.Context, l net.Listener) error {
+	config := &ssh.ServerConfig{PublicKeyCallback: s.authorize}
+	config.AddHostKey(s.HostKey)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.Close()
+		case <-done:
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(ctx, conn, config)
+		}()
+	}
+}
+
+// authorize accepts the authorized public keys
+func (s *SSHServer) authorize(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	for _, authorized := range s.AuthorizedKeys {
+		if bytes.Equal(authorized.Marshal(), key.Marshal()) {
+			return &ssh.Permissions{}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown public key for %s", conn.User())
+}
+
+// serveConn runs the sessions of a connection. They are cancelled when
+// the client disconnects or ctx is cancelled.
+func (s *SSHServer) serveConn(ctx context.Context, conn net.Conn, config *ssh.ServerConfig) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		sconn.Wait()
+		cancel()
+	}()
+	go func() {
+		<-ctx.Done()
+		sconn.Close()
+	}()
+	go ssh.DiscardRequests(reqs)
+
+	// the sessions of the connection are audited as the SSH user
+	newShell := func() *Goshell {
+		sh := s.NewShell()
+		sh.user = sconn.User()
+		return sh
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for newCh := range chans {
+		if newCh.ChannelType() != "session" {
+			newCh.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		ch, requests, err := newCh.Accept()
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serveSession(ctx, newShell, ch, requests)
+		}()
+	}
+}
+
+// payloads of the session requests, as defined by RFC 4254
+type (
+	ptyRequest struct {
+		Term          string
+		Columns, Rows uint32
+		Width, Height uint32
+		Modes         string
+	}
+	windowChange struct {
+		Columns, Rows uint32
+		Width, Height uint32
+	}
+	execRequest struct {
+		Command string
+	}
+	exitStatus struct {
+		Status uint32
+	}
+)
+
+// serveSession handles the requests of a session channel. The shell is
+// created by the shell or exec request. The window size of a PTY is
+// kept in the COLUMNS and LINES variables of the shell.
+func serveSession(ctx context.Context, newShell func() *Goshell, ch ssh.Channel, reqs <-chan *ssh.Request) {
+	var (
+		sh    *Goshell
+		pty   *ptyRequest
+		ended = make(chan struct{})
+	)
+	defer ch.Close()
+	for {
+		var req *ssh.Request
+		select {
+		case req = <-reqs:
+		case <-ended:
+			return
+		}
+		if req == nil {
+			break
+		}
+		ok := false
+		switch req.Type {
+		case "pty-req":
+			var p ptyRequest
+			if sh == nil && ssh.Unmarshal(req.Payload, &p) == nil {
+				pty, ok = &p, true
+			}
+		case "window-change":
+			var size windowChange
+			if pty != nil && ssh.Unmarshal(req.Payload, &size) == nil {
+				pty.Columns, pty.Rows = size.Columns, size.Rows
+				if sh != nil {
+					setWindowSize(sh.env, int(pty.Columns), int(pty.Rows))
+				}
+			}
+		case "shell", "exec":
+			var exec execRequest
+			if sh != nil || (req.Type == "exec" && ssh.Unmarshal(req.Payload, &exec) != nil) {
+				break
+			}
+			sh = newShell()
+			if pty != nil {
+				sh.remoteTerm = true
+				sh.env.Set("TERM", pty.Term)
+				setWindowSize(sh.env, int(pty.Columns), int(pty.Rows))
+			}
+			ok = true
+			go func(sh *Goshell, isPty bool) {
+				status := runSSHSession(ctx, sh, ch, isPty, exec.Command)
+				ch.SendRequest("exit-status", false, ssh.Marshal(exitStatus{Status: uint32(status)}))
+				close(ended)
+			}(sh, pty != nil)
+		}
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+	}
+	// the client closed the channel; wait for the shell to stop
+	if sh != nil {
+		<-ended
+	}
+}
+
+// runSSHSession runs the shell of a session on ch and returns its exit
+// status. Output to a PTY has its newlines translated, as the server
+// has no terminal to do it.
+func runSSHSession(ctx context.Context, sh *Goshell, ch ssh.Channel, pty bool, line string) int {
+	if pty {
+		out := crlfWriter{ch}
+		return runSession(ctx, sh, ch, out, out, line)
+	}
+	return runSession(ctx, sh, ch, ch, ch.Stderr(), line)
+}
+
+// LoadHostKey reads the private host key of an SSH server from path.
+// A new ed25519 key is generated and saved to path when it does not
+// exist.
+func LoadHostKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return ssh.ParsePrivateKey(data)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	block, err := ssh.MarshalPrivateKey(key, "gosh host key")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		return nil, err
+	}
+	return ssh.NewSignerFromKey(key)
+}
+
+// LoadAuthorizedKeys reads the public keys of a file in the format of
+// OpenSSH authorized_keys
+func LoadAuthorizedKeys(path string) ([]ssh.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var keys []ssh.PublicKey
+	for len(bytes.TrimSpace(data)) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		keys = append(keys, key)
+		data = rest
+	}
+	return keys, nil
+}
@@ -0,0 +1,106 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSSHServer(t *testing.T) {
+	hostKey, err := LoadHostKey(filepath.Join(t.TempDir(), "host_key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, clientKey, _ := ed25519.GenerateKey(rand.Reader)
+	signer, err := ssh.NewSignerFromKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &SSHServer{
+		NewShell: func() *Goshell {
+			shell := New(WithoutPlugins())
+			shell.history = newHistory("", 10)
+			shell.aliases = newAliasTable("")
+			shell.rcFiles = nil
+			return shell
+		},
+		HostKey:        hostKey,
+		AuthorizedKeys: []ssh.PublicKey{signer.PublicKey()},
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- server.Serve(ctx, l) }()
+	defer func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	config := &ssh.ClientConfig{
+		User:            "admin",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.FixedHostKey(hostKey.PublicKey()),
+	}
+	client, err := ssh.Dial("tcp", l.Addr().String(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// a command sent with the session runs on its own
+	session, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := session.Output("set output json; set output")
+	session.Close()
+	if err != nil || string(out) != "{\n  \"output\": \"json\"\n}\n" {
+		t.Errorf("unexpected output %q: %v", out, err)
+	}
+
+	session, _ = client.NewSession()
+	err = session.Run("unset")
+	session.Close()
+	if exitErr, ok := err.(*ssh.ExitError); !ok || exitErr.ExitStatus() != 2 {
+		t.Errorf("expected exit status 2, got %v", err)
+	}
+
+	// a PTY session gets the line editor
+	session, _ = client.NewSession()
+	var term bytes.Buffer
+	session.Stdout = &term
+	session.Stdin = strings.NewReader("set output\rexit\r")
+	if err := session.RequestPty("xterm", 24, 80, ssh.TerminalModes{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Shell(); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.Wait(); err != nil {
+		t.Error(err)
+	}
+	if !strings.Contains(term.String(), "output:  text\r\n") {
+		t.Errorf("unexpected terminal output: %q", term.String())
+	}
+
+	// unknown keys are rejected
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	other, _ := ssh.NewSignerFromKey(otherKey)
+	config.Auth = []ssh.AuthMethod{ssh.PublicKeys(other)}
+	if _, err := ssh.Dial("tcp", l.Addr().String(), config); err == nil {
+		t.Error("expected unknown keys to be rejected")
+	}
+}
@@ -0,0 +1,319 @@
+package shell
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/vladimirvivien/gosh/api"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// starlarkPattern matches Starlark scripting plugins
+const starlarkPattern = `_command\.star$`
+
+// starlarkCallKey is the thread local holding the *starlarkCall of a
+// running command
+const starlarkCallKey = "gosh.call"
+
+// starlarkPlugin is a Starlark script that registers commands with the
+// predeclared function command(name, fn, usage, short_desc, long_desc).
+// A command function is called with the list of command arguments and
+// may return an exit status; the predeclared module gosh gives it access
+// to the shell's I/O and environment.
+type starlarkPlugin struct {
+	registry map[string]api.Command
+}
+
+// starlarkCall is the state of a running Starlark command
+type starlarkCall struct {
+	ctx   context.Context
+	stdin *bufio.Reader
+}
+
+// openStarlarkPlugin runs the script at path to collect its commands.
+// Output printed by the script itself goes to the stdout of ctx.
+func openStarlarkPlugin(ctx context.Context, path string) (*starlarkPlugin, error) {
+	plug := &starlarkPlugin{registry: make(map[string]api.Command)}
+	thread := &starlark.Thread{
+		Name: path,
+		Print: func(_ *starlark.Thread, msg string) {
+			fmt.Fprintln(api.GetStdout(ctx), msg)
+		},
+	}
+	command := starlark.NewBuiltin("command", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		cmd := &starlarkCmd{}
+		if err := starlark.UnpackArgs(b.Name(), args, kwargs,
+			"name", &cmd.name,
+			"fn", &cmd.fn,
+			"usage?", &cmd.usage,
+			"short_desc?", &cmd.shortDesc,
+			"long_desc?", &cmd.longDesc,
+		); err != nil {
+			return nil, err
+		}
+		if cmd.usage == "" {
+			cmd.usage = cmd.name
+		}
+		plug.registry[cmd.name] = cmd
+		return starlark.None, nil
+	})
+
+	predeclared := starlark.StringDict{
+		"command": command,
+		"gosh":    starlarkModule,
+	}
+	if _, err := starlark.ExecFile(thread, path, nil, predeclared); err != nil {
+		return nil, err
+	}
+	return plug, nil
+}
+
+// Init does nothing; the script is run when the plugin is opened
+func (p *starlarkPlugin) Init(ctx context.Context) error { return nil }
+
+func (p *starlarkPlugin) Registry() map[string]api.Command { return p.registry }
+
+// starlarkCmd is a command implemented by a Starlark function
+type starlarkCmd struct {
+	name      string
+	fn        starlark.Callable
+	usage     string
+	shortDesc string
+	longDesc  string
+}
+
+func (c *starlarkCmd) Name() string      { return c.name }
+func (c *starlarkCmd) Usage() string     { return c.usage }
+func (c *starlarkCmd) ShortDesc() string { return c.shortDesc }
+func (c *starlarkCmd) LongDesc() string  { return c.longDesc }
+
+// Exec calls the command function in a new thread. Canceling ctx
+// cancels the thread.
+func (c *starlarkCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	call := &starlarkCall{ctx: ctx, stdin: bufio.NewReader(api.GetStdin(ctx))}
+	thread := &starlark.Thread{
+		Name: c.name,
+		Print: func(_ *starlark.Thread, msg string) {
+			fmt.Fprintln(api.GetStdout(call.ctx), msg)
+		},
+	}
+	thread.SetLocal(starlarkCallKey, call)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel("interrupted")
+		case <-done:
+		}
+	}()
+
+	list := make([]starlark.Value, len(args))
+	for i, arg := range args {
+		list[i] = starlark.String(arg)
+	}
+	result, err := starlark.Call(thread, c.fn, starlark.Tuple{starlark.NewList(list)}, nil)
+	if err != nil {
+		if ctx.Err() != nil {
+			return call.ctx, api.Result{}, ctx.Err()
+		}
+		var evalErr *starlark.EvalError
+		if errors.As(err, &evalErr) {
+			err = errors.New(evalErr.Msg)
+		}
+		return call.ctx, api.Result{}, err
+	}
+	if result == starlark.None {
+		return call.ctx, api.Result{}, nil
+	}
+	status, err := starlark.AsInt32(result)
+	if err != nil {
+		return call.ctx, api.Result{}, fmt.Errorf("%s: exit status: %v", c.name, err)
+	}
+	return call.ctx, api.Result{Code: status}, nil
+}
+
+// starlarkModule is the predeclared gosh module available to scripts
+var starlarkModule = &starlarkstruct.Module{
+	Name: "gosh",
+	Members: starlark.StringDict{
+		"write":      starlark.NewBuiltin("write", starlarkWrite),
+		"write_err":  starlark.NewBuiltin("write_err", starlarkWrite),
+		"read":       starlark.NewBuiltin("read", starlarkRead),
+		"read_line":  starlark.NewBuiltin("read_line", starlarkReadLine),
+		"getenv":     starlark.NewBuiltin("getenv", starlarkGetenv),
+		"setenv":     starlark.NewBuiltin("setenv", starlarkSetenv),
+		"unsetenv":   starlark.NewBuiltin("unsetenv", starlarkUnsetenv),
+		"environ":    starlark.NewBuiltin("environ", starlarkEnviron),
+		"prompt":     starlark.NewBuiltin("prompt", starlarkPrompt),
+		"set_prompt": starlark.NewBuiltin("set_prompt", starlarkSetPrompt),
+	},
+}
+
+// currentCall returns the state of the command running in thread
+func currentCall(thread *starlark.Thread, b *starlark.Builtin) (*starlarkCall, error) {
+	call, ok := thread.Local(starlarkCallKey).(*starlarkCall)
+	if !ok {
+		return nil, fmt.Errorf("%s: can only be used by a running command", b.Name())
+	}
+	return call, nil
+}
+
+// gosh.write(s) and gosh.write_err(s) write s to stdout and stderr
+func starlarkWrite(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &s); err != nil {
+		return nil, err
+	}
+	call, err := currentCall(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	out := api.GetStdout(call.ctx)
+	if b.Name() == "write_err" {
+		out = api.GetStderr(call.ctx)
+	}
+	if _, err := io.WriteString(out, s); err != nil {
+		return nil, err
+	}
+	return starlark.None, nil
+}
+
+// gosh.read() returns the rest of stdin
+func starlarkRead(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	call, err := currentCall(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(call.stdin)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.String(data), nil
+}
+
+// gosh.read_line() returns the next line of stdin without its newline,
+// or None at the end of the input
+func starlarkReadLine(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	call, err := currentCall(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	line, err := call.stdin.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return starlark.None, nil
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return starlark.String(strings.TrimSuffix(line, "\n")), nil
+}
+
+// gosh.getenv(name, default=None) returns the value of a variable
+func starlarkGetenv(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	var def starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "default?", &def); err != nil {
+		return nil, err
+	}
+	call, err := currentCall(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	if env := api.GetEnv(call.ctx); env != nil {
+		if value, ok := env.Get(name); ok {
+			return starlark.String(value), nil
+		}
+	}
+	return def, nil
+}
+
+// gosh.setenv(name, value) sets a variable
+func starlarkSetenv(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name, value string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name, "value", &value); err != nil {
+		return nil, err
+	}
+	call, err := currentCall(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	if env := api.GetEnv(call.ctx); env != nil {
+		env.Set(name, value)
+	}
+	return starlark.None, nil
+}
+
+// gosh.unsetenv(name) removes a variable
+func starlarkUnsetenv(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var name string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "name", &name); err != nil {
+		return nil, err
+	}
+	call, err := currentCall(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	if env := api.GetEnv(call.ctx); env != nil {
+		env.Unset(name)
+	}
+	return starlark.None, nil
+}
+
+// gosh.environ() returns the environment as a dict
+func starlarkEnviron(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	call, err := currentCall(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	dict := starlark.NewDict(0)
+	if env := api.GetEnv(call.ctx); env != nil {
+		for _, name := range env.Names() {
+			value, _ := env.Get(name)
+			dict.SetKey(starlark.String(name), starlark.String(value))
+		}
+	}
+	return dict, nil
+}
+
+// gosh.prompt() returns the shell prompt
+func starlarkPrompt(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	call, err := currentCall(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	return starlark.String(api.GetPrompt(call.ctx)), nil
+}
+
+// gosh.set_prompt(prompt) sets the shell prompt
+func starlarkSetPrompt(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var prompt string
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &prompt); err != nil {
+		return nil, err
+	}
+	call, err := currentCall(thread, b)
+	if err != nil {
+		return nil, err
+	}
+	call.ctx = api.WithPrompt(call.ctx, prompt)
+	return starlark.None, nil
+}
@@ -0,0 +1,70 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+const testStarlarkScript = `
+def greet(args):
+    name = gosh.getenv("NAME", "nobody")
+    print("hello", name, args[1:])
+    gosh.write_err(gosh.read_line() + "\n")
+    gosh.setenv("GREETED", name)
+    gosh.set_prompt("star>")
+
+def fail(args):
+    return 3
+
+command(name = "greet", fn = greet, short_desc = "greets")
+command(name = "fail", fn = fail)
+`
+
+func TestStarlarkPlugin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "greet_command.star")
+	if err := ioutil.WriteFile(path, []byte(testStarlarkScript), 0644); err != nil {
+		t.Fatal(err)
+	}
+	plug, err := openStarlarkPlugin(context.TODO(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := plug.Registry()
+	if len(registry) != 2 || registry["greet"].ShortDesc() != "greets" || registry["fail"].Usage() != "fail" {
+		t.Fatalf("unexpected registry: %v", registry)
+	}
+
+	var stdout, stderr bytes.Buffer
+	env := api.NewEnv([]string{"NAME=gosh"})
+	ctx := api.WithStdout(context.TODO(), &stdout)
+	ctx = api.WithStderr(ctx, &stderr)
+	ctx = api.WithStdin(ctx, strings.NewReader("first\nsecond\n"))
+	ctx = api.WithEnv(ctx, env)
+
+	ctx, _, err = registry["greet"].Exec(ctx, []string{"greet", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stdout.String(); got != "hello gosh [\"a\"]\n" {
+		t.Errorf("unexpected output: %q", got)
+	}
+	if got := stderr.String(); got != "first\n" {
+		t.Errorf("unexpected stderr: %q", got)
+	}
+	if greeted, _ := env.Get("GREETED"); greeted != "gosh" {
+		t.Errorf("variable should be set, got %q", greeted)
+	}
+	if prompt := api.GetPrompt(ctx); prompt != "star>" {
+		t.Errorf("unexpected prompt: %q", prompt)
+	}
+
+	if _, res, err := registry["fail"].Exec(ctx, []string{"fail"}); err != nil || res.Code != 3 {
+		t.Errorf("unexpected result: %+v, %v", res, err)
+	}
+}
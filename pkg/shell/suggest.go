@@ -0,0 +1,85 @@
+package shell
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// maxSuggestions is the number of commands suggested for a name that
+// is not found
+const maxSuggestions = 3
+
+// suggestCommands returns up to maxSuggestions names of the registry
+// close to name, closest first. Names within a third of the length of
+// name in edits, and at least within 2, are close.
+func (gosh *Goshell) suggestCommands(name string) []string {
+	maxDist := len(name) / 3
+	if maxDist < 2 {
+		maxDist = 2
+	}
+	type candidate struct {
+		name string
+		dist int
+	}
+	var candidates []candidate
+	for _, cmd := range (sessionRegistry{gosh}).names() {
+		if d := levenshtein(name, cmd); d <= maxDist {
+			candidates = append(candidates, candidate{cmd, d})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].dist != candidates[j].dist {
+			return candidates[i].dist < candidates[j].dist
+		}
+		return candidates[i].name < candidates[j].name
+	})
+	var names []string
+	for i := 0; i < len(candidates) && i < maxSuggestions; i++ {
+		names = append(names, candidates[i].name)
+	}
+	return names
+}
+
+// notFoundError returns the error of a command that is not found, with
+// the close names of the registry
+func (gosh *Goshell) notFoundError(name string) error {
+	msg := "command not found: " + name
+	if names := gosh.suggestCommands(name); len(names) > 0 {
+		msg += "\ndid you mean: " + strings.Join(names, ", ") + "?"
+	}
+	return errors.New(msg)
+}
+
+// levenshtein returns the number of single-character insertions,
+// deletions and substitutions turning a into b
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	prev := make([]int, len(t)+1)
+	cur := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		cur[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(t)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
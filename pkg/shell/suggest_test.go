@@ -0,0 +1,50 @@
+package shell
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		dist int
+	}{
+		{"", "", 0},
+		{"deploy", "deploy", 0},
+		{"deplyo", "deploy", 2},
+		{"delpoy", "deploy", 2},
+		{"deploi", "deploy", 1},
+		{"dep", "deploy", 3},
+		{"", "abc", 3},
+	}
+	for _, test := range tests {
+		if dist := levenshtein(test.a, test.b); dist != test.dist {
+			t.Errorf("levenshtein(%q, %q) = %d, expected %d", test.a, test.b, dist, test.dist)
+		}
+	}
+}
+
+func TestShellSuggestCommands(t *testing.T) {
+	shell := New(WithoutPlugins())
+	for _, name := range []string{"deploy", "deploys", "deploy2", "redeploy", "status"} {
+		shell.Register(name, pwdCmd(name))
+	}
+
+	if names := shell.suggestCommands("deplyo"); !reflect.DeepEqual(names, []string{"deploy", "deploy2", "deploys"}) {
+		t.Errorf("unexpected suggestions %v", names)
+	}
+	if names := shell.suggestCommands("statsu"); !reflect.DeepEqual(names, []string{"status"}) {
+		t.Errorf("unexpected suggestions %v", names)
+	}
+	if names := shell.suggestCommands("zzzzzz"); len(names) != 0 {
+		t.Errorf("expected no suggestions, got %v", names)
+	}
+
+	_, err := shell.handle(context.TODO(), "deplyo")
+	if err == nil || !strings.Contains(err.Error(), "did you mean: deploy, deploy2, deploys?") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,267 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TCPServer serves shell sessions over plain TCP connections, for
+// consoles in appliances and containers where SSH is too much. Clients
+// such as telnet or nc send lines of input; telnet commands are dropped.
+// Nothing is encrypted, so it should only listen on trusted networks.
+type TCPServer struct {
+	// NewShell returns the shell of a new session
+	NewShell func() *Goshell
+
+	// Password, when set, is asked for before the session starts
+	Password string
+
+	// LineRate limits the lines of input a connection sends per
+	// second, after a first burst of LineBurst lines. Zero disables
+	// the limit.
+	LineRate  float64
+	LineBurst int
+}
+
+// ListenAndServe listens on the TCP address addr and serves sessions
+// until ctx is cancelled
+func (s *TCPServer) ListenAndServe(ctx context.Context, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, l)
+}
+
+// Serve accepts connections on l until ctx is cancelled, then waits for
+// the open sessions to end
+func (s *TCPServer) Serve(ctx context.Context, l net.Listener) error {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.Close()
+		case <-done:
+		}
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.serveConn(ctx, conn)
+		}()
+	}
+}
+
+// serveConn runs a session on conn once the client has logged in
+func (s *TCPServer) serveConn(ctx context.Context, conn net.Conn) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	var in io.Reader = &telnetReader{r: conn}
+	if s.LineRate > 0 {
+		in = newLineLimiter(ctx, in, s.LineRate, s.LineBurst)
+	}
+	out := crlfWriter{conn}
+	if s.Password != "" && !s.login(in, out) {
+		return
+	}
+	runSession(ctx, s.NewShell(), in, out, out, "")
+}
+
+// login asks for the password and reports whether it was given
+func (s *TCPServer) login(in io.Reader, out io.Writer) bool {
+	fmt.Fprint(out, "password: ")
+	line, err := readLineUnbuffered(in)
+	if err != nil {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.TrimRight(line, "\r\n")), []byte(s.Password)) != 1 {
+		fmt.Fprintln(out, "login incorrect")
+		return false
+	}
+	fmt.Fprintln(out)
+	return true
+}
+
+// readLineUnbuffered reads a line a byte at a time, so that the rest
+// of the input is left for the shell
+func readLineUnbuffered(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := io.ReadFull(r, b); err != nil {
+			return string(line), err
+		}
+		line = append(line, b[0])
+		if b[0] == '\n' {
+			return string(line), nil
+		}
+	}
+}
+
+// telnet command bytes, as defined by RFC 854
+const (
+	telnetIAC  = 255
+	telnetSB   = 250
+	telnetSE   = 240
+	telnetWILL = 251
+	telnetDONT = 254
+)
+
+// telnetReader removes telnet commands and option negotiations from
+// the input, and the NUL a telnet client may send after a CR
+type telnetReader struct {
+	r     io.Reader
+	state int
+}
+
+const (
+	telnetData = iota
+	telnetCommand
+	telnetOption
+	telnetSub
+	telnetSubIAC
+	telnetCR
+)
+
+func (t *telnetReader) Read(p []byte) (int, error) {
+	for {
+		n, err := t.r.Read(p)
+		n = t.filter(p[:n])
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+// filter removes the telnet commands of p in place and returns the
+// number of bytes of data left
+func (t *telnetReader) filter(p []byte) int {
+	n := 0
+	for _, b := range p {
+		switch t.state {
+		case telnetCommand:
+			switch {
+			case b == telnetIAC:
+				// an escaped 255 data byte
+				p[n] = b
+				n++
+				t.state = telnetData
+			case b == telnetSB:
+				t.state = telnetSub
+			case b >= telnetWILL && b <= telnetDONT:
+				t.state = telnetOption
+			default:
+				t.state = telnetData
+			}
+			continue
+		case telnetOption:
+			t.state = telnetData
+			continue
+		case telnetSub:
+			if b == telnetIAC {
+				t.state = telnetSubIAC
+			}
+			continue
+		case telnetSubIAC:
+			t.state = telnetSub
+			if b == telnetSE {
+				t.state = telnetData
+			}
+			continue
+		case telnetCR:
+			t.state = telnetData
+			if b == 0 {
+				continue
+			}
+		}
+		switch b {
+		case telnetIAC:
+			t.state = telnetCommand
+			continue
+		case '\r':
+			t.state = telnetCR
+		}
+		p[n] = b
+		n++
+	}
+	return n
+}
+
+// lineLimiter delays the input of a connection so that it sends at most
+// rate lines per second after a burst, like a token bucket refilled at
+// the rate
+type lineLimiter struct {
+	ctx    context.Context
+	r      io.Reader
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLineLimiter(ctx context.Context, r io.Reader, rate float64, burst int) *lineLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &lineLimiter{ctx: ctx, r: r, rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+func (l *lineLimiter) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	for i := bytes.Count(p[:n], []byte("\n")); i > 0; i-- {
+		if werr := l.wait(); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// wait takes a token, waiting for one to be refilled when there is none
+func (l *lineLimiter) wait() error {
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return nil
+	}
+
+	delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		l.tokens = 0
+		l.last = now.Add(delay)
+		return nil
+	case <-l.ctx.Done():
+		return l.ctx.Err()
+	}
+}
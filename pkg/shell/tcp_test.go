@@ -0,0 +1,84 @@
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTCPServer(t *testing.T) {
+	server := &TCPServer{
+		NewShell: func() *Goshell {
+			shell := New(WithoutPlugins())
+			shell.history = newHistory("", 10)
+			shell.aliases = newAliasTable("")
+			shell.rcFiles = nil
+			return shell
+		},
+		Password: "secret",
+		LineRate: 100,
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- server.Serve(ctx, l) }()
+	defer func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	session := func(input string) string {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conn.Write([]byte(input))
+		out, _ := ioutil.ReadAll(conn)
+		return string(out)
+	}
+	if out := session("wrong\r\nset\r\n"); out != "password: login incorrect\r\n" {
+		t.Errorf("unexpected output for a wrong password: %q", out)
+	}
+	// a telnet client negotiates options and sends CR NUL
+	out := session("\xff\xfb\x1fsecret\r\x00\nset output\r\nexit\r\n")
+	if !strings.HasPrefix(out, "password: \r\n") || !strings.Contains(out, "output:  text\r\n") {
+		t.Errorf("unexpected session output: %q", out)
+	}
+}
+
+func TestTelnetReader(t *testing.T) {
+	input := "a\xff\xfd\x01b\xff\xfa\x18\x01\xff\xf0c\xff\xffd\r\x00e\r\n"
+	out, err := ioutil.ReadAll(&telnetReader{r: strings.NewReader(input)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "abc\xffd\re\r\n"; string(out) != expected {
+		t.Errorf("expected %q, got %q", expected, out)
+	}
+}
+
+func TestLineLimiter(t *testing.T) {
+	input := bytes.Repeat([]byte("x\n"), 5)
+	r := bufio.NewReaderSize(newLineLimiter(context.Background(), bytes.NewReader(input), 100, 2), 16)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := r.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the 3 lines after the burst take at least 10ms each
+	if elapsed := time.Since(start); elapsed < 25*time.Millisecond {
+		t.Errorf("lines were not rate limited: %v", elapsed)
+	}
+}
@@ -0,0 +1,49 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// teeCmd copies its input to its output and to files, so that the
+// output of a pipeline can be watched and saved at once
+type teeCmd string
+
+func (c teeCmd) Name() string  { return string(c) }
+func (c teeCmd) Usage() string { return "tee [-a] [file ...]" }
+func (c teeCmd) LongDesc() string {
+	return `The files are truncated first, unless -a (or --append) is given to append
+to them. Ending a command with |& instead of | pipes its errors along with
+its output, as in:
+
+    make |& tee build.log`
+}
+func (c teeCmd) ShortDesc() string { return `copies the input to the output and to files` }
+func (c teeCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	names := args[1:]
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if len(names) > 0 && (names[0] == "-a" || names[0] == "--append") {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		names = names[1:]
+	}
+
+	writers := []io.Writer{api.GetStdout(ctx)}
+	var files []io.Closer
+	defer func() { closeAll(files) }()
+	for _, name := range names {
+		file, err := os.OpenFile(workPath(ctx, name), flags, 0644)
+		if err != nil {
+			return ctx, api.Result{}, fmt.Errorf("tee: %w", err)
+		}
+		files = append(files, file)
+		writers = append(writers, file)
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), api.GetStdin(ctx)); err != nil {
+		return ctx, api.Result{}, fmt.Errorf("tee: %w", err)
+	}
+	return ctx, api.Result{}, nil
+}
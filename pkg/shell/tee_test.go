@@ -0,0 +1,58 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestShellTee(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	dir := t.TempDir()
+	shell.RegisterCommand(rpcTestCmd{"build", func(ctx context.Context, a []string) error {
+		fmt.Fprintln(api.GetStdout(ctx), "compiling")
+		fmt.Fprintln(api.GetStderr(ctx), "warning")
+		return nil
+	}})
+	var out, errOut bytes.Buffer
+	ctx := api.WithWorkDir(api.WithStderr(api.WithStdout(context.TODO(), &out), &errOut), dir)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line string
+		out  string
+		log  string
+	}{
+		{"build | tee build.log", "compiling\n", "compiling\n"},
+		{"build |& tee -a build.log other.log", "compiling\nwarning\n", "compiling\ncompiling\nwarning\n"},
+	}
+	for _, test := range tests {
+		out.Reset()
+		errOut.Reset()
+		if _, err := shell.Eval(shell.ctx, test.line); err != nil {
+			t.Fatalf("%s: %v", test.line, err)
+		}
+		if out.String() != test.out {
+			t.Errorf("%s: expected output %q, got %q", test.line, test.out, out.String())
+		}
+		if data, _ := ioutil.ReadFile(filepath.Join(dir, "build.log")); string(data) != test.log {
+			t.Errorf("%s: expected log %q, got %q", test.line, test.log, data)
+		}
+	}
+	if errOut.String() != "" {
+		t.Errorf("stderr should go down the pipe, got %q", errOut.String())
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(dir, "other.log")); string(data) != "compiling\nwarning\n" {
+		t.Errorf("unexpected copy in the second file: %q", data)
+	}
+}
@@ -0,0 +1,67 @@
+//go:build !windows
+
+package shell
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// termState holds a terminal state that can be restored later
+type termState struct {
+	termios syscall.Termios
+}
+
+func getTermios(fd uintptr) (*syscall.Termios, error) {
+	t := new(syscall.Termios)
+	if _, _, errno := syscall.Syscall6(syscall.SYS_IOCTL, fd, ioctlGetTermios, uintptr(unsafe.Pointer(t)), 0, 0, 0); errno != 0 {
+		return nil, errno
+	}
+	return t, nil
+}
+
+func setTermios(fd uintptr, t *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall6(syscall.SYS_IOCTL, fd, ioctlSetTermios, uintptr(unsafe.Pointer(t)), 0, 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// isTerminal returns true if fd refers to a terminal
+func isTerminal(fd uintptr) bool {
+	_, err := getTermios(fd)
+	return err == nil
+}
+
+// termSize returns the number of columns and rows of the terminal
+// referred to by fd
+func termSize(fd uintptr) (cols, rows int, err error) {
+	var ws struct{ row, col, xpixel, ypixel uint16 }
+	if _, _, errno := syscall.Syscall6(syscall.SYS_IOCTL, fd, syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&ws)), 0, 0, 0); errno != 0 {
+		return 0, 0, errno
+	}
+	return int(ws.col), int(ws.row), nil
+}
+
+// makeRaw turns off line buffering, echo and signal generation for
+// the terminal referred to by fd so that input, including Ctrl-C,
+// can be read key by key.
+func makeRaw(fd uintptr) (*termState, error) {
+	t, err := getTermios(fd)
+	if err != nil {
+		return nil, err
+	}
+	old := termState{termios: *t}
+	t.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.ISIG
+	t.Cc[syscall.VMIN] = 1
+	t.Cc[syscall.VTIME] = 0
+	if err := setTermios(fd, t); err != nil {
+		return nil, err
+	}
+	return &old, nil
+}
+
+// restoreTerm restores the terminal to a state saved by makeRaw
+func restoreTerm(fd uintptr, state *termState) error {
+	return setTermios(fd, &state.termios)
+}
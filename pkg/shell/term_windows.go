@@ -0,0 +1,46 @@
+package shell
+
+import "golang.org/x/sys/windows"
+
+// termState holds a console mode that can be restored later
+type termState struct {
+	mode uint32
+}
+
+// isTerminal returns true if fd refers to a console
+func isTerminal(fd uintptr) bool {
+	var mode uint32
+	return windows.GetConsoleMode(windows.Handle(fd), &mode) == nil
+}
+
+// termSize returns the number of columns and rows of the window of the
+// console referred to by fd
+func termSize(fd uintptr) (cols, rows int, err error) {
+	var info windows.ConsoleScreenBufferInfo
+	if err := windows.GetConsoleScreenBufferInfo(windows.Handle(fd), &info); err != nil {
+		return 0, 0, err
+	}
+	return int(info.Window.Right-info.Window.Left) + 1, int(info.Window.Bottom-info.Window.Top) + 1, nil
+}
+
+// makeRaw turns off line input, echo and the handling of Ctrl-C for the
+// console input referred to by fd so that input can be read key by key.
+// The arrow and function keys are read as the escape sequences of a
+// terminal.
+func makeRaw(fd uintptr) (*termState, error) {
+	var mode uint32
+	if err := windows.GetConsoleMode(windows.Handle(fd), &mode); err != nil {
+		return nil, err
+	}
+	raw := mode&^(windows.ENABLE_ECHO_INPUT|windows.ENABLE_LINE_INPUT|windows.ENABLE_PROCESSED_INPUT) |
+		windows.ENABLE_VIRTUAL_TERMINAL_INPUT
+	if err := windows.SetConsoleMode(windows.Handle(fd), raw); err != nil {
+		return nil, err
+	}
+	return &termState{mode: mode}, nil
+}
+
+// restoreTerm restores the console to a state saved by makeRaw
+func restoreTerm(fd uintptr, state *termState) error {
+	return windows.SetConsoleMode(windows.Handle(fd), state.mode)
+}
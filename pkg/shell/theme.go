@@ -0,0 +1,175 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/vladimirvivien/gosh/api"
+	"github.com/vladimirvivien/gosh/api/style"
+)
+
+// defaultTheme is the name of the theme used unless another is selected
+const defaultTheme = "default"
+
+// theme holds the styles of what the shell shows: the prompt, errors,
+// help and manuals, and the line editor
+type theme struct {
+	name string
+
+	// prompt styles the prompts that do not set their own colors
+	prompt style.Style
+	err    style.Style
+
+	// heading, command, code, strong and emphasis style help listings
+	// and manuals
+	heading  style.Style
+	command  style.Style
+	code     style.Style
+	strong   style.Style
+	emphasis style.Style
+
+	// suggestion, selected and completion style the line editor, its
+	// palette and menus
+	suggestion style.Style
+	selected   style.Style
+	completion style.Style
+}
+
+var themes = map[string]*theme{
+	"default": {
+		name:       "default",
+		err:        style.New(style.Red),
+		heading:    style.New(style.Bold),
+		code:       style.New(style.Bold),
+		strong:     style.New(style.Bold),
+		emphasis:   style.New(style.Underline),
+		suggestion: style.New(style.Dim),
+		selected:   style.New(style.Reverse),
+	},
+	"solarized": {
+		name:       "solarized",
+		prompt:     style.New(style.Blue, style.Bold),
+		err:        style.New(style.Red, style.Bold),
+		heading:    style.New(style.Yellow, style.Bold),
+		command:    style.New(style.Cyan),
+		code:       style.New(style.Cyan),
+		strong:     style.New(style.Bold),
+		emphasis:   style.New(style.Magenta),
+		suggestion: style.New(style.Dim),
+		selected:   style.New(style.Reverse, style.Blue),
+		completion: style.New(style.Cyan),
+	},
+	"monochrome": {
+		name:       "monochrome",
+		prompt:     style.New(style.Bold),
+		err:        style.New(style.Bold),
+		heading:    style.New(style.Bold),
+		code:       style.New(style.Bold),
+		strong:     style.New(style.Bold),
+		emphasis:   style.New(style.Underline),
+		suggestion: style.New(style.Dim),
+		selected:   style.New(style.Reverse),
+	},
+}
+
+// activeTheme holds the *theme in use. Like color output, the theme is
+// shared by the sessions of the process.
+var activeTheme atomic.Value
+
+func init() {
+	activeTheme.Store(themes[defaultTheme])
+}
+
+// currentTheme returns the theme in use
+func currentTheme() *theme {
+	return activeTheme.Load().(*theme)
+}
+
+// setTheme selects the theme called name
+func setTheme(name string) error {
+	t, ok := themes[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown theme %q, expected one of %s", name, strings.Join(themeNames(), ", "))
+	}
+	activeTheme.Store(t)
+	return nil
+}
+
+// themeNames returns the names of the themes in order
+func themeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// preview renders a sample of the styles of the theme
+func (t *theme) preview() string {
+	return strings.Join([]string{
+		t.prompt.Sprint("gosh>"),
+		t.command.Sprint("help") + t.suggestion.Sprint(" --all"),
+		t.err.Sprint("error"),
+		t.heading.Sprint("heading"),
+		t.code.Sprint("code"),
+		t.completion.Sprint("candidate"),
+		t.selected.Sprint("selected"),
+	}, "  ")
+}
+
+// themeCmd lists the themes or selects one
+type themeCmd string
+
+func (c themeCmd) Name() string  { return string(c) }
+func (c themeCmd) Usage() string { return "theme [<name>]" }
+func (c themeCmd) LongDesc() string {
+	return `Without arguments the themes are listed, the current one marked with a *,
+each followed by a preview of its styles when stdout is a terminal. A
+theme sets the colors of the prompt, errors, help, manuals and the line
+editor, and takes effect at once. Prompts that set their own colors keep
+them. The theme setting of the configuration file selects it at startup.`
+}
+func (c themeCmd) ShortDesc() string { return `lists or selects the color themes` }
+func (c themeCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	switch len(args) {
+	case 1:
+		out := api.GetStdout(ctx)
+		styled := style.Enabled(out)
+		for _, name := range themeNames() {
+			mark := " "
+			if name == currentTheme().name {
+				mark = "*"
+			}
+			if styled {
+				fmt.Fprintf(out, "%s %-12s %s\n", mark, name, themes[name].preview())
+			} else {
+				fmt.Fprintf(out, "%s %s\n", mark, name)
+			}
+		}
+		return ctx, api.Result{}, nil
+	case 2:
+		if err := setTheme(args[1]); err != nil {
+			return ctx, api.Result{}, fmt.Errorf("theme: %w", err)
+		}
+		return ctx, api.Result{}, nil
+	}
+	return ctx, api.Result{}, api.NewUsageError("too many arguments")
+}
+
+// Complete completes the theme names
+func (c themeCmd) Complete(ctx context.Context, args []string, cursorPos int) []string {
+	if cursorPos != 1 {
+		return nil
+	}
+	var names []string
+	for _, name := range themeNames() {
+		if strings.HasPrefix(name, args[cursorPos]) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -0,0 +1,52 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestThemeCmd(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	defer setTheme(defaultTheme)
+	out := bytes.NewBufferString("")
+	if err := shell.Init(api.WithStdout(context.TODO(), out)); err != nil {
+		t.Fatal(err)
+	}
+	ctx := shell.ctx
+
+	if _, err := shell.handle(ctx, "theme"); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "* default\n  monochrome\n  solarized\n"; out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+
+	if _, err := shell.handle(ctx, "theme solarized"); err != nil {
+		t.Fatal(err)
+	}
+	if currentTheme().name != "solarized" {
+		t.Errorf("expected the solarized theme, got %s", currentTheme().name)
+	}
+	if got := shell.renderPrompt(api.WithPrompt(ctx, "gosh>"), true); got != "\x1b[34;1mgosh>\x1b[0m" {
+		t.Errorf("expected a themed prompt, got %q", got)
+	}
+	if got := shell.renderPrompt(api.WithPrompt(ctx, "{{color \"red\"}}gosh>"), true); got != "\x1b[31mgosh>" {
+		t.Errorf("expected the colors of the prompt, got %q", got)
+	}
+	if got := shell.renderPrompt(api.WithPrompt(ctx, "gosh>"), false); got != "gosh>" {
+		t.Errorf("expected a plain prompt without color, got %q", got)
+	}
+
+	if _, err := shell.handle(ctx, "theme neon"); err == nil {
+		t.Error("expected an error for an unknown theme")
+	}
+	if currentTheme().name != "solarized" {
+		t.Errorf("an unknown theme changed the theme to %s", currentTheme().name)
+	}
+}
@@ -0,0 +1,82 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// timeCmd runs a command line and reports how long it ran
+type timeCmd struct {
+	gosh *Goshell
+}
+
+func (c timeCmd) Name() string  { return "time" }
+func (c timeCmd) Usage() string { return "time <command> [<args>...]" }
+func (c timeCmd) LongDesc() string {
+	return `The elapsed real time, and the user and system CPU time of the shell and
+of the processes it waited for, are written to stderr once the command
+completes, whatever its status, which time returns. A command line with
+operators is quoted, as in time 'build | tee build.log'. The CPU time
+includes the work of the shell for other commands running meanwhile,
+such as background jobs.`
+}
+func (c timeCmd) ShortDesc() string { return `runs a command and reports its run time` }
+func (c timeCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	if len(args) < 2 {
+		return ctx, api.Result{}, api.NewUsageError("expected a command")
+	}
+	list, err := c.gosh.parseLine(commandLine(args[1:]))
+	if err != nil {
+		return ctx, api.Result{}, err
+	}
+	startUser, startSys := cpuTimes()
+	start := time.Now()
+	res, err := c.gosh.runApart(ctx, list)
+	elapsed := time.Since(start)
+	user, sys := cpuTimes()
+	printTimes(api.GetStderr(ctx), elapsed, user-startUser, sys-startSys)
+	return ctx, rendered(res), err
+}
+
+// Complete completes the command run by time
+func (c timeCmd) Complete(ctx context.Context, args []string, cursorPos int) []string {
+	if cursorPos < 1 {
+		return nil
+	}
+	return c.gosh.complete(ctx, args[1:cursorPos+1])
+}
+
+// printTimes writes times in the format of the time keyword of bash
+func printTimes(w io.Writer, elapsed, user, sys time.Duration) {
+	for _, t := range []struct {
+		name string
+		d    time.Duration
+	}{{"real", elapsed}, {"user", user}, {"sys", sys}} {
+		minutes := int(t.d / time.Minute)
+		seconds := (t.d % time.Minute).Seconds()
+		fmt.Fprintf(w, "%s\t%dm%.3fs\n", t.name, minutes, seconds)
+	}
+}
+
+// reportSlow reports the pipelines that ran for the slow-command
+// setting or longer on stderr
+func (gosh *Goshell) reportSlow(ctx context.Context, stages []pipeStage, elapsed time.Duration) {
+	if gosh.slowCommand <= 0 || elapsed < gosh.slowCommand {
+		return
+	}
+	var cmds []string
+	for _, stage := range stages {
+		if stage.cmd.Name() != "" {
+			cmds = append(cmds, strings.Join(stage.args, " "))
+		}
+	}
+	if len(cmds) == 0 {
+		return
+	}
+	fmt.Fprintf(api.GetStderr(ctx), "%s: took %v\n", strings.Join(cmds, " | "), elapsed.Round(time.Millisecond))
+}
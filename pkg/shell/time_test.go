@@ -0,0 +1,63 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestPrintTimes(t *testing.T) {
+	var out bytes.Buffer
+	printTimes(&out, 61500*time.Millisecond, 20*time.Millisecond, 0)
+	if out.String() != "real\t1m1.500s\nuser\t0m0.020s\nsys\t0m0.000s\n" {
+		t.Errorf("unexpected times %q", out.String())
+	}
+}
+
+func TestShellTime(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	shell.Register("nap", rpcTestCmd{"nap", func(ctx context.Context, args []string) error {
+		time.Sleep(30 * time.Millisecond)
+		if len(args) > 1 {
+			return fmt.Errorf("woke up")
+		}
+		return nil
+	}})
+	if err := shell.Init(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	var errOut bytes.Buffer
+	ctx := api.WithStderr(shell.ctx, &errOut)
+	_, err := shell.handle(ctx, "time 'nap && nap early'")
+	if err == nil || err.Error() != "woke up" {
+		t.Errorf("expected the error of the command, got %v", err)
+	}
+	if !regexp.MustCompile(`^real\t0m\d\.\d{3}s\nuser\t0m\d\.\d{3}s\nsys\t0m\d\.\d{3}s\n$`).MatchString(errOut.String()) {
+		t.Errorf("unexpected times %q", errOut.String())
+	}
+
+	var out bytes.Buffer
+	if _, err := shell.handle(api.WithStdout(ctx, &out), "time set output"); err != nil || out.String() != "output:  text\n" {
+		t.Errorf("expected the setting to be printed once, got %q, %v", out.String(), err)
+	}
+
+	errOut.Reset()
+	if _, err := shell.handle(ctx, "set slow-command 20ms; nap; set output; nap"); err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^(nap: took \d+ms\n){2}$`).MatchString(errOut.String()) {
+		t.Errorf("expected the slow commands reported, got %q", errOut.String())
+	}
+	if _, err := shell.handle(shell.ctx, "set slow-command soon"); err == nil {
+		t.Error("an invalid threshold should fail")
+	}
+}
@@ -0,0 +1,99 @@
+package shell
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// timeoutStatus is the exit status of a command that timed out
+const timeoutStatus = 124
+
+// timeoutError is the error of a command cancelled at its deadline
+type timeoutError struct {
+	timeout time.Duration
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("timed out after %v", e.timeout)
+}
+
+// ExitCode returns 124, the status of timeout(1) for a command that
+// timed out
+func (e *timeoutError) ExitCode() int { return timeoutStatus }
+
+// runWithTimeout calls run with a context cancelled after timeout, if
+// it is not 0, and returns a timeout error when run failed or returned
+// after the deadline. The returned context keeps the values set by run
+// but is cancelled along with ctx.
+func runWithTimeout(ctx context.Context, timeout time.Duration, run func(context.Context) (context.Context, api.Result, error)) (context.Context, api.Result, error) {
+	if timeout <= 0 {
+		return run(ctx)
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	newCtx, res, err := run(timeoutCtx)
+	if newCtx == timeoutCtx {
+		newCtx = ctx
+	} else {
+		newCtx = detach(ctx, newCtx)
+	}
+	if errors.Is(timeoutCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		return newCtx, api.Result{Code: timeoutStatus}, &timeoutError{timeout: timeout}
+	}
+	return newCtx, res, err
+}
+
+// parseTimeout parses a duration such as 1m30s, or a number of seconds
+func parseTimeout(s string) (time.Duration, error) {
+	if secs, err := strconv.ParseFloat(s, 64); err == nil && secs >= 0 {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid timeout %q", s)
+	}
+	return d, nil
+}
+
+// timeoutCmd runs a command with a deadline
+type timeoutCmd struct {
+	gosh *Goshell
+}
+
+func (c timeoutCmd) Name() string  { return "timeout" }
+func (c timeoutCmd) Usage() string { return "timeout <duration> <command> [<args>...]" }
+func (c timeoutCmd) LongDesc() string {
+	return `The duration is a number of seconds or a Go duration such as 1m30s.
+The command is cancelled when it has not completed in time, and timeout
+fails with status 124. Commands end at the deadline only if they honor
+the cancellation of their context.`
+}
+func (c timeoutCmd) ShortDesc() string { return `runs a command with a time limit` }
+func (c timeoutCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	if len(args) < 3 {
+		return ctx, api.Result{}, api.NewUsageError("expected a duration and a command")
+	}
+	timeout, err := parseTimeout(args[1])
+	if err != nil {
+		return ctx, api.Result{}, api.NewUsageError("%v", err)
+	}
+	stage, err := c.gosh.commandStage(ctx, args[2:])
+	if err != nil {
+		return ctx, api.Result{}, err
+	}
+	newCtx, res, err := runWithTimeout(ctx, timeout, stage.exec)
+	return newCtx, rendered(res), err
+}
+
+// Complete completes the command and arguments run by timeout
+func (c timeoutCmd) Complete(ctx context.Context, args []string, cursorPos int) []string {
+	if cursorPos < 2 {
+		return nil
+	}
+	return c.gosh.complete(ctx, args[2:cursorPos+1])
+}
@@ -0,0 +1,78 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+	"github.com/vladimirvivien/gosh/api/output"
+)
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		s       string
+		timeout time.Duration
+		valid   bool
+	}{
+		{"10", 10 * time.Second, true},
+		{"0.5", 500 * time.Millisecond, true},
+		{"1m30s", 90 * time.Second, true},
+		{"0", 0, true},
+		{"-1s", 0, false},
+		{"soon", 0, false},
+	}
+	for _, test := range tests {
+		timeout, err := parseTimeout(test.s)
+		if (err == nil) != test.valid || timeout != test.timeout {
+			t.Errorf("parseTimeout(%q) = %v, %v", test.s, timeout, err)
+		}
+	}
+}
+
+func TestShellTimeout(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	shell.Register("wait", rpcTestCmd{"wait", func(ctx context.Context, args []string) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	}})
+	if err := shell.Init(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err := shell.Eval(shell.ctx, "timeout 0.05 wait")
+	if api.ExitStatus(err) != timeoutStatus || err.Error() != "timed out after 50ms" {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("the command should have been cancelled at its deadline")
+	}
+
+	ctx, err := shell.handle(shell.ctx, "timeout 1 set output json")
+	if err != nil || output.GetFormat(ctx) != output.JSON || ctx.Err() != nil {
+		t.Errorf("the values set under timeout should be kept: %v", err)
+	}
+
+	if _, err := shell.Eval(shell.ctx, "set command-timeout 50ms; wait"); api.ExitStatus(err) != timeoutStatus {
+		t.Errorf("expected the command timeout to apply, got %v", err)
+	}
+	if shell.commandTimeout != 50*time.Millisecond {
+		t.Errorf("unexpected command timeout %v", shell.commandTimeout)
+	}
+	var out bytes.Buffer
+	if _, err := shell.Eval(api.WithStdout(shell.ctx, &out), "set command-timeout 0; timeout 0.05 set output"); err != nil {
+		t.Error(err)
+	}
+	if out.String() != "output:  text\n" {
+		t.Errorf("expected the setting to be printed once, got %q", out.String())
+	}
+}
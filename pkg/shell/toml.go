@@ -0,0 +1,149 @@
+package shell
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// parseTOML parses the subset of TOML used by the shell configuration:
+// tables, key/value pairs with string, integer, boolean and array
+// values, and comments. Keys of a table are stored in a nested map.
+func parseTOML(r io.Reader) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	table := root
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		// arrays may span several lines
+		for strings.Count(stripComment(line), "[")-strings.Count(stripComment(line), "]") > 0 &&
+			strings.Contains(line, "=") && scanner.Scan() {
+			lineNum++
+			line = stripComment(line) + " " + strings.TrimSpace(scanner.Text())
+		}
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: invalid table header", lineNum)
+			}
+			table = root
+			for _, name := range strings.Split(line[1:len(line)-1], ".") {
+				name = unquoteKey(strings.TrimSpace(name))
+				sub, ok := table[name].(map[string]interface{})
+				if !ok {
+					sub = make(map[string]interface{})
+					table[name] = sub
+				}
+				table = sub
+			}
+			continue
+		}
+
+		i := strings.Index(line, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", lineNum)
+		}
+		key := unquoteKey(strings.TrimSpace(line[:i]))
+		val, err := parseTOMLValue(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+		table[key] = val
+	}
+	return root, scanner.Err()
+}
+
+func parseTOMLValue(s string) (interface{}, error) {
+	switch {
+	case s == "":
+		return nil, fmt.Errorf("missing value")
+	case s == "true":
+		return true, nil
+	case s == "false":
+		return false, nil
+	case s[0] == '"':
+		return strconv.Unquote(s)
+	case s[0] == '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return nil, fmt.Errorf("unterminated string %s", s)
+		}
+		return s[1 : len(s)-1], nil
+	case s[0] == '[':
+		if s[len(s)-1] != ']' {
+			return nil, fmt.Errorf("unterminated array %s", s)
+		}
+		var vals []interface{}
+		for _, item := range splitTOMLArray(s[1 : len(s)-1]) {
+			val, err := parseTOMLValue(item)
+			if err != nil {
+				return nil, err
+			}
+			vals = append(vals, val)
+		}
+		return vals, nil
+	}
+	n, err := strconv.ParseInt(strings.Replace(s, "_", "", -1), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value %s", s)
+	}
+	return n, nil
+}
+
+// splitTOMLArray splits the items of an array on commas outside strings
+func splitTOMLArray(s string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		items = append(items, last)
+	}
+	return items
+}
+
+// stripComment removes a # comment that is not inside a string
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquoteKey(key string) string {
+	if len(key) >= 2 && (key[0] == '"' || key[0] == '\'') && key[len(key)-1] == key[0] {
+		return key[1 : len(key)-1]
+	}
+	return key
+}
@@ -0,0 +1,96 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// traceStages writes to stderr, when the xtrace setting is on, the
+// expanded command line of each stage of a pipeline about to run and
+// where its command comes from
+func (gosh *Goshell) traceStages(ctx context.Context, stages []pipeStage) {
+	if !gosh.xtrace {
+		return
+	}
+	var b strings.Builder
+	for _, stage := range stages {
+		var words []string
+		for _, a := range stage.assigns {
+			words = append(words, a.name+"="+quoteWord(a.value))
+		}
+		if assigns, ok := stage.cmd.(assignCmd); ok {
+			for _, a := range assigns {
+				words = append(words, a.name+"="+quoteWord(a.value))
+			}
+		}
+		if stage.cmd.Name() != "" {
+			for _, arg := range stage.args {
+				words = append(words, quoteWord(arg))
+			}
+		}
+		for _, r := range stage.redirs {
+			if r.op == "<<" || r.op == "<<<" {
+				words = append(words, r.op+" ...")
+				continue
+			}
+			words = append(words, r.op+quoteWord(r.target))
+		}
+		if len(words) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "+ %s", strings.Join(words, " "))
+		if stage.origin != "" {
+			fmt.Fprintf(&b, "  # %s", stage.origin)
+		}
+		b.WriteByte('\n')
+	}
+	fmt.Fprint(api.GetStderr(ctx), b.String())
+}
+
+// traceResult writes to stderr, when the xtrace setting is on, the exit
+// status of a pipeline and how long it ran
+func (gosh *Goshell) traceResult(ctx context.Context, stages []pipeStage, res api.Result, err error, elapsed time.Duration) {
+	if !gosh.xtrace || stages[len(stages)-1].cmd.Name() == "" {
+		return
+	}
+	fmt.Fprintf(api.GetStderr(ctx), "+ %s: status %d in %v\n",
+		stages[len(stages)-1].args[0], api.Status(res, err), elapsed.Round(time.Microsecond))
+}
+
+// origin describes where the command of a stage comes from: a builtin,
+// a plugin, a shell function, a registered command or an executable
+func (gosh *Goshell) origin(stage pipeStage) string {
+	switch cmd := stage.cmd.(type) {
+	case *externalCmd:
+		return "external " + cmd.path
+	case funcCmd:
+		return "function"
+	}
+	if i := strings.LastIndex(stage.args[0], ":"); i > 0 {
+		if group := stage.args[0][:i]; group != builtinsGroup {
+			return "plugin " + group
+		}
+		return "builtin"
+	}
+	group, ok := gosh.commands.group(stage.args[0])
+	switch {
+	case !ok:
+		return "registered"
+	case group == builtinsGroup:
+		return "builtin"
+	}
+	return "plugin " + group
+}
+
+// quoteWord quotes arg when the lexer would not read it back as a
+// single word
+func quoteWord(arg string) string {
+	if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`|&;<>()*?[]{}#~") {
+		return shellQuote(arg)
+	}
+	return arg
+}
@@ -0,0 +1,43 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestShellTrace(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	shell.Register("fail", rpcTestCmd{"fail", func(ctx context.Context, args []string) error {
+		return api.NewExitError(3, nil)
+	}})
+	ctx := api.WithStdout(context.Background(), &stdout)
+	ctx = api.WithStderr(ctx, &stderr)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	script := "echo untraced\nset -x\nNAME=\"a b\"\nexport GREETING=$NAME > /dev/null\nfail\nset +x\necho done\n"
+	shell.RunScript(bytes.NewBufferString(script), "test.gsh", false)
+	if stdout.String() != "untraced\ndone\n" {
+		t.Errorf("unexpected output: %q", stdout.String())
+	}
+	expected := regexp.MustCompile(`^\+ set: status 0 in \S+\n` +
+		`\+ NAME='a b'\n` +
+		`\+ export 'GREETING=a b' >/dev/null  # builtin\n` +
+		`\+ export: status 0 in \S+\n` +
+		`\+ fail  # registered\n` +
+		`\+ fail: status 3 in \S+\n` +
+		`test.gsh:5: exit status 3\n` +
+		`\+ set \+x  # builtin\n$`)
+	if !expected.MatchString(stderr.String()) {
+		t.Errorf("unexpected trace: %q", stderr.String())
+	}
+}
@@ -0,0 +1,174 @@
+package shell
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// TranscriptExt is the extension of the golden transcript of a script,
+// which replaces the extension of the script
+const TranscriptExt = ".golden"
+
+// Transcript runs the statements of script in a new session of the
+// shell as if they were typed at its prompt, and returns the transcript
+// of the session: each prompt followed by the line typed, then what the
+// commands wrote to stdout and stderr. Commands reading their input,
+// such as the questions of api.Confirm, read the lines of script that
+// follow their statement. The session starts in dir with the default
+// prompt, and without history, aliases or startup files, so that the
+// transcript only depends on the script and the commands of the shell.
+func (gosh *Goshell) Transcript(ctx context.Context, script io.Reader, dir string) (string, error) {
+	var out bytes.Buffer
+	in := bufio.NewReader(script)
+	ctx = api.WithStdin(ctx, in)
+	ctx = api.WithStdout(ctx, &out)
+	ctx = api.WithStderr(ctx, &out)
+	ctx = api.WithPrompt(ctx, api.DefaultPrompt)
+	ctx = api.WithWorkDir(ctx, dir)
+
+	sh := gosh.NewSession()
+	sh.history = newHistory("", historyMaxSize)
+	sh.aliases = newAliasTable("")
+	sh.rcFiles = nil
+	if err := sh.Init(ctx); err != nil {
+		return out.String(), err
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), sessionCloseTimeout)
+		defer cancel()
+		sh.Close(closeCtx)
+	}()
+
+	loopCtx := sh.ctx
+	for {
+		if err := ctx.Err(); err != nil {
+			return out.String(), err
+		}
+		stmt, err := readTranscriptLine(in, &out, sh.renderPrompt(loopCtx, false))
+		if err == io.EOF {
+			return out.String(), nil
+		}
+		if err != nil {
+			return out.String(), err
+		}
+		for incomplete(stmt) {
+			line, err := readTranscriptLine(in, &out, continuationPrompt)
+			if err != nil {
+				break
+			}
+			stmt = continueLine(stmt, line)
+		}
+
+		loopCtx, err = sh.exec(loopCtx, stmt)
+		if err == errExit {
+			return out.String(), nil
+		}
+		if err != nil {
+			sh.printErr(loopCtx, err)
+		}
+	}
+}
+
+// readTranscriptLine reads a line of a script and writes it to out after
+// prompt, as it shows on a terminal once typed
+func readTranscriptLine(r *bufio.Reader, out io.Writer, prompt string) (string, error) {
+	line, err := r.ReadString('\n')
+	if line == "" && err != nil {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	fmt.Fprintf(out, "%s %s\n", prompt, line)
+	return line, nil
+}
+
+// CheckTranscript runs the script at path with Transcript, from the
+// directory of the script, and compares the transcript with the golden
+// one in the file of the same name with the .golden extension. It
+// returns a diff of the golden and actual transcripts, empty when they
+// match. When update is set, the golden file is written instead.
+func (gosh *Goshell) CheckTranscript(ctx context.Context, path string, update bool) (string, error) {
+	script, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer script.Close()
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	actual, err := gosh.Transcript(ctx, script, dir)
+	if err != nil {
+		return "", err
+	}
+
+	golden := strings.TrimSuffix(path, filepath.Ext(path)) + TranscriptExt
+	if update {
+		return "", os.WriteFile(golden, []byte(actual), 0644)
+	}
+	expected, err := os.ReadFile(golden)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("%s has no golden transcript %s, write it with --update", path, golden)
+	}
+	if err != nil {
+		return "", err
+	}
+	return diffLines(string(expected), actual), nil
+}
+
+// diffLines returns the lines of a and b, the lines only in a prefixed
+// with a -, the ones only in b with a +, or "" when a and b are equal
+func diffLines(a, b string) string {
+	if a == b {
+		return ""
+	}
+	x, y := strings.SplitAfter(a, "\n"), strings.SplitAfter(b, "\n")
+
+	// common[i][j] is the length of the longest common subsequence
+	// of x[i:] and y[j:]
+	common := make([][]int, len(x)+1)
+	for i := range common {
+		common[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			switch {
+			case x[i] == y[j]:
+				common[i][j] = common[i+1][j+1] + 1
+			case common[i+1][j] >= common[i][j+1]:
+				common[i][j] = common[i+1][j]
+			default:
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	var diff strings.Builder
+	line := func(prefix, text string) {
+		if text != "" {
+			diff.WriteString(prefix + strings.TrimSuffix(text, "\n") + "\n")
+		}
+	}
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			line("  ", x[i])
+			i, j = i+1, j+1
+		case i < len(x) && (j == len(y) || common[i+1][j] >= common[i][j+1]):
+			line("- ", x[i])
+			i++
+		default:
+			line("+ ", y[j])
+			j++
+		}
+	}
+	return diff.String()
+}
@@ -0,0 +1,52 @@
+package shell
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+var updateGolden = flag.Bool("update", false, "write the golden transcripts of testdata/transcripts")
+
+func TestTranscripts(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.RegisterCommand(
+		rpcTestCmd{"say", func(ctx context.Context, args []string) error {
+			fmt.Fprintln(api.GetStdout(ctx), strings.Join(args[1:], " "))
+			return nil
+		}},
+		rpcTestCmd{"ask", func(ctx context.Context, args []string) error {
+			yes, err := api.Confirm(ctx, args[1])
+			fmt.Fprintln(api.GetStdout(ctx), "answered", yes)
+			return err
+		}},
+	)
+
+	scripts, _ := filepath.Glob("testdata/transcripts/*.gosh")
+	if len(scripts) == 0 {
+		t.Fatal("no scripts in testdata/transcripts")
+	}
+	for _, script := range scripts {
+		diff, err := shell.CheckTranscript(context.Background(), script, *updateGolden)
+		if err != nil {
+			t.Errorf("%s: %v", script, err)
+		} else if diff != "" {
+			t.Errorf("%s: unexpected transcript:\n%s", script, diff)
+		}
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	if diff := diffLines("a\nb\n", "a\nb\n"); diff != "" {
+		t.Errorf("expected no diff, got %q", diff)
+	}
+	expected := "  a\n- b\n+ B\n  c\n+ d\n"
+	if diff := diffLines("a\nb\nc\n", "a\nB\nc\nd\n"); diff != expected {
+		t.Errorf("expected %q, got %q", expected, diff)
+	}
+}
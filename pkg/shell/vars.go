@@ -0,0 +1,127 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vladimirvivien/gosh/api"
+	"github.com/vladimirvivien/gosh/api/output"
+)
+
+// assignment is a name=value word
+type assignment struct {
+	name  string
+	value string
+}
+
+// splitAssignment splits a word of the form name=value, where name is
+// unquoted, into the name and the word of its value
+func splitAssignment(w word) (string, word, bool) {
+	if len(w) == 0 || w[0].quote != unquoted || w[0].subst {
+		return "", nil, false
+	}
+	text := w[0].text
+	i := 0
+	for i < len(text) && isNameChar(text[i], i == 0) {
+		i++
+	}
+	if i == 0 || i >= len(text) || text[i] != '=' {
+		return "", nil, false
+	}
+	var value word
+	if rest := text[i+1:]; rest != "" {
+		value = word{{text: rest, quote: unquoted}}
+	}
+	value = append(value, w[1:]...)
+	if len(value) == 0 {
+		value = word{{quote: literal}}
+	}
+	return text[:i], value, true
+}
+
+// expandAssignment expands the value of an assignment as text
+func (gosh *Goshell) expandAssignment(ctx context.Context, name string, value word) (assignment, error) {
+	text, err := gosh.expandText(ctx, value)
+	if err != nil {
+		return assignment{}, err
+	}
+	return assignment{name: name, value: text}, nil
+}
+
+// withAssignments runs the stage in a copy of the environment of ctx in
+// which its assignments are exported, so that they only apply to its
+// command
+func (stage pipeStage) withAssignments(ctx context.Context) (context.Context, api.Result, error) {
+	env := api.GetEnv(ctx)
+	cmdEnv := api.NewEnv(nil)
+	if env != nil {
+		cmdEnv = env.Clone()
+	}
+	for _, a := range stage.assigns {
+		cmdEnv.Set(a.name, a.value)
+	}
+	stage.assigns = nil
+	newCtx, res, err := stage.exec(api.WithEnv(ctx, cmdEnv))
+	if api.GetEnv(newCtx) == cmdEnv {
+		newCtx = api.WithEnv(newCtx, env)
+	}
+	return newCtx, res, err
+}
+
+// assignCmd runs a command line made of assignments alone, which set
+// shell variables
+type assignCmd []assignment
+
+func (c assignCmd) Name() string      { return "" }
+func (c assignCmd) Usage() string     { return "name=value ..." }
+func (c assignCmd) LongDesc() string  { return "" }
+func (c assignCmd) ShortDesc() string { return `sets shell variables` }
+func (c assignCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	env := api.GetEnv(ctx)
+	if env == nil {
+		return ctx, api.Result{}, fmt.Errorf("no shell environment")
+	}
+	for _, a := range c {
+		env.Assign(a.name, a.value)
+	}
+	return ctx, api.Result{}, nil
+}
+
+// varsCmd lists the variables of the shell with their scope
+type varsCmd string
+
+func (c varsCmd) Name() string  { return string(c) }
+func (c varsCmd) Usage() string { return "vars [name ...]" }
+func (c varsCmd) LongDesc() string {
+	return `name=value sets a shell variable, which commands of the session see as $name
+but external processes do not, unless it is exported with export name.
+A variable that is exported stays exported when it is assigned again.
+Assignments before a command, as in DEBUG=1 deploy, export the
+variables to that command alone.`
+}
+func (c varsCmd) ShortDesc() string {
+	return `lists the shell variables, exported or not, or the given ones`
+}
+func (c varsCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	env := api.GetEnv(ctx)
+	if env == nil {
+		return ctx, api.Result{}, fmt.Errorf("no shell environment")
+	}
+	names := args[1:]
+	if len(names) == 0 {
+		names = env.Names()
+	}
+	table := output.NewTable("NAME", "SCOPE", "VALUE")
+	for _, name := range names {
+		value, ok := env.Get(name)
+		if !ok {
+			return ctx, api.Result{}, fmt.Errorf("vars: %s not set", name)
+		}
+		scope := "shell"
+		if env.Exported(name) {
+			scope = "exported"
+		}
+		table.AddRow(name, scope, value)
+	}
+	return ctx, api.Result{Data: table}, nil
+}
@@ -0,0 +1,71 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestShellVariables(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	shell.env = api.NewEnv([]string{"HOME=/home/me", "PATH=/bin"})
+	var args, environ []string
+	shell.RegisterCommand(
+		rpcTestCmd{"args", func(ctx context.Context, a []string) error {
+			args, environ = a[1:], api.GetEnv(ctx).Environ()
+			return nil
+		}},
+		rpcTestCmd{"say", func(ctx context.Context, a []string) error {
+			fmt.Fprintln(api.GetStdout(ctx), strings.Join(a[1:], " "))
+			return nil
+		}},
+	)
+	if err := shell.Init(api.WithStderr(context.TODO(), ioutil.Discard)); err != nil {
+		t.Fatal(err)
+	}
+	shell.env.Unset("PWD")
+
+	tests := []struct {
+		line    string
+		args    []string
+		environ []string
+	}{
+		{`GREETING=hello; args $GREETING`, []string{"hello"}, []string{"HOME=/home/me", "PATH=/bin"}},
+		{`MSG="a  b" OUT=$(say x  y) DIR=~/src; args "$MSG" "$OUT" $DIR`, []string{"a  b", "x y", "/home/me/src"}, []string{"HOME=/home/me", "PATH=/bin"}},
+		{`DEBUG=1 args`, []string{}, []string{"DEBUG=1", "HOME=/home/me", "PATH=/bin"}},
+		{`export GREETING; args`, []string{}, []string{"GREETING=hello", "HOME=/home/me", "PATH=/bin"}},
+		{`GREETING=bye PATH=/usr/bin; args`, []string{}, []string{"GREETING=bye", "HOME=/home/me", "PATH=/usr/bin"}},
+		{`args x=1 'Y=2'`, []string{"x=1", "Y=2"}, []string{"GREETING=bye", "HOME=/home/me", "PATH=/usr/bin"}},
+	}
+	for _, test := range tests {
+		if _, err := shell.Eval(shell.ctx, test.line); err != nil {
+			t.Fatalf("%s: %v", test.line, err)
+		}
+		if !reflect.DeepEqual(args, test.args) || !reflect.DeepEqual(environ, test.environ) {
+			t.Errorf("%s: expected %q in %q, got %q in %q", test.line, test.args, test.environ, args, environ)
+		}
+	}
+	if _, ok := shell.env.Get("DEBUG"); ok {
+		t.Error("the assignment of a command should not outlive it")
+	}
+
+	var out bytes.Buffer
+	if _, err := shell.Eval(api.WithStdout(shell.ctx, &out), "set output text; vars MSG GREETING"); err != nil {
+		t.Fatal(err)
+	}
+	if expected := "NAME      SCOPE     VALUE\nMSG       shell     a  b\nGREETING  exported  bye\n"; out.String() != expected {
+		t.Errorf("unexpected variables: %q", out.String())
+	}
+	if _, err := shell.Eval(shell.ctx, "vars MISSING"); err == nil {
+		t.Error("expected an error for a variable that is not set")
+	}
+}
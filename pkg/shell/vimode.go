@@ -0,0 +1,395 @@
+package shell
+
+import (
+	"strings"
+	"unicode"
+)
+
+// viInsertBindings are the bindings of the insert mode of the vi
+// editing mode. Escape enters the command mode, whose keys are handled
+// by viCommand; the terminal keys such as the arrows keep their emacs
+// bindings in both modes.
+var viInsertBindings = map[string]string{
+	"\r":   "accept-line",
+	"\n":   "accept-line",
+	"\x03": "interrupt",
+	"\x04": "end-of-file",
+	"\x7f": "backward-delete-char",
+	"\x08": "backward-delete-char",
+	"\t":   "complete",
+	"\x15": "unix-line-discard",
+	"\x17": "unix-word-rubout",
+	"\x12": "reverse-search-history",
+	"\x10": "command-palette",
+	"\x1b": "vi-movement-mode",
+}
+
+func init() {
+	for seq, action := range emacsBindings {
+		if strings.HasPrefix(seq, "\x1b[") || strings.HasPrefix(seq, "\x1bO") {
+			viInsertBindings[seq] = action
+		}
+	}
+	editingModes["vi"] = viInsertBindings
+	editActions["vi-movement-mode"] = func(e *lineEditor) error {
+		e.vi.command = true
+		e.moveTo(e.pos - 1)
+		return nil
+	}
+}
+
+// viState is the state of the vi editing mode of a line editor
+type viState struct {
+	// command is set in the command mode
+	command bool
+
+	// yank holds the text of the last deletion or yank, for p and P
+	yank []rune
+
+	// undo holds the line before the last change, for u
+	undo    []rune
+	undoPos int
+}
+
+// viCommand reads and runs a command of the vi command mode: an
+// optional count, then a motion, an operator (d, c or y) followed by a
+// motion, or one of the editing commands. Operators repeated, as in dd,
+// apply to the whole line.
+func (e *lineEditor) viCommand() (err error) {
+	count, r, err := e.viReadCount()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err == nil {
+			e.viClamp()
+		}
+	}()
+	switch r {
+	case keyEnter, keyNewline:
+		return editActions["accept-line"](e)
+	case keyCtrlC:
+		return editActions["interrupt"](e)
+	case keyCtrlD:
+		return editActions["end-of-file"](e)
+	case keyEscape:
+		// the escape sequences of terminal keys run their binding
+		if e.in.Buffered() > 0 {
+			e.in.UnreadRune()
+			return e.readAction()
+		}
+	case 'i':
+		e.viInsert(e.pos)
+	case 'a':
+		e.viInsert(e.pos + 1)
+	case 'I':
+		e.viInsert(e.firstNonBlank())
+	case 'A':
+		e.viInsert(len(e.buf))
+	case 'x':
+		e.viOperate('d', e.pos, e.pos+count)
+	case 'X':
+		e.viOperate('d', e.pos-count, e.pos)
+	case 's':
+		e.viOperate('c', e.pos, e.pos+count)
+	case 'S':
+		e.viOperate('c', 0, len(e.buf))
+	case 'D':
+		e.viOperate('d', e.pos, len(e.buf))
+	case 'C':
+		e.viOperate('c', e.pos, len(e.buf))
+	case 'd', 'c', 'y':
+		return e.viOperator(r, count)
+	case 'p', 'P':
+		e.viPut(r == 'p', count)
+	case 'r':
+		c, _, err := e.in.ReadRune()
+		if err != nil {
+			return err
+		}
+		if c >= ' ' && e.pos+count <= len(e.buf) {
+			e.saveUndo()
+			for i := e.pos; i < e.pos+count; i++ {
+				e.buf[i] = c
+			}
+			e.pos += count - 1
+		}
+	case 'u':
+		if e.vi.undo == nil {
+			break
+		}
+		e.buf, e.vi.undo = e.vi.undo, append([]rune{}, e.buf...)
+		e.pos, e.vi.undoPos = e.vi.undoPos, e.pos
+	case 'k', '-':
+		for i := 0; i < count; i++ {
+			e.historyPrev()
+		}
+		e.pos = 0
+	case 'j', '+':
+		for i := 0; i < count; i++ {
+			e.historyNext()
+		}
+		e.pos = 0
+	default:
+		target, _, ok, err := e.viMotion(r, count)
+		if err != nil {
+			return err
+		}
+		if ok {
+			e.pos = target
+		}
+	}
+	return nil
+}
+
+// viReadCount reads a command with its count, 1 when it has none
+func (e *lineEditor) viReadCount() (int, rune, error) {
+	count := 0
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return 0, 0, err
+		}
+		if r < '0' || r > '9' || (r == '0' && count == 0) {
+			if count == 0 {
+				count = 1
+			}
+			return count, r, nil
+		}
+		count = count*10 + int(r-'0')
+	}
+}
+
+// viOperator reads the motion of an operator and applies the operator
+// to the text moved over
+func (e *lineEditor) viOperator(op rune, count int) error {
+	n, r, err := e.viReadCount()
+	if err != nil {
+		return err
+	}
+	count *= n
+	if r == op {
+		e.viOperate(op, 0, len(e.buf))
+		return nil
+	}
+	// cw changes the rest of the word, like ce
+	if op == 'c' && (r == 'w' || r == 'W') && e.pos < len(e.buf) && !unicode.IsSpace(e.buf[e.pos]) {
+		r = map[rune]rune{'w': 'e', 'W': 'E'}[r]
+	}
+	target, inclusive, ok, err := e.viMotion(r, count)
+	if err != nil || !ok {
+		return err
+	}
+	start, end := e.pos, target
+	if start > end {
+		start, end = end, start
+	}
+	if inclusive {
+		end++
+	}
+	e.viOperate(op, start, end)
+	return nil
+}
+
+// viOperate deletes, changes or yanks the text from start to end
+func (e *lineEditor) viOperate(op rune, start, end int) {
+	if start < 0 {
+		start = 0
+	}
+	if end > len(e.buf) {
+		end = len(e.buf)
+	}
+	if start >= end && op != 'c' {
+		return
+	}
+	e.vi.yank = append([]rune{}, e.buf[start:end]...)
+	if op == 'y' {
+		e.pos = start
+		return
+	}
+	e.saveUndo()
+	e.buf = append(e.buf[:start], e.buf[end:]...)
+	e.pos = start
+	if op == 'c' {
+		e.vi.command = false
+	}
+}
+
+// viPut inserts the yanked text count times after or before the cursor
+func (e *lineEditor) viPut(after bool, count int) {
+	if len(e.vi.yank) == 0 {
+		return
+	}
+	e.saveUndo()
+	at := e.pos
+	if after && len(e.buf) > 0 {
+		at++
+	}
+	text := []rune(strings.Repeat(string(e.vi.yank), count))
+	e.buf = append(e.buf[:at], append(text, e.buf[at:]...)...)
+	e.pos = at + len(text) - 1
+}
+
+// viInsert enters the insert mode with the cursor at pos
+func (e *lineEditor) viInsert(pos int) {
+	e.saveUndo()
+	if pos > len(e.buf) {
+		pos = len(e.buf)
+	}
+	e.pos = pos
+	e.vi.command = false
+}
+
+// viMotion returns the position count motions r away from the cursor,
+// and whether the motion includes the character at that position when
+// an operator applies to it. It reports false for keys that are not
+// motions.
+func (e *lineEditor) viMotion(r rune, count int) (int, bool, bool, error) {
+	pos := e.pos
+	inclusive := false
+	for i := 0; i < count; i++ {
+		switch r {
+		case 'h', keyBackspace, keyCtrlH:
+			if pos > 0 {
+				pos--
+			}
+		case 'l', ' ':
+			if pos < len(e.buf) {
+				pos++
+			}
+		case '0':
+			pos = 0
+		case '^':
+			pos = e.firstNonBlank()
+		case '$':
+			pos = len(e.buf)
+		case 'w', 'W':
+			pos = e.viNextWord(pos, r == 'W')
+		case 'b', 'B':
+			pos = e.viPrevWord(pos, r == 'B')
+		case 'e', 'E':
+			pos = e.viWordEnd(pos, r == 'E')
+			inclusive = true
+		case 'f', 'F', 't', 'T':
+			pos, ok, err := e.viFind(r, count)
+			return pos, r == 'f' || r == 't', ok, err
+		default:
+			return 0, false, false, nil
+		}
+	}
+	return pos, inclusive, true, nil
+}
+
+// viFind reads a character and returns the position of its count-th
+// occurrence after (f, t) or before (F, T) the cursor; t and T stop
+// next to it
+func (e *lineEditor) viFind(r rune, count int) (int, bool, error) {
+	c, _, err := e.in.ReadRune()
+	if err != nil {
+		return 0, false, err
+	}
+	step := 1
+	if r == 'F' || r == 'T' {
+		step = -1
+	}
+	for pos := e.pos + step; pos >= 0 && pos < len(e.buf); pos += step {
+		if e.buf[pos] != c {
+			continue
+		}
+		if count--; count > 0 {
+			continue
+		}
+		switch r {
+		case 't':
+			pos--
+		case 'T':
+			pos++
+		}
+		return pos, true, nil
+	}
+	return e.pos, false, nil
+}
+
+// viClass returns the class of r for word motions: blanks, word
+// characters and punctuation, the last two being one class for the
+// whitespace-separated WORDs of W, B and E
+func viClass(r rune, big bool) int {
+	switch {
+	case unicode.IsSpace(r):
+		return 0
+	case big || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+		return 1
+	}
+	return 2
+}
+
+// viNextWord returns the start of the word after pos
+func (e *lineEditor) viNextWord(pos int, big bool) int {
+	if pos < len(e.buf) {
+		c := viClass(e.buf[pos], big)
+		for pos < len(e.buf) && c != 0 && viClass(e.buf[pos], big) == c {
+			pos++
+		}
+	}
+	for pos < len(e.buf) && viClass(e.buf[pos], big) == 0 {
+		pos++
+	}
+	return pos
+}
+
+// viPrevWord returns the start of the word before pos
+func (e *lineEditor) viPrevWord(pos int, big bool) int {
+	for pos > 0 && viClass(e.buf[pos-1], big) == 0 {
+		pos--
+	}
+	if pos > 0 {
+		c := viClass(e.buf[pos-1], big)
+		for pos > 0 && viClass(e.buf[pos-1], big) == c {
+			pos--
+		}
+	}
+	return pos
+}
+
+// viWordEnd returns the end of the word after pos
+func (e *lineEditor) viWordEnd(pos int, big bool) int {
+	pos++
+	for pos < len(e.buf) && viClass(e.buf[pos], big) == 0 {
+		pos++
+	}
+	if pos >= len(e.buf) {
+		return len(e.buf) - 1
+	}
+	c := viClass(e.buf[pos], big)
+	for pos+1 < len(e.buf) && viClass(e.buf[pos+1], big) == c {
+		pos++
+	}
+	return pos
+}
+
+// firstNonBlank returns the position of the first non-blank character
+func (e *lineEditor) firstNonBlank() int {
+	pos := 0
+	for pos < len(e.buf) && unicode.IsSpace(e.buf[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// saveUndo records the line before a change
+func (e *lineEditor) saveUndo() {
+	e.vi.undo = append([]rune{}, e.buf...)
+	e.vi.undoPos = e.pos
+}
+
+// viClamp keeps the cursor on a character in the command mode, then
+// redraws the line
+func (e *lineEditor) viClamp() {
+	if e.vi.command && e.pos >= len(e.buf) {
+		e.pos = len(e.buf) - 1
+	}
+	if e.pos < 0 {
+		e.pos = 0
+	}
+	e.refresh()
+}
@@ -0,0 +1,45 @@
+package shell
+
+import (
+	"bufio"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestLineEditorViMode(t *testing.T) {
+	hist := newHistory("", 10)
+	hist.add("deploy prod")
+	tests := []struct {
+		name  string
+		input string
+		line  string
+	}{
+		{"insert", "hello\r", "hello"},
+		{"motions", "hello world\x1b0iX\x1b$aY\r", "Xhello worldY"},
+		{"change line", "junk\x1bccgood\r", "good"},
+		{"delete line", "junk\x1bdd\r", ""},
+		{"delete word", "hello bad world\x1b0wdw\r", "hello world"},
+		{"change word", "hello bad world\x1bbbcwgood\r", "hello good world"},
+		{"counts", "one two three four\x1b02dwx\r", "hree four"},
+		{"delete to end", "hello world\x1bbD\r", "hello "},
+		{"find", "a-b-c-d\x1b02f-x\r", "a-bc-d"},
+		{"change till", "key=value\x1b0ct=name\r", "name=value"},
+		{"replace", "hxllo\x1b0lre\r", "hello"},
+		{"yank put", "ab\x1b0ylp\r", "aab"},
+		{"undo", "hello\x1bddu\r", "hello"},
+		{"history", "draft\x1bk\r", "deploy prod"},
+		{"arrow keys", "hllo\x1b[D\x1b[D\x1b[De\r", "hello"},
+	}
+	for _, test := range tests {
+		keys, _ := newKeymap("vi")
+		in := bufio.NewReader(strings.NewReader(test.input))
+		line, err := newLineEditor(in, ioutil.Discard, ">", keys, hist, nil).readLine()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if line != test.line+"\n" {
+			t.Errorf("%s: expected %q, got %q", test.name, test.line, line)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package shell
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/tetratelabs/wazero"
+	wapi "github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+	"github.com/vladimirvivien/gosh/api"
+)
+
+const (
+	// wasmPattern matches WebAssembly plugins
+	wasmPattern = `_command\.wasm$`
+
+	// wasmHostModule is the module name of the host functions
+	wasmHostModule = "gosh"
+)
+
+// wasmPlugin is a command compiled to a WASI command module. The command
+// is named after the file (greet_command.wasm provides "greet") and runs
+// in a sandbox: it has no access to the file system or network, only to
+// its arguments, the environment and the host functions of the "gosh"
+// module. Its usage and descriptions are read from the custom sections
+// gosh.usage, gosh.short_desc and gosh.long_desc, if present. The read
+// and write paths of its manifest are mounted at the same paths; WASI
+// gives it no network or exec capability to grant.
+type wasmPlugin struct {
+	runtime  wazero.Runtime
+	registry map[string]api.Command
+}
+
+// wasmCall holds the context of a running WebAssembly command, which the
+// host functions read and update
+type wasmCall struct {
+	ctx context.Context
+}
+
+type wasmCallKey struct{}
+
+var (
+	wasmCacheOnce sync.Once
+	wasmCache     wazero.CompilationCache
+)
+
+// wasmCompilationCache returns the cache of compiled modules shared by
+// the plugins, kept in the user cache directory so that large modules
+// are not compiled again every time the shell starts
+func wasmCompilationCache() wazero.CompilationCache {
+	wasmCacheOnce.Do(func() {
+		if dir, err := os.UserCacheDir(); err == nil {
+			cache, err := wazero.NewCompilationCacheWithDir(filepath.Join(dir, "gosh", "wasm"))
+			if err == nil {
+				wasmCache = cache
+				return
+			}
+		}
+		wasmCache = wazero.NewCompilationCache()
+	})
+	return wasmCache
+}
+
+// openWasmPlugin compiles the WebAssembly module at path, which can
+// access the directories of caps
+func openWasmPlugin(path string, caps *pluginCapabilities) (*wasmPlugin, error) {
+	code, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCloseOnContextDone(true).
+		WithCustomSections(true).
+		WithCompilationCache(wasmCompilationCache()))
+	if err := instantiateWasmHost(ctx, runtime); err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+	compiled, err := runtime.CompileModule(ctx, code)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), "_command.wasm")
+	cmd := &wasmCmd{
+		name:      name,
+		usage:     name,
+		shortDesc: fmt.Sprintf("runs WebAssembly module %s", filepath.Base(path)),
+		runtime:   runtime,
+		module:    compiled,
+		fs:        wasmFSConfig(caps),
+	}
+	for _, section := range compiled.CustomSections() {
+		switch section.Name() {
+		case "gosh.usage":
+			cmd.usage = string(section.Data())
+		case "gosh.short_desc":
+			cmd.shortDesc = string(section.Data())
+		case "gosh.long_desc":
+			cmd.longDesc = string(section.Data())
+		}
+	}
+	return &wasmPlugin{
+		runtime:  runtime,
+		registry: map[string]api.Command{name: cmd},
+	}, nil
+}
+
+// wasmFSConfig mounts the read paths of caps read-only and its write
+// paths read-write
+func wasmFSConfig(caps *pluginCapabilities) wazero.FSConfig {
+	config := wazero.NewFSConfig()
+	if caps == nil {
+		return config
+	}
+	writable := make(map[string]bool)
+	for _, p := range caps.Write {
+		config = config.WithDirMount(p, p)
+		writable[p] = true
+	}
+	for _, p := range caps.Read {
+		if !writable[p] {
+			config = config.WithReadOnlyDirMount(p, p)
+		}
+	}
+	return config
+}
+
+// instantiateWasmHost provides WASI and the gosh host functions to the
+// modules of the runtime:
+//
+//	write_stdout(ptr, len i32) i32    writes to the command's stdout
+//	write_stderr(ptr, len i32) i32    writes to the command's stderr
+//	prompt(ptr, cap i32) i32          copies the shell prompt to memory
+//	                                  and returns its length
+//	set_prompt(ptr, len i32)          sets the shell prompt
+//
+// write_stdout and write_stderr return the number of bytes written, or
+// -1 on error.
+func instantiateWasmHost(ctx context.Context, runtime wazero.Runtime) error {
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		return err
+	}
+	_, err := runtime.NewHostModuleBuilder(wasmHostModule).
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, mod wapi.Module, ptr, size uint32) int32 {
+		return wasmWrite(mod, ptr, size, api.GetStdout(wasmContext(ctx)))
+	}).Export("write_stdout").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, mod wapi.Module, ptr, size uint32) int32 {
+		return wasmWrite(mod, ptr, size, api.GetStderr(wasmContext(ctx)))
+	}).Export("write_stderr").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, mod wapi.Module, ptr, size uint32) uint32 {
+		prompt := api.GetPrompt(wasmContext(ctx))
+		if uint32(len(prompt)) < size {
+			size = uint32(len(prompt))
+		}
+		mod.Memory().Write(ptr, []byte(prompt[:size]))
+		return uint32(len(prompt))
+	}).Export("prompt").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, mod wapi.Module, ptr, size uint32) {
+		call, ok := ctx.Value(wasmCallKey{}).(*wasmCall)
+		if !ok {
+			return
+		}
+		if prompt, ok := mod.Memory().Read(ptr, size); ok {
+			call.ctx = api.WithPrompt(call.ctx, string(prompt))
+		}
+	}).Export("set_prompt").
+		Instantiate(ctx)
+	return err
+}
+
+// wasmContext returns the shell context of the running command
+func wasmContext(ctx context.Context) context.Context {
+	if call, ok := ctx.Value(wasmCallKey{}).(*wasmCall); ok {
+		return call.ctx
+	}
+	return ctx
+}
+
+func wasmWrite(mod wapi.Module, ptr, size uint32, w io.Writer) int32 {
+	data, ok := mod.Memory().Read(ptr, size)
+	if !ok {
+		return -1
+	}
+	n, err := w.Write(data)
+	if err != nil {
+		return -1
+	}
+	return int32(n)
+}
+
+// Init does nothing; the module is compiled when the plugin is opened
+func (p *wasmPlugin) Init(ctx context.Context) error { return nil }
+
+func (p *wasmPlugin) Registry() map[string]api.Command { return p.registry }
+
+// Close releases the compiled module
+func (p *wasmPlugin) Close(ctx context.Context) error {
+	return p.runtime.Close(ctx)
+}
+
+// wasmCmd runs a WebAssembly module as a command
+type wasmCmd struct {
+	name      string
+	usage     string
+	shortDesc string
+	longDesc  string
+	runtime   wazero.Runtime
+	module    wazero.CompiledModule
+	fs        wazero.FSConfig
+}
+
+func (c *wasmCmd) Name() string      { return c.name }
+func (c *wasmCmd) Usage() string     { return c.usage }
+func (c *wasmCmd) ShortDesc() string { return c.shortDesc }
+func (c *wasmCmd) LongDesc() string  { return c.longDesc }
+
+// Exec instantiates the module, which runs its _start function with the
+// command arguments, environment and standard streams
+func (c *wasmCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(args...).
+		WithStdin(api.GetStdin(ctx)).
+		WithStdout(api.GetStdout(ctx)).
+		WithStderr(api.GetStderr(ctx)).
+		WithFSConfig(c.fs).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithSysNanosleep().
+		WithRandSource(rand.Reader)
+	if env := api.GetEnv(ctx); env != nil {
+		for _, kv := range env.Environ() {
+			if i := strings.Index(kv, "="); i > 0 {
+				config = config.WithEnv(kv[:i], kv[i+1:])
+			}
+		}
+	}
+
+	call := &wasmCall{ctx: ctx}
+	mod, err := c.runtime.InstantiateModule(context.WithValue(ctx, wasmCallKey{}, call), c.module, config)
+	if mod != nil {
+		mod.Close(ctx)
+	}
+	var exitErr *sys.ExitError
+	if errors.As(err, &exitErr) {
+		switch code := exitErr.ExitCode(); code {
+		case 0:
+			err = nil
+		case sys.ExitCodeContextCanceled, sys.ExitCodeDeadlineExceeded:
+			err = ctx.Err()
+		default:
+			return call.ctx, api.Result{Code: int(code)}, nil
+		}
+	}
+	return call.ctx, api.Result{}, err
+}
@@ -0,0 +1,88 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// wasmSection encodes a module section; every test section is shorter
+// than 128 bytes, so sizes fit in one LEB128 byte
+func wasmSection(id byte, content ...[]byte) []byte {
+	body := bytes.Join(content, nil)
+	return append([]byte{id, byte(len(body))}, body...)
+}
+
+func wasmName(name string) []byte {
+	return append([]byte{byte(len(name))}, name...)
+}
+
+// testWasmModule returns a module whose _start function writes the
+// prompt to stdout and sets the prompt to "new>"
+func testWasmModule() []byte {
+	module := []byte("\x00asm\x01\x00\x00\x00")
+	module = append(module, wasmSection(0, wasmName("gosh.short_desc"), []byte("prints the prompt"))...)
+	module = append(module, wasmSection(1, []byte{0x03,
+		0x60, 0x02, 0x7f, 0x7f, 0x01, 0x7f, // (i32, i32) -> i32
+		0x60, 0x02, 0x7f, 0x7f, 0x00, // (i32, i32) -> ()
+		0x60, 0x00, 0x00, // () -> ()
+	})...)
+	module = append(module, wasmSection(2, []byte{0x03},
+		wasmName("gosh"), wasmName("prompt"), []byte{0x00, 0x00},
+		wasmName("gosh"), wasmName("write_stdout"), []byte{0x00, 0x00},
+		wasmName("gosh"), wasmName("set_prompt"), []byte{0x00, 0x01},
+	)...)
+	module = append(module, wasmSection(3, []byte{0x01, 0x02})...)
+	module = append(module, wasmSection(5, []byte{0x01, 0x00, 0x01})...)
+	module = append(module, wasmSection(7, []byte{0x02},
+		wasmName("memory"), []byte{0x02, 0x00},
+		wasmName("_start"), []byte{0x00, 0x03},
+	)...)
+	start := []byte{0x00,
+		0x41, 0x00, 0x41, 0x00, 0x41, 0xc0, 0x00, 0x10, 0x00, // prompt(0, 64)
+		0x10, 0x01, 0x1a, // write_stdout(0, n)
+		0x41, 0xe4, 0x00, 0x41, 0x04, 0x10, 0x02, // set_prompt(100, 4)
+		0x0b,
+	}
+	module = append(module, wasmSection(10, []byte{0x01, byte(len(start))}, start)...)
+	module = append(module, wasmSection(11, []byte{0x01, 0x00, 0x41, 0xe4, 0x00, 0x0b}, wasmName("new>"))...)
+	return module
+}
+
+func TestWasmPlugin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prompt_command.wasm")
+	if err := ioutil.WriteFile(path, testWasmModule(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	plug, err := openWasmPlugin(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plug.Close(context.TODO())
+
+	cmd, ok := plug.Registry()["prompt"]
+	if !ok {
+		t.Fatalf("command should be named after the file: %v", plug.Registry())
+	}
+	if cmd.ShortDesc() != "prints the prompt" {
+		t.Errorf("unexpected description: %q", cmd.ShortDesc())
+	}
+
+	out := bytes.NewBufferString("")
+	ctx := api.WithStdout(context.TODO(), out)
+	ctx = api.WithPrompt(ctx, "wasm>")
+	ctx, _, err = cmd.Exec(ctx, []string{"prompt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "wasm>" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+	if prompt := api.GetPrompt(ctx); prompt != "new>" {
+		t.Errorf("prompt should be set by the module, got %q", prompt)
+	}
+}
@@ -0,0 +1,112 @@
+package shell
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+// defaultWatchInterval is the interval of watch without -n
+const defaultWatchInterval = 2 * time.Second
+
+// watchCmd reruns a command line on an interval, redrawing its output
+type watchCmd struct {
+	gosh *Goshell
+}
+
+func (c watchCmd) Name() string  { return "watch" }
+func (c watchCmd) Usage() string { return "watch [-n <interval>] <command> [<args>...]" }
+func (c watchCmd) LongDesc() string {
+	return `-n sets the interval between runs, a number of seconds or a Go duration
+such as 500ms, 2 seconds by default. The options of watch come before the
+command: the arguments after it, flags included, are the command's. The
+screen is cleared and the output of the command, errors included, is
+redrawn under a header after each run. A command line with operators is
+quoted, as in watch 'jobs | grep deploy'. Ctrl-C stops the watch and
+returns to the prompt.`
+}
+func (c watchCmd) Flags() []api.Flag {
+	return []api.Flag{
+		{Name: "interval", Short: "n", Kind: api.StringFlag, Default: "2", Usage: "the interval between runs"},
+	}
+}
+func (c watchCmd) ShortDesc() string { return `reruns a command on an interval` }
+func (c watchCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	interval := defaultWatchInterval
+	if flags := api.GetFlags(ctx); flags.IsSet("interval") {
+		d, err := parseTimeout(flags.String("interval"))
+		if err != nil || d <= 0 {
+			return ctx, api.Result{}, api.NewUsageError("invalid interval %q", flags.String("interval"))
+		}
+		interval = d
+	}
+	args = args[1:]
+	if len(args) == 0 {
+		return ctx, api.Result{}, api.NewUsageError("expected a command")
+	}
+	line := commandLine(args)
+	list, err := c.gosh.parseLine(line)
+	if err != nil {
+		return ctx, api.Result{}, err
+	}
+
+	out := api.GetStdout(ctx)
+	clearScreen := ""
+	if f, ok := out.(*os.File); ok && isTerminal(f.Fd()) {
+		clearScreen = "\x1b[H\x1b[2J"
+	}
+	// the flags of watch are not those of the commands it runs
+	runCtx := api.WithFlags(api.WithStdin(ctx, strings.NewReader("")), nil)
+	for {
+		// the output of a run is drawn at once, so that the screen
+		// does not flicker
+		output, _ := api.Capture(runCtx, func(ctx context.Context) error {
+			ctx = api.WithStderr(ctx, api.GetStdout(ctx))
+			if _, err := c.gosh.runApart(ctx, list); err != nil {
+				c.gosh.printErr(ctx, err)
+			}
+			return nil
+		})
+		if ctx.Err() != nil {
+			break
+		}
+		header := fmt.Sprintf("Every %v: %s  %s", interval, line, time.Now().Format(time.Stamp))
+		io.WriteString(out, clearScreen+header+"\n\n"+output)
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	// Ctrl-C only stops the watch
+	return ctx, api.Result{}, nil
+}
+
+// Complete completes the command run by watch
+func (c watchCmd) Complete(ctx context.Context, args []string, cursorPos int) []string {
+	first := 1
+	for first < cursorPos && strings.HasPrefix(args[first], "-") {
+		if args[first] == "--" {
+			first++
+			break
+		}
+		if args[first] == "-n" || args[first] == "--interval" {
+			first++
+		}
+		first++
+	}
+	if cursorPos < first {
+		return nil
+	}
+	return c.gosh.complete(ctx, args[first:cursorPos+1])
+}
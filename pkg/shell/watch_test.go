@@ -0,0 +1,61 @@
+package shell
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+func TestShellWatch(t *testing.T) {
+	shell := New(WithoutPlugins())
+	shell.history = newHistory("", 10)
+	shell.aliases = newAliasTable("")
+	shell.rcFiles = nil
+	var runs int32
+	shell.Register("count", rpcTestCmd{"count", func(ctx context.Context, args []string) error {
+		n := atomic.AddInt32(&runs, 1)
+		fmt.Fprintf(api.GetStdout(ctx), "run %d %s\n", n, strings.Join(args[1:], " "))
+		return fmt.Errorf("failed %d", n)
+	}})
+	if err := shell.Init(context.TODO()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"watch", "watch -n", "watch -n 0 count", "watch --interval soon count", "watch -n 1"} {
+		if _, err := shell.handle(shell.ctx, line); err == nil {
+			t.Errorf("%s should have failed", line)
+		}
+	}
+
+	var out bytes.Buffer
+	ctx, cancel := context.WithCancel(api.WithStdout(shell.ctx, &out))
+	done := make(chan error)
+	go func() {
+		_, err := shell.handle(ctx, "watch -n 0.02 count -n 5")
+		done <- err
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(&runs) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Ctrl-C stops the watch without failing
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("watch failed: %v", err)
+	}
+
+	// the flags after the command are its own
+	draws := strings.Split(out.String(), "Every 20ms: 'count' '-n' '5'  ")
+	if len(draws) < 3 {
+		t.Fatalf("expected the command to be redrawn, got:\n%s", out.String())
+	}
+	if !strings.Contains(draws[2], "run 2 -n 5\nfailed 2\n") {
+		t.Errorf("expected the output and errors of the second run, got:\n%s", draws[2])
+	}
+}
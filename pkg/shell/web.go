@@ -0,0 +1,173 @@
+package shell
+
+import (
+	"context"
+	"crypto/subtle"
+	_ "embed"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+// webPage is the terminal page, which runs xterm.js in the browser
+//
+//go:embed web/index.html
+var webPage []byte
+
+// WebServer serves shell sessions to browsers. The terminal page is
+// served at its root, and connects to the WebSocket endpoint at ws,
+// which runs a shell from NewShell for each connection.
+//
+// Browsers send JSON messages on the socket: {"type": "input", "data":
+// keys} for the keys typed and {"type": "resize", "cols": n, "rows": n}
+// when the terminal changes size. The output of the shell, stdout and
+// stderr alike, is sent back in binary messages.
+type WebServer struct {
+	// NewShell returns the shell of a new session
+	NewShell func() *Goshell
+
+	// Token, when set, must be passed in the token query parameter as
+	// in /?token=secret, which the page forwards to the socket
+	Token string
+
+	sessions sync.WaitGroup
+}
+
+// webMessage is a message sent by the terminal page
+type webMessage struct {
+	Type string `json:"type"`
+	Data string `json:"data"`
+	Cols int    `json:"cols"`
+	Rows int    `json:"rows"`
+}
+
+// ListenAndServe listens on the TCP address addr and serves sessions
+// until ctx is cancelled, then waits for the open sessions to end
+func (s *WebServer) ListenAndServe(ctx context.Context, addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, l)
+}
+
+// Serve accepts connections on l until ctx is cancelled, then waits for
+// the open sessions to end. Sessions are cancelled along with ctx.
+func (s *WebServer) Serve(ctx context.Context, l net.Listener) error {
+	err := serveHTTP(ctx, l, s)
+	s.sessions.Wait()
+	return err
+}
+
+// serveHTTP serves h on l until ctx is cancelled. The requests are
+// cancelled along with ctx.
+func serveHTTP(ctx context.Context, l net.Listener, h http.Handler) error {
+	srv := &http.Server{
+		Handler:     h,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			srv.Close()
+		case <-done:
+		}
+	}()
+
+	err := srv.Serve(l)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// ServeHTTP serves the terminal page and the WebSocket endpoint
+func (s *WebServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/ws"):
+		ws := websocket.Server{Handshake: checkOrigin, Handler: s.serveSocket}
+		ws.ServeHTTP(w, r)
+	case strings.HasSuffix(r.URL.Path, "/"):
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(webPage)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// authorized reports whether r has the token of the server
+func (s *WebServer) authorized(r *http.Request) bool {
+	if s.Token == "" {
+		return true
+	}
+	token := r.URL.Query().Get("token")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1
+}
+
+// checkOrigin refuses the sockets opened by pages of other sites, so
+// that they cannot run commands with the cookies or network access of
+// the user. Clients that are not browsers send no origin.
+func checkOrigin(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host != r.Host {
+		return errors.New("cross-origin socket refused")
+	}
+	return nil
+}
+
+// serveSocket runs a shell session on a socket. The session ends when
+// the shell exits or the socket closes.
+func (s *WebServer) serveSocket(ws *websocket.Conn) {
+	s.sessions.Add(1)
+	defer s.sessions.Done()
+	ws.PayloadType = websocket.BinaryFrame
+	ctx, cancel := context.WithCancel(ws.Request().Context())
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		ws.Close()
+	}()
+
+	sh := s.NewShell()
+	sh.remoteTerm = true
+	sh.env.Set("TERM", "xterm-256color")
+	in, keys := io.Pipe()
+	go func() {
+		defer cancel()
+		defer keys.Close()
+		for {
+			var msg webMessage
+			if err := websocket.JSON.Receive(ws, &msg); err != nil {
+				return
+			}
+			switch msg.Type {
+			case "input":
+				if _, err := io.WriteString(keys, msg.Data); err != nil {
+					return
+				}
+			case "resize":
+				setWindowSize(sh.env, msg.Cols, msg.Rows)
+			}
+		}
+	}()
+
+	out := crlfWriter{ws}
+	runSession(ctx, sh, in, out, out, "")
+	in.Close()
+}
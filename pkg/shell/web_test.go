@@ -0,0 +1,77 @@
+package shell
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestWebServer(t *testing.T) {
+	server := &WebServer{
+		NewShell: func() *Goshell {
+			shell := New(WithoutPlugins())
+			shell.history = newHistory("", 10)
+			shell.aliases = newAliasTable("")
+			shell.rcFiles = nil
+			return shell
+		},
+		Token: "secret",
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() { served <- server.Serve(ctx, l) }()
+	defer func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Error(err)
+		}
+	}()
+	base := "http://" + l.Addr().String()
+
+	resp, err := http.Get(base + "/?token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(page), "xterm") {
+		t.Error("expected the terminal page")
+	}
+	if resp, err := http.Get(base + "/"); err != nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Error("requests without the token should be refused")
+	}
+
+	wsURL := "ws://" + l.Addr().String() + "/ws?token=secret"
+	if _, err := websocket.Dial(wsURL, "", "http://example.com"); err == nil {
+		t.Error("sockets of other origins should be refused")
+	}
+	ws, err := websocket.Dial(wsURL, "", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	websocket.JSON.Send(ws, webMessage{Type: "resize", Cols: 100, Rows: 30})
+	websocket.JSON.Send(ws, webMessage{Type: "input", Data: "echo $COLUMNS\r"})
+	websocket.JSON.Send(ws, webMessage{Type: "input", Data: "exit\r"})
+
+	var out strings.Builder
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			break
+		}
+		out.Write(data)
+	}
+	if !strings.Contains(out.String(), "\r\n100\r\n") {
+		t.Errorf("unexpected terminal output: %q", out.String())
+	}
+}
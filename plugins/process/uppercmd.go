@@ -0,0 +1,51 @@
+// Command upper is an example process plugin. Build it as an executable
+// in the plugins directory:
+//
+//	go build -o plugins/upper_command ./plugins/process
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/vladimirvivien/gosh/api"
+)
+
+type upperCmd string
+
+func (u upperCmd) Name() string      { return string(u) }
+func (u upperCmd) Usage() string     { return `upper [text...]` }
+func (u upperCmd) ShortDesc() string { return `prints its arguments, or its input, in upper case` }
+func (u upperCmd) LongDesc() string  { return u.ShortDesc() }
+func (u upperCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	out := api.GetStdout(ctx)
+	if len(args) > 1 {
+		fmt.Fprintln(out, strings.ToUpper(strings.Join(args[1:], " ")))
+		return ctx, api.Result{}, nil
+	}
+	scanner := bufio.NewScanner(api.GetStdin(ctx))
+	for scanner.Scan() {
+		io.WriteString(out, strings.ToUpper(scanner.Text())+"\n")
+	}
+	return ctx, api.Result{}, scanner.Err()
+}
+
+type upperCmds struct{}
+
+func (u *upperCmds) Init(ctx context.Context) error { return nil }
+
+func (u *upperCmds) Registry() map[string]api.Command {
+	return map[string]api.Command{
+		"upper": upperCmd("upper"),
+	}
+}
+
+func main() {
+	if err := api.Serve(&upperCmds{}); err != nil {
+		log.Fatal(err)
+	}
+}
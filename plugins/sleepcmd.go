@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"github.com/vladimirvivien/gosh/api"
-	"io"
 	"strconv"
 	"time"
 )
@@ -19,25 +18,29 @@ func (s sleepCmd) ShortDesc() string { return "sleeps for <duration> seconds" }
 
 func (s sleepCmd) LongDesc() string { return s.ShortDesc() }
 
-func (s sleepCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+func (s sleepCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
 	if len(args) == 2 {
 		duration, err := strconv.Atoi(args[1])
 		if err != nil {
-			return ctx, err
+			return ctx, api.Result{}, err
 		}
-		time.Sleep(time.Duration(duration) * time.Second)
-		return ctx, nil
+		select {
+		case <-time.After(time.Duration(duration) * time.Second):
+		case <-ctx.Done():
+			return ctx, api.Result{}, ctx.Err()
+		}
+		return ctx, api.Result{}, nil
 	}
-	out := ctx.Value("gosh.stdout").(io.Writer)
+	out := api.GetStdout(ctx)
 	fmt.Fprintln(out, s.Usage())
-	return ctx, nil
+	return ctx, api.Result{}, nil
 
 }
 
 type sleepCmds struct{}
 
 func (s *sleepCmds) Init(ctx context.Context) error {
-	out := ctx.Value("gosh.stdout").(io.Writer)
+	out := api.GetStdout(ctx)
 	fmt.Fprintln(out, "sleep module loaded")
 	return nil
 }
@@ -49,3 +52,4 @@ func (s *sleepCmds) Registry() map[string]api.Command {
 }
 
 var Commands sleepCmds
+var APIVersion = api.APIVersion
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -12,85 +11,6 @@ import (
 	"github.com/vladimirvivien/gosh/api"
 )
 
-// helpCmd represents the `help` command
-// which prints out help information about other commands
-type helpCmd string
-
-func (h helpCmd) Name() string     { return string(h) }
-func (h helpCmd) Usage() string    { return fmt.Sprintf("%s or %s <command-name>", h.Name(), h.Name()) }
-func (h helpCmd) LongDesc() string { return "" }
-func (h helpCmd) ShortDesc() string {
-	return `prints help information for other commands.`
-}
-
-func (h helpCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
-	if ctx == nil {
-		return ctx, errors.New("nil context")
-	}
-
-	out := api.GetStdout(ctx)
-
-	cmdsVal := ctx.Value("gosh.commands")
-	if cmdsVal == nil {
-		return ctx, errors.New("nil context")
-	}
-
-	commands, ok := cmdsVal.(map[string]api.Command)
-	if !ok {
-		return ctx, errors.New("command map type mismatch")
-	}
-
-	var cmdNameParam string
-	if len(args) > 1 {
-		cmdNameParam = args[1]
-	}
-
-	// print help for a specified command
-	if cmdNameParam != "" {
-		cmd, found := commands[cmdNameParam]
-		if !found {
-			str := fmt.Sprintf("command %s not found", cmdNameParam)
-			return ctx, errors.New(str)
-		}
-		fmt.Fprintf(out, "\n%s\n", cmdNameParam)
-		if cmd.Usage() != "" {
-			fmt.Fprintf(out, "  Usage: %s\n", cmd.Usage())
-		}
-		if cmd.ShortDesc() != "" {
-			fmt.Fprintf(out, "  %s\n\n", cmd.ShortDesc())
-		}
-		if cmd.LongDesc() != "" {
-			fmt.Fprintf(out, "%s\n\n", cmd.LongDesc())
-		}
-		return ctx, nil
-	}
-
-	fmt.Fprintf(out, "\n%s: %s\n", h.Name(), h.ShortDesc())
-	fmt.Fprintln(out, "\nAvailable commands")
-	fmt.Fprintln(out, "------------------")
-	for cmdName, cmd := range commands {
-		fmt.Fprintf(out, "%12s:\t%s\n", cmdName, cmd.ShortDesc())
-	}
-	fmt.Fprintln(out, "\nUse \"help <command-name>\" for detail about the specified command\n")
-	return ctx, nil
-}
-
-// exitCmd implements a command to exit the shell
-type exitCmd string
-
-func (c exitCmd) Name() string     { return string(c) }
-func (c exitCmd) Usage() string    { return "exit" }
-func (c exitCmd) LongDesc() string { return "" }
-func (c exitCmd) ShortDesc() string {
-	return `exits the interactive shell immediately`
-}
-func (c exitCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
-	out := api.GetStdout(ctx)
-	fmt.Fprintln(out, "exiting...")
-	os.Exit(0)
-	return ctx, nil
-}
-
 // promptCmd a command that can change the prompt value
 type promptCmd string
 
@@ -100,11 +20,11 @@ func (c promptCmd) LongDesc() string { return "" }
 func (c promptCmd) ShortDesc() string {
 	return `sets a new shell prompt`
 }
-func (c promptCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+func (c promptCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
 	if len(args) < 2 {
-		return ctx, errors.New("unable to set prompt, see usage")
+		return ctx, api.Result{}, api.NewUsageError("missing prompt")
 	}
-	return context.WithValue(ctx, "gosh.prompt", args[1]), nil
+	return api.WithPrompt(ctx, args[1]), api.Result{}, nil
 }
 
 // sysinfoCmd implements a command that returns system information
@@ -116,7 +36,7 @@ func (c sysinfoCmd) LongDesc() string { return "" }
 func (c sysinfoCmd) ShortDesc() string {
 	return `sets a new shell prompt`
 }
-func (c sysinfoCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+func (c sysinfoCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
 	out := api.GetStdout(ctx)
 
 	hostname, _ := os.Hostname()
@@ -142,7 +62,7 @@ func (c sysinfoCmd) Exec(ctx context.Context, args []string) (context.Context, e
 		fmt.Fprintf(out, "\n%12s:\t%s", k.name, k.value)
 	}
 	fmt.Fprintln(out, "\n")
-	return ctx, nil
+	return ctx, api.Result{}, nil
 }
 
 // sysCommands represents a collection of commands supported by this
@@ -157,8 +77,6 @@ func (c *sysCommands) Init(ctx context.Context) error {
 
 func (t *sysCommands) Registry() map[string]api.Command {
 	return map[string]api.Command{
-		"help":   helpCmd("help"),
-		"exit":   exitCmd("exit"),
 		"prompt": promptCmd("prompt"),
 		"sys":    sysinfoCmd("sys"),
 	}
@@ -166,3 +84,6 @@ func (t *sysCommands) Registry() map[string]api.Command {
 
 // plugin entry point
 var Commands sysCommands
+
+// plugin API version the plugin is built against
+var APIVersion = api.APIVersion
@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"fmt"
-	"io"
 
 	"github.com/vladimirvivien/gosh/api"
 )
@@ -14,10 +13,10 @@ func (t helloCmd) Name() string      { return string(t) }
 func (t helloCmd) Usage() string     { return `hello` }
 func (t helloCmd) ShortDesc() string { return `prints greeting "hello there"` }
 func (t helloCmd) LongDesc() string  { return t.ShortDesc() }
-func (t helloCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
-	out := ctx.Value("gosh.stdout").(io.Writer)
+func (t helloCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	out := api.GetStdout(ctx)
 	fmt.Fprintln(out, "hello there")
-	return ctx, nil
+	return ctx, api.Result{}, nil
 }
 
 type goodbyeCmd string
@@ -26,17 +25,17 @@ func (t goodbyeCmd) Name() string      { return string(t) }
 func (t goodbyeCmd) Usage() string     { return t.Name() }
 func (t goodbyeCmd) ShortDesc() string { return `prints message "bye bye"` }
 func (t goodbyeCmd) LongDesc() string  { return t.ShortDesc() }
-func (t goodbyeCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
-	out := ctx.Value("gosh.stdout").(io.Writer)
+func (t goodbyeCmd) Exec(ctx context.Context, args []string) (context.Context, api.Result, error) {
+	out := api.GetStdout(ctx)
 	fmt.Fprintln(out, "bye bye")
-	return ctx, nil
+	return ctx, api.Result{}, nil
 }
 
 // command module
 type testCmds struct{}
 
 func (t *testCmds) Init(ctx context.Context) error {
-	out := ctx.Value("gosh.stdout").(io.Writer)
+	out := api.GetStdout(ctx)
 	fmt.Fprintln(out, "test module loaded OK")
 	return nil
 }
@@ -49,3 +48,4 @@ func (t *testCmds) Registry() map[string]api.Command {
 }
 
 var Commands testCmds
+var APIVersion = api.APIVersion
@@ -0,0 +1,49 @@
+// Command greet is an example WebAssembly plugin. Build it as a WASI
+// module in the plugins directory:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -o plugins/greet_command.wasm ./plugins/wasm
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unsafe"
+)
+
+//go:wasmimport gosh prompt
+func hostPrompt(ptr unsafe.Pointer, size uint32) uint32
+
+//go:wasmimport gosh set_prompt
+func hostSetPrompt(ptr unsafe.Pointer, size uint32)
+
+// prompt returns the current shell prompt
+func prompt() string {
+	buf := make([]byte, 64)
+	n := hostPrompt(unsafe.Pointer(&buf[0]), uint32(len(buf)))
+	if int(n) > len(buf) {
+		buf = make([]byte, n)
+		n = hostPrompt(unsafe.Pointer(&buf[0]), uint32(len(buf)))
+	}
+	return string(buf[:n])
+}
+
+// setPrompt sets the shell prompt
+func setPrompt(p string) {
+	buf := []byte(p)
+	if len(buf) == 0 {
+		return
+	}
+	hostSetPrompt(unsafe.Pointer(&buf[0]), uint32(len(buf)))
+}
+
+func main() {
+	name := "world"
+	if len(os.Args) > 1 {
+		name = strings.Join(os.Args[1:], " ")
+	}
+	fmt.Printf("hello %s, from WebAssembly (prompt %q)\n", name, prompt())
+	if os.Getenv("GREET_PROMPT") != "" {
+		setPrompt(os.Getenv("GREET_PROMPT"))
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/vladimirvivien/gosh/pkg/shell"
+)
+
+// serve runs "gosh serve", which serves sessions of shells configured
+// by opts over SSH, the web or plain TCP, the HTTP API and metrics,
+// until it receives SIGINT or SIGTERM, and returns the exit status of
+// gosh
+func serve(ctx context.Context, opts []shell.Option, args []string) int {
+	configDir := filepath.Dir(shell.DefaultConfigPath())
+	home, _ := os.UserHomeDir()
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	sshAddr := flags.String("ssh", "", "address to serve SSH sessions on, such as :2222")
+	httpAddr := flags.String("http", "", "address to serve a web terminal on, such as :8080")
+	apiAddr := flags.String("api", "", "address to serve the HTTP API running commands on, such as :8081")
+	tcpAddr := flags.String("tcp", "", "address to serve plain TCP sessions on, such as :7000")
+	metricsAddr := flags.String("metrics", "", "address to serve Prometheus metrics on, as in http://<addr>/metrics")
+	password := flags.String("password", os.Getenv("GOSH_PASSWORD"), "password asked for by TCP sessions")
+	lineRate := flags.Float64("line-rate", 10, "lines of input a TCP connection may send per second, 0 for no limit")
+	token := flags.String("token", os.Getenv("GOSH_TOKEN"), "token required by the web terminal, as in /?token=<token>, and by the API")
+	hostKeyPath := flags.String("host-key", filepath.Join(configDir, "ssh_host_ed25519_key"),
+		"private host key, generated when missing")
+	authKeysPath := flags.String("authorized-keys", filepath.Join(home, ".ssh", "authorized_keys"),
+		"public keys allowed to log in")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if (*sshAddr == "" && *httpAddr == "" && *tcpAddr == "" && *apiAddr == "") || flags.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "usage: gosh serve [--ssh <addr>] [--http <addr>] [--tcp <addr>] [--api <addr>] [--metrics <addr>] [flags]")
+		flags.PrintDefaults()
+		return 2
+	}
+
+	// the sessions share the plugins of one shell, which are loaded
+	// before serving and closed once the servers are done
+	sh := shell.New(opts...)
+	if err := sh.Init(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to initialize: %v\n", err)
+		return 1
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := sh.Close(closeCtx); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}()
+	newShell := sh.NewSession
+
+	// each server runs until the signal, or until one of them fails
+	var servers []func(context.Context) error
+	if *sshAddr != "" {
+		hostKey, err := shell.LoadHostKey(*hostKeyPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load host key: %v\n", err)
+			return 1
+		}
+		authKeys, err := shell.LoadAuthorizedKeys(*authKeysPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to load authorized keys: %v\n", err)
+			return 1
+		}
+		server := &shell.SSHServer{NewShell: newShell, HostKey: hostKey, AuthorizedKeys: authKeys}
+		servers = append(servers, func(ctx context.Context) error {
+			fmt.Fprintf(os.Stderr, "serving SSH sessions on %s\n", *sshAddr)
+			return server.ListenAndServe(ctx, *sshAddr)
+		})
+	}
+	if *httpAddr != "" {
+		if *token == "" {
+			fmt.Fprintln(os.Stderr, "warning: the web terminal has no token, anyone who can reach it gets a shell")
+		}
+		server := &shell.WebServer{NewShell: newShell, Token: *token}
+		servers = append(servers, func(ctx context.Context) error {
+			fmt.Fprintf(os.Stderr, "serving the web terminal on %s\n", *httpAddr)
+			return server.ListenAndServe(ctx, *httpAddr)
+		})
+	}
+	if *apiAddr != "" {
+		if *token == "" {
+			fmt.Fprintln(os.Stderr, "warning: the API has no token, anyone who can reach it can run commands")
+		}
+		server := &shell.APIServer{NewShell: newShell, Token: *token}
+		servers = append(servers, func(ctx context.Context) error {
+			fmt.Fprintf(os.Stderr, "serving the API on %s\n", *apiAddr)
+			return server.ListenAndServe(ctx, *apiAddr)
+		})
+	}
+	if *tcpAddr != "" {
+		if *password == "" {
+			fmt.Fprintln(os.Stderr, "warning: the TCP console has no password, anyone who can reach it gets a shell")
+		}
+		server := &shell.TCPServer{NewShell: newShell, Password: *password, LineRate: *lineRate, LineBurst: 20}
+		servers = append(servers, func(ctx context.Context) error {
+			fmt.Fprintf(os.Stderr, "serving TCP sessions on %s\n", *tcpAddr)
+			return server.ListenAndServe(ctx, *tcpAddr)
+		})
+	}
+	if *metricsAddr != "" {
+		server := &shell.MetricsServer{Shell: sh}
+		servers = append(servers, func(ctx context.Context) error {
+			fmt.Fprintf(os.Stderr, "serving metrics on %s\n", *metricsAddr)
+			return server.ListenAndServe(ctx, *metricsAddr)
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, len(servers))
+	for _, run := range servers {
+		go func(run func(context.Context) error) {
+			err := run(ctx)
+			cancel()
+			errs <- err
+		}(run)
+	}
+	status := 0
+	for range servers {
+		if err := <-errs; err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+		}
+	}
+	return status
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/vladimirvivien/gosh/pkg/shell"
+)
+
+// scriptExt is the extension of the scripts "gosh test" finds in the
+// directories it is given
+const scriptExt = ".gosh"
+
+// testTranscripts runs "gosh test", which runs scripts and compares
+// their transcripts with their golden transcripts, and returns the exit
+// status of gosh: 1 when a transcript differs
+func testTranscripts(ctx context.Context, opts []shell.Option, args []string) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	update := flags.Bool("update", false, "write the golden transcripts instead of comparing them")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: gosh test [--update] <script or directory> ...")
+		flags.PrintDefaults()
+		return 2
+	}
+
+	var scripts []string
+	for _, arg := range flags.Args() {
+		info, err := os.Stat(arg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if !info.IsDir() {
+			scripts = append(scripts, arg)
+			continue
+		}
+		matches, _ := filepath.Glob(filepath.Join(arg, "*"+scriptExt))
+		scripts = append(scripts, matches...)
+	}
+
+	sh := shell.New(opts...)
+	if err := sh.Init(ctx); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to initialize:", err)
+		return 1
+	}
+	defer sh.Close(context.Background())
+
+	status := 0
+	for _, script := range scripts {
+		diff, err := sh.CheckTranscript(ctx, script, *update)
+		switch {
+		case err != nil:
+			fmt.Printf("FAIL %s: %v\n", script, err)
+			status = 1
+		case diff != "":
+			fmt.Printf("FAIL %s\n%s", script, diff)
+			status = 1
+		case *update:
+			fmt.Printf("updated %s\n", script)
+		default:
+			fmt.Printf("ok   %s\n", script)
+		}
+	}
+	return status
+}